@@ -0,0 +1,60 @@
+package cmd
+
+import "sync"
+
+// runPool runs fn for every input using at most jobs concurrent workers.
+// Results are passed to report in input order, each as soon as it and all
+// results before it are available, so output stays deterministic.
+func runPool[I, T any](inputs []I, jobs int, fn func(I) T, report func(T)) []T {
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(inputs) {
+		jobs = len(inputs)
+	}
+
+	type indexed struct {
+		index  int
+		result T
+	}
+
+	work := make(chan int)
+	done := make(chan indexed)
+
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				done <- indexed{index: i, result: fn(inputs[i])}
+			}
+		}()
+	}
+
+	go func() {
+		for i := range inputs {
+			work <- i
+		}
+		close(work)
+		wg.Wait()
+		close(done)
+	}()
+
+	// Collect results, reporting the completed prefix in input order
+	results := make([]T, len(inputs))
+	ready := make([]bool, len(inputs))
+	next := 0
+	for r := range done {
+		results[r.index] = r.result
+		ready[r.index] = true
+		for next < len(inputs) && ready[next] {
+			if report != nil {
+				report(results[next])
+			}
+			next++
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunPoolPreservesOrder(t *testing.T) {
+	inputs := make([]string, 50)
+	for i := range inputs {
+		inputs[i] = strconv.Itoa(i)
+	}
+
+	var reported []string
+	results := runPool(inputs, 8, func(s string) string {
+		// Finish later inputs first to exercise reordering
+		n, _ := strconv.Atoi(s)
+		time.Sleep(time.Duration(len(inputs)-n) * 100 * time.Microsecond)
+		return "out-" + s
+	}, func(r string) {
+		reported = append(reported, r)
+	})
+
+	if len(results) != len(inputs) || len(reported) != len(inputs) {
+		t.Fatalf("expected %d results, got %d results and %d reports", len(inputs), len(results), len(reported))
+	}
+	for i, in := range inputs {
+		want := "out-" + in
+		if results[i] != want {
+			t.Errorf("results[%d] = %q, expected %q", i, results[i], want)
+		}
+		if reported[i] != want {
+			t.Errorf("reported[%d] = %q, expected %q", i, reported[i], want)
+		}
+	}
+}
+
+func TestRunPoolBoundsConcurrency(t *testing.T) {
+	inputs := make([]string, 20)
+	var running, maxRunning int32
+
+	runPool(inputs, 3, func(string) int {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return 0
+	}, nil)
+
+	if maxRunning > 3 {
+		t.Errorf("expected at most 3 concurrent workers, got %d", maxRunning)
+	}
+}
+
+func TestRunPoolEmpty(t *testing.T) {
+	results := runPool(nil, 4, func(s string) string { return s }, nil)
+	if len(results) != 0 {
+		t.Errorf("expected no results, got %d", len(results))
+	}
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	imglib "github.com/cwygoda/ansel/internal/image"
+)
+
+// maxShrinkSteps is how often an output that doesn't fit its byte budget at
+// the lowest quality is made smaller before giving up.
+const maxShrinkSteps = 6
+
+// parseMaxBytes parses --max-bytes. An empty value keeps the limits of the
+// size presets and "none" removes them; ok is false for an empty value.
+func parseMaxBytes(s string) (n int64, ok bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "":
+		return 0, false, nil
+	case "none", "0":
+		return 0, true, nil
+	}
+	n, err = parseByteSize(s)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid max bytes: %w", err)
+	}
+	return n, true, nil
+}
+
+// setMaxBytes sets the byte budget of size and its variants.
+func setMaxBytes(size *outputSize, n int64) {
+	size.maxBytes = n
+	for i := range size.variants {
+		setMaxBytes(&size.variants[i], n)
+	}
+}
+
+// saveOutput writes img to out.path with the metadata and resolution of the
+// output. Outputs with a byte budget are encoded at the highest quality that
+// fits; if none does, img is made smaller until it fits. Print outputs,
+// which have a resolution or a bleed, are never made smaller, as that would
+// change their physical size. The dimensions and the chosen quality are
+// recorded in out.
+func saveOutput(img *imglib.VipsImage, size outputSize, format imglib.Format, out *outputResult, opts *processOptions) error {
+	out.maxBytes = size.maxBytes
+	for step := 0; ; step++ {
+		data, encode, err := encodeOutput(img, size, format, opts)
+		if errors.Is(err, imglib.ErrOverBudget) && (size.dpi > 0 || size.bleedPx > 0) {
+			return fmt.Errorf("%s doesn't fit in %s at the lowest quality, and print sizes aren't scaled down", format, formatByteSize(size.maxBytes))
+		}
+		if errors.Is(err, imglib.ErrOverBudget) && step < maxShrinkSteps {
+			// The file size grows roughly with the pixel count
+			scale := max(0.5, min(0.9, 0.95*math.Sqrt(float64(size.maxBytes)/float64(len(data)))))
+			width, height := int(float64(img.Width())*scale), int(float64(img.Height())*scale)
+			if width < 1 || height < 1 {
+				return fmt.Errorf("%s doesn't fit in %s", format, formatByteSize(size.maxBytes))
+			}
+			if err := img.ResizeToFitColorspace(width, height, opts.filter, opts.colorspace); err != nil {
+				return err
+			}
+			out.downscaled = true
+			continue
+		}
+		if errors.Is(err, imglib.ErrOverBudget) {
+			return fmt.Errorf("%s doesn't fit in %s even at %dx%d", format, formatByteSize(size.maxBytes), img.Width(), img.Height())
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(out.path, data, 0644); err != nil {
+			return fmt.Errorf("failed to save: %w", err)
+		}
+		sum := sha256.Sum256(data)
+		out.outWidth, out.outHeight = img.Width(), img.Height()
+		out.bytes, out.hash = int64(len(data)), hex.EncodeToString(sum[:])
+		if encode.JPEGSubsample != opts.encode.JPEGSubsample {
+			out.subsample = encode.JPEGSubsample
+		}
+		if encode.Quality != opts.encode.Quality || out.subsample != imglib.SubsampleAuto ||
+			(out.downscaled && imglib.HasQuality(format, encode)) {
+			out.quality = encode.Quality
+		}
+		return nil
+	}
+}
+
+// encodeOutput encodes a copy of img with the metadata selected by the
+// policy and the output's resolution, within its byte budget if it has one.
+func encodeOutput(img *imglib.VipsImage, size outputSize, format imglib.Format, opts *processOptions) ([]byte, imglib.EncodeOptions, error) {
+	// The metadata policy prunes the copy, so img can be shrunk and encoded again
+	out, err := img.Copy()
+	if err != nil {
+		return nil, opts.encode, err
+	}
+	defer out.Close()
+
+	if err := out.ApplyMetadataPolicy(opts.metadata, format); err != nil {
+		return nil, opts.encode, fmt.Errorf("failed to apply metadata policy: %w", err)
+	}
+	if size.dpi > 0 {
+		if err := out.SetResolution(size.dpi); err != nil {
+			return nil, opts.encode, err
+		}
+	}
+	return out.EncodeWithin(format, opts.encode, size.maxBytes)
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestParseMaxBytes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		ok       bool
+	}{
+		{"", 0, false},
+		{"none", 0, true},
+		{"0", 0, true},
+		{"1MB", 1_000_000, true},
+		{"500KiB", 512_000, true},
+	}
+	for _, tc := range tests {
+		n, ok, err := parseMaxBytes(tc.input)
+		if err != nil {
+			t.Fatalf("parseMaxBytes(%q) failed: %v", tc.input, err)
+		}
+		if n != tc.expected || ok != tc.ok {
+			t.Errorf("parseMaxBytes(%q) = %d, %v; expected %d, %v", tc.input, n, ok, tc.expected, tc.ok)
+		}
+	}
+
+	for _, input := range []string{"big", "-1MB", "1TB"} {
+		if _, _, err := parseMaxBytes(input); err == nil {
+			t.Errorf("parseMaxBytes(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestSetMaxBytes(t *testing.T) {
+	sizes, err := parseSizes([]string{"ig-auto", "x-post", "800x600"})
+	if err != nil {
+		t.Fatalf("parseSizes failed: %v", err)
+	}
+
+	// Presets bring their platform's limit
+	if sizes[1].maxBytes != 5_000_000 || sizes[2].maxBytes != 0 {
+		t.Errorf("preset limits = %d, %d; expected 5000000, 0", sizes[1].maxBytes, sizes[2].maxBytes)
+	}
+
+	for i := range sizes {
+		setMaxBytes(&sizes[i], 1_000_000)
+	}
+	if sizes[1].maxBytes != 1_000_000 || sizes[2].maxBytes != 1_000_000 {
+		t.Errorf("limits = %d, %d; expected 1000000", sizes[1].maxBytes, sizes[2].maxBytes)
+	}
+	for _, v := range sizes[0].variants {
+		if v.maxBytes != 1_000_000 {
+			t.Errorf("variant %s limit = %d, expected 1000000", v.name, v.maxBytes)
+		}
+	}
+}
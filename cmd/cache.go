@@ -0,0 +1,390 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	imglib "github.com/cwygoda/ansel/internal/image"
+	"github.com/spf13/pflag"
+)
+
+// cachePath is the cache of the process command, relative to the current
+// directory like the project configuration.
+var cachePath = filepath.Join(".ansel", "cache.json")
+
+// cacheFormat is the version of the cache file layout. Caches of another
+// version are ignored.
+const cacheFormat = 1
+
+// cacheIgnoredFlags are process flags that don't change the outputs. Sizes
+// are part of each output's key instead, so that adding a size doesn't
+// invalidate the others.
+var cacheIgnoredFlags = map[string]bool{
+	"recipe":        true,
+	"size":          true,
+	"dry-run":       true,
+	"jobs":          true,
+	"overwrite":     true,
+	"skip-existing": true,
+	"cache":         true,
+	"prune":         true,
+	"report":        true,
+	"report-file":   true,
+}
+
+// processCache records the outputs of earlier runs by a key derived from
+// the contents of the input and its sidecars, the processing parameters and
+// the ansel version, so that unchanged outputs are not rendered again. It is
+// safe for concurrent use.
+type processCache struct {
+	path     string
+	params   string // normalised processing parameters; see cacheParams
+	mu       sync.Mutex
+	entries  map[string]cacheEntry
+	rendered map[string]bool // inputs rendered in this run, or planned on a dry run
+}
+
+// cacheFile is the JSON layout of the cache.
+type cacheFile struct {
+	Format  int                   `json:"format"`
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+// cacheEntry is an output recorded in the cache. Paths are absolute.
+type cacheEntry struct {
+	Input     string    `json:"input"`
+	InputHash string    `json:"inputHash"`
+	Sidecars  string    `json:"sidecars,omitempty"` // see sidecarHash
+	Output    string    `json:"output"`
+	Hash      string    `json:"hash,omitempty"` // hex SHA-256 of the output
+	Bytes     int64     `json:"bytes"`
+	ModTime   time.Time `json:"modTime"`
+	SrcWidth  int       `json:"srcWidth"`
+	SrcHeight int       `json:"srcHeight"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	Variant   string    `json:"variant,omitempty"`
+}
+
+// loadProcessCache reads the cache at path. A missing cache, or one of
+// another format, is empty.
+func loadProcessCache(path, params string) (*processCache, error) {
+	c := &processCache{path: path, params: params, entries: make(map[string]cacheEntry), rendered: make(map[string]bool)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if file.Format == cacheFormat && file.Entries != nil {
+		c.entries = file.Entries
+	}
+	return c, nil
+}
+
+// save writes the cache, replacing the file atomically.
+func (c *processCache) save() error {
+	c.mu.Lock()
+	data, err := json.MarshalIndent(cacheFile{Format: cacheFormat, Entries: c.entries}, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// key returns the cache key of an output at size and format of the input
+// at the absolute path input, whose contents and sidecars have the given
+// hashes.
+func (c *processCache) key(input, inputHash, sidecars string, size outputSize, format imglib.Format) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "ansel %s\ninput %s %s\nsidecars %s\nformat %s\nsize %+v\n%s", version, input, inputHash, sidecars, format, size, c.params)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// sidecarHash returns the hex SHA-256 of the metadata sidecars of an input
+// that exist, which labels and watermark text are read from, or "" if there
+// are none.
+func sidecarHash(inputPath string) (string, error) {
+	h := sha256.New()
+	found := false
+	for _, path := range imglib.SidecarPaths(inputPath) {
+		hash, err := hashFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %s\n", filepath.Base(path), hash)
+		found = true
+	}
+	if !found {
+		return "", nil
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// lookup returns the entry of key if its output still exists as written.
+func (c *processCache) lookup(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok {
+		return e, false
+	}
+	info, err := os.Stat(e.Output)
+	if err != nil || info.Size() != e.Bytes || !info.ModTime().Equal(e.ModTime) {
+		return e, false
+	}
+	return e, true
+}
+
+// store records the output written for key.
+func (c *processCache) store(key string, e cacheEntry) error {
+	info, err := os.Stat(e.Output)
+	if err != nil {
+		return err
+	}
+	e.Bytes, e.ModTime = info.Size(), info.ModTime()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = e
+	c.rendered[e.Input] = true
+	return nil
+}
+
+// prune removes the entries of inputs that were deleted since their outputs
+// were written, and of inputs or sidecars that changed and whose outputs
+// were written again in this run. Their outputs are deleted unless another
+// entry still refers to them or the file was replaced since. It returns the
+// deleted outputs. With dryRun, it only reports them.
+func (c *processCache) prune(dryRun bool) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type state struct{ hash, sidecars string } // "" hash if gone
+	inputs := make(map[string]state)
+	stale := make(map[string]bool)
+	for key, e := range c.entries {
+		s, ok := inputs[e.Input]
+		if !ok {
+			var err error
+			if s.hash, err = hashFile(e.Input); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			if s.hash != "" {
+				if s.sidecars, err = sidecarHash(e.Input); err != nil {
+					return nil, err
+				}
+			}
+			inputs[e.Input] = s
+		}
+		changed := s.hash != e.InputHash || s.sidecars != e.Sidecars
+		if s.hash == "" || (changed && c.rendered[e.Input]) {
+			stale[key] = true
+		}
+	}
+
+	live := make(map[string]bool)
+	for key, e := range c.entries {
+		if !stale[key] {
+			live[e.Output] = true
+		}
+	}
+	var removed []string
+	for key := range stale {
+		e := c.entries[key]
+		if !dryRun {
+			delete(c.entries, key)
+		}
+		if live[e.Output] {
+			continue
+		}
+		info, err := os.Stat(e.Output)
+		if err != nil || info.Size() != e.Bytes || !info.ModTime().Equal(e.ModTime) {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(e.Output); err != nil {
+				return removed, fmt.Errorf("failed to prune: %w", err)
+			}
+		}
+		live[e.Output] = true // listed once
+		removed = append(removed, e.Output)
+	}
+	sort.Strings(removed)
+	return removed, nil
+}
+
+// cacheParams returns the processing parameters as "flag=value" lines in
+// name order, with the values after applying the recipe and defaults, so
+// that the same settings give the same keys however they were given. Files
+// the outputs are made from, like watermarks, are keyed by their contents,
+// and the frame style by its definition.
+func cacheParams(flags *pflag.FlagSet, opts *processOptions) (string, error) {
+	var b strings.Builder
+	flags.VisitAll(func(f *pflag.Flag) {
+		if !cacheIgnoredFlags[f.Name] {
+			fmt.Fprintf(&b, "%s=%s\n", f.Name, f.Value.String())
+		}
+	})
+	style, err := json.Marshal(opts.frameStyle)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(&b, "frame-style %s\n", style)
+
+	files := []string{opts.background.Path, opts.labelFontFile, opts.profile.Path()}
+	if opts.watermark != nil {
+		files = append(files, opts.watermark.Path)
+	}
+	for _, path := range files {
+		if path == "" {
+			continue
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "file %s %s\n", path, hash)
+	}
+	return b.String(), nil
+}
+
+// inputCache is the cache state of one input. A nil inputCache caches
+// nothing.
+type inputCache struct {
+	cache    *processCache
+	input    string // absolute path
+	hash     string
+	sidecars string   // see sidecarHash
+	keys     []string // per output size
+}
+
+// forInput returns the cache state of inputPath, whose contents have the
+// given hash ("" to hash it here). It returns nil if c is nil.
+func (c *processCache) forInput(inputPath, hash string, format imglib.Format, sizes []outputSize) (*inputCache, error) {
+	if c == nil {
+		return nil, nil
+	}
+	input, err := filepath.Abs(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	if hash == "" {
+		if hash, err = hashFile(inputPath); err != nil {
+			return nil, err
+		}
+	}
+	sidecars, err := sidecarHash(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	ic := &inputCache{cache: c, input: input, hash: hash, sidecars: sidecars}
+	for _, size := range sizes {
+		ic.keys = append(ic.keys, c.key(input, hash, sidecars, size, format))
+	}
+	return ic, nil
+}
+
+// outputs returns the outputs whose cache entries are up to date, by index
+// in sizes, with the dimensions of their source.
+func (ic *inputCache) outputs(sizes []outputSize) (cached map[int]outputResult, srcWidth, srcHeight int) {
+	if ic == nil {
+		return nil, 0, 0
+	}
+	cached = make(map[int]outputResult)
+	for i, size := range sizes {
+		e, ok := ic.cache.lookup(ic.keys[i])
+		if !ok {
+			continue
+		}
+		size, _ := size.resolve(e.SrcWidth, e.SrcHeight)
+		cached[i] = outputResult{
+			size:      size.name,
+			variant:   e.Variant,
+			path:      relativePath(e.Output),
+			outWidth:  e.Width,
+			outHeight: e.Height,
+			dpi:       size.dpi,
+			framePx:   size.frameWidthPx,
+			bytes:     e.Bytes,
+			hash:      e.Hash,
+			cached:    true,
+		}
+		srcWidth, srcHeight = e.SrcWidth, e.SrcHeight
+	}
+	return cached, srcWidth, srcHeight
+}
+
+// store records out as the output of the i-th size.
+func (ic *inputCache) store(i int, out outputResult, srcWidth, srcHeight int) error {
+	if ic == nil {
+		return nil
+	}
+	output, err := filepath.Abs(out.path)
+	if err != nil {
+		return err
+	}
+	return ic.cache.store(ic.keys[i], cacheEntry{
+		Input:     ic.input,
+		InputHash: ic.hash,
+		Sidecars:  ic.sidecars,
+		Output:    output,
+		Hash:      out.hash,
+		SrcWidth:  srcWidth,
+		SrcHeight: srcHeight,
+		Width:     out.outWidth,
+		Height:    out.outHeight,
+		Variant:   out.variant,
+	})
+}
+
+// planned records that an output of the input would be rendered, so that a
+// dry run lists the outputs prune would delete.
+func (ic *inputCache) planned() {
+	if ic == nil {
+		return
+	}
+	ic.cache.mu.Lock()
+	defer ic.cache.mu.Unlock()
+	ic.cache.rendered[ic.input] = true
+}
+
+// relativePath returns path relative to the current directory if it is
+// inside it, as output paths are given on the command line.
+func relativePath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cwygoda/ansel/internal/config"
+	imglib "github.com/cwygoda/ansel/internal/image"
+	"github.com/spf13/pflag"
+)
+
+func TestProcessCache(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "photo.jpg")
+	output := filepath.Join(dir, "photo_v0.jpg")
+	if err := os.WriteFile(input, []byte("source"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, ".ansel", "cache.json")
+	size := outputSize{name: "ig-post", width: 1080, height: 1080}
+
+	c, err := loadProcessCache(path, "fit=cover\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ic, err := c.forInput(input, "", imglib.JPEG, []outputSize{size})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached, _, _ := ic.outputs([]outputSize{size}); len(cached) != 0 {
+		t.Fatalf("empty cache has outputs %v", cached)
+	}
+
+	// A stored output is found again after saving and loading the cache
+	if err := os.WriteFile(output, []byte("output"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ic.store(0, outputResult{path: output, outWidth: 1080, outHeight: 1080}, 6000, 4000); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+	c, err = loadProcessCache(path, "fit=cover\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ic, _ = c.forInput(input, "", imglib.JPEG, []outputSize{size})
+	cached, srcWidth, srcHeight := ic.outputs([]outputSize{size})
+	if out, ok := cached[0]; !ok || !out.cached || out.outWidth != 1080 || srcWidth != 6000 || srcHeight != 4000 {
+		t.Errorf("outputs = %v, %d, %d, expected the stored output of a 6000x4000 source", cached, srcWidth, srcHeight)
+	}
+
+	// Other settings, sizes or formats miss
+	other, _ := loadProcessCache(path, "fit=expand\n")
+	misses := map[string]*inputCache{}
+	misses["params"], _ = other.forInput(input, "", imglib.JPEG, []outputSize{size})
+	misses["format"], _ = c.forInput(input, "", imglib.WebP, []outputSize{size})
+	misses["size"], _ = c.forInput(input, "", imglib.JPEG, []outputSize{{name: "ig-story", width: 1080, height: 1920}})
+	for name, ic := range misses {
+		if cached, _, _ := ic.outputs([]outputSize{size}); len(cached) != 0 {
+			t.Errorf("%s: expected a cache miss, got %v", name, cached)
+		}
+	}
+
+	// So does an input with a new sidecar, as labels are read from it
+	sidecar := filepath.Join(dir, "photo.xmp")
+	if err := os.WriteFile(sidecar, []byte("<x:xmpmeta/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	captioned, _ := c.forInput(input, "", imglib.JPEG, []outputSize{size})
+	if cached, _, _ := captioned.outputs([]outputSize{size}); len(cached) != 0 {
+		t.Errorf("sidecar: expected a cache miss, got %v", cached)
+	}
+	if err := os.Remove(sidecar); err != nil {
+		t.Fatal(err)
+	}
+
+	// A modified output is rendered again
+	if err := os.WriteFile(output, []byte("edited output"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cached, _, _ := ic.outputs([]outputSize{size}); len(cached) != 0 {
+		t.Errorf("modified output: expected a cache miss, got %v", cached)
+	}
+}
+
+func TestProcessCachePrune(t *testing.T) {
+	dir := t.TempDir()
+	c, err := loadProcessCache(filepath.Join(dir, "cache.json"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := outputSize{name: "ig-post", width: 1080, height: 1080}
+	store := func(input, output string) {
+		t.Helper()
+		if err := os.WriteFile(output, []byte(output), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ic, err := c.forInput(input, "", imglib.JPEG, []outputSize{size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ic.store(0, outputResult{path: output}, 100, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// After their outputs were written, kept is unchanged, changed is edited,
+	// captioned gets a sidecar, removed and replaced are deleted, and
+	// replaced's output is overwritten by another tool
+	names := []string{"kept", "changed", "captioned", "removed", "replaced"}
+	outputs := make(map[string]string)
+	for _, name := range names {
+		input := filepath.Join(dir, name+".jpg")
+		outputs[name] = filepath.Join(dir, name+"_v0.jpg")
+		if err := os.WriteFile(input, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		store(input, outputs[name])
+	}
+	c.rendered = make(map[string]bool) // a new run
+
+	for path, data := range map[string]string{
+		"changed.jpg":       "edited",
+		"captioned.jpg.xmp": "<x:xmpmeta/>",
+		"replaced_v0.jpg":   "another image",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"removed", "replaced"} {
+		if err := os.Remove(filepath.Join(dir, name+".jpg")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// captioned is rendered again in this run; changed isn't, so its output
+	// is all there is of it
+	store(filepath.Join(dir, "captioned.jpg"), filepath.Join(dir, "captioned_v1.jpg"))
+
+	removed, err := c.prune(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 || len(c.entries) != 6 {
+		t.Errorf("dry run pruned %v with %d entries left, expected 2 outputs and 6 entries", removed, len(c.entries))
+	}
+
+	removed, err = c.prune(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{outputs["captioned"], outputs["removed"]}
+	if len(removed) != 2 || removed[0] != expected[0] || removed[1] != expected[1] {
+		t.Errorf("prune removed %v, expected %v", removed, expected)
+	}
+	for name, output := range outputs {
+		_, err := os.Stat(output)
+		if exists := err == nil; exists != (name != "captioned" && name != "removed") {
+			t.Errorf("%s: output exists = %v after pruning", name, exists)
+		}
+	}
+	if len(c.entries) != 3 {
+		t.Errorf("prune left %d entries, expected kept, changed and the new captioned", len(c.entries))
+	}
+}
+
+func TestCacheParams(t *testing.T) {
+	// The same settings give the same parameters, whether given as flags,
+	// by a recipe or left at their defaults
+	params := func(args []string, recipe config.Recipe) string {
+		flags := pflag.NewFlagSet("process", pflag.ContinueOnError)
+		flags.String("recipe", "", "")
+		flags.String("fit", "expand", "")
+		flags.Int("quality", 92, "")
+		flags.Int("jobs", 4, "")
+		if err := flags.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		if recipe != nil {
+			if _, err := applyRecipe(flags, "r", map[string]config.Recipe{"r": recipe}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		p, err := cacheParams(flags, &processOptions{frameStyle: imglib.FlatFrameStyle})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	base := params([]string{"--fit", "cover"}, nil)
+	for name, p := range map[string]string{
+		"recipe":   params([]string{"--recipe", "r"}, config.Recipe{"fit": "cover"}),
+		"default":  params([]string{"--fit", "cover", "--quality", "92"}, nil),
+		"operator": params([]string{"--fit", "cover", "--jobs", "1"}, nil),
+	} {
+		if p != base {
+			t.Errorf("%s: params %q, expected %q", name, p, base)
+		}
+	}
+	if p := params([]string{"--fit", "cover", "--quality", "80"}, nil); p == base {
+		t.Errorf("quality 80: params unchanged")
+	}
+}
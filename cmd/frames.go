@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strings"
+
+	"github.com/cwygoda/ansel/internal/config"
+	imglib "github.com/cwygoda/ansel/internal/image"
+)
+
+// keylineColor is the colour of the thin lines in the built-in styles.
+var keylineColor = color.RGBA{R: 0x1a, G: 0x1a, B: 0x1a, A: 0xff}
+
+// frameStyles are the built-in frame styles. Layers without a colour use --color.
+var frameStyles = map[string]imglib.FrameStyle{
+	"flat": imglib.FlatFrameStyle,
+	// Thin dark line around the image inside the mat
+	"keyline": {
+		Layers: []imglib.FrameLayer{{Width: 0.08, Color: keylineColor}, {Width: 0.92}},
+		Sides:  [4]float64{1, 1, 1, 1},
+	},
+	// Two lines, the outer one at the edge of the image area
+	"double": {
+		Layers: []imglib.FrameLayer{{Width: 0.06, Color: keylineColor}, {Width: 0.12}, {Width: 0.06, Color: keylineColor}, {Width: 0.76}},
+		Sides:  [4]float64{1, 1, 1, 1},
+	},
+	// Keyline and mat with a deeper bottom margin for a caption
+	"gallery": {
+		Layers: []imglib.FrameLayer{{Width: 0.05, Color: keylineColor}, {Width: 0.95}},
+		Sides:  [4]float64{1, 1, 1.4, 1},
+	},
+	"polaroid": {
+		Layers: []imglib.FrameLayer{{Width: 1}},
+		Sides:  [4]float64{1, 1, 3, 1},
+	},
+	// Image floating above the mat
+	"shadow": {
+		Layers: []imglib.FrameLayer{{Width: 1}},
+		Sides:  [4]float64{1, 1, 1, 1},
+		Shadow: &imglib.FrameShadow{Blur: 0.12, OffsetX: 0.04, OffsetY: 0.08, Opacity: 0.45, Color: color.Black},
+	},
+}
+
+// loadFrameStyles returns the built-in frame styles with the user and
+// project styles added. Project styles override user styles, which
+// override built-in styles. Colours are converted from sRGB to profile.
+func loadFrameStyles(user, project map[string]config.FrameStyle, profile imglib.OutputProfile, intent imglib.RenderingIntent) (map[string]imglib.FrameStyle, error) {
+	styles := make(map[string]imglib.FrameStyle, len(frameStyles)+len(user)+len(project))
+	for name, style := range frameStyles {
+		styles[name] = style
+	}
+	for _, layer := range []map[string]config.FrameStyle{user, project} {
+		for name, cfg := range layer {
+			style, err := newFrameStyle(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("frame style %q: %w", name, err)
+			}
+			styles[strings.ToLower(name)] = style
+		}
+	}
+	for name, style := range styles {
+		style, err := convertFrameStyle(style, profile, intent)
+		if err != nil {
+			return nil, fmt.Errorf("frame style %q: %w", name, err)
+		}
+		styles[name] = style
+	}
+	return styles, nil
+}
+
+// convertFrameStyle returns a copy of style with its colours converted from
+// sRGB to profile. Layers without a colour keep using the frame colour.
+func convertFrameStyle(style imglib.FrameStyle, profile imglib.OutputProfile, intent imglib.RenderingIntent) (imglib.FrameStyle, error) {
+	if profile == imglib.ProfileSRGB {
+		return style, nil
+	}
+	layers := make([]imglib.FrameLayer, len(style.Layers))
+	for i, layer := range style.Layers {
+		if layer.Color != nil {
+			c, err := imglib.ConvertColor(layer.Color, profile, intent)
+			if err != nil {
+				return style, err
+			}
+			layer.Color = c
+		}
+		layers[i] = layer
+	}
+	style.Layers = layers
+	if style.Shadow != nil {
+		shadow := *style.Shadow
+		c, err := imglib.ConvertColor(shadow.Color, profile, intent)
+		if err != nil {
+			return style, err
+		}
+		shadow.Color = c
+		style.Shadow = &shadow
+	}
+	return style, nil
+}
+
+// newFrameStyle converts and validates a configured frame style.
+func newFrameStyle(cfg config.FrameStyle) (imglib.FrameStyle, error) {
+	style := imglib.FrameStyle{
+		Sides:  [4]float64{1, 1, 1, 1},
+		Radius: cfg.Radius,
+	}
+
+	for _, l := range cfg.Layers {
+		layer := imglib.FrameLayer{Width: l.Width}
+		if l.Color != "" {
+			c, err := imglib.ParseColor(l.Color)
+			if err != nil {
+				return style, err
+			}
+			layer.Color = c
+		}
+		style.Layers = append(style.Layers, layer)
+	}
+
+	switch len(cfg.Sides) {
+	case 0:
+	case 4:
+		copy(style.Sides[:], cfg.Sides)
+	default:
+		return style, fmt.Errorf("sides must have 4 values (top, right, bottom, left), got %d", len(cfg.Sides))
+	}
+
+	if s := cfg.Shadow; s != nil {
+		shadow := &imglib.FrameShadow{Blur: s.Blur, Opacity: s.Opacity, Color: color.Black}
+		if shadow.Opacity == 0 {
+			shadow.Opacity = 0.5
+		}
+		switch len(s.Offset) {
+		case 0:
+		case 2:
+			shadow.OffsetX, shadow.OffsetY = s.Offset[0], s.Offset[1]
+		default:
+			return style, fmt.Errorf("shadow offset must have 2 values (x, y), got %d", len(s.Offset))
+		}
+		if s.Color != "" {
+			c, err := imglib.ParseColor(s.Color)
+			if err != nil {
+				return style, err
+			}
+			shadow.Color = c
+		}
+		style.Shadow = shadow
+	}
+
+	return style, style.Validate()
+}
+
+// lookupFrameStyle returns the named frame style.
+func lookupFrameStyle(name string, styles map[string]imglib.FrameStyle) (imglib.FrameStyle, error) {
+	style, ok := styles[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(styles))
+		for n := range styles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return style, fmt.Errorf("unknown frame style %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	return style, nil
+}
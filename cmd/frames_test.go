@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/cwygoda/ansel/internal/config"
+	imglib "github.com/cwygoda/ansel/internal/image"
+)
+
+func TestBuiltinFrameStyles(t *testing.T) {
+	for name, style := range frameStyles {
+		if err := style.Validate(); err != nil {
+			t.Errorf("frame style %q is invalid: %v", name, err)
+		}
+	}
+}
+
+func TestNewFrameStyle(t *testing.T) {
+	style, err := newFrameStyle(config.FrameStyle{
+		Layers: []config.FrameLayer{{Width: 1, Color: "#222"}, {Width: 9}},
+		Sides:  []float64{1, 1, 1.5, 1},
+		Radius: 0.2,
+		Shadow: &config.FrameShadow{Blur: 0.1, Offset: []float64{0.05, 0.1}, Color: "navy"},
+	})
+	if err != nil {
+		t.Fatalf("newFrameStyle failed: %v", err)
+	}
+
+	if len(style.Layers) != 2 || style.Layers[0].Color == nil || style.Layers[1].Color != nil {
+		t.Errorf("layers = %+v, expected a coloured keyline and an uncoloured mat", style.Layers)
+	}
+	if style.Sides != [4]float64{1, 1, 1.5, 1} || style.Radius != 0.2 {
+		t.Errorf("sides = %v, radius = %v", style.Sides, style.Radius)
+	}
+	sh := style.Shadow
+	if sh == nil || sh.OffsetX != 0.05 || sh.OffsetY != 0.1 || sh.Opacity != 0.5 {
+		t.Fatalf("shadow = %+v, expected offset 0.05,0.1 and default opacity", sh)
+	}
+	if r, g, b, _ := sh.Color.RGBA(); r != 0 || g != 0 || b>>8 != 0x80 {
+		t.Errorf("shadow colour = %v, expected navy", sh.Color)
+	}
+
+	// Sides default to 1
+	flat, err := newFrameStyle(config.FrameStyle{Layers: []config.FrameLayer{{Width: 1}}})
+	if err != nil {
+		t.Fatalf("newFrameStyle failed: %v", err)
+	}
+	if flat.Sides != imglib.FlatFrameStyle.Sides {
+		t.Errorf("default sides = %v", flat.Sides)
+	}
+}
+
+func TestNewFrameStyleErrors(t *testing.T) {
+	layer := []config.FrameLayer{{Width: 1}}
+	tests := []struct {
+		name  string
+		style config.FrameStyle
+	}{
+		{"no layers", config.FrameStyle{}},
+		{"bad colour", config.FrameStyle{Layers: []config.FrameLayer{{Width: 1, Color: "nope"}}}},
+		{"zero width", config.FrameStyle{Layers: []config.FrameLayer{{Width: 0}}}},
+		{"three sides", config.FrameStyle{Layers: layer, Sides: []float64{1, 1, 2}}},
+		{"negative radius", config.FrameStyle{Layers: layer, Radius: -1}},
+		{"shadow offset", config.FrameStyle{Layers: layer, Shadow: &config.FrameShadow{Offset: []float64{1}}}},
+		{"shadow opacity", config.FrameStyle{Layers: layer, Shadow: &config.FrameShadow{Opacity: 2}}},
+		{"shadow colour", config.FrameStyle{Layers: layer, Shadow: &config.FrameShadow{Color: "nope"}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := newFrameStyle(tc.style); err == nil {
+				t.Errorf("newFrameStyle(%+v) expected error, got nil", tc.style)
+			}
+		})
+	}
+}
+
+func TestLoadFrameStyles(t *testing.T) {
+	user := map[string]config.FrameStyle{
+		"Museum": {Layers: []config.FrameLayer{{Width: 1, Color: "black"}, {Width: 4}}},
+		"flat":   {Layers: []config.FrameLayer{{Width: 1, Color: "red"}}},
+	}
+	project := map[string]config.FrameStyle{
+		"museum": {Layers: []config.FrameLayer{{Width: 1}}, Sides: []float64{1, 1, 2, 1}},
+	}
+	styles, err := loadFrameStyles(user, project, imglib.ProfileSRGB, imglib.IntentRelative)
+	if err != nil {
+		t.Fatalf("loadFrameStyles failed: %v", err)
+	}
+
+	museum, err := lookupFrameStyle("MUSEUM", styles)
+	if err != nil {
+		t.Fatalf("lookupFrameStyle failed: %v", err)
+	}
+	if museum.Sides[2] != 2 {
+		t.Errorf("museum = %+v, expected the project style", museum)
+	}
+	if flat := styles["flat"]; flat.Layers[0].Color != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("flat = %+v, expected the user style", flat)
+	}
+	if _, ok := styles["gallery"]; !ok {
+		t.Error("built-in gallery style missing")
+	}
+	if _, ok := frameStyles["flat"]; !ok || frameStyles["flat"].Layers[0].Color != nil {
+		t.Error("loadFrameStyles modified the built-in styles")
+	}
+
+	if _, err := lookupFrameStyle("nope", styles); err == nil {
+		t.Error("lookupFrameStyle(nope) expected error")
+	}
+	if _, err := loadFrameStyles(map[string]config.FrameStyle{"bad": {}}, nil, imglib.ProfileSRGB, imglib.IntentRelative); err == nil {
+		t.Error("loadFrameStyles with an invalid style expected error")
+	}
+}
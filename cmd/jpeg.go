@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	imglib "github.com/cwygoda/ansel/internal/image"
+	"github.com/spf13/pflag"
+)
+
+// jpegFlags holds the JPEG encoder flags, which the process and sheet
+// commands share.
+type jpegFlags struct {
+	defaults       string
+	subsample      string
+	progressive    bool
+	optimizeCoding bool
+	trellis        bool
+	deringing      bool
+	quantTable     int
+}
+
+// register adds the JPEG encoder flags to flags.
+func (j *jpegFlags) register(flags *pflag.FlagSet) {
+	flags.StringVar(&j.defaults, "jpeg-defaults", "", "JPEG encoder defaults: web (small, progressive) or print (4:4:4, baseline); unset keeps libvips' defaults")
+	flags.StringVar(&j.subsample, "jpeg-subsample", "auto", "JPEG chroma subsampling: auto, 4:2:0 or 4:4:4 (overrides --jpeg-defaults)")
+	flags.BoolVar(&j.progressive, "jpeg-progressive", false, "Write progressive JPEG (overrides --jpeg-defaults)")
+	flags.BoolVar(&j.optimizeCoding, "jpeg-optimize-coding", false, "Optimise JPEG Huffman tables (overrides --jpeg-defaults)")
+	flags.BoolVar(&j.trellis, "jpeg-trellis", false, "Use trellis quantisation, with mozjpeg (overrides --jpeg-defaults)")
+	flags.BoolVar(&j.deringing, "jpeg-deringing", false, "Use overshoot deringing, with mozjpeg (overrides --jpeg-defaults)")
+	flags.IntVar(&j.quantTable, "jpeg-quant-table", 0, "JPEG quantisation table 0-8, with mozjpeg (overrides --jpeg-defaults)")
+}
+
+// apply sets the JPEG settings of opts from --jpeg-defaults, if given, then
+// from the JPEG flags given on the command line or by a recipe. flags is the
+// flag set j is registered with.
+func (j *jpegFlags) apply(flags *pflag.FlagSet, opts *imglib.EncodeOptions) error {
+	if j.defaults != "" {
+		tuning, err := imglib.ParseJPEGTuning(j.defaults)
+		if err != nil {
+			return err
+		}
+		tuning.Apply(opts)
+	}
+
+	if flags.Changed("jpeg-subsample") {
+		subsample, err := imglib.ParseChromaSubsampling(j.subsample)
+		if err != nil {
+			return err
+		}
+		opts.JPEGSubsample = subsample
+	}
+	if flags.Changed("jpeg-progressive") {
+		opts.JPEGProgressive = j.progressive
+	}
+	if flags.Changed("jpeg-optimize-coding") {
+		opts.JPEGOptimizeCoding = j.optimizeCoding
+	}
+	if flags.Changed("jpeg-trellis") {
+		opts.JPEGTrellis = j.trellis
+	}
+	if flags.Changed("jpeg-deringing") {
+		opts.JPEGDeringing = j.deringing
+	}
+	if flags.Changed("jpeg-quant-table") {
+		opts.JPEGQuantTable = j.quantTable
+	}
+	return nil
+}
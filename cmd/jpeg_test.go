@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/cwygoda/ansel/internal/config"
+	imglib "github.com/cwygoda/ansel/internal/image"
+	"github.com/spf13/pflag"
+)
+
+func TestJPEGFlagsApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		recipe   config.Recipe
+		expected imglib.EncodeOptions
+	}{
+		{"default", nil, nil, imglib.EncodeOptions{}},
+		{"web", []string{"--jpeg-defaults", "web"}, nil, imglib.EncodeOptions{
+			JPEGSubsample: imglib.Subsample420, JPEGProgressive: true, JPEGOptimizeCoding: true,
+			JPEGTrellis: true, JPEGDeringing: true, JPEGQuantTable: 3,
+		}},
+		{"print", []string{"--jpeg-defaults", "print"}, nil, imglib.EncodeOptions{
+			JPEGSubsample: imglib.Subsample444, JPEGOptimizeCoding: true,
+		}},
+		{"overrides", []string{"--jpeg-defaults", "web", "--jpeg-subsample", "4:4:4", "--jpeg-trellis=false", "--jpeg-quant-table", "2"}, nil, imglib.EncodeOptions{
+			JPEGSubsample: imglib.Subsample444, JPEGProgressive: true, JPEGOptimizeCoding: true,
+			JPEGDeringing: true, JPEGQuantTable: 2,
+		}},
+		{"recipe", []string{"--jpeg-progressive"}, config.Recipe{"jpeg_defaults": "print", "jpeg_progressive": false}, imglib.EncodeOptions{
+			JPEGSubsample: imglib.Subsample444, JPEGProgressive: true, JPEGOptimizeCoding: true,
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var jpeg jpegFlags
+			flags := pflag.NewFlagSet("process", pflag.ContinueOnError)
+			jpeg.register(flags)
+			if err := flags.Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			if tc.recipe != nil {
+				if _, err := applyRecipe(flags, "r", map[string]config.Recipe{"r": tc.recipe}); err != nil {
+					t.Fatalf("applyRecipe failed: %v", err)
+				}
+			}
+			var got imglib.EncodeOptions
+			if err := jpeg.apply(flags, &got); err != nil {
+				t.Fatalf("apply failed: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("apply = %+v, expected %+v", got, tc.expected)
+			}
+		})
+	}
+
+	for _, args := range [][]string{{"--jpeg-defaults", "archive"}, {"--jpeg-subsample", "4:1:1"}} {
+		var jpeg jpegFlags
+		flags := pflag.NewFlagSet("process", pflag.ContinueOnError)
+		jpeg.register(flags)
+		if err := flags.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		if err := jpeg.apply(flags, &imglib.EncodeOptions{}); err == nil {
+			t.Errorf("apply(%q) expected error, got nil", args)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	imglib "github.com/cwygoda/ansel/internal/image"
+)
+
+// versionRegex matches a base name with a version suffix like _v0, _v1, etc.
+var versionRegex = regexp.MustCompile(`^(.+)_v(\d+)$`)
+
+// splitVersion returns a base name without its version suffix, and the
+// version; ok is false if there is none.
+func splitVersion(base string) (name string, version int, ok bool) {
+	matches := versionRegex.FindStringSubmatch(base)
+	if matches == nil {
+		return base, 0, false
+	}
+	version, _ = strconv.Atoi(matches[2])
+	return matches[1], version, true
+}
+
+// outputName returns the name of an output without version and extension,
+// and its first version: an input that already has a version suffix gets the
+// next one. A non-empty sizeName is appended unless the name already ends
+// with it.
+func outputName(inputPath string, sizeName string) (string, int) {
+	base := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	name, version, ok := splitVersion(base)
+	if ok {
+		version++
+	}
+	if sizeName != "" && !strings.HasSuffix(name, "_"+sizeName) {
+		name += "_" + sizeName
+	}
+	return name, version
+}
+
+// nameTokenRegex matches a token of a --name template, e.g. {base} or
+// {date:2006-01-02}.
+var nameTokenRegex = regexp.MustCompile(`\{([a-z0-9]+)(?::([^{}]*))?\}`)
+
+// nameTokens are the tokens of a --name template.
+var nameTokens = map[string]bool{
+	"base":   true,
+	"preset": true,
+	"w":      true,
+	"h":      true,
+	"date":   true,
+	"seq":    true,
+	"hash8":  true,
+}
+
+// defaultNameDateLayout is the layout of {date} without one.
+const defaultNameDateLayout = "2006-01-02"
+
+// nameTemplate is a parsed --name template.
+type nameTemplate struct {
+	text string
+	uses map[string]bool // tokens in the template
+}
+
+// parseNameTemplate parses a --name template such as "{base}_{w}x{h}".
+func parseNameTemplate(s string) (*nameTemplate, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("invalid name template: empty")
+	}
+	if literal := nameTokenRegex.ReplaceAllString(s, ""); strings.ContainsAny(literal, `{}/\`) {
+		return nil, fmt.Errorf("invalid name template %q: unknown token or path separator", s)
+	}
+
+	t := &nameTemplate{text: s, uses: make(map[string]bool)}
+	for _, m := range nameTokenRegex.FindAllStringSubmatch(s, -1) {
+		if !nameTokens[m[1]] {
+			return nil, fmt.Errorf("invalid name template %q: unknown token {%s} (use base, preset, w, h, date, seq or hash8)", s, m[1])
+		}
+		if m[2] != "" && m[1] != "date" {
+			return nil, fmt.Errorf("invalid name template %q: {%s} takes no layout", s, m[1])
+		}
+		t.uses[m[1]] = true
+	}
+	return t, nil
+}
+
+// nameFields are the values of the --name tokens for one output.
+type nameFields struct {
+	base          string // input name without extension and version
+	preset        string
+	width, height int
+	date          time.Time // capture date, or the file's modification time
+	seq           int       // position of the input on the command line, from 1
+	hash          string    // hex SHA-256 of the input file
+}
+
+// execute returns the output name for f, without extension. Path
+// separators in dates are replaced with dashes.
+func (t *nameTemplate) execute(f nameFields) string {
+	return nameTokenRegex.ReplaceAllStringFunc(t.text, func(token string) string {
+		m := nameTokenRegex.FindStringSubmatch(token)
+		switch m[1] {
+		case "base":
+			return f.base
+		case "preset":
+			return f.preset
+		case "w":
+			return strconv.Itoa(f.width)
+		case "h":
+			return strconv.Itoa(f.height)
+		case "date":
+			layout := m[2]
+			if layout == "" {
+				layout = defaultNameDateLayout
+			}
+			return strings.NewReplacer("/", "-", `\`, "-").Replace(f.date.Format(layout))
+		case "seq":
+			return fmt.Sprintf("%03d", f.seq)
+		case "hash8":
+			return f.hash[:min(8, len(f.hash))]
+		}
+		return token
+	})
+}
+
+// outputPath returns the path of an output at size, named by the --name
+// template or, without one, after the input with a version suffix. sizeName
+// is "" if the output isn't named after its size. skip is true if the file
+// exists and is to be left alone.
+//
+// Outputs are named before they are rendered, so {w} and {h} are the planned
+// dimensions: an output scaled down to fit --max-bytes keeps its name.
+func outputPath(inputPath, sizeName string, size outputSize, srcWidth, srcHeight int, format imglib.Format, f nameFields, opts *processOptions) (path string, skip bool) {
+	// Use output directory if specified, otherwise use input file's directory
+	dir := opts.outDir
+	if dir == "" {
+		dir = filepath.Dir(inputPath)
+	}
+
+	// Default names always carry a version; template names only get one
+	// when the plain name is taken
+	var versionPath func(int) string
+	version := 0
+	if opts.name == nil {
+		var name string
+		name, version = outputName(inputPath, sizeName)
+		versionPath = func(v int) string {
+			return filepath.Join(dir, fmt.Sprintf("%s_v%d%s", name, v, format.Extension()))
+		}
+	} else {
+		f.preset = size.name
+		f.width, f.height, _ = planSize(srcWidth, srcHeight, size, opts)
+		name := opts.name.execute(f)
+		versionPath = func(v int) string {
+			if v == 0 {
+				return filepath.Join(dir, name+format.Extension())
+			}
+			return filepath.Join(dir, fmt.Sprintf("%s_v%d%s", name, v, format.Extension()))
+		}
+	}
+
+	if opts.claims == nil {
+		return versionPath(version), false
+	}
+	return opts.claims.claim(versionPath, version, opts.existing)
+}
+
+// fileNameFields returns the name fields of an input that don't depend on
+// the output size. The date and hash are only read if the template uses them.
+func fileNameFields(inputPath string, opts *processOptions) (nameFields, error) {
+	base := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	f := nameFields{seq: opts.seq[inputPath]}
+	f.base, _, _ = splitVersion(base)
+	if opts.name == nil {
+		return f, nil
+	}
+
+	if opts.name.uses["date"] {
+		f.date = imglib.ReadMetadata(inputPath).DateTaken
+		if f.date.IsZero() {
+			info, err := os.Stat(inputPath)
+			if err != nil {
+				return f, err
+			}
+			f.date = info.ModTime()
+		}
+	}
+	if opts.name.uses["hash8"] {
+		var err error
+		if f.hash, err = hashFile(inputPath); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// hashFile returns the hex SHA-256 of a file's contents.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// existingPolicy selects what happens when an output file already exists.
+type existingPolicy int
+
+const (
+	// existingNextVersion writes the next free version.
+	existingNextVersion existingPolicy = iota
+	// existingOverwrite replaces the file.
+	existingOverwrite
+	// existingSkip leaves the file and skips the output.
+	existingSkip
+)
+
+// outputClaims hands out the output paths of a run, so that no two outputs
+// get the same file. Outputs are claimed in input order before any is
+// written, so that a run names its outputs the same way every time.
+type outputClaims struct {
+	claimed map[string]bool
+}
+
+// newOutputClaims returns claims for a run over inputs. The inputs are
+// claimed from the start, so that no output replaces one of them.
+func newOutputClaims(inputs []string) *outputClaims {
+	c := &outputClaims{claimed: make(map[string]bool)}
+	for _, input := range inputs {
+		c.claimed[filepath.Clean(input)] = true
+	}
+	return c
+}
+
+// reserve claims path, which an output of the run keeps.
+func (c *outputClaims) reserve(path string) {
+	c.claimed[filepath.Clean(path)] = true
+}
+
+// claim returns the path of the first version from version on that is free
+// under policy, where path returns the path of a version. Paths claimed
+// earlier in the run are never reused. skip is true if the output exists and
+// policy is existingSkip.
+func (c *outputClaims) claim(path func(version int) string, version int, policy existingPolicy) (p string, skip bool) {
+	for v := version; ; v++ {
+		p = filepath.Clean(path(v))
+		if c.claimed[p] {
+			continue
+		}
+		if _, err := os.Stat(p); err == nil {
+			if policy == existingSkip {
+				return p, true
+			}
+			if policy == existingNextVersion {
+				continue
+			}
+		}
+		c.claimed[p] = true
+		return p, false
+	}
+}
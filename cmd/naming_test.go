@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	imglib "github.com/cwygoda/ansel/internal/image"
+)
+
+func TestParseNameTemplate(t *testing.T) {
+	fields := nameFields{
+		base:   "photo",
+		preset: "ig-post",
+		width:  1080,
+		height: 1350,
+		date:   time.Date(2024, 5, 17, 14, 30, 0, 0, time.UTC),
+		seq:    7,
+		hash:   "0123456789abcdef",
+	}
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{"{base}", "photo"},
+		{"{base}_{preset}_{w}x{h}", "photo_ig-post_1080x1350"},
+		{"{date}_{seq}", "2024-05-17_007"},
+		{"{date:20060102-1504}-{hash8}", "20240517-1430-01234567"},
+		{"{date:2006/01/02}", "2024-05-17"},
+		{"shoot-{seq}", "shoot-007"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.template, func(t *testing.T) {
+			tmpl, err := parseNameTemplate(tc.template)
+			if err != nil {
+				t.Fatalf("parseNameTemplate(%q) failed: %v", tc.template, err)
+			}
+			if got := tmpl.execute(fields); got != tc.expected {
+				t.Errorf("execute(%q) = %q, expected %q", tc.template, got, tc.expected)
+			}
+		})
+	}
+
+	for _, template := range []string{"", "{name}", "{base", "{w:4}", "out/{base}", `{base}\x`} {
+		if _, err := parseNameTemplate(template); err == nil {
+			t.Errorf("parseNameTemplate(%q) expected error, got nil", template)
+		}
+	}
+}
+
+func TestOutputClaims(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "photo_v0.jpg")
+	if err := os.WriteFile(existing, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := func(v int) string {
+		return filepath.Join(dir, fmt.Sprintf("photo_v%d.jpg", v))
+	}
+
+	tests := []struct {
+		name     string
+		policy   existingPolicy
+		expected []string // paths of three claims
+		skip     bool
+	}{
+		{"next version", existingNextVersion, []string{"photo_v1.jpg", "photo_v2.jpg", "photo_v3.jpg"}, false},
+		{"overwrite", existingOverwrite, []string{"photo_v0.jpg", "photo_v1.jpg", "photo_v2.jpg"}, false},
+		{"skip", existingSkip, []string{"photo_v0.jpg", "photo_v0.jpg", "photo_v0.jpg"}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := newOutputClaims(nil)
+			for _, expected := range tc.expected {
+				got, skip := claims.claim(path, 0, tc.policy)
+				if got != filepath.Join(dir, expected) || skip != tc.skip {
+					t.Errorf("claim = %q, %v, expected %q, %v", got, skip, expected, tc.skip)
+				}
+			}
+		})
+	}
+
+	// Inputs are never claimed as outputs, even when overwriting
+	input := filepath.Join(dir, "photo_v1.jpg")
+	claims := newOutputClaims([]string{input})
+	if got, _ := claims.claim(path, 1, existingOverwrite); got != filepath.Join(dir, "photo_v2.jpg") {
+		t.Errorf("claim = %q, expected photo_v2.jpg", got)
+	}
+}
+
+func TestOutputPathVersion(t *testing.T) {
+	tests := []struct {
+		input    string
+		outDir   string
+		expected string
+	}{
+		// No version suffix, no outDir
+		{"photo.jpg", "", "photo_v0.jpg"},
+		{"image.png", "", "image_v0.jpg"},
+		{"test.tiff", "", "test_v0.jpg"},
+
+		// With version suffix - increment
+		{"photo_v0.jpg", "", "photo_v1.jpg"},
+		{"photo_v1.jpg", "", "photo_v2.jpg"},
+		{"photo_v9.jpg", "", "photo_v10.jpg"},
+		{"photo_v99.jpg", "", "photo_v100.jpg"},
+
+		// With input directory, no outDir
+		{"/path/to/photo.jpg", "", "/path/to/photo_v0.jpg"},
+		{"/path/to/photo_v0.jpg", "", "/path/to/photo_v1.jpg"},
+		{"./photo.jpg", "", "photo_v0.jpg"},
+
+		// Edge cases
+		{"my_photo.jpg", "", "my_photo_v0.jpg"},
+		{"my_photo_v0.jpg", "", "my_photo_v1.jpg"},
+		{"photo_v0_edited.jpg", "", "photo_v0_edited_v0.jpg"},
+
+		// With outDir specified
+		{"photo.jpg", "/output", "/output/photo_v0.jpg"},
+		{"/path/to/photo.jpg", "/output", "/output/photo_v0.jpg"},
+		{"photo_v0.jpg", "/output", "/output/photo_v1.jpg"},
+		{"photo.jpg", "out", "out/photo_v0.jpg"},
+	}
+
+	for _, tc := range tests {
+		name := tc.input
+		if tc.outDir != "" {
+			name += " -> " + tc.outDir
+		}
+		t.Run(name, func(t *testing.T) {
+			result, _ := outputPath(tc.input, "", outputSize{}, 0, 0, imglib.JPEG, nameFields{}, &processOptions{outDir: tc.outDir})
+			if result != tc.expected {
+				t.Errorf("outputPath(%q, %q) = %q, expected %q",
+					tc.input, tc.outDir, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestOutputPathFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		format   imglib.Format
+		expected string
+	}{
+		{"photo.jpg", imglib.JPEG, "photo_v0.jpg"},
+		{"photo.jpg", imglib.PNG, "photo_v0.png"},
+		{"photo.jpg", imglib.WebP, "photo_v0.webp"},
+		{"photo.jpg", imglib.AVIF, "photo_v0.avif"},
+		{"photo.jpg", imglib.TIFF, "photo_v0.tif"},
+		{"photo_v0.png", imglib.JXL, "photo_v1.jxl"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input+" as "+tc.format.String(), func(t *testing.T) {
+			result, _ := outputPath(tc.input, "", outputSize{}, 0, 0, tc.format, nameFields{}, &processOptions{})
+			if result != tc.expected {
+				t.Errorf("outputPath(%q, %s) = %q, expected %q",
+					tc.input, tc.format, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestOutputPathSizeName(t *testing.T) {
+	tests := []struct {
+		input    string
+		sizeName string
+		expected string
+	}{
+		{"photo.jpg", "ig-post", "photo_ig-post_v0.jpg"},
+		{"photo.jpg", "1920x1080", "photo_1920x1080_v0.jpg"},
+		{"photo_ig-post_v0.jpg", "ig-post", "photo_ig-post_v1.jpg"},
+		{"photo_v2.jpg", "x-post", "photo_x-post_v3.jpg"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input+"/"+tc.sizeName, func(t *testing.T) {
+			result, _ := outputPath(tc.input, tc.sizeName, outputSize{}, 0, 0, imglib.JPEG, nameFields{}, &processOptions{})
+			if result != tc.expected {
+				t.Errorf("outputPath(%q, %q) = %q, expected %q",
+					tc.input, tc.sizeName, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "photo_v2.jpg")
+	if err := os.WriteFile(filepath.Join(dir, "photo_v3.jpg"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	size := outputSize{name: "ig-post", width: 1080, height: 1080}
+	fields := nameFields{base: "photo", seq: 1}
+
+	tests := []struct {
+		name     string
+		template string
+		sizeName string
+		expected string
+	}{
+		{"default", "", "", "photo_v4.jpg"},
+		{"default with size", "", "ig-post", "photo_ig-post_v3.jpg"},
+		{"template", "{base}-{preset}-{w}x{h}", "", "photo-ig-post-1080x1080.jpg"},
+		{"template taken", "{base}_v3", "", "photo_v3_v1.jpg"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &processOptions{fit: "expand", frameStyle: imglib.FlatFrameStyle, claims: newOutputClaims([]string{input})}
+			if tc.template != "" {
+				var err error
+				if opts.name, err = parseNameTemplate(tc.template); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, skip := outputPath(input, tc.sizeName, size, 4000, 3000, imglib.JPEG, fields, opts)
+			if got != filepath.Join(dir, tc.expected) || skip {
+				t.Errorf("outputPath = %q, %v, expected %q", got, skip, tc.expected)
+			}
+		})
+	}
+}
+
+func TestNameOutputs(t *testing.T) {
+	dir := t.TempDir()
+	name, err := parseNameTemplate("{preset}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := outputSize{name: "ig-post", width: 1080, height: 1080}
+	opts := &processOptions{
+		sizes: []outputSize{size}, fit: "expand", frameStyle: imglib.FlatFrameStyle,
+		outDir: dir, name: name, claims: newOutputClaims(nil),
+	}
+
+	// The third input's output is cached at the name the first would get;
+	// the others are versioned in input order
+	plans := make([]*inputPlan, 3)
+	for i := range plans {
+		plans[i] = &inputPlan{
+			input: fmt.Sprintf("photo%d.jpg", i), format: imglib.JPEG, srcWidth: 4000, srcHeight: 3000,
+			sizes: make([]outputSize, 1), outputs: make([]outputResult, 1),
+		}
+	}
+	plans[2].outputs[0] = outputResult{path: filepath.Join(dir, "ig-post.jpg"), cached: true}
+	nameOutputs(plans, opts)
+
+	for i, expected := range []string{"ig-post_v1.jpg", "ig-post_v2.jpg", "ig-post.jpg"} {
+		if got := plans[i].outputs[0].path; got != filepath.Join(dir, expected) {
+			t.Errorf("input %d: output %q, expected %q", i, got, expected)
+		}
+	}
+	if plans[0].sizes[0].width != 1080 {
+		t.Errorf("resolved size = %+v, expected ig-post", plans[0].sizes[0])
+	}
+}
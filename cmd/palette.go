@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	imglib "github.com/cwygoda/ansel/internal/image"
+	"github.com/spf13/cobra"
+)
+
+var paletteCmd = &cobra.Command{
+	Use:   "palette [flags] <file>",
+	Short: "Extract the colour palette of an image",
+	Long: `Extract the dominant colours of an image, as used by --color auto.
+
+The image is converted to sRGB and its colours are clustered into up to
+--count swatches, ordered from the most to the least common. By default the
+swatches are printed as hex colours, one per line. With --json the output
+also includes each swatch's share of the image, the average colour and the
+colours the auto frame modes would pick:
+
+  auto             the dominant colour
+  auto-dark        a deep shade of the dominant hue
+  auto-light       a pale tint of the dominant hue
+  auto-complement  a muted colour opposite the dominant hue
+
+Examples:
+  ansel palette photo.jpg
+  ansel palette --count 8 --json photo.jpg`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPalette,
+}
+
+var (
+	paletteCount int
+	paletteJSON  bool
+)
+
+func init() {
+	rootCmd.AddCommand(paletteCmd)
+
+	paletteCmd.Flags().IntVarP(&paletteCount, "count", "n", 6, "Maximum number of swatches")
+	paletteCmd.Flags().BoolVar(&paletteJSON, "json", false, "Output as JSON")
+}
+
+// paletteSwatch is a swatch as written by "ansel palette --json".
+type paletteSwatch struct {
+	Hex    string   `json:"hex"`
+	RGB    [3]uint8 `json:"rgb"`
+	Weight float64  `json:"weight"`
+}
+
+// paletteOutput is the JSON output of "ansel palette".
+type paletteOutput struct {
+	File     string            `json:"file"`
+	Swatches []paletteSwatch   `json:"swatches"`
+	Average  string            `json:"average"`
+	Auto     map[string]string `json:"auto"`
+}
+
+// newPaletteOutput converts an extracted palette to its JSON form.
+func newPaletteOutput(file string, p imglib.Palette) paletteOutput {
+	out := paletteOutput{
+		File:     file,
+		Swatches: make([]paletteSwatch, 0, len(p.Swatches)),
+		Average:  imglib.HexColor(p.Average),
+		Auto:     make(map[string]string),
+	}
+	for _, s := range p.Swatches {
+		out.Swatches = append(out.Swatches, paletteSwatch{
+			Hex:    s.Hex(),
+			RGB:    [3]uint8{s.Color.R, s.Color.G, s.Color.B},
+			Weight: s.Weight,
+		})
+	}
+	for _, mode := range []imglib.AutoColor{imglib.AutoDominant, imglib.AutoDark, imglib.AutoLight, imglib.AutoComplement} {
+		out.Auto[mode.String()] = imglib.HexColor(p.Color(mode))
+	}
+	return out
+}
+
+func runPalette(cmd *cobra.Command, args []string) error {
+	if paletteCount < 1 {
+		return fmt.Errorf("invalid count: %d (must be at least 1)", paletteCount)
+	}
+
+	imglib.InitVips()
+	defer imglib.ShutdownVips()
+
+	img, err := imglib.LoadVips(args[0])
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+
+	// Swatches are reported as sRGB
+	if err := img.ConvertToProfile(imglib.ProfileSRGB, imglib.IntentPerceptual); err != nil {
+		return err
+	}
+	palette, err := img.Palette(paletteCount)
+	if err != nil {
+		return err
+	}
+
+	if paletteJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(newPaletteOutput(args[0], palette))
+	}
+	for _, s := range palette.Swatches {
+		fmt.Println(s.Hex())
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"encoding/json"
+	"image/color"
+	"strings"
+	"testing"
+
+	imglib "github.com/cwygoda/ansel/internal/image"
+)
+
+func TestNewPaletteOutput(t *testing.T) {
+	p := imglib.Palette{
+		Swatches: []imglib.Swatch{
+			{Color: color.RGBA{0xdc, 0x78, 0x14, 0xff}, Weight: 0.6},
+			{Color: color.RGBA{0x10, 0x20, 0x30, 0xff}, Weight: 0.4},
+		},
+		Average: color.RGBA{0x80, 0x60, 0x40, 0xff},
+	}
+
+	out := newPaletteOutput("photo.jpg", p)
+	if len(out.Swatches) != 2 || out.Swatches[0].Hex != "#dc7814" || out.Swatches[1].RGB != [3]uint8{0x10, 0x20, 0x30} {
+		t.Errorf("swatches = %+v", out.Swatches)
+	}
+	if out.Average != "#806040" {
+		t.Errorf("average = %q, expected #806040", out.Average)
+	}
+	if out.Auto["auto"] != "#dc7814" {
+		t.Errorf("auto = %q, expected the dominant colour", out.Auto["auto"])
+	}
+	for _, mode := range []string{"auto-dark", "auto-light", "auto-complement"} {
+		if !strings.HasPrefix(out.Auto[mode], "#") {
+			t.Errorf("missing %s colour: %v", mode, out.Auto)
+		}
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"rgb":[220,120,20]`) {
+		t.Errorf("rgb should be a list of numbers: %s", data)
+	}
+}
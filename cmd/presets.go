@@ -0,0 +1,411 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cwygoda/ansel/internal/config"
+	imglib "github.com/cwygoda/ansel/internal/image"
+	"github.com/spf13/cobra"
+)
+
+// Preset sources, from lowest to highest precedence.
+const (
+	presetSourceBuiltin = "built-in"
+	presetSourceUser    = "user"
+	presetSourceProject = "project"
+)
+
+// preset is a named output size with optional platform metadata.
+type preset struct {
+	Name        string         `json:"name"`
+	Width       int            `json:"width,omitempty"`
+	Height      int            `json:"height,omitempty"`
+	Rotate      bool           `json:"rotate,omitempty"`   // matches each image's orientation
+	DPI         float64        `json:"dpi,omitempty"`      // print resolution
+	Variants    []string       `json:"variants,omitempty"` // preset family
+	Platform    string         `json:"platform,omitempty"`
+	MaxFileSize int64          `json:"max_file_size,omitempty"` // bytes; the default --max-bytes
+	Format      string         `json:"format,omitempty"`
+	SafeZone    *config.Insets `json:"safe_zone,omitempty"`
+	Source      string         `json:"source"`
+}
+
+// builtinPresetInfo holds the metadata of the built-in presets in sizePresets.
+var builtinPresetInfo = map[string]preset{
+	"ig-post":      {Platform: "Instagram", MaxFileSize: 8_000_000},
+	"ig-portrait":  {Platform: "Instagram", MaxFileSize: 8_000_000},
+	"ig-landscape": {Platform: "Instagram", MaxFileSize: 8_000_000},
+	// Profile and caption overlays cover the top and bottom
+	"ig-story": {Platform: "Instagram", MaxFileSize: 8_000_000, SafeZone: &config.Insets{Top: 250, Bottom: 250}},
+	"ig-reel":  {Platform: "Instagram", MaxFileSize: 8_000_000, SafeZone: &config.Insets{Top: 220, Bottom: 420}},
+	"fb-post":  {Platform: "Facebook"},
+	"fb-cover": {Platform: "Facebook"},
+	"x-post":   {Platform: "X", MaxFileSize: 5_000_000},
+	"x-header": {Platform: "X", MaxFileSize: 2_000_000},
+	"yt-thumb": {Platform: "YouTube", MaxFileSize: 2_000_000},
+	"li-post":  {Platform: "LinkedIn"},
+	"li-cover": {Platform: "LinkedIn"},
+	"4x6":      {Platform: "Print", Format: "tiff", Rotate: true, DPI: defaultPrintDPI},
+	"5x7":      {Platform: "Print", Format: "tiff", Rotate: true, DPI: defaultPrintDPI},
+	"8x10":     {Platform: "Print", Format: "tiff", Rotate: true, DPI: defaultPrintDPI},
+}
+
+// sizeFamilies are the built-in preset families.
+var sizeFamilies = map[string][]string{
+	"ig-auto": {"ig-portrait", "ig-post", "ig-landscape"},
+}
+
+// presets is the preset registry used to resolve --size values. It holds the
+// built-in presets until loadPresets merges the configured ones.
+var presets = builtinPresets()
+
+// builtinPresets returns the built-in presets.
+func builtinPresets() map[string]preset {
+	registry := make(map[string]preset, len(sizePresets))
+	for name, size := range sizePresets {
+		p := builtinPresetInfo[name]
+		p.Name = name
+		p.Width, p.Height = size[0], size[1]
+		p.Source = presetSourceBuiltin
+		registry[name] = p
+	}
+	for name, variants := range sizeFamilies {
+		registry[name] = preset{
+			Name:     name,
+			Platform: registry[variants[0]].Platform,
+			Variants: variants,
+			Source:   presetSourceBuiltin,
+		}
+	}
+	return registry
+}
+
+// presetNameRegex matches names that would be read as a size rather than a preset.
+var presetNameRegex = regexp.MustCompile(`^\d+x\d+$`)
+
+// loadPresets adds the user and project presets and families to the
+// registry. Project definitions override user definitions, which override
+// built-in ones.
+func loadPresets(user *config.UserConfig, project *config.ProjectConfig) error {
+	registry := builtinPresets()
+	for _, layer := range []struct {
+		source   string
+		presets  map[string]config.Preset
+		families map[string][]string
+	}{
+		{presetSourceUser, user.Presets, user.Families},
+		{presetSourceProject, project.Presets, project.Families},
+	} {
+		for name, cfg := range layer.presets {
+			p, err := newPreset(name, cfg, layer.source)
+			if err != nil {
+				return err
+			}
+			registry[p.Name] = p
+		}
+		for name, variants := range layer.families {
+			name = strings.ToLower(name)
+			if err := validatePresetName(name, layer.source); err != nil {
+				return err
+			}
+			if len(variants) == 0 {
+				return fmt.Errorf("%s family %q has no variants", layer.source, name)
+			}
+			family := preset{Name: name, Source: layer.source}
+			for _, v := range variants {
+				family.Variants = append(family.Variants, strings.ToLower(strings.TrimSpace(v)))
+			}
+			registry[name] = family
+		}
+	}
+
+	// Variants may refer to presets from any layer
+	for name, p := range registry {
+		for _, v := range p.Variants {
+			variant, ok := registry[v]
+			if !ok {
+				return fmt.Errorf("%s family %q: unknown preset %q", p.Source, name, v)
+			}
+			if len(variant.Variants) > 0 {
+				return fmt.Errorf("%s family %q: %q is a family", p.Source, name, v)
+			}
+		}
+		if len(p.Variants) > 0 && p.Platform == "" {
+			p.Platform = registry[p.Variants[0]].Platform
+			registry[name] = p
+		}
+	}
+	presets = registry
+	return nil
+}
+
+// validatePresetName rejects names that can't be told apart from sizes or lists.
+func validatePresetName(name, source string) error {
+	if name == "" || strings.ContainsAny(name, ", \t") || presetNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid %s preset name %q", source, name)
+	}
+	return nil
+}
+
+// newPreset validates a configured preset.
+func newPreset(name string, cfg config.Preset, source string) (preset, error) {
+	name = strings.ToLower(name)
+	if err := validatePresetName(name, source); err != nil {
+		return preset{}, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return preset{}, fmt.Errorf("%s preset %q: width and height must be positive", source, name)
+	}
+	if cfg.DPI < 0 {
+		return preset{}, fmt.Errorf("%s preset %q: dpi must not be negative", source, name)
+	}
+
+	p := preset{
+		Name:     name,
+		Width:    cfg.Width,
+		Height:   cfg.Height,
+		Rotate:   cfg.Rotate,
+		DPI:      cfg.DPI,
+		Platform: cfg.Platform,
+		SafeZone: cfg.SafeZone,
+		Source:   source,
+	}
+	if cfg.Format != "" {
+		format, err := imglib.ParseFormat(cfg.Format)
+		if err != nil {
+			return preset{}, fmt.Errorf("%s preset %q: %w", source, name, err)
+		}
+		p.Format = format.String()
+	}
+	if cfg.MaxFileSize != "" {
+		size, err := parseByteSize(cfg.MaxFileSize)
+		if err != nil {
+			return preset{}, fmt.Errorf("%s preset %q: invalid max_file_size: %w", source, name, err)
+		}
+		p.MaxFileSize = size
+	}
+	if z := cfg.SafeZone; z != nil {
+		if z.Top < 0 || z.Right < 0 || z.Bottom < 0 || z.Left < 0 ||
+			z.Left+z.Right >= cfg.Width || z.Top+z.Bottom >= cfg.Height {
+			return preset{}, fmt.Errorf("%s preset %q: safe zone insets must be non-negative and smaller than the size", source, name)
+		}
+	}
+	return p, nil
+}
+
+// byteUnits are the accepted size suffixes, longest first.
+var byteUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"kib", 1 << 10},
+	{"mib", 1 << 20},
+	{"gib", 1 << 30},
+	{"kb", 1000},
+	{"mb", 1000 * 1000},
+	{"gb", 1000 * 1000 * 1000},
+	{"k", 1000},
+	{"m", 1000 * 1000},
+	{"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// parseByteSize parses a file size such as "500KB", "8MB" or "2MiB".
+// KB and MB are decimal units, KiB and MiB binary ones.
+func parseByteSize(s string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	factor := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			factor = unit.factor
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return int64(n * float64(factor)), nil
+}
+
+// formatByteSize formats a size in bytes with the largest unit that
+// represents it exactly.
+func formatByteSize(n int64) string {
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{
+		{"GB", 1000 * 1000 * 1000},
+		{"MiB", 1 << 20},
+		{"MB", 1000 * 1000},
+		{"KiB", 1 << 10},
+		{"KB", 1000},
+	} {
+		if n >= unit.factor && n%unit.factor == 0 {
+			return fmt.Sprintf("%d%s", n/unit.factor, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// sortedPresets returns the registry sorted by platform and name.
+func sortedPresets() []preset {
+	list := make([]preset, 0, len(presets))
+	for _, p := range presets {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Platform != list[j].Platform {
+			return list[i].Platform < list[j].Platform
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// presetSize returns the output size for a preset name. Family variants are
+// resolved per image by outputSize.resolve.
+func presetSize(name string) (outputSize, bool) {
+	p, ok := presets[name]
+	if !ok {
+		return outputSize{}, false
+	}
+	size := outputSize{name: name, width: p.Width, height: p.Height, rotate: p.Rotate, dpi: p.DPI, maxBytes: p.MaxFileSize}
+	for _, v := range p.Variants {
+		variant, _ := presetSize(v)
+		size.variants = append(size.variants, variant)
+	}
+	return size, true
+}
+
+// presetNames returns the sorted names of all presets.
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var presetsCmd = &cobra.Command{
+	Use:   "presets",
+	Short: "List size presets",
+	Long: `List the built-in size presets and those defined in configuration files.
+
+Presets are read from the user configuration (~/.config/ansel/config.toml on
+Linux) and the project's .ansel.toml. Project presets override user presets,
+which override built-in presets of the same name:
+
+  [preset.lab-13x18]
+  width = 1535
+  height = 2126
+  dpi = 300
+  platform = "Print lab"
+  format = "tiff"
+
+  [preset.shop-banner]
+  width = 1920
+  height = 600
+  platform = "Shop"
+  max_file_size = "500KB"
+  format = "webp"
+  safe_zone = { top = 0, right = 400, bottom = 0, left = 400 }
+
+The platform, recommended format and safe zone (insets in pixels) are
+informational. The maximum file size is the default --max-bytes budget: the
+quality is lowered, and screen sizes are scaled down, until outputs fit,
+unless --max-bytes sets another budget or turns it off with --max-bytes 0
+(or none). This includes the built-in ig-*, x-post, x-header and yt-thumb
+limits. The dpi is written to the output as its print resolution, and lets
+--bleed and --safe-margin be given in mm or inches.
+
+Presets with rotate = true swap width and height to match the orientation of
+each image, like the built-in print sizes. A family picks the variant closest
+to each image's aspect ratio, like ig-auto:
+
+  [preset.lab-13x18]
+  width = 1535
+  height = 2126
+  rotate = true
+
+  [family]
+  shop-auto = ["shop-banner", "shop-square"]
+
+Examples:
+  ansel presets
+  ansel presets --json`,
+	Args: cobra.NoArgs,
+	RunE: runPresets,
+}
+
+var presetsJSON bool
+
+func init() {
+	rootCmd.AddCommand(presetsCmd)
+
+	presetsCmd.Flags().BoolVar(&presetsJSON, "json", false, "Output as JSON")
+}
+
+func runPresets(cmd *cobra.Command, args []string) error {
+	userCfg, err := config.LoadUserConfig()
+	if err != nil {
+		return err
+	}
+	projectCfg, err := config.LoadProjectConfig()
+	if err != nil {
+		return err
+	}
+	if err := loadPresets(userCfg, projectCfg); err != nil {
+		return err
+	}
+
+	list := sortedPresets()
+	if presetsJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tPLATFORM\tMAX SIZE\tFORMAT\tSAFE ZONE\tSOURCE")
+	for _, p := range list {
+		maxSize, safeZone := "-", "-"
+		if p.MaxFileSize > 0 {
+			maxSize = formatByteSize(p.MaxFileSize)
+		}
+		if z := p.SafeZone; z != nil {
+			safeZone = fmt.Sprintf("%d %d %d %d", z.Top, z.Right, z.Bottom, z.Left)
+		}
+		size := fmt.Sprintf("%dx%d", p.Width, p.Height)
+		if p.DPI > 0 {
+			size += fmt.Sprintf("@%gdpi", p.DPI)
+		}
+		switch {
+		case len(p.Variants) > 0:
+			size = strings.Join(p.Variants, "|")
+		case p.Rotate:
+			size += " (rotates)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			p.Name, size, orDash(p.Platform), maxSize, orDash(p.Format), safeZone, p.Source)
+	}
+	return w.Flush()
+}
+
+// orDash returns s, or "-" if it is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/cwygoda/ansel/internal/config"
+)
+
+func TestBuiltinPresets(t *testing.T) {
+	registry := builtinPresets()
+	if len(registry) != len(sizePresets)+len(sizeFamilies) {
+		t.Fatalf("got %d built-in presets, expected %d", len(registry), len(sizePresets)+len(sizeFamilies))
+	}
+	for name := range builtinPresetInfo {
+		if _, ok := sizePresets[name]; !ok {
+			t.Errorf("metadata for unknown preset %q", name)
+		}
+	}
+	for name, p := range registry {
+		if p.Platform == "" || p.Source != presetSourceBuiltin {
+			t.Errorf("preset %q = %+v, expected a platform and built-in source", name, p)
+		}
+	}
+}
+
+func TestLoadPresets(t *testing.T) {
+	t.Cleanup(func() { presets = builtinPresets() })
+
+	user := &config.UserConfig{
+		Presets: map[string]config.Preset{
+			"Lab-13x18": {Width: 1535, Height: 2126, Platform: "Print lab", Format: "tif", MaxFileSize: "20MB", Rotate: true},
+			"banner":    {Width: 1920, Height: 600},
+		},
+		Families: map[string][]string{"shop-auto": {"banner", "SQUARE"}},
+	}
+	project := &config.ProjectConfig{
+		Presets: map[string]config.Preset{
+			"banner":  {Width: 1600, Height: 500, SafeZone: &config.Insets{Left: 100, Right: 100}},
+			"ig-post": {Width: 1440, Height: 1440},
+			"square":  {Width: 1000, Height: 1000, Platform: "Shop"},
+		},
+	}
+	if err := loadPresets(user, project); err != nil {
+		t.Fatalf("loadPresets failed: %v", err)
+	}
+
+	lab := presets["lab-13x18"]
+	if lab.Width != 1535 || !lab.Rotate || lab.Format != "tiff" || lab.MaxFileSize != 20_000_000 || lab.Source != presetSourceUser {
+		t.Errorf("lab-13x18 = %+v", lab)
+	}
+	if banner := presets["banner"]; banner.Width != 1600 || banner.Source != presetSourceProject {
+		t.Errorf("banner = %+v, expected the project preset", banner)
+	}
+	if w, h, err := parseSize("ig-post"); err != nil || w != 1440 || h != 1440 {
+		t.Errorf("parseSize(ig-post) = %d, %d, %v; expected the overriding preset", w, h, err)
+	}
+	if _, _, err := parseSize("LAB-13x18"); err != nil {
+		t.Errorf("parseSize(LAB-13x18) failed: %v", err)
+	}
+
+	family, ok := presetSize("shop-auto")
+	if !ok || len(family.variants) != 2 || family.variants[0].width != 1600 || family.variants[1].name != "square" {
+		t.Errorf("presetSize(shop-auto) = %+v, %v", family, ok)
+	}
+}
+
+func TestLoadPresetsErrors(t *testing.T) {
+	t.Cleanup(func() { presets = builtinPresets() })
+
+	tests := []struct {
+		name   string
+		preset config.Preset
+	}{
+		{"bad", config.Preset{Width: 0, Height: 100}},
+		{"bad", config.Preset{Width: 100, Height: 100, Format: "gif"}},
+		{"bad", config.Preset{Width: 100, Height: 100, MaxFileSize: "lots"}},
+		{"bad", config.Preset{Width: 100, Height: 100, SafeZone: &config.Insets{Top: 60, Bottom: 40}}},
+		{"bad", config.Preset{Width: 100, Height: 100, SafeZone: &config.Insets{Left: -1}}},
+		{"800x600", config.Preset{Width: 100, Height: 100}},
+		{"a,b", config.Preset{Width: 100, Height: 100}},
+		{"a b", config.Preset{Width: 100, Height: 100}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			project := &config.ProjectConfig{Presets: map[string]config.Preset{tc.name: tc.preset}}
+			if err := loadPresets(&config.UserConfig{}, project); err == nil {
+				t.Errorf("loadPresets(%q: %+v) expected error, got nil", tc.name, tc.preset)
+			}
+		})
+	}
+
+	families := []struct {
+		name     string
+		variants []string
+	}{
+		{"empty", nil},
+		{"unknown", []string{"ig-post", "nope"}},
+		{"nested", []string{"ig-post", "ig-auto"}},
+		{"1x2", []string{"ig-post"}},
+	}
+	for _, tc := range families {
+		t.Run("family "+tc.name, func(t *testing.T) {
+			user := &config.UserConfig{Families: map[string][]string{tc.name: tc.variants}}
+			if err := loadPresets(user, &config.ProjectConfig{}); err == nil {
+				t.Errorf("loadPresets(family %q: %v) expected error, got nil", tc.name, tc.variants)
+			}
+		})
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		hasErr   bool
+	}{
+		{"1024", 1024, false},
+		{"500KB", 500_000, false},
+		{"8MB", 8_000_000, false},
+		{"8 mb", 8_000_000, false},
+		{"1.5MB", 1_500_000, false},
+		{"2MiB", 2 << 20, false},
+		{"64KiB", 64 << 10, false},
+		{"1GB", 1_000_000_000, false},
+		{"300k", 300_000, false},
+		{"", 0, true},
+		{"MB", 0, true},
+		{"-1MB", 0, true},
+		{"lots", 0, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := parseByteSize(tc.input)
+			if tc.hasErr {
+				if err == nil {
+					t.Errorf("parseByteSize(%q) expected error, got %d", tc.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseByteSize(%q) failed: %v", tc.input, err)
+			}
+			if got != tc.expected {
+				t.Errorf("parseByteSize(%q) = %d, expected %d", tc.input, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	tests := []struct {
+		input    int64
+		expected string
+	}{
+		{8_000_000, "8MB"},
+		{2 << 20, "2MiB"},
+		{500_000, "500KB"},
+		{3072, "3KiB"},
+		{1500, "1500B"},
+	}
+
+	for _, tc := range tests {
+		if got := formatByteSize(tc.input); got != tc.expected {
+			t.Errorf("formatByteSize(%d) = %q, expected %q", tc.input, got, tc.expected)
+		}
+	}
+}
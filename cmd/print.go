@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	imglib "github.com/cwygoda/ansel/internal/image"
+)
+
+// defaultPrintDPI is the resolution of the built-in print presets and of
+// print sizes given without one.
+const defaultPrintDPI = 300
+
+// unitsPerInch are the physical units accepted in print sizes and lengths.
+var unitsPerInch = map[string]float64{
+	"mm": 25.4,
+	"cm": 2.54,
+	"in": 1,
+}
+
+// printSizeRegex matches the size part of a print size, e.g. "13x18cm",
+// "5x7in" or "1800x1200" (which needs a resolution).
+var printSizeRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?)x(\d+(?:\.\d+)?)(mm|cm|in)?$`)
+
+// parsePrintSize parses a size with physical units or a resolution, such as
+// "13x18cm@360dpi", "5x7in", "1800x1200@300dpi" or "8x10@360dpi" (a print
+// preset at another resolution). Returns false if s is neither. Physical
+// sizes without a resolution are printed at defaultPrintDPI, and turn to
+// each image's orientation like the print presets.
+func parsePrintSize(s string) (outputSize, bool, error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	base, res, hasDPI := strings.Cut(s, "@")
+
+	dpi := float64(defaultPrintDPI)
+	if hasDPI {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSuffix(res, "dpi"), "ppi"), 64)
+		if err != nil || v <= 0 || math.IsInf(v, 0) {
+			return outputSize{}, false, fmt.Errorf("invalid resolution in size %q", s)
+		}
+		dpi = v
+	}
+	name := base
+	if hasDPI {
+		name = fmt.Sprintf("%s@%gdpi", base, dpi)
+	}
+
+	// A print preset keeps its physical size at the new resolution
+	if p, ok := presets[base]; ok && hasDPI {
+		if p.DPI == 0 || len(p.Variants) > 0 {
+			return outputSize{}, false, fmt.Errorf("invalid size %q: preset %s has no print resolution", s, base)
+		}
+		scale := dpi / p.DPI
+		size := outputSize{
+			name:   name,
+			width:  int(math.Round(float64(p.Width) * scale)),
+			height: int(math.Round(float64(p.Height) * scale)),
+			rotate: p.Rotate,
+			dpi:    dpi,
+		}
+		return size, true, nil
+	}
+
+	m := printSizeRegex.FindStringSubmatch(base)
+	unit := ""
+	if m != nil {
+		unit = m[3]
+	}
+	if unit == "" && !hasDPI {
+		return outputSize{}, false, nil
+	}
+	if m == nil {
+		return outputSize{}, false, fmt.Errorf("invalid size %q (use e.g. 13x18cm@300dpi)", s)
+	}
+
+	// Pixel sizes only get the resolution tag
+	if unit == "" {
+		width, errW := strconv.Atoi(m[1])
+		height, errH := strconv.Atoi(m[2])
+		if errW != nil || errH != nil || width <= 0 || height <= 0 {
+			return outputSize{}, false, fmt.Errorf("invalid size %q: pixel sizes must be whole numbers", s)
+		}
+		return outputSize{name: name, width: width, height: height, dpi: dpi}, true, nil
+	}
+
+	w, _ := strconv.ParseFloat(m[1], 64)
+	h, _ := strconv.ParseFloat(m[2], 64)
+	size := outputSize{
+		name:   name,
+		width:  int(math.Round(w / unitsPerInch[unit] * dpi)),
+		height: int(math.Round(h / unitsPerInch[unit] * dpi)),
+		rotate: true,
+		dpi:    dpi,
+	}
+	if size.width <= 0 || size.height <= 0 {
+		return outputSize{}, false, fmt.Errorf("invalid size %q: too small at %g dpi", s, dpi)
+	}
+	return size, true, nil
+}
+
+// printLength is a distance on a print, such as "3mm", "0.125in" or "36px".
+type printLength struct {
+	value float64
+	unit  string // mm, cm, in or px
+}
+
+// parsePrintLength parses a length for --bleed and --safe-margin. Numbers
+// without a unit are millimetres.
+func parsePrintLength(s string) (printLength, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	unit := "mm"
+	for _, u := range []string{"mm", "cm", "in", "px"} {
+		if v, ok := strings.CutSuffix(value, u); ok {
+			value, unit = strings.TrimSpace(v), u
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) {
+		return printLength{}, fmt.Errorf("invalid length: %s (use e.g. 3mm, 0.125in or 36px)", s)
+	}
+	return printLength{value: n, unit: unit}, nil
+}
+
+// pixels returns the length in pixels at dpi. Physical lengths need a
+// resolution.
+func (l printLength) pixels(dpi float64) (int, error) {
+	switch {
+	case l.value == 0:
+		return 0, nil
+	case l.unit == "px":
+		return int(math.Round(l.value)), nil
+	case dpi <= 0:
+		return 0, fmt.Errorf("%s needs a print size with a resolution, e.g. 13x18cm@300dpi, or a length in px", l)
+	}
+	return int(math.Round(l.value / unitsPerInch[l.unit] * dpi)), nil
+}
+
+// String returns the length with its unit.
+func (l printLength) String() string {
+	return strconv.FormatFloat(l.value, 'g', -1, 64) + l.unit
+}
+
+// setPrintMargins converts the bleed and safe margin to pixels for size and
+// its variants.
+func setPrintMargins(size *outputSize, bleed, safeMargin printLength) error {
+	if len(size.variants) > 0 {
+		for i := range size.variants {
+			if err := setPrintMargins(&size.variants[i], bleed, safeMargin); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if size.bleedPx, err = bleed.pixels(size.dpi); err != nil {
+		return fmt.Errorf("--bleed for size %s: %w", size.name, err)
+	}
+	if size.safeMarginPx, err = safeMargin.pixels(size.dpi); err != nil {
+		return fmt.Errorf("--safe-margin for size %s: %w", size.name, err)
+	}
+	if 2*size.safeMarginPx >= size.shorterSide() {
+		return fmt.Errorf("--safe-margin %s is too large for size %s", safeMargin, size.name)
+	}
+	return nil
+}
+
+// frameInsets returns the frame width on each side of an output, widened to
+// the safe margin so that the image stays clear of the trim line.
+func frameInsets(size outputSize, opts *processOptions) imglib.Insets {
+	frame := opts.frameStyle.Insets(size.frameWidthPx)
+	frame.Top = max(frame.Top, size.safeMarginPx)
+	frame.Right = max(frame.Right, size.safeMarginPx)
+	frame.Bottom = max(frame.Bottom, size.safeMarginPx)
+	frame.Left = max(frame.Left, size.safeMarginPx)
+	return frame
+}
+
+// planSize returns the dimensions of the output for a source of the given
+// size without rendering it, including the bleed, and the effective
+// resolution of the source on the print: the source pixels per inch of the
+// printed image. The resolution is 0 for sizes without a DPI.
+func planSize(srcWidth, srcHeight int, size outputSize, opts *processOptions) (width, height int, ppi float64) {
+	frame := frameInsets(size, opts)
+	availWidth := float64(size.width - frame.Left - frame.Right)
+	availHeight := float64(size.height - frame.Top - frame.Bottom)
+	scaleX, scaleY := availWidth/float64(srcWidth), availHeight/float64(srcHeight)
+
+	width, height = size.width, size.height
+	var scale float64
+	switch opts.fit {
+	case "cover":
+		scale = max(scaleX, scaleY)
+	case "wrap":
+		// The frame is added around an image of the full size
+		scale = min(float64(size.width)/float64(srcWidth), float64(size.height)/float64(srcHeight))
+		width = int(math.Round(float64(srcWidth)*scale)) + frame.Left + frame.Right
+		height = int(math.Round(float64(srcHeight)*scale)) + frame.Top + frame.Bottom
+	default:
+		scale = min(scaleX, scaleY)
+	}
+
+	if size.dpi > 0 && scale > 0 {
+		ppi = size.dpi / scale
+	}
+	return width + 2*size.bleedPx, height + 2*size.bleedPx, ppi
+}
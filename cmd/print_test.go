@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"math"
+	"testing"
+
+	imglib "github.com/cwygoda/ansel/internal/image"
+)
+
+func TestParsePrintSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected outputSize
+	}{
+		{"13x18cm@360dpi", outputSize{name: "13x18cm@360dpi", width: 1843, height: 2551, dpi: 360, rotate: true}},
+		{"13x18cm", outputSize{name: "13x18cm", width: 1535, height: 2126, dpi: 300, rotate: true}},
+		{"5x7in@240ppi", outputSize{name: "5x7in@240dpi", width: 1200, height: 1680, dpi: 240, rotate: true}},
+		{"130 x 180 mm @ 300", outputSize{name: "130x180mm@300dpi", width: 1535, height: 2126, dpi: 300, rotate: true}},
+		{"1800x1200@300dpi", outputSize{name: "1800x1200@300dpi", width: 1800, height: 1200, dpi: 300}},
+		{"8x10@360dpi", outputSize{name: "8x10@360dpi", width: 3600, height: 2880, dpi: 360, rotate: true}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			got, ok, err := parsePrintSize(tc.input)
+			if err != nil || !ok {
+				t.Fatalf("parsePrintSize(%q) = %v, %v", tc.input, ok, err)
+			}
+			if got.name != tc.expected.name || got.width != tc.expected.width || got.height != tc.expected.height ||
+				got.dpi != tc.expected.dpi || got.rotate != tc.expected.rotate {
+				t.Errorf("parsePrintSize(%q) = %+v, expected %+v", tc.input, got, tc.expected)
+			}
+		})
+	}
+
+	// Plain pixel sizes and presets are left to the other parsers
+	for _, input := range []string{"1920x1080", "ig-post", "8x10"} {
+		if _, ok, err := parsePrintSize(input); ok || err != nil {
+			t.Errorf("parsePrintSize(%q) = %v, %v; expected not a print size", input, ok, err)
+		}
+	}
+
+	for _, input := range []string{"13x18cm@", "13x18cm@0dpi", "13xcm@300dpi", "12.5x10@300dpi", "ig-post@300dpi", "ig-auto@300dpi", "0.001x1mm"} {
+		if _, _, err := parsePrintSize(input); err == nil {
+			t.Errorf("parsePrintSize(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestParsePrintLength(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int // pixels at 300 dpi
+	}{
+		{"3mm", 35},
+		{"3", 35},
+		{"0.3cm", 35},
+		{"0.125in", 38},
+		{"36px", 36},
+		{"0", 0},
+	}
+	for _, tc := range tests {
+		l, err := parsePrintLength(tc.input)
+		if err != nil {
+			t.Fatalf("parsePrintLength(%q) failed: %v", tc.input, err)
+		}
+		got, err := l.pixels(300)
+		if err != nil {
+			t.Fatalf("pixels(%q) failed: %v", tc.input, err)
+		}
+		if got != tc.expected {
+			t.Errorf("%q at 300 dpi = %dpx, expected %d", tc.input, got, tc.expected)
+		}
+	}
+
+	for _, input := range []string{"", "-3mm", "3pt", "mm"} {
+		if _, err := parsePrintLength(input); err == nil {
+			t.Errorf("parsePrintLength(%q) expected error, got nil", input)
+		}
+	}
+
+	// Physical lengths need a resolution, pixels don't
+	mm, _ := parsePrintLength("3mm")
+	if _, err := mm.pixels(0); err == nil {
+		t.Error("3mm without a resolution expected error, got nil")
+	}
+	px, _ := parsePrintLength("20px")
+	if got, err := px.pixels(0); err != nil || got != 20 {
+		t.Errorf("20px without a resolution = %d, %v", got, err)
+	}
+}
+
+func TestSetPrintMargins(t *testing.T) {
+	bleed, _ := parsePrintLength("3mm")
+	safe, _ := parsePrintLength("5mm")
+
+	size, _, _ := parsePrintSize("13x18cm")
+	if err := setPrintMargins(&size, bleed, safe); err != nil {
+		t.Fatalf("setPrintMargins failed: %v", err)
+	}
+	if size.bleedPx != 35 || size.safeMarginPx != 59 {
+		t.Errorf("bleed, safe margin = %d, %d; expected 35, 59", size.bleedPx, size.safeMarginPx)
+	}
+
+	// Family variants are converted at their own resolution
+	family := outputSize{name: "lab-auto", variants: []outputSize{size, {name: "big", width: 6000, height: 4000, dpi: 600}}}
+	if err := setPrintMargins(&family, bleed, safe); err != nil {
+		t.Fatalf("setPrintMargins(family) failed: %v", err)
+	}
+	if family.variants[1].bleedPx != 71 {
+		t.Errorf("variant bleed = %d, expected 71", family.variants[1].bleedPx)
+	}
+
+	screen, _ := presetSize("ig-post")
+	if err := setPrintMargins(&screen, bleed, printLength{}); err == nil {
+		t.Error("physical bleed on a screen size expected error, got nil")
+	}
+	huge, _ := parsePrintLength("7cm")
+	if err := setPrintMargins(&size, printLength{}, huge); err == nil {
+		t.Error("safe margin larger than the size expected error, got nil")
+	}
+}
+
+func TestPlanSize(t *testing.T) {
+	// A 6000x4000 source on a 6x4in print at 300 dpi
+	size := outputSize{name: "6x4in", width: 1800, height: 1200, dpi: 300, frameWidthPx: 60}
+
+	tests := []struct {
+		name          string
+		fit           string
+		bleed, safe   int
+		width, height int
+		ppi           float64
+	}{
+		// The image fits 1680x1080 inside the frame at 1620x1080, so
+		// 6000px span 5.4in
+		{"expand", "expand", 0, 0, 1800, 1200, 6000.0 / 5.4},
+		{"bleed", "expand", 36, 0, 1872, 1272, 6000.0 / 5.4},
+		// The safe margin widens the frame to 90px, leaving 1530x1020
+		{"safe margin", "expand", 0, 90, 1800, 1200, 6000.0 / 5.1},
+		{"cover", "cover", 0, 0, 1800, 1200, 6000.0 / 5.6},
+		{"wrap", "wrap", 0, 0, 1920, 1320, 6000.0 / 6},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := size
+			s.bleedPx, s.safeMarginPx = tc.bleed, tc.safe
+			opts := &processOptions{fit: tc.fit, frameStyle: imglib.FlatFrameStyle}
+			w, h, ppi := planSize(6000, 4000, s, opts)
+			if w != tc.width || h != tc.height || math.Abs(ppi-tc.ppi) > 0.01 {
+				t.Errorf("planSize = %dx%d at %.1f ppi, expected %dx%d at %.1f ppi", w, h, ppi, tc.width, tc.height, tc.ppi)
+			}
+		})
+	}
+
+	// Screen sizes have no print resolution
+	if _, _, ppi := planSize(6000, 4000, outputSize{width: 1080, height: 1080}, &processOptions{fit: "expand", frameStyle: imglib.FlatFrameStyle}); ppi != 0 {
+		t.Errorf("ppi of a screen size = %v, expected 0", ppi)
+	}
+}
@@ -2,14 +2,19 @@ package cmd
 
 import (
 	"fmt"
+	"image"
+	"math"
 	"os"
-	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/cwygoda/ansel/internal/config"
 	imglib "github.com/cwygoda/ansel/internal/image"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 // Size presets for common platforms
@@ -46,9 +51,29 @@ Output files are created next to the input files with a version suffix:
   photo.jpg → photo_v0.jpg
   photo_v0.jpg → photo_v1.jpg
 
+Existing files are kept and the next free version is written instead, unless
+--overwrite or --skip-existing is given. --name sets a name template, e.g.
+--name "{date}_{base}_{preset}_{w}x{h}"; tokens are {base}, {preset}, {w},
+{h}, {date} (or {date:<Go layout>}), {seq} and {hash8}. Templated names get
+a version suffix only when they are taken.
+
+--cache records outputs in .ansel/cache.json and skips those whose input,
+settings and ansel version are unchanged on later runs. --prune deletes the
+outputs of inputs that were removed since, or changed and rendered again.
+
+--report json or ndjson writes a record per file, with its outputs, sizes,
+hashes, timings and errors, to stdout or --report-file. Progress is written
+to stderr only when it is a terminal; errors always are.
+
 Output size can be specified as:
   - Two numbers: --size 1920x1080 or --size 1920,1080
   - A preset name: --size ig-post, --size ig-story, etc.
+  - A print size in mm, cm or in: --size 13x18cm@360dpi (300 dpi if omitted)
+
+Several sizes can be given as a list (--size ig-post,ig-story,x-post) or by
+repeating --size. Each input is decoded once and one output is written per
+size, named after the preset or WxH size:
+  photo.jpg → photo_ig-post_v0.jpg, photo_ig-story_v0.jpg, ...
 
 Available presets:
   Instagram: ig-post (1080x1080), ig-portrait (1080x1350), ig-landscape (1080x566),
@@ -59,57 +84,321 @@ Available presets:
   LinkedIn:  li-post (1200x627), li-cover (1584x396)
   Print:     4x6 (1800x1200), 5x7 (2100x1500), 8x10 (3000x2400)
 
+  Print sizes rotate to match the orientation of each image, e.g. 4x6 is
+  1200x1800 for a portrait photo. The ig-auto family picks ig-portrait,
+  ig-post or ig-landscape, whichever is closest to the image's aspect ratio
+  (after applying the EXIF orientation). The chosen variant is reported.
+  Custom presets can be defined in configuration files; run "ansel presets"
+  to list all presets.
+
+Print sizes and presets write their resolution to JPEG, TIFF and PNG output.
+--bleed extends the canvas beyond the trim line, and --safe-margin keeps the
+image and label inside it. --dry-run reports the outputs, with the effective
+PPI of the source on each print, without writing them.
+
+Output formats (--format):
+  jpeg (default), png, webp, avif, tiff, jxl, or auto to keep the input
+  format. The output extension follows the format.
+
+Colour management:
+  Images are converted from their embedded ICC profile (sRGB if there is
+  none) to the output profile, which is embedded in the output. Use
+  --output-profile srgb, p3, or the path to an .icc file, and --intent to
+  choose the rendering intent. Colours, of frames, labels and watermarks,
+  are given in sRGB and converted to the output profile.
+
+Metadata (--keep-metadata):
+  - none:      Strip all metadata (default)
+  - copyright: Keep creator, copyright, credit and usage terms only
+  - iptc:      Keep descriptive IPTC/XMP metadata (title, caption, keywords,
+               location, copyright), but no camera EXIF data
+  - all:       Keep all EXIF, IPTC and XMP metadata
+  Use --strip-gps to remove the GPS location from iptc/all output.
+
+Recipes:
+  Options can be saved as named recipes in .ansel.toml (or the user
+  configuration file) and selected with --recipe. Keys are flag names;
+  flags on the command line override them.
+
+    [recipe.instagram]
+    size = ["ig-post", "ig-story"]
+    fit = "cover"
+    frame = 3
+    color = "black"
+    quality = 90
+    outdir = "instagram"
+
 Fit modes:
   - expand: Output is exactly the specified size. Image is resized to fit within
             the frame area and centered. Frame fills remaining space.
   - wrap:   Frame wraps tightly around the resized image. Output size equals
             image size plus frame on all sides.
+  - cover:  Output is exactly the specified size. Image is resized to fill the
+            frame area and the overflow is cropped. --gravity picks the part
+            to keep (centre, edges, corners, or attention/entropy smart crop),
+            --focus x,y keeps an explicit point (fractions of the image).
+
+Frame styles (--frame-style):
+  - flat:     Single layer of --color (default)
+  - keyline:  Thin dark line around the image inside a --color mat
+  - double:   Two thin lines inside a --color mat
+  - gallery:  Keyline and mat with a deeper bottom margin
+  - polaroid: Flat frame with a deep bottom margin
+  - shadow:   Image casting a soft drop shadow onto the mat
+  Custom styles are defined as [frame.<name>] tables in the configuration,
+  with lengths relative to --frame:
+
+    [frame.museum]
+    layers = [{ width = 1, color = "#222" }, { width = 9 }]  # image outwards
+    sides = [1, 1, 1.4, 1]                                   # top, right, bottom, left
+    radius = 0.3
+    shadow = { blur = 0.1, offset = [0.05, 0.1], opacity = 0.4 }
+
+Automatic colours (--color):
+  Instead of a fixed colour, the frame colour can be derived from each
+  image's palette (see "ansel palette"):
+  - auto:            The image's dominant colour
+  - auto-dark:       A deep shade of the dominant hue
+  - auto-light:      A pale tint of the dominant hue
+  - auto-complement: A muted colour opposite the dominant hue
+
+Labels (--label, --label-template):
+  --label adds the photo's headline below the image. --label-template sets
+  the text from the photo's metadata (embedded EXIF, IPTC and XMP, XMP and
+  DxO PhotoLab sidecars) with Go template syntax. Fields: .Title, .Headline,
+  .Caption, .Creator, .Copyright, .Keywords, .Location, .City, .State,
+  .Country, .Camera, .Make, .Model, .Lens, .FocalLength, .FNumber,
+  .ExposureTime, .ISO, .Filename and .Date "layout". Missing fields are empty;
+  {{.Title | default .Filename}} gives a fallback and {{with .City}}...{{end}}
+  leaves out a part.
+
+  --label-placement puts the label below or above the image, inside (centred
+  in the frame below the image) or overlay (on the image). --label-align
+  lines it up with the left or right edge of the image or centres it. Long
+  labels wrap to --label-max-lines lines and end in an ellipsis. The text is
+  drawn in --label-color on a --label-background box, which may be
+  translucent (#rrggbbaa) or transparent.
+
+  --label-fontfile loads a TTF or OTF font without installing it and uses
+  it unless --label-font names another face. Right-to-left text and emoji
+  are laid out by Pango; emoji missing from the font come from other fonts.
+
+Watermarks (--watermark):
+  --watermark stamps a logo file (PNG, SVG, ...) or text:<template> on each
+  output, at --watermark-position inside the image, or centred in the frame
+  on that side with --watermark-on frame. Its width (--watermark-scale) and
+  margin scale with the shorter side. --watermark-mode tile repeats it in a
+  grid, and diagonal in a grid along the diagonal.
+
+Backgrounds (--background):
+  - color:        Fill the frame with --color (default)
+  - blur:         Fill it with the image itself, scaled to cover the output
+                  and blurred by --background-blur (percent of shorter side)
+  - image:<path>: Fill it with another image, scaled to cover the output
+  The background is built in linear light and darkened by --background-dim
+  before the image is composited on top. Inner frame layers are drawn over it.
 
 Examples:
   # Process a single image for Instagram
   ansel process --size ig-post photo.jpg
 
+  # Instagram post, story and X versions in one run
+  ansel process --size ig-post,ig-story,x-post photo.jpg
+
   # Process multiple images with black frame
   ansel process --size 1920x1080 --color black *.jpg
 
+  # Frame each image in a dark shade of its own dominant colour
+  ansel process --size ig-post --color auto-dark *.jpg
+
   # Wrap mode with 3% frame
-  ansel process --size 800x600 --fit wrap --frame 3 photo.jpg`,
+  ansel process --size 800x600 --fit wrap --frame 3 photo.jpg
+
+  # Caption each print with its title, camera and year
+  ansel process --size 8x10 --label-template '{{.Title}} — {{.Camera}}, {{.Date "2006"}}' photo.jpg
+
+  # White caption on a translucent band over the image
+  ansel process --size ig-post --frame 0 --label --label-placement overlay --label-align centre --label-color white --label-background "#00000080" photo.jpg
+
+  # Copyright notice from the photo's metadata in the bottom frame margin
+  ansel process --size 8x10 --frame 8 --watermark 'text:© {{.Creator}}' --watermark-on frame --watermark-position south photo.jpg
+
+  # Gallery mat with a keyline and a deeper bottom margin
+  ansel process --size 8x10 --frame 10 --frame-style gallery --color "#f5f3ee" photo.jpg
+
+  # Letterbox a photo in a story over a blurred copy of itself
+  ansel process --size ig-story --frame 0 --background blur --background-dim 0.2 photo.jpg
+
+  # Fill an Instagram story, keeping the most interesting part
+  ansel process --size ig-story --fit cover --gravity attention photo.jpg
+
+  # 13x18 cm print with bleed, checking the source resolution first
+  ansel process --size 13x18cm@360dpi --bleed 3mm --safe-margin 5mm --dry-run photo.jpg
+
+  # Print with sharpening for matte paper
+  ansel process --size 8x10 --sharpen matte photo.tif
+
+  # Stay under the 1 MB upload limit of a CMS, lowering the quality as needed
+  ansel process --size 1920x1080 --max-bytes 1MB photo.jpg
+
+  # Use the "instagram" recipe, but with a white frame
+  ansel process --recipe instagram --color white *.jpg
+
+  # JPEG for a print lab: 4:4:4 colour, baseline scans
+  ansel process --size 8x10 --format jpeg --jpeg-defaults print photo.jpg
+
+  # AVIF output at 10-bit depth
+  ansel process --size ig-post --format avif --avif-depth 10 photo.jpg
+
+  # Wide-gamut output for displays that support Display P3
+  ansel process --size ig-post --output-profile p3 photo.jpg
+
+  # Keep captions and copyright, but not the location
+  ansel process --size ig-post --keep-metadata all --strip-gps photo.jpg
+
+  # Process a whole shoot using 4 parallel workers
+  ansel process --size ig-post --jobs 4 *.jpg`,
 	Args: cobra.MinimumNArgs(1),
 	RunE: runProcess,
 }
 
 var (
-	processSize         string
-	processFilter       string
-	processFit          string
-	processFrame        float64
-	processColor        string
-	processQuality      int
-	processOutDir       string
-	processLabel        bool
-	processLabelFont    string
-	processLabelSize    float64
-	processLabelPadding float64
+	processSize            []string
+	processRecipe          string
+	processFilter          string
+	processSharpen         string
+	processFit             string
+	processFrame           float64
+	processFrameStyle      string
+	processColor           string
+	processBackground      string
+	processBackgroundBlur  float64
+	processBackgroundDim   float64
+	processQuality         int
+	processMaxBytes        string
+	processOutDir          string
+	processLabel           bool
+	processLabelTemplate   string
+	processLabelFont       string
+	processLabelFontFile   string
+	processLabelSize       float64
+	processLabelPadding    float64
+	processLabelAlign      string
+	processLabelPlacement  string
+	processLabelColor      string
+	processLabelBackground string
+	processLabelMaxLines   int
+	processWatermark       string
+	processWatermarkPos    string
+	processWatermarkMargin float64
+	processWatermarkScale  float64
+	processWatermarkAlpha  float64
+	processWatermarkBlend  string
+	processWatermarkMode   string
+	processWatermarkOn     string
+	processWatermarkFont   string
+	processWatermarkColor  string
+	processJobs            int
+	processJPEG            jpegFlags
+	processColorspace      string
+	processKeepMetadata    string
+	processStripGPS        bool
+	processProfile         string
+	processIntent          string
+	processGravity         string
+	processFocus           string
+	processBleed           string
+	processSafeMargin      string
+	processDryRun          bool
+	processName            string
+	processOverwrite       bool
+	processSkipExisting    bool
+	processUseCache        bool
+	processPrune           bool
+	processReport          string
+	processReportFile      string
+
+	processFormat          string
+	processWebPLossless    bool
+	processWebPEffort      int
+	processAVIFSpeed       int
+	processAVIFDepth       int
+	processPNGPalette      bool
+	processTIFFCompression string
+	processJXLDistance     float64
 )
 
 func init() {
 	rootCmd.AddCommand(processCmd)
 
-	processCmd.Flags().StringVar(&processSize, "size", "", "Output size: WxH, W,H, or preset name (required)")
+	processCmd.Flags().StringVar(&processRecipe, "recipe", "", "Named recipe from the configuration to take defaults from")
+	processCmd.Flags().StringArrayVar(&processSize, "size", nil, "Output size: WxH, W,H, or preset name; repeat or separate with commas for several (required unless set by --recipe)")
 	processCmd.Flags().StringVar(&processFilter, "filter", "mks2021", "Resize filter: lanczos, catmull-rom, bilinear, mks2021")
-	processCmd.Flags().StringVar(&processFit, "fit", "expand", "Fit mode: expand or wrap")
+	processCmd.Flags().StringVar(&processSharpen, "sharpen", "none", "Output sharpening after resizing: screen-low, screen-high, matte, glossy, custom(radius,amount,threshold) or none")
+	processCmd.Flags().StringVar(&processColorspace, "colorspace", "linear", "Resize colorspace: linear or srgb")
+	processCmd.Flags().StringVar(&processProfile, "output-profile", "srgb", "Output ICC profile: srgb, p3, or path to an .icc file")
+	processCmd.Flags().StringVar(&processIntent, "intent", "relative", "Rendering intent: relative, perceptual, saturation, absolute")
+	processCmd.Flags().StringVar(&processFit, "fit", "expand", "Fit mode: expand, wrap or cover")
+	processCmd.Flags().StringVar(&processGravity, "gravity", "centre", "Crop gravity for --fit cover: centre, north, south, east, west, northeast, northwest, southeast, southwest, attention, entropy")
+	processCmd.Flags().StringVar(&processFocus, "focus", "", "Focus point for --fit cover as x,y fractions of the image (e.g. 0.5,0.3)")
 	processCmd.Flags().Float64Var(&processFrame, "frame", 5, "Frame width as percentage of shorter side")
-	processCmd.Flags().StringVar(&processColor, "color", "#fff", "Frame color (hex or named)")
-	processCmd.Flags().IntVar(&processQuality, "quality", 92, "JPEG quality (1-100)")
+	processCmd.Flags().StringVar(&processColor, "color", "#fff", "Frame color (hex or named), or auto, auto-dark, auto-light, auto-complement to derive it from each image")
+	processCmd.Flags().StringVar(&processFrameStyle, "frame-style", "flat", "Frame style: flat, keyline, double, gallery, polaroid, shadow, or a style from the configuration")
+	processCmd.Flags().StringVar(&processBackground, "background", "color", "Frame fill: color, blur (the image itself, blurred) or image:<path>")
+	processCmd.Flags().Float64Var(&processBackgroundBlur, "background-blur", 4, "Background blur as percentage of shorter side (image backgrounds are only blurred if set)")
+	processCmd.Flags().Float64Var(&processBackgroundDim, "background-dim", 0, "Darken the background by this fraction (0-1)")
+	processCmd.Flags().IntVar(&processQuality, "quality", 92, "Output quality for lossy formats (1-100)")
+	processCmd.Flags().StringVar(&processMaxBytes, "max-bytes", "", "Keep each output under this file size, e.g. 1MB, lowering the quality as needed (default: the size preset's limit; none to ignore it)")
 	processCmd.Flags().StringVarP(&processOutDir, "outdir", "o", "", "Output directory (created if needed)")
+	processCmd.Flags().StringVar(&processBleed, "bleed", "0", "Bleed added around print sizes beyond the trim line, e.g. 3mm, 0.125in or 36px")
+	processCmd.Flags().StringVar(&processSafeMargin, "safe-margin", "0", "Keep the image and label this far inside the trim line, e.g. 5mm")
+	processCmd.Flags().StringVar(&processName, "name", "", "Output file name template without extension: {base}, {preset}, {w}, {h}, {date}, {date:<Go layout>}, {seq}, {hash8}")
+	processCmd.Flags().BoolVar(&processOverwrite, "overwrite", false, "Replace existing output files instead of writing the next free version")
+	processCmd.Flags().BoolVar(&processSkipExisting, "skip-existing", false, "Leave existing output files alone and skip those outputs")
+	processCmd.Flags().BoolVar(&processUseCache, "cache", false, "Skip outputs whose input and settings are unchanged since an earlier run (cached in .ansel/cache.json)")
+	processCmd.Flags().BoolVar(&processPrune, "prune", false, "Delete cached outputs of removed inputs, and of changed inputs rendered again (implies --cache)")
+	processCmd.Flags().StringVar(&processReport, "report", "", "Write a machine-readable report of each file: json or ndjson")
+	processCmd.Flags().StringVar(&processReportFile, "report-file", "", "Write the report to this file instead of stdout")
+	processCmd.Flags().BoolVar(&processDryRun, "dry-run", false, "Report output sizes and the effective PPI of each source without writing files")
+	processCmd.Flags().IntVarP(&processJobs, "jobs", "j", runtime.NumCPU(), "Number of images to process in parallel")
+	processCmd.Flags().StringVar(&processKeepMetadata, "keep-metadata", "none", "Metadata to keep: none, copyright, iptc, all")
+	processCmd.Flags().BoolVar(&processStripGPS, "strip-gps", false, "Remove GPS location even when keeping metadata")
+
+	// Output format flags
+	processCmd.Flags().StringVar(&processFormat, "format", "jpeg", "Output format: jpeg, png, webp, avif, tiff, jxl, or auto (keep input format)")
+	processCmd.Flags().BoolVar(&processWebPLossless, "webp-lossless", false, "Use lossless WebP encoding")
+	processCmd.Flags().IntVar(&processWebPEffort, "webp-effort", 4, "WebP CPU effort (0-6, higher is smaller and slower)")
+	processCmd.Flags().IntVar(&processAVIFSpeed, "avif-speed", 4, "AVIF encoder speed (0-9, higher is faster and larger)")
+	processCmd.Flags().IntVar(&processAVIFDepth, "avif-depth", 8, "AVIF bit depth: 8, 10 or 12")
+	processCmd.Flags().BoolVar(&processPNGPalette, "png-palette", false, "Quantise PNG output to an 8-bit palette")
+	processCmd.Flags().StringVar(&processTIFFCompression, "tiff-compression", "deflate", "TIFF compression: deflate, lzw, zstd, jpeg, webp, packbits, none")
+	processCmd.Flags().Float64Var(&processJXLDistance, "jxl-distance", 0, "JPEG XL distance (0.1-15, lower is better; 0 derives it from --quality)")
+	processJPEG.register(processCmd.Flags())
 
 	// Label flags
 	processCmd.Flags().BoolVar(&processLabel, "label", false, "Add IPTC headline as text label")
+	processCmd.Flags().StringVar(&processLabelTemplate, "label-template", "", "Label text template using photo metadata, e.g. '{{.Title}} — {{.Camera}}' (implies --label)")
 	processCmd.Flags().StringVar(&processLabelFont, "label-font", "sans", "Font family for label")
+	processCmd.Flags().StringVar(&processLabelFontFile, "label-fontfile", "", "TrueType or OpenType font file for the label; selects its font unless --label-font is given")
 	processCmd.Flags().Float64Var(&processLabelSize, "label-size", 1.5, "Label font size as percentage of shorter side")
 	processCmd.Flags().Float64Var(&processLabelPadding, "label-padding", 1, "Padding between image and label as percentage of shorter side")
+	processCmd.Flags().StringVar(&processLabelAlign, "label-align", "left", "Label alignment: left, centre or right")
+	processCmd.Flags().StringVar(&processLabelPlacement, "label-placement", "below", "Label placement: below, above, inside (centred in the frame below the image) or overlay (on the image)")
+	processCmd.Flags().StringVar(&processLabelColor, "label-color", "#000", "Label text color (hex or named)")
+	processCmd.Flags().StringVar(&processLabelBackground, "label-background", "#fff", "Label background color (hex or named, #rrggbbaa for translucent, or transparent)")
+	processCmd.Flags().IntVar(&processLabelMaxLines, "label-max-lines", 1, "Wrap the label to at most this many lines, truncating with an ellipsis (0 for no limit)")
 
-	processCmd.MarkFlagRequired("size")
+	// Watermark flags
+	processCmd.Flags().StringVar(&processWatermark, "watermark", "", "Logo file (PNG, SVG, ...) or text:<template> to stamp on each output")
+	processCmd.Flags().StringVar(&processWatermarkPos, "watermark-position", "southeast", "Watermark position: centre, north, south, east, west, northeast, northwest, southeast, southwest")
+	processCmd.Flags().Float64Var(&processWatermarkMargin, "watermark-margin", 2, "Watermark distance from the edge (and gap between tiles) as percentage of shorter side")
+	processCmd.Flags().Float64Var(&processWatermarkScale, "watermark-scale", 15, "Watermark width as percentage of shorter side")
+	processCmd.Flags().Float64Var(&processWatermarkAlpha, "watermark-opacity", 0.5, "Watermark opacity (0-1)")
+	processCmd.Flags().StringVar(&processWatermarkBlend, "watermark-blend", "over", "Watermark blend mode: over, multiply, screen, overlay, soft-light, difference")
+	processCmd.Flags().StringVar(&processWatermarkMode, "watermark-mode", "single", "Watermark mode: single, tile or diagonal")
+	processCmd.Flags().StringVar(&processWatermarkOn, "watermark-on", "image", "Place the watermark on the image or on the frame")
+	processCmd.Flags().StringVar(&processWatermarkFont, "watermark-font", "sans bold", "Font for text watermarks")
+	processCmd.Flags().StringVar(&processWatermarkColor, "watermark-color", "#fff", "Color of text watermarks (hex or named)")
 }
 
 func runProcess(cmd *cobra.Command, args []string) error {
@@ -117,8 +406,35 @@ func runProcess(cmd *cobra.Command, args []string) error {
 	imglib.InitVips()
 	defer imglib.ShutdownVips()
 
-	// Parse output size
-	targetWidth, targetHeight, err := parseSize(processSize)
+	// Load presets and recipes from the user and project configuration
+	userCfg, err := config.LoadUserConfig()
+	if err != nil {
+		return err
+	}
+	projectCfg, err := config.LoadProjectConfig()
+	if err != nil {
+		return err
+	}
+	if err := loadPresets(userCfg, projectCfg); err != nil {
+		return err
+	}
+
+	// Apply the recipe first; flags given on the command line override it
+	var fromRecipe recipeFlags
+	if processRecipe != "" {
+		recipes := mergeRecipes(userCfg.Recipes, projectCfg.Recipes)
+		if fromRecipe, err = applyRecipe(cmd.Flags(), processRecipe, recipes); err != nil {
+			return err
+		}
+	}
+
+	// Size is required, but may come from the recipe
+	if len(processSize) == 0 {
+		return fmt.Errorf(`required flag "size" not set`)
+	}
+
+	// Parse output sizes
+	sizes, err := parseSizes(processSize)
 	if err != nil {
 		return err
 	}
@@ -129,80 +445,766 @@ func runProcess(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// Parse color
-	frameColor, err := imglib.ParseColor(processColor)
+	// Parse output sharpening
+	sharpen, err := imglib.ParseSharpen(processSharpen)
+	if err != nil {
+		return err
+	}
+
+	// Parse resize colorspace
+	colorspace, err := imglib.ParseColorspace(processColorspace)
+	if err != nil {
+		return err
+	}
+
+	// Parse colour management settings
+	outputProfile, err := imglib.ParseOutputProfile(processProfile)
+	if err != nil {
+		return err
+	}
+	intent, err := imglib.ParseRenderingIntent(processIntent)
+	if err != nil {
+		return err
+	}
+
+	// Parse crop settings for cover mode; --focus and --gravity on the
+	// command line replace the other from the recipe
+	focus := processFocus
+	if fromRecipe.overrides(cmd.Flags(), "gravity", "focus") {
+		focus = ""
+	}
+	gravitySet := cmd.Flags().Changed("gravity") && !fromRecipe.overrides(cmd.Flags(), "focus", "gravity")
+	crop, err := parseCropOptions(processGravity, focus, gravitySet)
+	if err != nil {
+		return err
+	}
+
+	// Parse color; automatic colours are picked per image
+	var frameColor imglib.Color
+	autoColor, isAuto := imglib.ParseAutoColor(processColor)
+	if !isAuto {
+		frameColor, err = imglib.ParseColor(processColor)
+		if err != nil {
+			return fmt.Errorf("invalid color: %w", err)
+		}
+		if frameColor, err = imglib.ConvertColor(frameColor, outputProfile, intent); err != nil {
+			return fmt.Errorf("invalid color: %w", err)
+		}
+	}
+
+	// Resolve the frame style
+	styles, err := loadFrameStyles(userCfg.Frames, projectCfg.Frames, outputProfile, intent)
+	if err != nil {
+		return err
+	}
+	frameStyle, err := lookupFrameStyle(processFrameStyle, styles)
+	if err != nil {
+		return err
+	}
+
+	// Labels show the headline unless a template is given
+	var labelTemplate *imglib.LabelTemplate
+	if processLabel || processLabelTemplate != "" {
+		text := processLabelTemplate
+		if text == "" {
+			text = defaultLabelTemplate
+		}
+		labelTemplate, err = imglib.ParseLabelTemplate(text)
+		if err != nil {
+			return err
+		}
+	}
+	// A font file is used by name unless --label-font picks another face
+	labelFont := processLabelFont
+	if processLabelFontFile != "" {
+		name, err := imglib.FontName(processLabelFontFile)
+		if err != nil {
+			return fmt.Errorf("invalid label font file: %w", err)
+		}
+		if !cmd.Flags().Changed("label-font") || fromRecipe.overrides(cmd.Flags(), "label-font-file", "label-font") {
+			labelFont = name
+		}
+	}
+	labelAlign, err := imglib.ParseLabelAlign(processLabelAlign)
+	if err != nil {
+		return err
+	}
+	labelPlacement, err := imglib.ParseLabelPlacement(processLabelPlacement)
+	if err != nil {
+		return err
+	}
+	labelColor, err := imglib.ParseColor(processLabelColor)
+	if err != nil {
+		return fmt.Errorf("invalid label color: %w", err)
+	}
+	labelBackground, err := imglib.ParseColor(processLabelBackground)
+	if err != nil {
+		return fmt.Errorf("invalid label background: %w", err)
+	}
+	if processLabelMaxLines < 0 {
+		return fmt.Errorf("invalid label max lines: %d (must not be negative)", processLabelMaxLines)
+	}
+
+	// Watermarks are a logo file or a template like the label
+	var watermark *imglib.Watermark
+	var watermarkTemplate *imglib.LabelTemplate
+	if processWatermark != "" {
+		wm, err := imglib.ParseWatermark(processWatermark)
+		if err != nil {
+			return err
+		}
+		if wm.Path != "" {
+			if _, err := os.Stat(wm.Path); err != nil {
+				return fmt.Errorf("invalid watermark: %w", err)
+			}
+		} else {
+			watermarkTemplate, err = imglib.ParseLabelTemplate(wm.Text)
+			if err != nil {
+				return fmt.Errorf("watermark: %w", err)
+			}
+		}
+		watermark = &wm
+	}
+	watermarkStyle, err := parseWatermarkStyle(processWatermarkPos, processWatermarkMode, processWatermarkBlend, processWatermarkOn, processWatermarkAlpha)
+	if err != nil {
+		return err
+	}
+	if processWatermarkScale <= 0 || processWatermarkMargin < 0 {
+		return fmt.Errorf("invalid watermark scale or margin: %g, %g (scale must be positive, margin not negative)", processWatermarkScale, processWatermarkMargin)
+	}
+	watermarkColor, err := imglib.ParseColor(processWatermarkColor)
+	if err != nil {
+		return fmt.Errorf("invalid watermark color: %w", err)
+	}
+
+	// Colours are given in sRGB and painted into pixels in the output profile
+	for _, c := range []*imglib.Color{&labelColor, &labelBackground, &watermarkColor} {
+		if *c, err = imglib.ConvertColor(*c, outputProfile, intent); err != nil {
+			return err
+		}
+	}
+
+	// Parse background; image backgrounds are only blurred on request
+	background, err := imglib.ParseBackground(processBackground)
+	if err != nil {
+		return err
+	}
+	if processBackgroundDim < 0 || processBackgroundDim > 1 {
+		return fmt.Errorf("invalid background dim: %g (must be 0-1)", processBackgroundDim)
+	}
+	if processBackgroundBlur < 0 {
+		return fmt.Errorf("invalid background blur: %g (must not be negative)", processBackgroundBlur)
+	}
+	backgroundBlur := processBackgroundBlur
+	// A blur set by the recipe for another background doesn't apply to a
+	// --background image given on the command line
+	if background.Mode == imglib.BackgroundImage &&
+		(!cmd.Flags().Changed("background-blur") || fromRecipe.overrides(cmd.Flags(), "background", "background-blur")) {
+		backgroundBlur = 0
+	}
+
+	// Parse output format ("auto" is resolved per input file)
+	var format imglib.Format
+	autoFormat := strings.EqualFold(processFormat, "auto")
+	if !autoFormat {
+		format, err = imglib.ParseFormat(processFormat)
+		if err != nil {
+			return err
+		}
+	}
+
+	tiffCompression, err := imglib.ParseTiffCompression(processTIFFCompression)
+	if err != nil {
+		return err
+	}
+
+	metadataPolicy, err := imglib.ParseMetadataPolicy(processKeepMetadata)
 	if err != nil {
-		return fmt.Errorf("invalid color: %w", err)
+		return err
+	}
+
+	encode := imglib.EncodeOptions{
+		Quality:         processQuality,
+		WebPLossless:    processWebPLossless,
+		WebPEffort:      processWebPEffort,
+		AVIFSpeed:       processAVIFSpeed,
+		AVIFBitDepth:    processAVIFDepth,
+		PNGPalette:      processPNGPalette,
+		TIFFCompression: tiffCompression,
+		JXLDistance:     processJXLDistance,
+	}
+	if err := processJPEG.apply(cmd.Flags(), &encode); err != nil {
+		return err
+	}
+	if err := encode.Validate(); err != nil {
+		return err
+	}
+
+	// A byte budget on the command line replaces those of the presets
+	maxBytes, hasMaxBytes, err := parseMaxBytes(processMaxBytes)
+	if err != nil {
+		return err
+	}
+	if hasMaxBytes {
+		for i := range sizes {
+			setMaxBytes(&sizes[i], maxBytes)
+		}
 	}
 
 	// Create output directory if specified
-	if processOutDir != "" {
+	if processOutDir != "" && !processDryRun {
 		if err := os.MkdirAll(processOutDir, 0755); err != nil {
 			return fmt.Errorf("failed to create output directory: %w", err)
 		}
 	}
 
+	// Output names come from the template, and existing files are kept
+	// unless requested otherwise
+	var nameTmpl *nameTemplate
+	if processName != "" {
+		if nameTmpl, err = parseNameTemplate(processName); err != nil {
+			return err
+		}
+	}
+	overwrite := processOverwrite && !fromRecipe.overrides(cmd.Flags(), "skip-existing", "overwrite")
+	skipExisting := processSkipExisting && !fromRecipe.overrides(cmd.Flags(), "overwrite", "skip-existing")
+	existing := existingNextVersion
+	switch {
+	case overwrite && skipExisting:
+		return fmt.Errorf("--overwrite and --skip-existing are mutually exclusive")
+	case overwrite:
+		existing = existingOverwrite
+	case skipExisting:
+		existing = existingSkip
+	}
+	seq := make(map[string]int, len(args))
+	for i, input := range args {
+		if _, ok := seq[input]; !ok {
+			seq[input] = i + 1
+		}
+	}
+
+	reportFmt, err := parseReportFormat(processReport)
+	if err != nil {
+		return err
+	}
+	if processReportFile != "" && reportFmt == reportNone {
+		return fmt.Errorf("--report-file needs --report json or ndjson")
+	}
+
+	if processJobs < 1 {
+		return fmt.Errorf("invalid jobs: %d (must be at least 1)", processJobs)
+	}
+
 	// Calculate frame width in pixels (percentage of shorter output side)
-	shorterSide := targetWidth
-	if targetHeight < targetWidth {
-		shorterSide = targetHeight
+	for i := range sizes {
+		sizes[i].frameWidthPx = int(float64(sizes[i].shorterSide()) * processFrame / 100.0)
+		for j := range sizes[i].variants {
+			v := &sizes[i].variants[j]
+			v.frameWidthPx = int(float64(v.shorterSide()) * processFrame / 100.0)
+		}
 	}
-	frameWidthPx := int(float64(shorterSide) * processFrame / 100.0)
 
-	// Process each input file
-	for _, inputPath := range args {
-		if err := processFile(inputPath, targetWidth, targetHeight, frameWidthPx, frameColor, filter); err != nil {
-			fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", inputPath, err)
+	// Convert the bleed and safe margin at each size's print resolution
+	bleed, err := parsePrintLength(processBleed)
+	if err != nil {
+		return fmt.Errorf("invalid bleed: %w", err)
+	}
+	safeMargin, err := parsePrintLength(processSafeMargin)
+	if err != nil {
+		return fmt.Errorf("invalid safe margin: %w", err)
+	}
+	for i := range sizes {
+		if err := setPrintMargins(&sizes[i], bleed, safeMargin); err != nil {
+			return err
+		}
+	}
+
+	opts := &processOptions{
+		sizes:           sizes,
+		frameColor:      frameColor,
+		autoColor:       autoColor,
+		frameStyle:      frameStyle,
+		background:      background,
+		backgroundBlur:  backgroundBlur,
+		backgroundDim:   processBackgroundDim,
+		filter:          filter,
+		sharpen:         sharpen,
+		colorspace:      colorspace,
+		profile:         outputProfile,
+		intent:          intent,
+		fit:             processFit,
+		crop:            crop,
+		format:          format,
+		autoFormat:      autoFormat,
+		encode:          encode,
+		metadata:        imglib.MetadataOptions{Policy: metadataPolicy, StripGPS: processStripGPS},
+		outDir:          processOutDir,
+		name:            nameTmpl,
+		existing:        existing,
+		claims:          newOutputClaims(args),
+		seq:             seq,
+		report:          reportFmt != reportNone,
+		dryRun:          processDryRun,
+		label:           labelTemplate,
+		labelFont:       labelFont,
+		labelFontFile:   processLabelFontFile,
+		labelSize:       processLabelSize,
+		labelPadding:    processLabelPadding,
+		labelAlign:      labelAlign,
+		labelPlacement:  labelPlacement,
+		labelColor:      labelColor,
+		labelBackground: labelBackground,
+		labelMaxLines:   processLabelMaxLines,
+		watermark:       watermark,
+		watermarkText:   watermarkTemplate,
+		watermarkStyle:  watermarkStyle,
+		watermarkScale:  processWatermarkScale,
+		watermarkMargin: processWatermarkMargin,
+		watermarkFont:   processWatermarkFont,
+		watermarkColor:  watermarkColor,
+	}
+
+	// Outputs are keyed by their input's contents and the settings
+	if processUseCache || processPrune {
+		params, err := cacheParams(cmd.Flags(), opts)
+		if err != nil {
+			return fmt.Errorf("failed to key cache: %w", err)
+		}
+		if opts.cache, err = loadProcessCache(cachePath, params); err != nil {
+			return err
+		}
+	}
+
+	// An image background is decoded once and copied for each input
+	if background.Mode == imglib.BackgroundImage && !opts.dryRun {
+		bgImg, err := imglib.LoadVips(background.Path)
+		if err != nil {
+			return fmt.Errorf("failed to load background: %w", err)
+		}
+		defer bgImg.Close()
+		if err := bgImg.ConvertToProfile(opts.profile, opts.intent); err != nil {
+			return fmt.Errorf("background: %w", err)
+		}
+		opts.backgroundImage = bgImg
+	}
+
+	// A logo is loaded once and scaled for each output
+	if watermark != nil && watermark.Path != "" && !opts.dryRun {
+		if opts.logo, err = imglib.LoadLogo(watermark.Path); err != nil {
+			return err
+		}
+		defer opts.logo.Close()
+	}
+
+	var report *reportWriter
+	if reportFmt != reportNone {
+		if report, err = newReportWriter(reportFmt, processReportFile); err != nil {
+			return err
+		}
+	}
+
+	// Inputs are read in parallel and their outputs named in input order,
+	// so that the names don't depend on the order the workers finish in
+	plans := runPool(args, processJobs, func(inputPath string) *inputPlan {
+		return readInput(inputPath, opts)
+	}, nil)
+	nameOutputs(plans, opts)
+
+	// Process input files in parallel; results are reported in input order.
+	// Progress is only shown on a terminal, errors always.
+	progress := term.IsTerminal(int(os.Stderr.Fd()))
+	var reportErr error
+	runPool(plans, processJobs, func(plan *inputPlan) processResult {
+		res := processResult{input: plan.input, dryRun: opts.dryRun}
+		start := time.Now()
+		res.err = processFile(plan, opts, &res)
+		res.duration = time.Since(start)
+		return res
+	}, func(res processResult) {
+		printResult(res, progress)
+		if report != nil && reportErr == nil {
+			reportErr = report.add(newFileReport(res, opts.fit))
+		}
+	})
+
+	if report != nil {
+		if err := report.close(); reportErr == nil {
+			reportErr = err
+		}
+		if reportErr != nil {
+			return reportErr
+		}
+	}
+	if opts.cache == nil {
+		return nil
+	}
+	if processPrune {
+		removed, err := opts.cache.prune(opts.dryRun)
+		for _, path := range removed {
+			if opts.dryRun {
+				fmt.Fprintf(os.Stderr, "Would prune %s [dry run]\n", relativePath(path))
+			} else {
+				fmt.Fprintf(os.Stderr, "Pruned %s\n", relativePath(path))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if opts.dryRun {
+		return nil
+	}
+	return opts.cache.save()
+}
+
+// processOptions holds the resolved settings for a process run.
+// It is built once from the command-line flags and shared read-only by all workers.
+type processOptions struct {
+	sizes           []outputSize
+	frameColor      imglib.Color
+	autoColor       imglib.AutoColor // derive frameColor from each image
+	frameStyle      imglib.FrameStyle
+	background      imglib.Background
+	backgroundImage *imglib.VipsImage // decoded image:<path> background
+	backgroundBlur  float64           // percentage of shorter side
+	backgroundDim   float64
+	filter          imglib.Filter
+	sharpen         imglib.Sharpen
+	colorspace      imglib.Colorspace
+	profile         imglib.OutputProfile
+	intent          imglib.RenderingIntent
+	fit             string
+	crop            imglib.CropOptions
+	format          imglib.Format
+	autoFormat      bool
+	encode          imglib.EncodeOptions
+	metadata        imglib.MetadataOptions
+	outDir          string
+	name            *nameTemplate         // nil for the default names
+	existing        existingPolicy        // what to do with existing output files
+	claims          *outputClaims         // output paths taken in this run
+	cache           *processCache         // nil unless --cache is given
+	report          bool                  // hash inputs and outputs for the report
+	seq             map[string]int        // position of each input, from 1
+	dryRun          bool                  // report the outputs without rendering them
+	label           *imglib.LabelTemplate // nil if labels are disabled
+	labelFont       string
+	labelFontFile   string
+	labelSize       float64
+	labelPadding    float64
+	labelAlign      imglib.LabelAlign
+	labelPlacement  imglib.LabelPlacement
+	labelColor      imglib.Color
+	labelBackground imglib.Color
+	labelMaxLines   int                   // 0 for no limit
+	watermark       *imglib.Watermark     // nil if there is no watermark
+	logo            *imglib.Logo          // loaded logo of the watermark
+	watermarkText   *imglib.LabelTemplate // template of a text watermark
+	watermarkStyle  imglib.WatermarkStyle // Margin is set per output size
+	watermarkScale  float64               // percentage of shorter side
+	watermarkMargin float64               // percentage of shorter side
+	watermarkFont   string
+	watermarkColor  imglib.Color
+}
+
+// outputFormat returns the format to write for inputPath. In auto mode the
+// input's format is kept if it can be written, otherwise JPEG is used.
+func (o *processOptions) outputFormat(inputPath string) imglib.Format {
+	if !o.autoFormat {
+		return o.format
+	}
+	if f, ok := imglib.FormatFromPath(inputPath); ok {
+		return f
+	}
+	return imglib.JPEG
+}
+
+// outputSize is a requested output size.
+type outputSize struct {
+	name         string // preset name or WxH, used in output filenames
+	width        int
+	height       int
+	frameWidthPx int
+	dpi          float64      // print resolution, 0 for sizes in pixels only
+	bleedPx      int          // added on every side beyond the trim line
+	safeMarginPx int          // keeps the image and label inside the trim line
+	maxBytes     int64        // file size budget, 0 for none
+	rotate       bool         // swap width and height to match the image orientation
+	variants     []outputSize // preset family; see resolve
+}
+
+// resolve returns the size to render for an image of the given dimensions,
+// and a description of the chosen variant ("" if the size is fixed). A
+// family uses the variant whose aspect ratio is closest to the image's; a
+// rotating size is turned to the image's orientation. The name is kept, so
+// output filenames don't depend on the variant.
+func (s outputSize) resolve(imgWidth, imgHeight int) (outputSize, string) {
+	if len(s.variants) > 0 {
+		imgAspect := math.Log(float64(imgWidth) / float64(imgHeight))
+		var best outputSize
+		var bestName, bestDesc string
+		bestDist := math.Inf(1)
+		for _, v := range s.variants {
+			resolved, desc := v.resolve(imgWidth, imgHeight)
+			dist := math.Abs(math.Log(float64(resolved.width)/float64(resolved.height)) - imgAspect)
+			if dist < bestDist {
+				best, bestName, bestDesc, bestDist = resolved, v.name, desc, dist
+			}
+		}
+		best.name = s.name
+		if bestDesc != "" {
+			bestName += " " + bestDesc
+		}
+		return best, bestName
+	}
+
+	if !s.rotate {
+		return s, ""
+	}
+	portrait := imgHeight > imgWidth
+	if portrait != (s.height > s.width) && s.width != s.height {
+		s.width, s.height = s.height, s.width
+	}
+	if s.height > s.width {
+		return s, "portrait"
+	}
+	return s, "landscape"
+}
+
+// shorterSide returns the shorter of the output width and height.
+func (s outputSize) shorterSide() int {
+	if s.height < s.width {
+		return s.height
+	}
+	return s.width
+}
+
+// processResult describes the outcome of processing a single input file.
+type processResult struct {
+	input     string
+	srcWidth  int
+	srcHeight int
+	outputs   []outputResult
+	inputHash string // hex SHA-256, if the cache or report needed it
+	label     string // label text, if any
+	duration  time.Duration
+	err       error // failure before any output was rendered
+	dryRun    bool  // outputs were planned, not rendered
+}
+
+// outputResult describes a single output rendered from an input file.
+type outputResult struct {
+	size       string
+	variant    string // chosen family variant or orientation, if any
+	path       string
+	outWidth   int
+	outHeight  int
+	dpi        float64                  // print resolution of the output
+	ppi        float64                  // effective resolution of the source, for dry runs
+	framePx    int                      // frame width in pixels
+	bytes      int64                    // size of the written file
+	hash       string                   // hex SHA-256 of the written file
+	duration   time.Duration            // time taken to render and save
+	maxBytes   int64                    // file size budget of the output
+	quality    int                      // encoder quality lowered to fit maxBytes, 0 if unchanged
+	subsample  imglib.ChromaSubsampling // set if subsampling was needed to fit
+	downscaled bool                     // the output was made smaller to fit maxBytes
+	skipped    bool                     // path exists and was left alone
+	cached     bool                     // input and settings unchanged since path was written
+	err        error
+}
+
+// printResult writes a one-line summary per output of a processed file to
+// stderr. Without progress, only errors are written.
+func printResult(r processResult, progress bool) {
+	if r.err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", r.input, r.err)
+		return
+	}
+	for _, o := range r.outputs {
+		if o.err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing %s (%s): %v\n", r.input, o.size, o.err)
+			continue
+		}
+		if !progress {
 			continue
 		}
+		if o.skipped {
+			fmt.Fprintf(os.Stderr, "%s: %s exists, skipped\n", r.input, o.path)
+			continue
+		}
+		details := ""
+		if o.variant != "" {
+			details = fmt.Sprintf(", %s: %s", o.size, o.variant)
+		}
+		if o.dpi > 0 {
+			details += fmt.Sprintf(", %g dpi", o.dpi)
+		}
+		if o.quality > 0 || o.downscaled {
+			if o.quality > 0 {
+				details += fmt.Sprintf(", quality %d", o.quality)
+			}
+			if o.subsample != imglib.SubsampleAuto {
+				details += " " + o.subsample.String()
+			}
+			if o.downscaled {
+				details += ", downscaled"
+			}
+			details += " to fit " + formatByteSize(o.maxBytes)
+		}
+		if o.cached {
+			fmt.Fprintf(os.Stderr, "%s: %dx%d → %s (%dx%d%s) [unchanged]\n",
+				r.input, r.srcWidth, r.srcHeight, o.path, o.outWidth, o.outHeight, details)
+			continue
+		}
+		if r.dryRun {
+			if o.ppi > 0 {
+				details += fmt.Sprintf(", source at %.0f ppi", o.ppi)
+				if math.Round(o.ppi) < o.dpi {
+					details += " (upscaled)"
+				}
+			}
+			fmt.Fprintf(os.Stderr, "%s: %dx%d → %s (%dx%d%s) [dry run]\n",
+				r.input, r.srcWidth, r.srcHeight, o.path, o.outWidth, o.outHeight, details)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: %dx%d → %s (%dx%d%s)\n",
+			r.input, r.srcWidth, r.srcHeight, o.path, o.outWidth, o.outHeight, details)
 	}
+}
 
+// defaultLabelTemplate is the label text of --label without --label-template.
+const defaultLabelTemplate = "{{.Headline}}"
+
+// autoColorSwatches is the number of swatches extracted for --color auto.
+const autoColorSwatches = 6
+
+// inputPlan is an input with its outputs named, before rendering. It is
+// read by a worker, named in input order and then rendered by a worker.
+type inputPlan struct {
+	input     string
+	fields    nameFields
+	format    imglib.Format
+	cache     *inputCache
+	srcWidth  int
+	srcHeight int
+	sizes     []outputSize   // opts.sizes resolved for the source
+	outputs   []outputResult // per size; cached outputs aren't rendered
+	err       error          // failure to read the input
+}
+
+// readInput returns the plan of inputPath with everything its outputs are
+// named from: the name fields, the cached outputs and, unless all of them
+// are cached, the dimensions from the image's header. It only reads opts,
+// so it is safe to call concurrently.
+func readInput(inputPath string, opts *processOptions) *inputPlan {
+	plan := &inputPlan{input: inputPath, format: opts.outputFormat(inputPath)}
+	plan.err = plan.read(opts)
+	return plan
+}
+
+// read fills in the plan; see readInput.
+func (p *inputPlan) read(opts *processOptions) error {
+	fields, err := fileNameFields(p.input, opts)
+	if err != nil {
+		return fmt.Errorf("failed to name outputs: %w", err)
+	}
+	if fields.hash == "" && (opts.cache != nil || opts.report) {
+		if fields.hash, err = hashFile(p.input); err != nil {
+			return err
+		}
+	}
+	p.fields = fields
+
+	// Outputs whose input and settings are unchanged are kept
+	if p.cache, err = opts.cache.forInput(p.input, fields.hash, p.format, opts.sizes); err != nil {
+		return fmt.Errorf("failed to read cache: %w", err)
+	}
+	cached, srcWidth, srcHeight := p.cache.outputs(opts.sizes)
+	if len(cached) == 0 {
+		if srcWidth, srcHeight, err = imglib.ReadSize(p.input); err != nil {
+			return fmt.Errorf("failed to load: %w", err)
+		}
+	}
+	p.srcWidth, p.srcHeight = srcWidth, srcHeight
+	p.sizes = make([]outputSize, len(opts.sizes))
+	p.outputs = make([]outputResult, len(opts.sizes))
+	for i, out := range cached {
+		p.outputs[i] = out
+	}
 	return nil
 }
 
-// labelConfig holds label rendering parameters
-type labelConfig struct {
-	enabled      bool
-	text         string
-	font         string
-	size         int
-	offsetX      int
-	imageBottomY int // Y position where image ends (frame begins)
-	paddingY     int // Padding below image bottom
-}
-
-func processFile(inputPath string, targetWidth, targetHeight, frameWidthPx int, frameColor imglib.Color, filter imglib.Filter) error {
-	// Generate output path
-	outputPath := generateOutputPath(inputPath, processOutDir)
-
-	// Read IPTC headline if label is enabled
-	var label labelConfig
-	if processLabel {
-		headline := imglib.ReadIPTCHeadline(inputPath)
-		if headline != "" {
-			// Calculate font size (percentage of shorter output side)
-			shorterSide := targetWidth
-			if targetHeight < targetWidth {
-				shorterSide = targetHeight
+// cached reports whether all outputs of the plan are cached.
+func (p *inputPlan) cached() bool {
+	for _, out := range p.outputs {
+		if !out.cached {
+			return false
+		}
+	}
+	return true
+}
+
+// nameOutputs names the outputs of plans in input order, so that the
+// versions handed out don't depend on the order the inputs were read in.
+// The paths of cached outputs are reserved first, so that no other output
+// takes them.
+func nameOutputs(plans []*inputPlan, opts *processOptions) {
+	for _, plan := range plans {
+		for _, out := range plan.outputs {
+			if out.cached {
+				opts.claims.reserve(out.path)
 			}
-			fontSize := int(float64(shorterSide) * processLabelSize / 100.0)
-			if fontSize < 8 {
-				fontSize = 8 // minimum readable size
+		}
+	}
+	for _, plan := range plans {
+		for i, out := range plan.outputs {
+			if !out.cached {
+				plan.sizes[i], plan.outputs[i] = newOutput(plan.input, opts.sizes[i], plan.srcWidth, plan.srcHeight, plan.format, plan.fields, opts)
 			}
+		}
+	}
+}
 
-			// Calculate padding (percentage of shorter side)
-			paddingY := int(float64(shorterSide) * processLabelPadding / 100.0)
+// processFile renders the outputs of a named input and records its
+// dimensions and outputs in res. The source is decoded once and branched
+// for each output size; if all outputs are cached, it isn't decoded at all.
+// It only reads opts, so it is safe to call concurrently.
+func processFile(plan *inputPlan, opts *processOptions, res *processResult) error {
+	if plan.err != nil {
+		return plan.err
+	}
+	inputPath := plan.input
+	res.srcWidth, res.srcHeight = plan.srcWidth, plan.srcHeight
+	res.inputHash = plan.fields.hash
 
-			label = labelConfig{
-				enabled:  true,
-				text:     headline,
-				font:     fmt.Sprintf("%s %d", processLabelFont, fontSize),
-				size:     fontSize,
-				paddingY: paddingY,
+	// Render the label text from the image's metadata
+	var labelText, watermarkText string
+	if opts.label != nil || opts.watermarkText != nil {
+		meta := imglib.ReadMetadata(inputPath)
+		if opts.label != nil {
+			text, err := opts.label.Execute(meta)
+			if err != nil {
+				return err
+			}
+			labelText = text
+			res.label = text
+		}
+		if opts.watermarkText != nil {
+			text, err := opts.watermarkText.Execute(meta)
+			if err != nil {
+				return fmt.Errorf("watermark: %w", err)
 			}
+			watermarkText = text
 		}
 	}
 
+	if opts.dryRun || plan.cached() {
+		planFile(plan, opts, res)
+		return nil
+	}
+
 	// Load image using vips
 	img, err := imglib.LoadVips(inputPath)
 	if err != nil {
@@ -210,129 +1212,378 @@ func processFile(inputPath string, targetWidth, targetHeight, frameWidthPx int,
 	}
 	defer img.Close()
 
-	fmt.Fprintf(os.Stderr, "%s: %dx%d", inputPath, img.Width(), img.Height())
+	// Convert from the embedded profile to the output profile
+	if err := img.ConvertToProfile(opts.profile, opts.intent); err != nil {
+		return err
+	}
 
-	// imageOffsetX/imageBottomY track where the image is in the final output
-	var imageOffsetX, imageBottomY int
+	// Pick the frame colour from the image's palette
+	if opts.autoColor != imglib.AutoNone {
+		palette, err := img.Palette(autoColorSwatches)
+		if err != nil {
+			return fmt.Errorf("failed to extract palette: %w", err)
+		}
+		fileOpts := *opts
+		fileOpts.frameColor = palette.Color(opts.autoColor)
+		opts = &fileOpts
+	}
 
-	switch processFit {
+	// The background is built from the source, or from another image
+	var bgSource *imglib.VipsImage
+	switch opts.background.Mode {
+	case imglib.BackgroundBlur:
+		bgSource = img
+	case imglib.BackgroundImage:
+		bgImg, err := opts.backgroundImage.Copy()
+		if err != nil {
+			return fmt.Errorf("background: %w", err)
+		}
+		defer bgImg.Close()
+		bgSource = bgImg
+	}
+
+	for i, out := range plan.outputs {
+		if !out.cached && !out.skipped {
+			start := time.Now()
+			out.err = renderSize(img, bgSource, plan.sizes[i], labelText, watermarkText, plan.format, &out, opts)
+			out.duration = time.Since(start)
+			if out.err == nil {
+				out.err = plan.cache.store(i, out, img.Width(), img.Height())
+			}
+		}
+		res.outputs = append(res.outputs, out)
+	}
+	return nil
+}
+
+// planFile records the outputs of a dry run in res, with the effective
+// resolution of the source on each print.
+func planFile(plan *inputPlan, opts *processOptions, res *processResult) {
+	for i, out := range plan.outputs {
+		if !out.cached {
+			out.outWidth, out.outHeight, out.ppi = planSize(plan.srcWidth, plan.srcHeight, plan.sizes[i], opts)
+			if !out.skipped {
+				plan.cache.planned()
+			}
+		}
+		res.outputs = append(res.outputs, out)
+	}
+}
+
+// newOutput resolves size for a source of the given dimensions and returns
+// it with the output's description. fields are the input's name fields.
+func newOutput(inputPath string, size outputSize, srcWidth, srcHeight int, format imglib.Format, fields nameFields, opts *processOptions) (outputSize, outputResult) {
+	// Only name outputs after their size when there is more than one
+	sizeName := ""
+	if len(opts.sizes) > 1 {
+		sizeName = size.name
+	}
+	size, variant := size.resolve(srcWidth, srcHeight)
+	path, skipped := outputPath(inputPath, sizeName, size, srcWidth, srcHeight, format, fields, opts)
+	return size, outputResult{
+		size:    size.name,
+		variant: variant,
+		path:    path,
+		dpi:     size.dpi,
+		framePx: size.frameWidthPx,
+		skipped: skipped,
+	}
+}
+
+// renderSize renders a branch of img at one output size and saves it to
+// out.path. bgSource is the image the background is made from, or nil for
+// a frame of solid colour. The output dimensions are recorded in out.
+func renderSize(src, bgSource *imglib.VipsImage, size outputSize, labelText, watermarkText string, format imglib.Format, out *outputResult, opts *processOptions) error {
+	img, err := src.Copy()
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+
+	// imageArea tracks where the image is in the final output
+	var imageArea image.Rectangle
+
+	switch opts.fit {
 	case "expand":
-		imageOffsetX, imageBottomY, err = processExpandVips(img, targetWidth, targetHeight, frameWidthPx, frameColor, filter)
+		imageArea, err = processExpandVips(img, bgSource, size, opts)
 	case "wrap":
-		imageOffsetX, imageBottomY, err = processWrapVips(img, targetWidth, targetHeight, frameWidthPx, frameColor, filter)
+		imageArea, err = processWrapVips(img, bgSource, size, opts)
+	case "cover":
+		imageArea, err = processCoverVips(img, bgSource, size, opts)
 	default:
-		return fmt.Errorf("unknown fit mode: %s", processFit)
+		return fmt.Errorf("unknown fit mode: %s", opts.fit)
 	}
 
 	if err != nil {
 		return err
 	}
 
-	// Add label if enabled and headline was found
-	if label.enabled {
-		label.offsetX = imageOffsetX
-		label.imageBottomY = imageBottomY
-		if err := img.AddLabel(label.text, label.font, label.size, label.offsetX, label.imageBottomY, label.paddingY); err != nil {
+	// Add label if the text isn't empty
+	if labelText != "" {
+		if err := img.AddLabel(labelText, labelStyle(size, opts), imageArea); err != nil {
 			return fmt.Errorf("failed to add label: %w", err)
 		}
 	}
 
-	// Save
-	if err := img.SaveJPEG(outputPath, processQuality); err != nil {
-		return fmt.Errorf("failed to save: %w", err)
+	// Stamp the watermark over the image, frame and label
+	if opts.watermark != nil && (opts.watermark.Path != "" || watermarkText != "") {
+		if err := addWatermark(img, size, watermarkText, imageArea, opts); err != nil {
+			return fmt.Errorf("failed to add watermark: %w", err)
+		}
 	}
 
-	fmt.Fprintf(os.Stderr, " → %s (%dx%d)\n", outputPath, img.Width(), img.Height())
-	return nil
+	// Extend prints beyond the trim line
+	if err := img.AddBleed(size.bleedPx); err != nil {
+		return err
+	}
+
+	// Save with the selected metadata, within the file size budget
+	return saveOutput(img, size, format, out, opts)
+}
+
+// labelStyle returns the label style for an output size. The font size and
+// padding scale with the shorter side of the output.
+func labelStyle(size outputSize, opts *processOptions) imglib.LabelStyle {
+	shorterSide := size.shorterSide()
+	fontSize := int(float64(shorterSide) * opts.labelSize / 100.0)
+	if fontSize < 8 {
+		fontSize = 8 // minimum readable size
+	}
+
+	return imglib.LabelStyle{
+		Font:       fmt.Sprintf("%s %d", opts.labelFont, fontSize),
+		FontFile:   opts.labelFontFile,
+		Size:       fontSize,
+		Align:      opts.labelAlign,
+		Placement:  opts.labelPlacement,
+		Color:      opts.labelColor,
+		Background: opts.labelBackground,
+		MaxLines:   opts.labelMaxLines,
+		Padding:    int(float64(shorterSide) * opts.labelPadding / 100.0),
+		SafeMargin: size.safeMarginPx,
+	}
+}
+
+// addWatermark stamps the logo or the rendered watermark text on img. The
+// watermark's width and margin scale with the shorter side of the output.
+func addWatermark(img *imglib.VipsImage, size outputSize, text string, area image.Rectangle, opts *processOptions) error {
+	shorterSide := float64(size.shorterSide())
+	width := max(1, int(shorterSide*opts.watermarkScale/100.0))
+
+	var mark *imglib.VipsImage
+	var err error
+	if opts.watermark.Path != "" {
+		mark, err = opts.logo.Scaled(width)
+	} else {
+		// Fonts loaded with --label-fontfile can be named here too
+		mark, err = imglib.TextWatermark(text, opts.watermarkFont, opts.labelFontFile, opts.watermarkColor, width)
+	}
+	if err != nil {
+		return err
+	}
+	defer mark.Close()
+
+	style := opts.watermarkStyle
+	style.Margin = int(shorterSide * opts.watermarkMargin / 100.0)
+	return img.AddWatermark(mark, style, area)
+}
+
+// parseWatermarkStyle resolves the watermark flags other than its size.
+func parseWatermarkStyle(position, mode, blend, on string, opacity float64) (imglib.WatermarkStyle, error) {
+	var style imglib.WatermarkStyle
+	var err error
+	if style.Anchor, err = imglib.ParseGravity(position); err != nil {
+		return style, fmt.Errorf("invalid watermark position: %w", err)
+	}
+	if style.Mode, err = imglib.ParseWatermarkMode(mode); err != nil {
+		return style, err
+	}
+	if style.Blend, err = imglib.ParseBlendMode(blend); err != nil {
+		return style, err
+	}
+	switch strings.ToLower(on) {
+	case "image":
+	case "frame":
+		style.OnFrame = true
+	default:
+		return style, fmt.Errorf("invalid watermark placement: %s (use image or frame)", on)
+	}
+	style.Opacity = opacity
+	return style, style.Validate()
 }
 
-// processExpandVips creates output of exactly targetWidth x targetHeight.
+// processExpandVips creates output of exactly the output size.
 // Image is resized to fit within the frame area and centered.
-// Returns (imageOffsetX, imageBottomY) for label positioning.
-func processExpandVips(img *imglib.VipsImage, targetWidth, targetHeight, frameWidth int, frameColor imglib.Color, filter imglib.Filter) (int, int, error) {
+// Returns the position of the image in the output for label placement.
+func processExpandVips(img, bgSource *imglib.VipsImage, size outputSize, opts *processOptions) (image.Rectangle, error) {
 	// Calculate available space for the image (inside frame)
-	availWidth := targetWidth - 2*frameWidth
-	availHeight := targetHeight - 2*frameWidth
+	frame := frameInsets(size, opts)
+	availWidth := size.width - frame.Left - frame.Right
+	availHeight := size.height - frame.Top - frame.Bottom
 
 	if availWidth <= 0 || availHeight <= 0 {
-		return 0, 0, fmt.Errorf("frame too large for output size")
+		return image.Rectangle{}, fmt.Errorf("frame too large for output size")
 	}
 
 	// Resize to fit within available space
-	if err := img.ResizeToFit(availWidth, availHeight, filter); err != nil {
-		return 0, 0, err
+	if err := img.ResizeToFitColorspace(availWidth, availHeight, opts.filter, opts.colorspace); err != nil {
+		return image.Rectangle{}, err
 	}
+	if err := img.Sharpen(opts.sharpen); err != nil {
+		return image.Rectangle{}, err
+	}
+
+	return placeInFrame(img, bgSource, size, opts)
+}
 
-	// Calculate centering offsets
+// processCoverVips creates output of exactly the output size.
+// Image is resized to cover the frame area and cropped to fill it.
+// Returns the position of the image in the output for label placement.
+func processCoverVips(img, bgSource *imglib.VipsImage, size outputSize, opts *processOptions) (image.Rectangle, error) {
+	frame := frameInsets(size, opts)
+	availWidth := size.width - frame.Left - frame.Right
+	availHeight := size.height - frame.Top - frame.Bottom
+
+	if availWidth <= 0 || availHeight <= 0 {
+		return image.Rectangle{}, fmt.Errorf("frame too large for output size")
+	}
+
+	if err := img.ResizeToCover(availWidth, availHeight, opts.filter, opts.colorspace, opts.crop); err != nil {
+		return image.Rectangle{}, err
+	}
+	if err := img.Sharpen(opts.sharpen); err != nil {
+		return image.Rectangle{}, err
+	}
+
+	return placeInFrame(img, bgSource, size, opts)
+}
+
+// placeInFrame adds a frame in the configured style that centers the image
+// in the area inside the frame of a canvas of the output size.
+// Returns the position of the image in the output for label placement.
+func placeInFrame(img, bgSource *imglib.VipsImage, size outputSize, opts *processOptions) (image.Rectangle, error) {
+	// Calculate centering offsets within the area inside the frame
+	frame := frameInsets(size, opts)
 	resizeWidth := img.Width()
 	resizeHeight := img.Height()
-	offsetX := (targetWidth - resizeWidth) / 2
-	offsetY := (targetHeight - resizeHeight) / 2
-	imageBottomY := offsetY + resizeHeight
+	offsetX := frame.Left + (size.width-frame.Left-frame.Right-resizeWidth)/2
+	offsetY := frame.Top + (size.height-frame.Top-frame.Bottom-resizeHeight)/2
+	area := image.Rect(offsetX, offsetY, offsetX+resizeWidth, offsetY+resizeHeight)
 
-	// Add frame with asymmetric borders to center the image
-	err := img.AddFrame(
-		offsetY,                           // top
-		targetWidth-resizeWidth-offsetX,   // right
-		targetHeight-resizeHeight-offsetY, // bottom
-		offsetX,                           // left
-		frameColor,
-	)
-	return offsetX, imageBottomY, err
+	err := addFrame(img, bgSource, size.frameWidthPx, size.width, size.height, offsetX, offsetY, opts)
+	return area, err
 }
 
-// processWrapVips resizes image to fit target size, then wraps frame around it.
-// Returns (imageOffsetX, imageBottomY) for label positioning.
-func processWrapVips(img *imglib.VipsImage, targetWidth, targetHeight, frameWidth int, frameColor imglib.Color, filter imglib.Filter) (int, int, error) {
-	// Resize to fit target dimensions
-	if err := img.ResizeToFit(targetWidth, targetHeight, filter); err != nil {
-		return 0, 0, err
+// addFrame adds a frame in the configured style to img on a canvasWidth x
+// canvasHeight canvas, with the image at x, y. If bgSource isn't nil, the
+// outermost layer of the frame is a background made from it.
+func addFrame(img, bgSource *imglib.VipsImage, frameWidth, canvasWidth, canvasHeight, x, y int, opts *processOptions) error {
+	if bgSource == nil {
+		return img.AddFrameStyle(opts.frameStyle, frameWidth, canvasWidth, canvasHeight, x, y, opts.frameColor)
 	}
 
-	// Remember image height before adding frame
-	imageBottomY := frameWidth + img.Height()
-
-	// Add uniform frame
-	err := img.AddUniformFrame(frameWidth, frameColor)
-	return frameWidth, imageBottomY, err
+	// The blur scales with the output like the frame
+	sigma := float64(min(canvasWidth, canvasHeight)) * opts.backgroundBlur / 100.0
+	background, err := bgSource.CoverBackground(canvasWidth, canvasHeight, sigma, opts.backgroundDim, opts.filter)
+	if err != nil {
+		return fmt.Errorf("failed to create background: %w", err)
+	}
+	defer background.Close()
+	return img.AddFrameStyleOver(opts.frameStyle, frameWidth, background, x, y, opts.frameColor)
 }
 
-// generateOutputPath creates output filename with version suffix.
-func generateOutputPath(inputPath string, outDir string) string {
-	ext := filepath.Ext(inputPath)
-	base := strings.TrimSuffix(filepath.Base(inputPath), ext)
+// parseCropOptions resolves the --gravity and --focus flags. An explicit
+// focus point can't be combined with an explicit gravity.
+func parseCropOptions(gravity, focus string, gravitySet bool) (imglib.CropOptions, error) {
+	if focus != "" {
+		if gravitySet {
+			return imglib.CropOptions{}, fmt.Errorf("--focus and --gravity are mutually exclusive")
+		}
+		x, y, err := imglib.ParseFocus(focus)
+		if err != nil {
+			return imglib.CropOptions{}, err
+		}
+		return imglib.CropOptions{Gravity: imglib.GravityFocus, FocusX: x, FocusY: y}, nil
+	}
 
-	// Check if base already has a version suffix like _v0, _v1, etc.
-	versionRegex := regexp.MustCompile(`^(.+)_v(\d+)$`)
-	matches := versionRegex.FindStringSubmatch(base)
+	g, err := imglib.ParseGravity(gravity)
+	if err != nil {
+		return imglib.CropOptions{}, err
+	}
+	return imglib.CropOptions{Gravity: g}, nil
+}
 
-	var newBase string
-	if matches != nil {
-		// Already has version suffix, increment it
-		baseName := matches[1]
-		version, _ := strconv.Atoi(matches[2])
-		newBase = fmt.Sprintf("%s_v%d", baseName, version+1)
-	} else {
-		// No version suffix, add _v0
-		newBase = base + "_v0"
+// processWrapVips resizes image to fit target size, then wraps frame around it.
+// Returns the position of the image in the output for label placement.
+func processWrapVips(img, bgSource *imglib.VipsImage, size outputSize, opts *processOptions) (image.Rectangle, error) {
+	// Resize to fit target dimensions
+	if err := img.ResizeToFitColorspace(size.width, size.height, opts.filter, opts.colorspace); err != nil {
+		return image.Rectangle{}, err
 	}
 
-	// Use output directory if specified, otherwise use input file's directory
-	dir := outDir
-	if dir == "" {
-		dir = filepath.Dir(inputPath)
+	// Sharpen before framing so the frame edges stay crisp
+	if err := img.Sharpen(opts.sharpen); err != nil {
+		return image.Rectangle{}, err
 	}
 
-	// Always output as JPEG
-	return filepath.Join(dir, newBase+".jpg")
+	// Remember the image size before adding frame
+	frame := frameInsets(size, opts)
+	area := image.Rect(frame.Left, frame.Top, frame.Left+img.Width(), frame.Top+img.Height())
+
+	// Wrap the frame tightly around the image
+	err := addFrame(img, bgSource, size.frameWidthPx,
+		frame.Left+img.Width()+frame.Right, frame.Top+img.Height()+frame.Bottom,
+		frame.Left, frame.Top, opts)
+	return area, err
+}
+
+// sizePairRegex matches a single size written as "W,H".
+var sizePairRegex = regexp.MustCompile(`^\s*\d+\s*,\s*\d+\s*$`)
+
+// parseSizes parses the --size values. Each value is a single size or a
+// comma-separated list of sizes; "W,H" is read as one size.
+func parseSizes(values []string) ([]outputSize, error) {
+	var sizes []outputSize
+	seen := make(map[string]bool)
+	for _, value := range values {
+		items := []string{value}
+		if !sizePairRegex.MatchString(value) {
+			items = strings.Split(value, ",")
+		}
+		for _, item := range items {
+			size, ok := presetSize(strings.ToLower(strings.TrimSpace(item)))
+			if !ok {
+				var err error
+				if size, ok, err = parsePrintSize(item); err != nil {
+					return nil, err
+				}
+			}
+			if !ok {
+				width, height, err := parseSize(item)
+				if err != nil {
+					return nil, err
+				}
+				size = outputSize{name: fmt.Sprintf("%dx%d", width, height), width: width, height: height}
+			}
+			if seen[size.name] {
+				return nil, fmt.Errorf("duplicate size: %s", size.name)
+			}
+			seen[size.name] = true
+			sizes = append(sizes, size)
+		}
+	}
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("no output size given")
+	}
+	return sizes, nil
 }
 
 func parseSize(s string) (int, int, error) {
 	s = strings.ToLower(strings.TrimSpace(s))
 
-	// Check for preset
-	if preset, ok := sizePresets[s]; ok {
-		return preset[0], preset[1], nil
+	// Check for preset; families have no fixed size
+	if p, ok := presets[s]; ok && len(p.Variants) == 0 {
+		return p.Width, p.Height, nil
 	}
 
 	// Try parsing as WxH or W,H
@@ -371,11 +1622,5 @@ func parseSize(s string) (int, int, error) {
 		}
 	}
 
-	// List available presets in error message
-	presetList := make([]string, 0, len(sizePresets))
-	for name := range sizePresets {
-		presetList = append(presetList, name)
-	}
-
-	return 0, 0, fmt.Errorf("invalid size '%s'. Use WxH, W,H, or a preset: %s", s, strings.Join(presetList, ", "))
+	return 0, 0, fmt.Errorf("invalid size '%s'. Use WxH, W,H, or a preset: %s", s, strings.Join(presetNames(), ", "))
 }
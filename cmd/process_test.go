@@ -1,7 +1,10 @@
 package cmd
 
 import (
+	"reflect"
 	"testing"
+
+	imglib "github.com/cwygoda/ansel/internal/image"
 )
 
 func TestParseSize(t *testing.T) {
@@ -87,51 +90,202 @@ func TestSizePresets(t *testing.T) {
 	}
 }
 
-func TestGenerateOutputPath(t *testing.T) {
+func TestOutputFormatAuto(t *testing.T) {
+	opts := &processOptions{autoFormat: true}
+
 	tests := []struct {
 		input    string
-		outDir   string
-		expected string
+		expected imglib.Format
 	}{
-		// No version suffix, no outDir
-		{"photo.jpg", "", "photo_v0.jpg"},
-		{"image.png", "", "image_v0.jpg"},
-		{"test.tiff", "", "test_v0.jpg"},
-
-		// With version suffix - increment
-		{"photo_v0.jpg", "", "photo_v1.jpg"},
-		{"photo_v1.jpg", "", "photo_v2.jpg"},
-		{"photo_v9.jpg", "", "photo_v10.jpg"},
-		{"photo_v99.jpg", "", "photo_v100.jpg"},
-
-		// With input directory, no outDir
-		{"/path/to/photo.jpg", "", "/path/to/photo_v0.jpg"},
-		{"/path/to/photo_v0.jpg", "", "/path/to/photo_v1.jpg"},
-		{"./photo.jpg", "", "photo_v0.jpg"},
-
-		// Edge cases
-		{"my_photo.jpg", "", "my_photo_v0.jpg"},
-		{"my_photo_v0.jpg", "", "my_photo_v1.jpg"},
-		{"photo_v0_edited.jpg", "", "photo_v0_edited_v0.jpg"},
-
-		// With outDir specified
-		{"photo.jpg", "/output", "/output/photo_v0.jpg"},
-		{"/path/to/photo.jpg", "/output", "/output/photo_v0.jpg"},
-		{"photo_v0.jpg", "/output", "/output/photo_v1.jpg"},
-		{"photo.jpg", "out", "out/photo_v0.jpg"},
+		{"photo.jpg", imglib.JPEG},
+		{"photo.JPEG", imglib.JPEG},
+		{"scan.tiff", imglib.TIFF},
+		{"shot.png", imglib.PNG},
+		{"web.webp", imglib.WebP},
+		{"phone.heic", imglib.JPEG}, // not writable, falls back
+		{"noext", imglib.JPEG},
 	}
 
 	for _, tc := range tests {
-		name := tc.input
-		if tc.outDir != "" {
-			name += " -> " + tc.outDir
-		}
-		t.Run(name, func(t *testing.T) {
-			result := generateOutputPath(tc.input, tc.outDir)
-			if result != tc.expected {
-				t.Errorf("generateOutputPath(%q, %q) = %q, expected %q",
-					tc.input, tc.outDir, result, tc.expected)
+		t.Run(tc.input, func(t *testing.T) {
+			if got := opts.outputFormat(tc.input); got != tc.expected {
+				t.Errorf("outputFormat(%q) = %s, expected %s", tc.input, got, tc.expected)
+			}
+		})
+	}
+
+	fixed := &processOptions{format: imglib.AVIF}
+	if got := fixed.outputFormat("photo.png"); got != imglib.AVIF {
+		t.Errorf("outputFormat with fixed format = %s, expected avif", got)
+	}
+}
+
+func TestParseCropOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		gravity    string
+		focus      string
+		gravitySet bool
+		expected   imglib.CropOptions
+		hasErr     bool
+	}{
+		{"default", "centre", "", false, imglib.CropOptions{Gravity: imglib.GravityCentre}, false},
+		{"edge", "north", "", true, imglib.CropOptions{Gravity: imglib.GravityNorth}, false},
+		{"smart", "attention", "", true, imglib.CropOptions{Gravity: imglib.GravityAttention}, false},
+		{"focus", "centre", "0.25,0.75", false, imglib.CropOptions{Gravity: imglib.GravityFocus, FocusX: 0.25, FocusY: 0.75}, false},
+		{"focus and gravity", "north", "0.5,0.5", true, imglib.CropOptions{}, true},
+		{"bad focus", "centre", "2,0.5", false, imglib.CropOptions{}, true},
+		{"bad gravity", "up", "", true, imglib.CropOptions{}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseCropOptions(tc.gravity, tc.focus, tc.gravitySet)
+			if tc.hasErr {
+				if err == nil {
+					t.Errorf("parseCropOptions expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCropOptions failed: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("parseCropOptions = %+v, expected %+v", got, tc.expected)
 			}
 		})
 	}
 }
+
+func TestParseWatermarkStyle(t *testing.T) {
+	tests := []struct {
+		name                      string
+		position, mode, blend, on string
+		opacity                   float64
+		expected                  imglib.WatermarkStyle
+		hasErr                    bool
+	}{
+		{"default", "southeast", "single", "over", "image", 0.5,
+			imglib.WatermarkStyle{Anchor: imglib.GravitySouthEast, Opacity: 0.5}, false},
+		{"frame", "south", "single", "multiply", "frame", 1,
+			imglib.WatermarkStyle{Anchor: imglib.GravitySouth, Blend: imglib.BlendMultiply, Opacity: 1, OnFrame: true}, false},
+		{"diagonal", "centre", "diagonal", "screen", "frame", 0.2,
+			imglib.WatermarkStyle{Anchor: imglib.GravityCentre, Mode: imglib.WatermarkDiagonal, Blend: imglib.BlendScreen, Opacity: 0.2, OnFrame: true}, false},
+		{"smart position", "attention", "single", "over", "image", 0.5, imglib.WatermarkStyle{}, true},
+		{"centre of frame", "centre", "single", "over", "frame", 0.5, imglib.WatermarkStyle{}, true},
+		{"bad placement", "south", "single", "over", "label", 0.5, imglib.WatermarkStyle{}, true},
+		{"bad opacity", "south", "single", "over", "image", 2, imglib.WatermarkStyle{}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseWatermarkStyle(tc.position, tc.mode, tc.blend, tc.on, tc.opacity)
+			if tc.hasErr {
+				if err == nil {
+					t.Errorf("parseWatermarkStyle expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseWatermarkStyle failed: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("parseWatermarkStyle = %+v, expected %+v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseSizes(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []string
+		expected []outputSize
+		hasErr   bool
+	}{
+		{"single preset", []string{"ig-post"}, []outputSize{{name: "ig-post", width: 1080, height: 1080, maxBytes: 8_000_000}}, false},
+		{"W,H is one size", []string{"1920,1080"}, []outputSize{{name: "1920x1080", width: 1920, height: 1080}}, false},
+		{"list", []string{"ig-post,ig-story, x-post"}, []outputSize{
+			{name: "ig-post", width: 1080, height: 1080, maxBytes: 8_000_000},
+			{name: "ig-story", width: 1080, height: 1920, maxBytes: 8_000_000},
+			{name: "x-post", width: 1200, height: 675, maxBytes: 5_000_000},
+		}, false},
+		{"repeated", []string{"IG-POST", "800x600"}, []outputSize{
+			{name: "ig-post", width: 1080, height: 1080, maxBytes: 8_000_000},
+			{name: "800x600", width: 800, height: 600},
+		}, false},
+		{"rotating", []string{"4x6"}, []outputSize{{name: "4x6", width: 1800, height: 1200, dpi: 300, rotate: true}}, false},
+		{"print size", []string{"13x18cm@360dpi"}, []outputSize{{name: "13x18cm@360dpi", width: 1843, height: 2551, dpi: 360, rotate: true}}, false},
+		{"invalid resolution", []string{"13x18cm@dpi"}, nil, true},
+		{"family", []string{"ig-auto"}, []outputSize{{name: "ig-auto", variants: []outputSize{
+			{name: "ig-portrait", width: 1080, height: 1350, maxBytes: 8_000_000},
+			{name: "ig-post", width: 1080, height: 1080, maxBytes: 8_000_000},
+			{name: "ig-landscape", width: 1080, height: 566, maxBytes: 8_000_000},
+		}}}, false},
+		{"duplicate", []string{"ig-post", "ig-post"}, nil, true},
+		{"invalid entry", []string{"ig-post,nope"}, nil, true},
+		{"empty", nil, nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sizes, err := parseSizes(tc.values)
+			if tc.hasErr {
+				if err == nil {
+					t.Errorf("parseSizes(%q) expected error, got %v", tc.values, sizes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSizes(%q) failed: %v", tc.values, err)
+			}
+			if !reflect.DeepEqual(sizes, tc.expected) {
+				t.Errorf("parseSizes(%q) = %v, expected %v", tc.values, sizes, tc.expected)
+			}
+		})
+	}
+}
+
+func TestOutputSizeResolve(t *testing.T) {
+	auto, _ := presetSize("ig-auto")
+	printSize, _ := presetSize("4x6")
+	fixed, _ := presetSize("ig-story")
+
+	tests := []struct {
+		name    string
+		size    outputSize
+		imgW    int
+		imgH    int
+		width   int
+		height  int
+		variant string
+	}{
+		{"auto portrait", auto, 3000, 4000, 1080, 1350, "ig-portrait"},
+		{"auto square", auto, 2000, 2100, 1080, 1080, "ig-post"},
+		{"auto landscape", auto, 6000, 4000, 1080, 566, "ig-landscape"},
+		{"auto panorama", auto, 8000, 2000, 1080, 566, "ig-landscape"},
+		{"print landscape", printSize, 6000, 4000, 1800, 1200, "landscape"},
+		{"print portrait", printSize, 4000, 6000, 1200, 1800, "portrait"},
+		{"print square", printSize, 4000, 4000, 1800, 1200, "landscape"},
+		{"fixed", fixed, 6000, 4000, 1080, 1920, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, variant := tc.size.resolve(tc.imgW, tc.imgH)
+			if got.width != tc.width || got.height != tc.height || variant != tc.variant {
+				t.Errorf("resolve(%d, %d) = %dx%d %q, expected %dx%d %q",
+					tc.imgW, tc.imgH, got.width, got.height, variant, tc.width, tc.height, tc.variant)
+			}
+			if got.name != tc.size.name {
+				t.Errorf("resolve changed the name to %q", got.name)
+			}
+		})
+	}
+
+	// Rotating variants of a family report both choices
+	family := outputSize{name: "lab-auto", variants: []outputSize{printSize, fixed}}
+	if got, variant := family.resolve(4000, 6000); got.width != 1200 || variant != "4x6 portrait" {
+		t.Errorf("family resolve = %dx%d %q, expected 1200x1800 %q", got.width, got.height, variant, "4x6 portrait")
+	}
+}
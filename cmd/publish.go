@@ -6,6 +6,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/cwygoda/ansel/internal/config"
 	"github.com/cwygoda/ansel/internal/nanoid"
 	"github.com/cwygoda/ansel/internal/publish"
 	"github.com/spf13/cobra"
@@ -22,8 +23,9 @@ Creates a CloudFormation stack with:
   - ACM certificate (auto-validated via DNS)
   - Route53 subdomain record
 
-On first run, a random subdomain is generated and saved to .ansel.toml.
-Subsequent runs update the existing site.
+On first run, a random subdomain is generated and saved to the [publish]
+table of .ansel.toml; the rest of the file is left as it is. Subsequent
+runs update the existing site.
 
 Requires AWS credentials configured via:
   - AWS CLI profile (~/.aws/credentials)
@@ -78,7 +80,7 @@ func runPublish(cmd *cobra.Command, args []string) error {
 	}
 
 	// Load project config
-	cfg, err := publish.LoadProjectConfig()
+	cfg, err := config.LoadProjectConfig()
 	if err != nil {
 		return err
 	}
@@ -134,7 +136,7 @@ func runPublish(cmd *cobra.Command, args []string) error {
 		cfg.Publish.Subdomain = subdomain
 		cfg.Publish.HostedZoneID = zone.ID
 		cfg.Publish.DomainName = zone.Name
-		if err := publish.SaveProjectConfig(cfg); err != nil {
+		if err := config.SavePublishConfig(cfg.Publish); err != nil {
 			return err
 		}
 		fmt.Fprintln(os.Stderr, "Saved configuration to .ansel.toml")
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cwygoda/ansel/internal/config"
+	"github.com/spf13/pflag"
+)
+
+// recipeExcludedFlags are process flags that can't be set from a recipe.
+var recipeExcludedFlags = map[string]bool{
+	"recipe": true,
+	"help":   true,
+}
+
+// recipeFlags are the flags set by a recipe. pflag marks them as changed
+// like flags given on the command line.
+type recipeFlags map[string]bool
+
+// overrides reports whether flag name, given on the command line, overrides
+// the related flag other set by the recipe, like --focus does --gravity.
+func (r recipeFlags) overrides(flags *pflag.FlagSet, name, other string) bool {
+	return flags.Changed(name) && !r[name] && r[other]
+}
+
+// applyRecipe sets flags from the named recipe and returns the flags it set.
+// Flags already given on the command line keep their values, so they
+// override the recipe.
+func applyRecipe(flags *pflag.FlagSet, name string, recipes map[string]config.Recipe) (recipeFlags, error) {
+	recipe, ok := recipes[name]
+	if !ok {
+		available := make([]string, 0, len(recipes))
+		for n := range recipes {
+			available = append(available, n)
+		}
+		sort.Strings(available)
+		if len(available) == 0 {
+			return nil, fmt.Errorf("unknown recipe %q: no recipes defined", name)
+		}
+		return nil, fmt.Errorf("unknown recipe %q (available: %s)", name, strings.Join(available, ", "))
+	}
+
+	// Apply keys in a stable order so errors are reproducible
+	keys := make([]string, 0, len(recipe))
+	for key := range recipe {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	set := make(recipeFlags)
+	for _, key := range keys {
+		flagName := strings.ReplaceAll(key, "_", "-")
+		flag := flags.Lookup(flagName)
+		if flag == nil || recipeExcludedFlags[flagName] {
+			return nil, fmt.Errorf("unknown key %q in recipe %q", key, name)
+		}
+		if flag.Changed {
+			continue
+		}
+
+		values, err := recipeValues(recipe[key])
+		if err != nil {
+			return nil, fmt.Errorf("recipe %q: invalid %s: %w", name, key, err)
+		}
+		if len(values) != 1 && !strings.HasSuffix(flag.Value.Type(), "Array") && !strings.HasSuffix(flag.Value.Type(), "Slice") {
+			return nil, fmt.Errorf("recipe %q: invalid %s: expected a single value", name, key)
+		}
+		for _, v := range values {
+			if err := flags.Set(flagName, v); err != nil {
+				return nil, fmt.Errorf("recipe %q: invalid %s: %w", name, key, err)
+			}
+		}
+		set[flagName] = true
+	}
+	return set, nil
+}
+
+// mergeRecipes combines the user and project recipes. Project recipes
+// replace user recipes of the same name.
+func mergeRecipes(user, project map[string]config.Recipe) map[string]config.Recipe {
+	recipes := make(map[string]config.Recipe, len(user)+len(project))
+	for name, recipe := range user {
+		recipes[name] = recipe
+	}
+	for name, recipe := range project {
+		recipes[name] = recipe
+	}
+	return recipes
+}
+
+// recipeValues converts a TOML value to flag value strings.
+func recipeValues(value any) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case int64:
+		return []string{strconv.FormatInt(v, 10)}, nil
+	case float64:
+		return []string{strconv.FormatFloat(v, 'g', -1, 64)}, nil
+	case []any:
+		var values []string
+		for _, item := range v {
+			if _, nested := item.([]any); nested {
+				return nil, fmt.Errorf("nested arrays are not supported")
+			}
+			itemValues, err := recipeValues(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, itemValues...)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unsupported value %v", value)
+	}
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cwygoda/ansel/internal/config"
+	imglib "github.com/cwygoda/ansel/internal/image"
+	"github.com/spf13/pflag"
+)
+
+// testRecipeFlags returns a flag set with a subset of the process flags.
+func testRecipeFlags() (*pflag.FlagSet, *[]string, *string, *float64, *bool) {
+	flags := pflag.NewFlagSet("process", pflag.ContinueOnError)
+	size := flags.StringArray("size", nil, "")
+	fit := flags.String("fit", "expand", "")
+	frame := flags.Float64("frame", 5, "")
+	label := flags.Bool("label", false, "")
+	flags.String("label-font", "sans", "")
+	flags.String("recipe", "", "")
+	return flags, size, fit, frame, label
+}
+
+func TestApplyRecipe(t *testing.T) {
+	recipes := map[string]config.Recipe{
+		"instagram": {
+			"size":       []any{"ig-post", "ig-story"},
+			"fit":        "cover",
+			"frame":      int64(3),
+			"label":      true,
+			"label_font": "serif",
+		},
+	}
+
+	flags, size, fit, frame, label := testRecipeFlags()
+	if err := flags.Parse([]string{"--fit", "wrap"}); err != nil {
+		t.Fatal(err)
+	}
+	set, err := applyRecipe(flags, "instagram", recipes)
+	if err != nil {
+		t.Fatalf("applyRecipe failed: %v", err)
+	}
+	expected := recipeFlags{"size": true, "frame": true, "label": true, "label-font": true}
+	if !reflect.DeepEqual(set, expected) {
+		t.Errorf("recipe set %v, expected %v", set, expected)
+	}
+
+	if !reflect.DeepEqual(*size, []string{"ig-post", "ig-story"}) {
+		t.Errorf("size = %v", *size)
+	}
+	if *fit != "wrap" {
+		t.Errorf("fit = %q, expected the command-line value %q", *fit, "wrap")
+	}
+	if *frame != 3 {
+		t.Errorf("frame = %v, expected 3", *frame)
+	}
+	if !*label {
+		t.Error("label = false, expected true")
+	}
+	if got := flags.Lookup("label-font").Value.String(); got != "serif" {
+		t.Errorf("label-font = %q, expected %q", got, "serif")
+	}
+}
+
+func TestApplyRecipeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		recipes map[string]config.Recipe
+		recipe  string
+		errText string
+	}{
+		{"unknown recipe", map[string]config.Recipe{"web": {}}, "print", `unknown recipe "print" (available: web)`},
+		{"no recipes", nil, "print", "no recipes defined"},
+		{"unknown key", map[string]config.Recipe{"web": {"sharpness": int64(1)}}, "web", `unknown key "sharpness"`},
+		{"recipe key", map[string]config.Recipe{"web": {"recipe": "other"}}, "web", `unknown key "recipe"`},
+		{"bad value", map[string]config.Recipe{"web": {"frame": "wide"}}, "web", "invalid frame"},
+		{"array for single flag", map[string]config.Recipe{"web": {"fit": []any{"cover", "wrap"}}}, "web", "expected a single value"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			flags, _, _, _, _ := testRecipeFlags()
+			_, err := applyRecipe(flags, tc.recipe, tc.recipes)
+			if err == nil {
+				t.Fatal("applyRecipe expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tc.errText) {
+				t.Errorf("error %q does not contain %q", err, tc.errText)
+			}
+		})
+	}
+}
+
+func TestRecipeFlagsOverrides(t *testing.T) {
+	// A recipe with gravity, run with --focus on the command line
+	flags := pflag.NewFlagSet("process", pflag.ContinueOnError)
+	flags.String("gravity", "centre", "")
+	flags.String("focus", "", "")
+	flags.String("fit", "expand", "")
+	if err := flags.Parse([]string{"--focus", "0.3,0.4"}); err != nil {
+		t.Fatal(err)
+	}
+	set, err := applyRecipe(flags, "r", map[string]config.Recipe{"r": {"gravity": "north", "fit": "cover"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !set.overrides(flags, "focus", "gravity") {
+		t.Error("--focus doesn't override the recipe gravity")
+	}
+	for _, pair := range [][2]string{{"gravity", "focus"}, {"fit", "gravity"}} {
+		if set.overrides(flags, pair[0], pair[1]) {
+			t.Errorf("%s overrides %s", pair[0], pair[1])
+		}
+	}
+
+	gravitySet := flags.Changed("gravity") && !set.overrides(flags, "focus", "gravity")
+	crop, err := parseCropOptions("north", "0.3,0.4", gravitySet)
+	if err != nil || crop.Gravity != imglib.GravityFocus {
+		t.Errorf("parseCropOptions = %+v, %v; expected the command-line focus", crop, err)
+	}
+}
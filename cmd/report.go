@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// reportFormat selects the layout of the --report output.
+type reportFormat int
+
+const (
+	// reportNone writes no report.
+	reportNone reportFormat = iota
+	// reportJSON writes one JSON array of all files when the run is done.
+	reportJSON
+	// reportNDJSON writes one JSON object per file as soon as it is done.
+	reportNDJSON
+)
+
+// parseReportFormat converts a string to a reportFormat type.
+func parseReportFormat(s string) (reportFormat, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return reportNone, nil
+	case "json":
+		return reportJSON, nil
+	case "ndjson", "jsonl":
+		return reportNDJSON, nil
+	default:
+		return reportNone, fmt.Errorf("unknown report format: %s (use json or ndjson)", s)
+	}
+}
+
+// fileReport is the report record of one input file.
+type fileReport struct {
+	Input      string         `json:"input"`
+	InputHash  string         `json:"inputHash,omitempty"` // hex SHA-256
+	Width      int            `json:"width,omitempty"`
+	Height     int            `json:"height,omitempty"`
+	Label      string         `json:"label,omitempty"`
+	DurationMS float64        `json:"durationMs"`
+	Error      string         `json:"error,omitempty"`
+	Outputs    []outputReport `json:"outputs"`
+}
+
+// outputReport is the report record of one output.
+type outputReport struct {
+	Size       string  `json:"size"`
+	Variant    string  `json:"variant,omitempty"`
+	Path       string  `json:"path"`
+	Status     string  `json:"status"` // written, unchanged, skipped, planned or failed
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	Fit        string  `json:"fit"`
+	FramePx    int     `json:"framePx"`
+	DPI        float64 `json:"dpi,omitempty"`
+	PPI        float64 `json:"ppi,omitempty"` // effective source resolution, for dry runs
+	Bytes      int64   `json:"bytes,omitempty"`
+	Hash       string  `json:"hash,omitempty"`    // hex SHA-256
+	Quality    int     `json:"quality,omitempty"` // lowered to fit the file size budget
+	Downscaled bool    `json:"downscaled,omitempty"`
+	DurationMS float64 `json:"durationMs,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// newFileReport returns the report record of a processed file.
+func newFileReport(r processResult, fit string) fileReport {
+	rep := fileReport{
+		Input:      r.input,
+		InputHash:  r.inputHash,
+		Width:      r.srcWidth,
+		Height:     r.srcHeight,
+		Label:      r.label,
+		DurationMS: milliseconds(r.duration),
+		Outputs:    []outputReport{},
+	}
+	if r.err != nil {
+		rep.Error = r.err.Error()
+	}
+	for _, o := range r.outputs {
+		out := outputReport{
+			Size:       o.size,
+			Variant:    o.variant,
+			Path:       o.path,
+			Status:     "written",
+			Width:      o.outWidth,
+			Height:     o.outHeight,
+			Fit:        fit,
+			FramePx:    o.framePx,
+			DPI:        o.dpi,
+			PPI:        o.ppi,
+			Bytes:      o.bytes,
+			Hash:       o.hash,
+			Quality:    o.quality,
+			Downscaled: o.downscaled,
+			DurationMS: milliseconds(o.duration),
+		}
+		switch {
+		case o.err != nil:
+			out.Status, out.Error = "failed", o.err.Error()
+		case o.skipped:
+			out.Status = "skipped"
+		case o.cached:
+			out.Status = "unchanged"
+		case r.dryRun:
+			out.Status = "planned"
+		}
+		rep.Outputs = append(rep.Outputs, out)
+	}
+	return rep
+}
+
+// milliseconds returns d in milliseconds, rounded to microseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// reportWriter writes the report of a process run.
+type reportWriter struct {
+	format  reportFormat
+	w       io.Writer
+	file    *os.File // nil when writing to stdout
+	records []fileReport
+}
+
+// newReportWriter returns a writer of reports in format to path, or to
+// stdout if path is "" or "-".
+func newReportWriter(format reportFormat, path string) (*reportWriter, error) {
+	r := &reportWriter{format: format, w: os.Stdout}
+	if path != "" && path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create report: %w", err)
+		}
+		r.w, r.file = file, file
+	}
+	return r, nil
+}
+
+// add records a file. NDJSON records are written at once, so that scripts
+// can follow the run.
+func (r *reportWriter) add(rep fileReport) error {
+	if r.format == reportNDJSON {
+		return json.NewEncoder(r.w).Encode(rep)
+	}
+	r.records = append(r.records, rep)
+	return nil
+}
+
+// close writes the JSON report and closes the report file.
+func (r *reportWriter) close() error {
+	var err error
+	if r.format == reportJSON {
+		if r.records == nil {
+			r.records = []fileReport{}
+		}
+		enc := json.NewEncoder(r.w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r.records)
+	}
+	if r.file != nil {
+		if cerr := r.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReportFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected reportFormat
+	}{
+		{"", reportNone},
+		{"json", reportJSON},
+		{"NDJSON", reportNDJSON},
+		{"jsonl", reportNDJSON},
+	}
+	for _, tc := range tests {
+		got, err := parseReportFormat(tc.input)
+		if err != nil || got != tc.expected {
+			t.Errorf("parseReportFormat(%q) = %v, %v, expected %v", tc.input, got, err, tc.expected)
+		}
+	}
+	if _, err := parseReportFormat("csv"); err == nil {
+		t.Error("parseReportFormat(\"csv\") expected error, got nil")
+	}
+}
+
+func TestNewFileReport(t *testing.T) {
+	res := processResult{
+		input:     "photo.jpg",
+		inputHash: "abc",
+		srcWidth:  6000,
+		srcHeight: 4000,
+		label:     "Sunset",
+		duration:  1500 * time.Microsecond,
+		outputs: []outputResult{
+			{size: "ig-post", path: "photo_ig-post_v0.jpg", outWidth: 1080, outHeight: 1080, framePx: 54, bytes: 1000, hash: "def"},
+			{size: "ig-story", path: "photo_ig-story_v0.jpg", cached: true},
+			{size: "x-post", path: "photo_x-post_v0.jpg", skipped: true},
+			{size: "4x6", path: "photo_4x6_v0.jpg", err: errors.New("boom")},
+		},
+	}
+	rep := newFileReport(res, "cover")
+	if rep.Input != "photo.jpg" || rep.InputHash != "abc" || rep.Label != "Sunset" || rep.DurationMS != 1.5 {
+		t.Errorf("newFileReport = %+v", rep)
+	}
+	expected := []string{"written", "unchanged", "skipped", "failed"}
+	for i, out := range rep.Outputs {
+		if out.Status != expected[i] || out.Fit != "cover" {
+			t.Errorf("output %d: status %q, fit %q, expected %q, cover", i, out.Status, out.Fit, expected[i])
+		}
+	}
+	if out := rep.Outputs[0]; out.Width != 1080 || out.FramePx != 54 || out.Bytes != 1000 || out.Hash != "def" {
+		t.Errorf("output 0 = %+v", out)
+	}
+	if rep.Outputs[3].Error != "boom" {
+		t.Errorf("output 3 error = %q, expected boom", rep.Outputs[3].Error)
+	}
+
+	res.dryRun = true
+	if rep := newFileReport(res, "cover"); rep.Outputs[0].Status != "planned" {
+		t.Errorf("dry run status = %q, expected planned", rep.Outputs[0].Status)
+	}
+}
+
+func TestReportWriter(t *testing.T) {
+	records := []fileReport{{Input: "a.jpg"}, {Input: "b.jpg", Error: "failed to load"}}
+	for _, format := range []reportFormat{reportJSON, reportNDJSON} {
+		path := filepath.Join(t.TempDir(), "report")
+		r, err := newReportWriter(format, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rec := range records {
+			if err := r.add(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := r.close(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []fileReport
+		if format == reportJSON {
+			err = json.Unmarshal(data, &got)
+		} else {
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				var rec fileReport
+				if err = json.Unmarshal([]byte(line), &rec); err != nil {
+					break
+				}
+				got = append(got, rec)
+			}
+		}
+		if err != nil {
+			t.Fatalf("format %d: invalid report %q: %v", format, data, err)
+		}
+		if len(got) != 2 || got[0].Input != "a.jpg" || got[1].Error != "failed to load" {
+			t.Errorf("format %d: report %+v, expected %+v", format, got, records)
+		}
+	}
+}
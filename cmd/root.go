@@ -2,10 +2,16 @@ package cmd
 
 import (
 	"os"
+	"runtime/debug"
 
 	"github.com/spf13/cobra"
 )
 
+// version is the ansel version, set at build time with
+// -ldflags "-X github.com/cwygoda/ansel/cmd.version=v1.2.3". Without it, the
+// module version is used if the binary was installed with go install.
+var version = "dev"
+
 var rootCmd = &cobra.Command{
 	Use:   "ansel",
 	Short: "A CLI tool for image processing",
@@ -14,9 +20,9 @@ images for social media and print.
 
 Features:
   - Linear light resizing using Magic Kernel Sharp 2021
-  - Automatic framing with configurable colors and widths
+  - Automatic framing with configurable or image-derived colors and widths
   - Size presets for Instagram, Facebook, Twitter/X, YouTube, LinkedIn
-  - High-quality JPEG output
+  - JPEG, PNG, WebP, AVIF, TIFF and JPEG XL output
 
 Named after Ansel Adams, the legendary photographer known for his
 meticulous attention to image quality.
@@ -34,4 +40,9 @@ func Execute() {
 
 func init() {
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
+
+	if info, ok := debug.ReadBuildInfo(); ok && version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		version = info.Main.Version
+	}
+	rootCmd.Version = version
 }
@@ -0,0 +1,499 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cwygoda/ansel/internal/config"
+	imglib "github.com/cwygoda/ansel/internal/image"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// paperSizes are the named sheet sizes in millimetres, portrait.
+var paperSizes = map[string][2]float64{
+	"a5":      {148, 210},
+	"a4":      {210, 297},
+	"a3":      {297, 420},
+	"a3+":     {329, 483},
+	"letter":  {215.9, 279.4},
+	"legal":   {215.9, 355.6},
+	"tabloid": {279.4, 431.8},
+	"13x19":   {330.2, 482.6},
+}
+
+var sheetCmd = &cobra.Command{
+	Use:   "sheet [flags] <input>...",
+	Short: "Lay out several images on a print sheet",
+	Long: `Lay out images in a grid on a sheet of paper, e.g. four 4x6 prints on a
+letter sheet, to print them in one go and cut them apart.
+
+The sheet is a paper size at --dpi:
+  a5, a4, a3, a3+, letter, legal, tabloid, 13x19 (inches), or a size in
+  mm, cm or in such as 330x480mm
+
+The grid is given as --grid CxR, whose cells share the sheet, or as a cell
+size with --cell, e.g. 4x6in, in which case as many cells as fit are used,
+turned if more fit that way. Cells are separated by --gutter and the grid is
+centred inside --margin. Inputs that don't fit on one sheet continue on the
+next: sheet.jpg → sheet_1.jpg, sheet_2.jpg, ...
+
+Each image is resized to fit its cell (--fit expand) or to fill it (--fit
+cover), and turned to the cell's orientation unless --rotate=false. A frame
+and caption can be added to each cell, like "ansel process" does for whole
+images. --crop-marks extends every cut line into the margin around the grid.
+
+Examples:
+  # Four 4x6 prints on a letter sheet with crop marks
+  ansel sheet --paper letter --cell 4x6in --fit cover --crop-marks -o prints.tif *.jpg
+
+  # Contact sheet with titles, 4 by 5 on A4
+  ansel sheet --paper a4 --grid 4x5 --gutter 4mm --frame 3 --caption '{{.Title}}' *.jpg`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runSheet,
+}
+
+var (
+	sheetPaper       string
+	sheetLandscape   bool
+	sheetDPI         float64
+	sheetGrid        string
+	sheetCell        string
+	sheetMargin      string
+	sheetGutter      string
+	sheetFit         string
+	sheetRotate      bool
+	sheetFrame       float64
+	sheetFrameStyle  string
+	sheetColor       string
+	sheetPaperColor  string
+	sheetCropMarks   bool
+	sheetCaption     string
+	sheetCaptionFont string
+	sheetCaptionSize float64
+	sheetFilter      string
+	sheetSharpen     string
+	sheetProfile     string
+	sheetQuality     int
+	sheetOutput      string
+	sheetJobs        int
+	sheetJPEG        jpegFlags
+)
+
+func init() {
+	rootCmd.AddCommand(sheetCmd)
+
+	sheetCmd.Flags().StringVar(&sheetPaper, "paper", "a4", "Paper size: a5, a4, a3, a3+, letter, legal, tabloid, 13x19, or WxH in mm, cm or in")
+	sheetCmd.Flags().BoolVar(&sheetLandscape, "landscape", false, "Use the paper in landscape orientation")
+	sheetCmd.Flags().Float64Var(&sheetDPI, "dpi", defaultPrintDPI, "Print resolution of the sheet")
+	sheetCmd.Flags().StringVar(&sheetGrid, "grid", "", "Grid of cells as columns x rows, e.g. 2x2 (default 2x2 unless --cell is given)")
+	sheetCmd.Flags().StringVar(&sheetCell, "cell", "", "Cell size in mm, cm or in, e.g. 4x6in; fits as many cells as possible")
+	sheetCmd.Flags().StringVar(&sheetMargin, "margin", "10mm", "Space around the grid, where crop marks go")
+	sheetCmd.Flags().StringVar(&sheetGutter, "gutter", "5mm", "Space between cells")
+	sheetCmd.Flags().StringVar(&sheetFit, "fit", "expand", "Fit mode in each cell: expand or cover")
+	sheetCmd.Flags().BoolVar(&sheetRotate, "rotate", true, "Turn images to the orientation of the cells")
+	sheetCmd.Flags().Float64Var(&sheetFrame, "frame", 0, "Frame width in each cell as percentage of the cell's shorter side")
+	sheetCmd.Flags().StringVar(&sheetFrameStyle, "frame-style", "flat", "Frame style: flat, keyline, double, gallery, polaroid, shadow, or a style from the configuration")
+	sheetCmd.Flags().StringVar(&sheetColor, "color", "#fff", "Frame color (hex or named)")
+	sheetCmd.Flags().StringVar(&sheetPaperColor, "paper-color", "#fff", "Sheet color (hex or named)")
+	sheetCmd.Flags().BoolVar(&sheetCropMarks, "crop-marks", false, "Draw crop marks along every cut line")
+	sheetCmd.Flags().StringVar(&sheetCaption, "caption", "", "Caption template below each image, e.g. '{{.Title}}'")
+	sheetCmd.Flags().StringVar(&sheetCaptionFont, "caption-font", "sans", "Font family for captions")
+	sheetCmd.Flags().Float64Var(&sheetCaptionSize, "caption-size", 3, "Caption font size as percentage of the cell's shorter side")
+	sheetCmd.Flags().StringVar(&sheetFilter, "filter", "mks2021", "Resize filter: lanczos, catmull-rom, bilinear, mks2021")
+	sheetCmd.Flags().StringVar(&sheetSharpen, "sharpen", "none", "Output sharpening after resizing: screen-low, screen-high, matte, glossy, custom(radius,amount,threshold) or none")
+	sheetCmd.Flags().StringVar(&sheetProfile, "output-profile", "srgb", "Output ICC profile: srgb, p3, or path to an .icc file")
+	sheetCmd.Flags().IntVar(&sheetQuality, "quality", 92, "Output quality for lossy formats (1-100)")
+	sheetCmd.Flags().StringVarP(&sheetOutput, "output", "o", "sheet.jpg", "Output file; the format follows the extension")
+	sheetCmd.Flags().IntVarP(&sheetJobs, "jobs", "j", runtime.NumCPU(), "Number of images to prepare in parallel")
+	sheetJPEG.register(sheetCmd.Flags())
+}
+
+// sheetOptions holds the resolved settings for a sheet run.
+type sheetOptions struct {
+	layout       imglib.SheetLayout
+	dpi          float64
+	fit          string
+	rotate       bool
+	frameWidth   int
+	frameStyle   imglib.FrameStyle
+	frameColor   color.Color
+	paperColor   color.Color
+	cropMarks    bool
+	caption      *imglib.LabelTemplate // nil without captions
+	captionStyle imglib.LabelStyle
+	filter       imglib.Filter
+	sharpen      imglib.Sharpen
+	profile      imglib.OutputProfile
+	format       imglib.Format
+	encode       imglib.EncodeOptions
+}
+
+// cellResult is an image prepared for a cell of the sheet.
+type cellResult struct {
+	img *imglib.VipsImage
+	err error
+}
+
+func runSheet(cmd *cobra.Command, args []string) error {
+	imglib.InitVips()
+	defer imglib.ShutdownVips()
+
+	userCfg, err := config.LoadUserConfig()
+	if err != nil {
+		return err
+	}
+	projectCfg, err := config.LoadProjectConfig()
+	if err != nil {
+		return err
+	}
+	opts, err := newSheetOptions(cmd.Flags(), userCfg, projectCfg)
+	if err != nil {
+		return err
+	}
+	if sheetJobs < 1 {
+		return fmt.Errorf("invalid jobs: %d (must be at least 1)", sheetJobs)
+	}
+
+	// Fill one sheet at a time, so only its images are held in memory
+	perSheet := opts.layout.Count()
+	sheets := (len(args) + perSheet - 1) / perSheet
+	for n := range sheets {
+		inputs := args[n*perSheet : min((n+1)*perSheet, len(args))]
+		path := sheetOutput
+		if sheets > 1 {
+			ext := filepath.Ext(sheetOutput)
+			path = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(sheetOutput, ext), n+1, ext)
+		}
+		if err := renderSheet(inputs, path, opts); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d images on %s (%dx%d, %dx%d cells, %g dpi)\n",
+			path, len(inputs), sheetPaper, opts.layout.Width, opts.layout.Height, opts.layout.Columns, opts.layout.Rows, opts.dpi)
+	}
+	return nil
+}
+
+// newSheetOptions resolves the sheet flags.
+func newSheetOptions(flags *pflag.FlagSet, userCfg *config.UserConfig, projectCfg *config.ProjectConfig) (*sheetOptions, error) {
+	if sheetDPI <= 0 {
+		return nil, fmt.Errorf("invalid dpi: %g", sheetDPI)
+	}
+	layout, err := sheetLayout(sheetPaper, sheetLandscape, sheetGrid, sheetCell, sheetMargin, sheetGutter, sheetDPI)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &sheetOptions{
+		layout:    layout,
+		dpi:       sheetDPI,
+		fit:       sheetFit,
+		rotate:    sheetRotate,
+		cropMarks: sheetCropMarks,
+	}
+	if opts.fit != "expand" && opts.fit != "cover" {
+		return nil, fmt.Errorf("invalid fit mode: %s (use expand or cover)", opts.fit)
+	}
+
+	shorterSide := min(layout.CellWidth, layout.CellHeight)
+	opts.frameWidth = int(float64(shorterSide) * sheetFrame / 100.0)
+	if opts.profile, err = imglib.ParseOutputProfile(sheetProfile); err != nil {
+		return nil, err
+	}
+	styles, err := loadFrameStyles(userCfg.Frames, projectCfg.Frames, opts.profile, imglib.IntentPerceptual)
+	if err != nil {
+		return nil, err
+	}
+	if opts.frameStyle, err = lookupFrameStyle(sheetFrameStyle, styles); err != nil {
+		return nil, err
+	}
+	if opts.frameColor, err = imglib.ParseColor(sheetColor); err != nil {
+		return nil, fmt.Errorf("invalid color: %w", err)
+	}
+	if opts.paperColor, err = imglib.ParseColor(sheetPaperColor); err != nil {
+		return nil, fmt.Errorf("invalid paper color: %w", err)
+	}
+
+	if sheetCaption != "" {
+		if opts.caption, err = imglib.ParseLabelTemplate(sheetCaption); err != nil {
+			return nil, err
+		}
+		fontSize := max(8, int(float64(shorterSide)*sheetCaptionSize/100.0))
+		opts.captionStyle = imglib.LabelStyle{
+			Font:      fmt.Sprintf("%s %d", sheetCaptionFont, fontSize),
+			Size:      fontSize,
+			Align:     imglib.LabelCentre,
+			Placement: imglib.LabelInside,
+			MaxLines:  1,
+		}
+	}
+
+	if opts.filter, err = imglib.ParseFilter(sheetFilter); err != nil {
+		return nil, err
+	}
+	if opts.sharpen, err = imglib.ParseSharpen(sheetSharpen); err != nil {
+		return nil, err
+	}
+	if opts.frameColor, err = imglib.ConvertColor(opts.frameColor, opts.profile, imglib.IntentPerceptual); err != nil {
+		return nil, fmt.Errorf("invalid color: %w", err)
+	}
+	if opts.paperColor, err = imglib.ConvertColor(opts.paperColor, opts.profile, imglib.IntentPerceptual); err != nil {
+		return nil, fmt.Errorf("invalid paper color: %w", err)
+	}
+
+	var ok bool
+	if opts.format, ok = imglib.FormatFromPath(sheetOutput); !ok {
+		return nil, fmt.Errorf("unknown output format for %s", sheetOutput)
+	}
+	opts.encode = imglib.DefaultEncodeOptions(sheetQuality)
+	opts.encode.StripMetadata = false
+	if err := sheetJPEG.apply(flags, &opts.encode); err != nil {
+		return nil, err
+	}
+	if err := opts.encode.Validate(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// sheetLayout resolves the paper, grid and spacing flags to a layout in
+// pixels at dpi. A cell size is tried both ways round, and turned if more
+// cells fit that way.
+func sheetLayout(paper string, landscape bool, grid, cell, margin, gutter string, dpi float64) (imglib.SheetLayout, error) {
+	paperWidth, paperHeight, err := parsePaperSize(paper, dpi)
+	if err != nil {
+		return imglib.SheetLayout{}, err
+	}
+	if landscape != (paperWidth > paperHeight) {
+		paperWidth, paperHeight = paperHeight, paperWidth
+	}
+	layout := imglib.SheetLayout{Width: paperWidth, Height: paperHeight}
+
+	for _, l := range []struct {
+		value string
+		px    *int
+		name  string
+	}{{margin, &layout.Margin, "margin"}, {gutter, &layout.Gutter, "gutter"}} {
+		length, err := parsePrintLength(l.value)
+		if err != nil {
+			return layout, fmt.Errorf("invalid %s: %w", l.name, err)
+		}
+		*l.px, _ = length.pixels(dpi)
+	}
+
+	if grid != "" {
+		if layout.Columns, layout.Rows, err = parseGrid(grid); err != nil {
+			return layout, err
+		}
+	}
+	if cell == "" {
+		if grid == "" {
+			layout.Columns, layout.Rows = 2, 2
+		}
+		return layout.Resolve()
+	}
+
+	layout.CellWidth, layout.CellHeight, err = parseCellSize(cell, dpi)
+	if err != nil {
+		return layout, err
+	}
+	if grid != "" {
+		return layout.Resolve()
+	}
+	upright, errUpright := layout.Resolve()
+	turned := layout
+	turned.CellWidth, turned.CellHeight = layout.CellHeight, layout.CellWidth
+	turned, errTurned := turned.Resolve()
+	switch {
+	case errUpright != nil && errTurned != nil:
+		return layout, errUpright
+	case errUpright != nil || (errTurned == nil && turned.Count() > upright.Count()):
+		return turned, nil
+	}
+	return upright, nil
+}
+
+// parsePaperSize returns the size in pixels at dpi of a named paper size or
+// of a size such as 330x480mm, in portrait orientation.
+func parsePaperSize(s string, dpi float64) (int, int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	px := func(mm float64) int { return int(math.Round(mm / unitsPerInch["mm"] * dpi)) }
+	if size, ok := paperSizes[s]; ok {
+		return px(size[0]), px(size[1]), nil
+	}
+	w, h, err := parseCellSize(s, dpi)
+	if err != nil {
+		names := make([]string, 0, len(paperSizes))
+		for name := range paperSizes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return 0, 0, fmt.Errorf("unknown paper size: %s (use %s, or WxH in mm, cm or in)", s, strings.Join(names, ", "))
+	}
+	return min(w, h), max(w, h), nil
+}
+
+// parseCellSize returns the size in pixels at dpi of a physical size such
+// as 4x6in or 10x15cm.
+func parseCellSize(s string, dpi float64) (int, int, error) {
+	m := printSizeRegex.FindStringSubmatch(strings.ToLower(strings.Join(strings.Fields(s), "")))
+	if m == nil || m[3] == "" {
+		return 0, 0, fmt.Errorf("invalid size: %s (use e.g. 4x6in or 10x15cm)", s)
+	}
+	w, _ := strconv.ParseFloat(m[1], 64)
+	h, _ := strconv.ParseFloat(m[2], 64)
+	width := int(math.Round(w / unitsPerInch[m[3]] * dpi))
+	height := int(math.Round(h / unitsPerInch[m[3]] * dpi))
+	if width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return width, height, nil
+}
+
+// parseGrid parses a grid written as columns x rows, e.g. 3x4.
+func parseGrid(s string) (int, int, error) {
+	cols, rows, ok := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "x")
+	c, errC := strconv.Atoi(strings.TrimSpace(cols))
+	r, errR := strconv.Atoi(strings.TrimSpace(rows))
+	if !ok || errC != nil || errR != nil || c < 1 || r < 1 {
+		return 0, 0, fmt.Errorf("invalid grid: %s (use columns x rows, e.g. 2x3)", s)
+	}
+	return c, r, nil
+}
+
+// renderSheet prepares the images in parallel, lays them out on one sheet
+// and saves it to path.
+func renderSheet(inputs []string, path string, opts *sheetOptions) error {
+	results := runPool(inputs, sheetJobs, func(input string) cellResult {
+		img, err := renderCell(input, opts)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", input, err)
+		}
+		return cellResult{img: img, err: err}
+	}, func(cellResult) {})
+
+	var cells []*imglib.VipsImage
+	var firstErr error
+	for _, r := range results {
+		if r.err != nil && firstErr == nil {
+			firstErr = r.err
+		}
+		if r.img != nil {
+			defer r.img.Close()
+			cells = append(cells, r.img)
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	sheet, err := imglib.ComposeSheet(opts.layout, cells, opts.paperColor)
+	if err != nil {
+		return err
+	}
+	defer sheet.Close()
+
+	if opts.cropMarks {
+		// Hairlines of 0.25pt, 5mm long and 1.5mm clear of the grid
+		mm := opts.dpi / unitsPerInch["mm"]
+		weight := max(1, int(math.Round(opts.dpi/288)))
+		marks := opts.layout.CropMarks(int(math.Round(5*mm)), int(math.Round(1.5*mm)), weight)
+		if err := sheet.DrawMarks(marks, color.Black); err != nil {
+			return err
+		}
+	}
+
+	if err := sheet.ApplyMetadataPolicy(imglib.MetadataOptions{Policy: imglib.MetadataNone}, opts.format); err != nil {
+		return fmt.Errorf("failed to apply metadata policy: %w", err)
+	}
+	if err := sheet.SetResolution(opts.dpi); err != nil {
+		return err
+	}
+	if err := sheet.SaveFormat(path, opts.format, opts.encode); err != nil {
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	return nil
+}
+
+// renderCell loads an image and renders it at the cell size with its frame
+// and caption.
+func renderCell(input string, opts *sheetOptions) (*imglib.VipsImage, error) {
+	var caption string
+	if opts.caption != nil {
+		text, err := opts.caption.Execute(imglib.ReadMetadata(input))
+		if err != nil {
+			return nil, err
+		}
+		caption = text
+	}
+
+	img, err := imglib.LoadVips(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load: %w", err)
+	}
+	if err := renderCellImage(img, caption, opts); err != nil {
+		img.Close()
+		return nil, err
+	}
+	return img, nil
+}
+
+// renderCellImage turns, resizes, frames and captions img in place.
+func renderCellImage(img *imglib.VipsImage, caption string, opts *sheetOptions) error {
+	layout := opts.layout
+	if err := img.ConvertToProfile(opts.profile, imglib.IntentPerceptual); err != nil {
+		return err
+	}
+	portrait := img.Height() > img.Width()
+	if opts.rotate && layout.CellWidth != layout.CellHeight && img.Width() != img.Height() &&
+		portrait != (layout.CellHeight > layout.CellWidth) {
+		if err := img.Rotate90(); err != nil {
+			return err
+		}
+	}
+
+	// The caption goes in a band below the image, inside the frame
+	frame := opts.frameStyle.Insets(opts.frameWidth)
+	band := 0
+	if caption != "" {
+		band = 2 * opts.captionStyle.Size
+	}
+	availWidth := layout.CellWidth - frame.Left - frame.Right
+	availHeight := layout.CellHeight - frame.Top - frame.Bottom - band
+	if availWidth <= 0 || availHeight <= 0 {
+		return fmt.Errorf("frame and caption too large for the cell")
+	}
+
+	if opts.fit == "cover" {
+		err := img.ResizeToCover(availWidth, availHeight, opts.filter, imglib.LinearLight, imglib.CropOptions{Gravity: imglib.GravityCentre})
+		if err != nil {
+			return err
+		}
+	} else if err := img.ResizeToFitColorspace(availWidth, availHeight, opts.filter, imglib.LinearLight); err != nil {
+		return err
+	}
+	if err := img.Sharpen(opts.sharpen); err != nil {
+		return err
+	}
+
+	x := frame.Left + (availWidth-img.Width())/2
+	y := frame.Top + (availHeight-img.Height())/2
+	area := image.Rect(x, y, x+img.Width(), y+img.Height())
+	if err := img.AddFrameStyle(opts.frameStyle, opts.frameWidth, layout.CellWidth, layout.CellHeight, x, y, opts.frameColor); err != nil {
+		return err
+	}
+	if caption != "" {
+		if err := img.AddLabel(caption, opts.captionStyle, area); err != nil {
+			return fmt.Errorf("failed to add caption: %w", err)
+		}
+	}
+	return nil
+}
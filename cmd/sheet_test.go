@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestParsePaperSize(t *testing.T) {
+	tests := []struct {
+		input         string
+		width, height int
+	}{
+		{"a4", 2480, 3508},
+		{"Letter", 2550, 3300},
+		{"13x19", 3900, 5700},
+		{"480x330mm", 3898, 5669},
+		{"8.5 x 11 in", 2550, 3300},
+	}
+	for _, tc := range tests {
+		w, h, err := parsePaperSize(tc.input, 300)
+		if err != nil {
+			t.Fatalf("parsePaperSize(%q) failed: %v", tc.input, err)
+		}
+		if w != tc.width || h != tc.height {
+			t.Errorf("parsePaperSize(%q) = %dx%d, expected %dx%d", tc.input, w, h, tc.width, tc.height)
+		}
+	}
+
+	for _, input := range []string{"", "a9", "210x297", "0x297mm"} {
+		if _, _, err := parsePaperSize(input, 300); err == nil {
+			t.Errorf("parsePaperSize(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestParseGrid(t *testing.T) {
+	if c, r, err := parseGrid("3x4"); err != nil || c != 3 || r != 4 {
+		t.Errorf("parseGrid(3x4) = %d, %d, %v", c, r, err)
+	}
+	for _, input := range []string{"", "3", "0x2", "3x", "2.5x2"} {
+		if _, _, err := parseGrid(input); err == nil {
+			t.Errorf("parseGrid(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestSheetLayout(t *testing.T) {
+	tests := []struct {
+		name                  string
+		paper                 string
+		landscape             bool
+		grid, cell            string
+		columns, rows         int
+		cellWidth, cellHeight int
+	}{
+		{"default grid", "a4", false, "", "", 2, 2, 1092, 1606},
+		{"grid", "a4", true, "3x2", "", 3, 2, 1051, 1092},
+		// Two 4x6 cells fit on letter only when turned
+		{"cell turned", "letter", false, "", "4x6in", 1, 2, 1800, 1200},
+		{"cell", "letter", true, "", "4x6in", 2, 1, 1200, 1800},
+		{"cell and grid", "letter", false, "1x2", "6x4in", 1, 2, 1800, 1200},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := sheetLayout(tc.paper, tc.landscape, tc.grid, tc.cell, "10mm", "5mm", 300)
+			if err != nil {
+				t.Fatalf("sheetLayout failed: %v", err)
+			}
+			if l.Columns != tc.columns || l.Rows != tc.rows || l.CellWidth != tc.cellWidth || l.CellHeight != tc.cellHeight {
+				t.Errorf("layout = %dx%d cells of %dx%d, expected %dx%d cells of %dx%d",
+					l.Columns, l.Rows, l.CellWidth, l.CellHeight, tc.columns, tc.rows, tc.cellWidth, tc.cellHeight)
+			}
+		})
+	}
+
+	for _, tc := range []struct{ paper, grid, cell, margin string }{
+		{"a4", "", "10x12in", "10mm"},
+		{"a4", "2x2", "6x4in", "10mm"},
+		{"a4", "", "", "12cm"},
+		{"a4", "2", "", "10mm"},
+		{"a4", "", "", "wide"},
+	} {
+		if _, err := sheetLayout(tc.paper, false, tc.grid, tc.cell, tc.margin, "5mm", 300); err == nil {
+			t.Errorf("sheetLayout(%+v) expected error, got nil", tc)
+		}
+	}
+}
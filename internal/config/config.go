@@ -0,0 +1,259 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+const configFileName = ".ansel.toml"
+
+// userConfigFileName is relative to the user's configuration directory.
+const userConfigFileName = "ansel/config.toml"
+
+// ProjectConfig represents the project-local configuration.
+type ProjectConfig struct {
+	Publish  PublishConfig         `toml:"publish"`
+	Presets  map[string]Preset     `toml:"preset,omitempty"`
+	Families map[string][]string   `toml:"family,omitempty"` // preset families, e.g. shop-auto = ["shop-portrait", "shop-square"]
+	Frames   map[string]FrameStyle `toml:"frame,omitempty"`
+	Recipes  map[string]Recipe     `toml:"recipe,omitempty"`
+}
+
+// UserConfig represents the per-user configuration. Presets, families,
+// frame styles and recipes defined here are available in every directory;
+// project definitions with the same name take precedence.
+type UserConfig struct {
+	Presets  map[string]Preset     `toml:"preset,omitempty"`
+	Families map[string][]string   `toml:"family,omitempty"`
+	Frames   map[string]FrameStyle `toml:"frame,omitempty"`
+	Recipes  map[string]Recipe     `toml:"recipe,omitempty"`
+}
+
+// Preset is a user-defined output size from a [preset.<name>] table.
+type Preset struct {
+	Width  int `toml:"width"`
+	Height int `toml:"height"`
+
+	// Rotate swaps width and height to match the orientation of each image
+	Rotate bool `toml:"rotate,omitempty"`
+
+	// DPI is the print resolution written to the output, 0 for none
+	DPI float64 `toml:"dpi,omitempty"`
+
+	// MaxFileSize, e.g. "8MB", is the default file size budget of outputs
+	MaxFileSize string `toml:"max_file_size,omitempty"`
+
+	// Optional metadata
+	Platform string  `toml:"platform,omitempty"`
+	Format   string  `toml:"format,omitempty"` // recommended output format
+	SafeZone *Insets `toml:"safe_zone,omitempty"`
+}
+
+// Insets are distances in pixels from the edges of an output image, e.g.
+// the area covered by a platform's interface.
+type Insets struct {
+	Top    int `toml:"top,omitempty" json:"top"`
+	Right  int `toml:"right,omitempty" json:"right"`
+	Bottom int `toml:"bottom,omitempty" json:"bottom"`
+	Left   int `toml:"left,omitempty" json:"left"`
+}
+
+// FrameStyle is a frame style from a [frame.<name>] table. Widths, the
+// radius and shadow lengths are relative to the frame width (--frame).
+type FrameStyle struct {
+	Layers []FrameLayer `toml:"layers"`           // from the image outwards
+	Sides  []float64    `toml:"sides,omitempty"`  // top, right, bottom, left; default 1 each
+	Radius float64      `toml:"radius,omitempty"` // corner radius
+	Shadow *FrameShadow `toml:"shadow,omitempty"`
+}
+
+// FrameLayer is one layer of a frame style.
+type FrameLayer struct {
+	Width float64 `toml:"width"`           // share of the frame
+	Color string  `toml:"color,omitempty"` // default: the frame colour (--color)
+}
+
+// FrameShadow is the drop shadow of a frame style.
+type FrameShadow struct {
+	Blur    float64   `toml:"blur,omitempty"`
+	Offset  []float64 `toml:"offset,omitempty"` // x, y
+	Opacity float64   `toml:"opacity,omitempty"`
+	Color   string    `toml:"color,omitempty"`
+}
+
+// Recipe is a named set of process options from a [recipe.<name>] table.
+// Keys are process flag names, with underscores or hyphens; values are
+// strings, numbers, booleans, or arrays for flags that can be repeated.
+type Recipe map[string]any
+
+// PublishConfig holds publishing-related settings.
+type PublishConfig struct {
+	Subdomain    string `toml:"subdomain"`
+	HostedZoneID string `toml:"hosted_zone_id"`
+	DomainName   string `toml:"domain_name"`
+}
+
+// LoadProjectConfig loads the configuration from .ansel.toml in the current directory.
+// Returns an empty config if the file doesn't exist.
+func LoadProjectConfig() (*ProjectConfig, error) {
+	data, err := os.ReadFile(configFileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &ProjectConfig{}, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", configFileName, err)
+	}
+
+	var cfg ProjectConfig
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", configFileName, err)
+	}
+
+	return &cfg, nil
+}
+
+// UserConfigPath returns the path of the user configuration file,
+// e.g. ~/.config/ansel/config.toml on Linux.
+func UserConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, userConfigFileName), nil
+}
+
+// LoadUserConfig loads the user configuration file.
+// Returns an empty config if the file doesn't exist.
+func LoadUserConfig() (*UserConfig, error) {
+	path, err := UserConfigPath()
+	if err != nil {
+		// No home directory, so there can't be a user config either
+		return &UserConfig{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &UserConfig{}, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var cfg UserConfig
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// SavePublishConfig writes the publish settings to the [publish] table of
+// .ansel.toml in the current directory. Only the publish keys are rewritten;
+// the rest of the file, including comments and the order of its tables, is
+// kept as it is. The table is appended if the file doesn't have one.
+func SavePublishConfig(publish PublishConfig) error {
+	data, err := os.ReadFile(configFileName)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", configFileName, err)
+	}
+
+	keys, err := toml.Marshal(publish)
+	if err != nil {
+		return fmt.Errorf("failed to serialize config: %w", err)
+	}
+	updated := setTableKeys(string(data), "publish", strings.SplitAfter(string(keys), "\n"))
+
+	// A publish table given as dotted keys or an inline table can't be
+	// updated line by line, and would now be defined twice.
+	var cfg ProjectConfig
+	if err := toml.Unmarshal([]byte(updated), &cfg); err != nil || cfg.Publish != publish {
+		return fmt.Errorf("failed to update the [publish] table of %s; edit it by hand", configFileName)
+	}
+
+	if err := os.WriteFile(configFileName, []byte(updated), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", configFileName, err)
+	}
+
+	return nil
+}
+
+// setTableKeys sets the "key = value" lines in table of the TOML document
+// data, replacing the lines of keys that are already there and adding the
+// others after the table's last key.
+func setTableKeys(data, table string, lines []string) string {
+	values := make(map[string]string)
+	var order []string
+	for _, line := range lines {
+		if key, ok := tomlKey(line); ok {
+			values[key] = strings.TrimRight(line, "\n") + "\n"
+			order = append(order, key)
+		}
+	}
+
+	doc := strings.SplitAfter(data, "\n")
+	if doc[len(doc)-1] == "" {
+		doc = doc[:len(doc)-1]
+	}
+	if n := len(doc); n > 0 && !strings.HasSuffix(doc[n-1], "\n") {
+		doc[n-1] += "\n"
+	}
+
+	var out []string
+	found, inTable := false, false
+	insert := -1 // index in out after the table's last key
+	for _, line := range doc {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			name := strings.TrimSpace(strings.Trim(strings.SplitN(trimmed, "#", 2)[0], " \t[]"))
+			inTable = !strings.HasPrefix(trimmed, "[[") && name == table
+			if inTable {
+				found = true
+				out = append(out, line)
+				insert = len(out)
+				continue
+			}
+		}
+		if inTable {
+			if key, ok := tomlKey(line); ok {
+				if value, ok := values[key]; ok {
+					line = value
+					delete(values, key)
+				}
+				out = append(out, line)
+				insert = len(out)
+				continue
+			}
+		}
+		out = append(out, line)
+	}
+
+	var missing []string
+	for _, key := range order {
+		if value, ok := values[key]; ok {
+			missing = append(missing, value)
+		}
+	}
+	if !found {
+		if len(out) > 0 {
+			out = append(out, "\n")
+		}
+		out = append(out, "["+table+"]\n")
+		insert = len(out)
+	}
+	out = append(out[:insert], append(missing, out[insert:]...)...)
+	return strings.Join(out, "")
+}
+
+// tomlKey returns the bare key of a "key = value" line.
+func tomlKey(line string) (string, bool) {
+	key, _, ok := strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || strings.HasPrefix(key, "#") || strings.HasPrefix(key, "[") {
+		return "", false
+	}
+	return key, true
+}
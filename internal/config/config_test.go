@@ -0,0 +1,232 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadProjectConfigRecipes(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	data := `[publish]
+subdomain = "abc"
+
+[recipe.instagram]
+size = ["ig-post", "ig-story"]
+fit = "cover"
+frame = 3
+quality = 90
+label = true
+`
+	if err := os.WriteFile(configFileName, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadProjectConfig()
+	if err != nil {
+		t.Fatalf("LoadProjectConfig failed: %v", err)
+	}
+	if cfg.Publish.Subdomain != "abc" {
+		t.Errorf("subdomain = %q, expected %q", cfg.Publish.Subdomain, "abc")
+	}
+
+	expected := Recipe{
+		"size":    []any{"ig-post", "ig-story"},
+		"fit":     "cover",
+		"frame":   int64(3),
+		"quality": int64(90),
+		"label":   true,
+	}
+	if got := cfg.Recipes["instagram"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("recipe = %#v, expected %#v", got, expected)
+	}
+
+}
+
+func TestSavePublishConfig(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	data := `# Project settings
+[recipe.instagram] # square and story
+size = ["ig-post", "ig-story"]
+fit = "cover"
+
+[publish]
+subdomain = "abc" # chosen by hand
+domain_name = "example.com"
+
+[preset.lab]
+width = 1535
+height = 2126
+`
+	if err := os.WriteFile(configFileName, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	publish := PublishConfig{Subdomain: "xyz", HostedZoneID: "Z123", DomainName: "example.com"}
+	if err := SavePublishConfig(publish); err != nil {
+		t.Fatalf("SavePublishConfig failed: %v", err)
+	}
+	got, err := os.ReadFile(configFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# Project settings
+[recipe.instagram] # square and story
+size = ["ig-post", "ig-story"]
+fit = "cover"
+
+[publish]
+subdomain = 'xyz'
+domain_name = 'example.com'
+hosted_zone_id = 'Z123'
+
+[preset.lab]
+width = 1535
+height = 2126
+`
+	if string(got) != expected {
+		t.Errorf("saved config:\n%s\nexpected:\n%s", got, expected)
+	}
+
+	cfg, err := LoadProjectConfig()
+	if err != nil {
+		t.Fatalf("LoadProjectConfig failed: %v", err)
+	}
+	if cfg.Publish != publish {
+		t.Errorf("publish = %+v, expected %+v", cfg.Publish, publish)
+	}
+	expectedRecipe := Recipe{"size": []any{"ig-post", "ig-story"}, "fit": "cover"}
+	if !reflect.DeepEqual(cfg.Recipes["instagram"], expectedRecipe) {
+		t.Errorf("recipe = %#v, expected %#v", cfg.Recipes["instagram"], expectedRecipe)
+	}
+}
+
+func TestSavePublishConfigNewTable(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	publish := PublishConfig{Subdomain: "abc", HostedZoneID: "Z123", DomainName: "example.com"}
+	for _, data := range []string{"", "[recipe.web]\nformat = \"webp\""} {
+		if err := os.WriteFile(configFileName, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := SavePublishConfig(publish); err != nil {
+			t.Fatalf("SavePublishConfig(%q) failed: %v", data, err)
+		}
+		cfg, err := LoadProjectConfig()
+		if err != nil {
+			t.Fatalf("LoadProjectConfig failed: %v", err)
+		}
+		if cfg.Publish != publish {
+			t.Errorf("publish = %+v, expected %+v", cfg.Publish, publish)
+		}
+		if data != "" && cfg.Recipes["web"]["format"] != "webp" {
+			t.Errorf("recipe = %#v", cfg.Recipes["web"])
+		}
+	}
+
+	// Dotted publish keys can't be updated in place
+	if err := os.WriteFile(configFileName, []byte("publish.subdomain = \"abc\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SavePublishConfig(publish); err == nil {
+		t.Error("SavePublishConfig with dotted keys expected error, got nil")
+	}
+}
+
+func TestLoadProjectConfigMissing(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	cfg, err := LoadProjectConfig()
+	if err != nil {
+		t.Fatalf("LoadProjectConfig failed: %v", err)
+	}
+	if len(cfg.Recipes) != 0 {
+		t.Errorf("expected no recipes, got %v", cfg.Recipes)
+	}
+}
+
+func TestLoadUserConfigPresets(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+
+	cfg, err := LoadUserConfig()
+	if err != nil {
+		t.Fatalf("LoadUserConfig without a file failed: %v", err)
+	}
+	if len(cfg.Presets) != 0 {
+		t.Errorf("expected no presets, got %v", cfg.Presets)
+	}
+
+	path, err := UserConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := `[preset.lab-13x18]
+width = 1535
+height = 2126
+platform = "Print lab"
+max_file_size = "20MB"
+format = "tiff"
+safe_zone = { top = 10, bottom = 20 }
+
+[recipe.web]
+format = "webp"
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err = LoadUserConfig()
+	if err != nil {
+		t.Fatalf("LoadUserConfig failed: %v", err)
+	}
+	expected := Preset{
+		Width:       1535,
+		Height:      2126,
+		Platform:    "Print lab",
+		MaxFileSize: "20MB",
+		Format:      "tiff",
+		SafeZone:    &Insets{Top: 10, Bottom: 20},
+	}
+	if got := cfg.Presets["lab-13x18"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("preset = %#v, expected %#v", got, expected)
+	}
+	if cfg.Recipes["web"]["format"] != "webp" {
+		t.Errorf("recipe = %#v", cfg.Recipes["web"])
+	}
+}
+
+func TestLoadProjectConfigFrames(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	data := `[frame.gallery]
+layers = [{ width = 1, color = "#222" }, { width = 9 }]
+sides = [1, 1, 1.4, 1]
+radius = 0.5
+shadow = { blur = 0.2, offset = [0.1, 0.2], opacity = 0.4 }
+`
+	if err := os.WriteFile(configFileName, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadProjectConfig()
+	if err != nil {
+		t.Fatalf("LoadProjectConfig failed: %v", err)
+	}
+	expected := FrameStyle{
+		Layers: []FrameLayer{{Width: 1, Color: "#222"}, {Width: 9}},
+		Sides:  []float64{1, 1, 1.4, 1},
+		Radius: 0.5,
+		Shadow: &FrameShadow{Blur: 0.2, Offset: []float64{0.1, 0.2}, Opacity: 0.4},
+	}
+	if got := cfg.Frames["gallery"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("frame = %#v, expected %#v", got, expected)
+	}
+}
@@ -0,0 +1,127 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// BackgroundMode selects what fills the area around the image.
+type BackgroundMode int
+
+const (
+	// BackgroundColor fills the frame with the frame colour.
+	BackgroundColor BackgroundMode = iota
+	// BackgroundBlur fills the frame with the image itself, scaled up to
+	// cover the output and blurred.
+	BackgroundBlur
+	// BackgroundImage fills the frame with another image.
+	BackgroundImage
+)
+
+// Background describes the fill around the image.
+type Background struct {
+	Mode BackgroundMode
+	Path string // image file for BackgroundImage
+}
+
+// ParseBackground converts "color", "blur" or "image:<path>" to a Background.
+func ParseBackground(s string) (Background, error) {
+	switch strings.ToLower(s) {
+	case "color", "colour":
+		return Background{Mode: BackgroundColor}, nil
+	case "blur":
+		return Background{Mode: BackgroundBlur}, nil
+	}
+	if path, ok := strings.CutPrefix(s, "image:"); ok {
+		if path == "" {
+			return Background{}, fmt.Errorf("missing path in background: %s", s)
+		}
+		return Background{Mode: BackgroundImage, Path: path}, nil
+	}
+	return Background{}, fmt.Errorf("unknown background: %s (use color, blur or image:<path>)", s)
+}
+
+// String returns the background name.
+func (b Background) String() string {
+	switch b.Mode {
+	case BackgroundColor:
+		return "color"
+	case BackgroundBlur:
+		return "blur"
+	case BackgroundImage:
+		return "image:" + b.Path
+	default:
+		return "unknown"
+	}
+}
+
+// CoverBackground returns a width x height background made from the image:
+// scaled to cover the area, centred, blurred with a Gaussian of the given
+// sigma in pixels, and darkened by dim (0-1). All steps are done in linear
+// light, so blurred highlights keep their brightness.
+func (v *VipsImage) CoverBackground(width, height int, sigma, dim float64, filter Filter) (*VipsImage, error) {
+	bg, err := v.Copy()
+	if err != nil {
+		return nil, err
+	}
+	if err := bg.coverBackground(width, height, sigma, dim, filter); err != nil {
+		bg.Close()
+		return nil, err
+	}
+	return bg, nil
+}
+
+// coverBackground does the work of CoverBackground in place.
+func (v *VipsImage) coverBackground(width, height int, sigma, dim float64, filter Filter) error {
+	if v.ref.HasAlpha() {
+		if err := v.ref.Flatten(&vips.Color{}); err != nil {
+			return fmt.Errorf("flatten failed: %w", err)
+		}
+	}
+
+	outSpace := vips.InterpretationSRGB
+	switch v.ref.Interpretation() {
+	case vips.InterpretationRGB16, vips.InterpretationGrey16:
+		outSpace = vips.InterpretationRGB16
+	}
+	if err := v.ref.ToColorSpace(vips.InterpretationScRGB); err != nil {
+		return fmt.Errorf("convert to linear light failed: %w", err)
+	}
+
+	scale := max(float64(width)/float64(v.ref.Width()), float64(height)/float64(v.ref.Height()))
+	if err := v.ref.Resize(scale, filterToVipsKernel(filter)); err != nil {
+		return fmt.Errorf("resize failed: %w", err)
+	}
+
+	// Centre crop; rounding in the resize may leave a pixel less than requested
+	cropWidth, cropHeight := min(width, v.ref.Width()), min(height, v.ref.Height())
+	left := (v.ref.Width() - cropWidth) / 2
+	top := (v.ref.Height() - cropHeight) / 2
+	if err := v.ref.ExtractArea(left, top, cropWidth, cropHeight); err != nil {
+		return fmt.Errorf("crop failed: %w", err)
+	}
+	if cropWidth < width || cropHeight < height {
+		if err := v.ref.Embed(0, 0, width, height, vips.ExtendCopy); err != nil {
+			return fmt.Errorf("embed failed: %w", err)
+		}
+	}
+
+	debugLog("CoverBackground: %dx%d sigma=%.1f dim=%.2f", width, height, sigma, dim)
+	if sigma > 0 {
+		if err := v.ref.GaussianBlur(sigma); err != nil {
+			return fmt.Errorf("blur failed: %w", err)
+		}
+	}
+	if dim > 0 {
+		if err := v.ref.Linear([]float64{1 - dim}, []float64{0}); err != nil {
+			return fmt.Errorf("dim failed: %w", err)
+		}
+	}
+
+	if err := v.ref.ToColorSpace(outSpace); err != nil {
+		return fmt.Errorf("convert from linear light failed: %w", err)
+	}
+	return nil
+}
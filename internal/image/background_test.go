@@ -0,0 +1,101 @@
+package image
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseBackground(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Background
+		hasErr   bool
+	}{
+		{"color", Background{Mode: BackgroundColor}, false},
+		{"colour", Background{Mode: BackgroundColor}, false},
+		{"blur", Background{Mode: BackgroundBlur}, false},
+		{"BLUR", Background{Mode: BackgroundBlur}, false},
+		{"image:paper.jpg", Background{Mode: BackgroundImage, Path: "paper.jpg"}, false},
+		{"image:", Background{}, true},
+		{"gradient", Background{}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseBackground(tc.input)
+			if tc.hasErr {
+				if err == nil {
+					t.Errorf("ParseBackground(%q) expected error", tc.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBackground(%q) unexpected error: %v", tc.input, err)
+			}
+			if got != tc.expected {
+				t.Errorf("ParseBackground(%q) = %+v, expected %+v", tc.input, got, tc.expected)
+			}
+			if round, _ := ParseBackground(got.String()); round != got {
+				t.Errorf("String() = %q doesn't round-trip", got.String())
+			}
+		})
+	}
+}
+
+func TestVipsCoverBackground(t *testing.T) {
+	img, err := LoadVips(testImageVips)
+	if err != nil {
+		t.Fatalf("LoadVips failed: %v", err)
+	}
+	defer img.Close()
+
+	// Wider and taller than the image's aspect ratio
+	for _, size := range [][2]int{{400, 100}, {100, 400}, {333, 333}} {
+		bg, err := img.CoverBackground(size[0], size[1], 8, 0.5, Bilinear)
+		if err != nil {
+			t.Fatalf("CoverBackground(%v) failed: %v", size, err)
+		}
+		if bg.Width() != size[0] || bg.Height() != size[1] {
+			t.Errorf("CoverBackground(%v) size = %dx%d", size, bg.Width(), bg.Height())
+		}
+		bg.Close()
+	}
+
+	// The source is unchanged
+	width := img.Width()
+	if _, err := img.CoverBackground(10, 10, 0, 0, Bilinear); err != nil {
+		t.Fatalf("CoverBackground failed: %v", err)
+	}
+	if img.Width() != width {
+		t.Errorf("CoverBackground changed the source width to %d", img.Width())
+	}
+}
+
+func TestVipsAddFrameStyleOver(t *testing.T) {
+	img, err := LoadVips(testImageVips)
+	if err != nil {
+		t.Fatalf("LoadVips failed: %v", err)
+	}
+	defer img.Close()
+
+	if err := img.ResizeToFit(200, 150, Bilinear); err != nil {
+		t.Fatalf("ResizeToFit failed: %v", err)
+	}
+	bands := img.ref.Bands()
+	background, err := img.CoverBackground(300, 300, 4, 0, Bilinear)
+	if err != nil {
+		t.Fatalf("CoverBackground failed: %v", err)
+	}
+	defer background.Close()
+
+	x, y := (300-img.Width())/2, (300-img.Height())/2
+	if err := img.AddFrameStyleOver(testGalleryStyle(), 20, background, x, y, color.White); err != nil {
+		t.Fatalf("AddFrameStyleOver failed: %v", err)
+	}
+	if img.Width() != 300 || img.Height() != 300 {
+		t.Errorf("AddFrameStyleOver size = %dx%d, expected 300x300", img.Width(), img.Height())
+	}
+	if img.ref.Bands() != bands {
+		t.Errorf("AddFrameStyleOver changed bands from %d to %d", bands, img.ref.Bands())
+	}
+}
@@ -0,0 +1,103 @@
+package image
+
+import (
+	"errors"
+)
+
+// ErrOverBudget is returned by EncodeWithin when the image doesn't fit the
+// byte budget even at the lowest quality.
+var ErrOverBudget = errors.New("output exceeds the file size budget")
+
+// budgetQualityFloor is the lowest quality EncodeWithin tries per format.
+// Below it, compression artefacts are worse than a smaller image.
+var budgetQualityFloor = map[Format]int{
+	JPEG: 50,
+	WebP: 50,
+	AVIF: 35,
+	JXL:  45,
+	PNG:  30,
+	TIFF: 50,
+}
+
+// HasQuality reports whether the quality setting changes the size of format
+// encoded with opts, i.e. whether EncodeWithin can search it.
+func HasQuality(format Format, opts EncodeOptions) bool {
+	switch format {
+	case JPEG, AVIF:
+		return true
+	case WebP:
+		return !opts.WebPLossless
+	case JXL:
+		// The quality is converted to a distance unless one is given
+		return opts.JXLDistance == 0
+	case PNG:
+		return opts.PNGPalette
+	case TIFF:
+		return opts.TIFFCompression == TiffJPEG || opts.TIFFCompression == TiffWebP
+	default:
+		return false
+	}
+}
+
+// EncodeWithin encodes the image like Encode, lowering the quality as little
+// as needed for the output to take at most maxBytes. JPEG output that still
+// doesn't fit at the lowest quality is tried again with 4:2:0 chroma
+// subsampling. Returns the encoded bytes and the settings that produced them.
+//
+// If the image can't be made to fit, the smallest encoding is returned with
+// ErrOverBudget, so that the caller can shrink the image and try again.
+func (v *VipsImage) EncodeWithin(format Format, opts EncodeOptions, maxBytes int64) ([]byte, EncodeOptions, error) {
+	return searchQuality(format, opts, maxBytes, func(o EncodeOptions) ([]byte, error) {
+		return v.Encode(format, o)
+	})
+}
+
+// searchQuality finds the highest quality at which encode fits maxBytes, by
+// bisection between the format's floor and opts.Quality.
+func searchQuality(format Format, opts EncodeOptions, maxBytes int64, encode func(EncodeOptions) ([]byte, error)) ([]byte, EncodeOptions, error) {
+	data, err := encode(opts)
+	if err != nil {
+		return nil, opts, err
+	}
+	if maxBytes <= 0 || int64(len(data)) <= maxBytes {
+		return data, opts, nil
+	}
+	if !HasQuality(format, opts) {
+		return data, opts, ErrOverBudget
+	}
+
+	low := opts
+	low.Quality = min(budgetQualityFloor[format], opts.Quality)
+	lowData := data
+	if low.Quality < opts.Quality {
+		if lowData, err = encode(low); err != nil {
+			return nil, low, err
+		}
+	}
+	if int64(len(lowData)) > maxBytes {
+		if format == JPEG && !opts.JPEGSubsample.subsamples(low.Quality) {
+			opts.JPEGSubsample = Subsample420
+			return searchQuality(format, opts, maxBytes, encode)
+		}
+		debugLog("EncodeWithin: %d bytes at quality %d, over %d", len(lowData), low.Quality, maxBytes)
+		return lowData, low, ErrOverBudget
+	}
+
+	// low fits and high doesn't; narrow the gap to one quality step
+	high := opts.Quality
+	for high-low.Quality > 1 {
+		mid := low
+		mid.Quality = (low.Quality + high) / 2
+		midData, err := encode(mid)
+		if err != nil {
+			return nil, mid, err
+		}
+		if int64(len(midData)) <= maxBytes {
+			low, lowData = mid, midData
+		} else {
+			high = mid.Quality
+		}
+	}
+	debugLog("EncodeWithin: %s at quality %d, %d of %d bytes", format, low.Quality, len(lowData), maxBytes)
+	return lowData, low, nil
+}
@@ -0,0 +1,116 @@
+package image
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeEncode pretends that each quality step costs 1000 bytes, and that
+// chroma subsampled JPEG takes 60% of that.
+func fakeEncode(format Format, calls *int) func(EncodeOptions) ([]byte, error) {
+	return func(o EncodeOptions) ([]byte, error) {
+		*calls++
+		n := o.Quality * 1000
+		if format == JPEG && o.JPEGSubsample.subsamples(o.Quality) {
+			n = n * 6 / 10
+		}
+		return make([]byte, n), nil
+	}
+}
+
+func TestSearchQuality(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    Format
+		opts      EncodeOptions
+		maxBytes  int64
+		quality   int
+		subsample ChromaSubsampling
+		over      bool
+	}{
+		{"no budget", WebP, EncodeOptions{Quality: 92}, 0, 92, SubsampleAuto, false},
+		{"fits", WebP, EncodeOptions{Quality: 92}, 100_000, 92, SubsampleAuto, false},
+		{"lower quality", WebP, EncodeOptions{Quality: 92}, 70_500, 70, SubsampleAuto, false},
+		{"below floor", WebP, EncodeOptions{Quality: 92}, 40_000, 50, SubsampleAuto, true},
+		{"lossless", WebP, EncodeOptions{Quality: 92, WebPLossless: true}, 40_000, 92, SubsampleAuto, true},
+		{"quality below floor", AVIF, EncodeOptions{Quality: 20}, 10_000, 20, SubsampleAuto, true},
+		// libvips subsamples below quality 90 by itself
+		{"jpeg auto", JPEG, EncodeOptions{Quality: 95}, 60_000, 89, SubsampleAuto, false},
+		{"jpeg subsampled", JPEG, EncodeOptions{Quality: 92, JPEGSubsample: Subsample444}, 40_000, 66, Subsample420, false},
+		{"jpeg over", JPEG, EncodeOptions{Quality: 92, JPEGSubsample: Subsample444}, 20_000, 50, Subsample420, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			data, got, err := searchQuality(tc.format, tc.opts, tc.maxBytes, fakeEncode(tc.format, &calls))
+			if tc.over != errors.Is(err, ErrOverBudget) {
+				t.Fatalf("searchQuality error = %v, expected over budget: %v", err, tc.over)
+			}
+			if !tc.over && err != nil {
+				t.Fatalf("searchQuality failed: %v", err)
+			}
+			if got.Quality != tc.quality || got.JPEGSubsample != tc.subsample {
+				t.Errorf("quality = %d (%s), expected %d (%s)", got.Quality, got.JPEGSubsample, tc.quality, tc.subsample)
+			}
+			if !tc.over && tc.maxBytes > 0 && int64(len(data)) > tc.maxBytes {
+				t.Errorf("%d bytes, over the budget of %d", len(data), tc.maxBytes)
+			}
+			if calls > 16 {
+				t.Errorf("%d encodes, expected a bisection", calls)
+			}
+		})
+	}
+}
+
+func TestVipsEncodeWithin(t *testing.T) {
+	img, err := LoadVips(testImageVips)
+	if err != nil {
+		t.Fatalf("LoadVips failed: %v", err)
+	}
+	defer img.Close()
+	if err := img.ResizeToFit(400, 400, Bilinear); err != nil {
+		t.Fatalf("ResizeToFit failed: %v", err)
+	}
+
+	full, err := img.Encode(JPEG, DefaultEncodeOptions(95))
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	budget := int64(len(full)) * 2 / 3
+	data, opts, err := img.EncodeWithin(JPEG, DefaultEncodeOptions(95), budget)
+	if err != nil {
+		t.Fatalf("EncodeWithin failed: %v", err)
+	}
+	if int64(len(data)) > budget || opts.Quality >= 95 {
+		t.Errorf("%d bytes at quality %d, expected at most %d below quality 95", len(data), opts.Quality, budget)
+	}
+
+	if _, _, err := img.EncodeWithin(JPEG, DefaultEncodeOptions(95), 100); !errors.Is(err, ErrOverBudget) {
+		t.Errorf("EncodeWithin(100 bytes) error = %v, expected ErrOverBudget", err)
+	}
+}
+
+func TestVipsEncodeWithinJXL(t *testing.T) {
+	img, err := LoadVips(testImageVips)
+	if err != nil {
+		t.Fatalf("LoadVips failed: %v", err)
+	}
+	defer img.Close()
+	if err := img.ResizeToFit(400, 400, Bilinear); err != nil {
+		t.Fatalf("ResizeToFit failed: %v", err)
+	}
+
+	// Without a distance, the quality sets it, so the search can lower it
+	full, err := img.Encode(JXL, DefaultEncodeOptions(95))
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	budget := int64(len(full)) * 2 / 3
+	data, opts, err := img.EncodeWithin(JXL, DefaultEncodeOptions(95), budget)
+	if err != nil {
+		t.Fatalf("EncodeWithin failed: %v", err)
+	}
+	if int64(len(data)) > budget || opts.Quality >= 95 {
+		t.Errorf("%d bytes at quality %d, expected at most %d below quality 95", len(data), opts.Quality, budget)
+	}
+}
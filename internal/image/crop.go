@@ -0,0 +1,211 @@
+package image
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// Gravity selects which part of the image is kept when cropping.
+type Gravity int
+
+const (
+	// GravityCentre keeps the centre of the image.
+	GravityCentre Gravity = iota
+	// GravityNorth keeps the top edge.
+	GravityNorth
+	// GravitySouth keeps the bottom edge.
+	GravitySouth
+	// GravityEast keeps the right edge.
+	GravityEast
+	// GravityWest keeps the left edge.
+	GravityWest
+	// GravityNorthEast keeps the top right corner.
+	GravityNorthEast
+	// GravityNorthWest keeps the top left corner.
+	GravityNorthWest
+	// GravitySouthEast keeps the bottom right corner.
+	GravitySouthEast
+	// GravitySouthWest keeps the bottom left corner.
+	GravitySouthWest
+	// GravityAttention keeps the most eye-catching region, using libvips'
+	// attention detector (skin tones, saturation and edges).
+	GravityAttention
+	// GravityEntropy keeps the region with the most detail.
+	GravityEntropy
+	// GravityFocus keeps the explicit focus point in CropOptions centred
+	// as far as possible.
+	GravityFocus
+)
+
+// ParseGravity converts a string to a Gravity type.
+func ParseGravity(s string) (Gravity, error) {
+	switch strings.ToLower(s) {
+	case "centre", "center", "c":
+		return GravityCentre, nil
+	case "north", "n", "top":
+		return GravityNorth, nil
+	case "south", "s", "bottom":
+		return GravitySouth, nil
+	case "east", "e", "right":
+		return GravityEast, nil
+	case "west", "w", "left":
+		return GravityWest, nil
+	case "northeast", "ne":
+		return GravityNorthEast, nil
+	case "northwest", "nw":
+		return GravityNorthWest, nil
+	case "southeast", "se":
+		return GravitySouthEast, nil
+	case "southwest", "sw":
+		return GravitySouthWest, nil
+	case "attention", "smart":
+		return GravityAttention, nil
+	case "entropy":
+		return GravityEntropy, nil
+	default:
+		return GravityCentre, fmt.Errorf("unknown gravity: %s", s)
+	}
+}
+
+// String returns the gravity name.
+func (g Gravity) String() string {
+	switch g {
+	case GravityCentre:
+		return "centre"
+	case GravityNorth:
+		return "north"
+	case GravitySouth:
+		return "south"
+	case GravityEast:
+		return "east"
+	case GravityWest:
+		return "west"
+	case GravityNorthEast:
+		return "northeast"
+	case GravityNorthWest:
+		return "northwest"
+	case GravitySouthEast:
+		return "southeast"
+	case GravitySouthWest:
+		return "southwest"
+	case GravityAttention:
+		return "attention"
+	case GravityEntropy:
+		return "entropy"
+	case GravityFocus:
+		return "focus"
+	default:
+		return "unknown"
+	}
+}
+
+// CropOptions controls which part of the image ResizeToCover keeps.
+type CropOptions struct {
+	Gravity Gravity
+	// FocusX and FocusY are the focus point for GravityFocus, as fractions
+	// (0-1) of the image width and height from the top left corner.
+	FocusX, FocusY float64
+}
+
+// ParseFocus parses a focus point given as "x,y" fractions of the image
+// size, e.g. "0.5,0.3" for the horizontal centre, 30% from the top.
+func ParseFocus(s string) (float64, float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid focus point: %s (use x,y)", s)
+	}
+	var coords [2]float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || v < 0 || v > 1 {
+			return 0, 0, fmt.Errorf("invalid focus point: %s (coordinates must be 0-1)", s)
+		}
+		coords[i] = v
+	}
+	return coords[0], coords[1], nil
+}
+
+// cropOffset returns the offset of a crop window of size crop within size
+// that keeps the point at fraction f as central as possible.
+func cropOffset(size, crop int, f float64) int {
+	offset := int(f*float64(size) - float64(crop)/2 + 0.5)
+	if offset < 0 {
+		return 0
+	}
+	if offset > size-crop {
+		return size - crop
+	}
+	return offset
+}
+
+// gravityFocus returns the focus point fractions for the edge and corner
+// gravities.
+func gravityFocus(g Gravity) (float64, float64) {
+	x, y := 0.5, 0.5
+	switch g {
+	case GravityNorth, GravityNorthEast, GravityNorthWest:
+		y = 0
+	case GravitySouth, GravitySouthEast, GravitySouthWest:
+		y = 1
+	}
+	switch g {
+	case GravityWest, GravityNorthWest, GravitySouthWest:
+		x = 0
+	case GravityEast, GravityNorthEast, GravitySouthEast:
+		x = 1
+	}
+	return x, y
+}
+
+// ResizeToCover resizes the image to cover width x height, maintaining
+// aspect ratio, and crops the overflow according to crop.
+func (v *VipsImage) ResizeToCover(width, height int, filter Filter, space Colorspace, crop CropOptions) error {
+	scaleX := float64(width) / float64(v.ref.Width())
+	scaleY := float64(height) / float64(v.ref.Height())
+	scale := scaleX
+	if scaleY > scaleX {
+		scale = scaleY
+	}
+
+	if err := v.resizeColorspace(scale, filter, space); err != nil {
+		return err
+	}
+
+	// Rounding in the resize may leave a pixel less than requested
+	if v.ref.Width() < width {
+		width = v.ref.Width()
+	}
+	if v.ref.Height() < height {
+		height = v.ref.Height()
+	}
+	if v.ref.Width() == width && v.ref.Height() == height {
+		return nil
+	}
+
+	debugLog("ResizeToCover: cropping %dx%d to %dx%d with gravity %s", v.ref.Width(), v.ref.Height(), width, height, crop.Gravity)
+	switch crop.Gravity {
+	case GravityAttention, GravityEntropy:
+		interesting := vips.InterestingAttention
+		if crop.Gravity == GravityEntropy {
+			interesting = vips.InterestingEntropy
+		}
+		if err := v.ref.SmartCrop(width, height, interesting); err != nil {
+			return fmt.Errorf("smart crop failed: %w", err)
+		}
+		return nil
+	}
+
+	fx, fy := crop.FocusX, crop.FocusY
+	if crop.Gravity != GravityFocus {
+		fx, fy = gravityFocus(crop.Gravity)
+	}
+	left := cropOffset(v.ref.Width(), width, fx)
+	top := cropOffset(v.ref.Height(), height, fy)
+	if err := v.ref.ExtractArea(left, top, width, height); err != nil {
+		return fmt.Errorf("crop failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package image
+
+import "testing"
+
+func TestParseGravity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Gravity
+	}{
+		{"centre", GravityCentre},
+		{"center", GravityCentre},
+		{"north", GravityNorth},
+		{"SE", GravitySouthEast},
+		{"attention", GravityAttention},
+		{"smart", GravityAttention},
+		{"entropy", GravityEntropy},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			g, err := ParseGravity(tc.input)
+			if err != nil {
+				t.Fatalf("ParseGravity(%q) failed: %v", tc.input, err)
+			}
+			if g != tc.expected {
+				t.Errorf("ParseGravity(%q) = %v, expected %v", tc.input, g, tc.expected)
+			}
+		})
+	}
+
+	// Focus is selected with --focus, not by name
+	for _, s := range []string{"focus", "middle"} {
+		if _, err := ParseGravity(s); err == nil {
+			t.Errorf("ParseGravity(%q) expected error, got nil", s)
+		}
+	}
+}
+
+func TestParseFocus(t *testing.T) {
+	tests := []struct {
+		input  string
+		x, y   float64
+		hasErr bool
+	}{
+		{"0.5,0.5", 0.5, 0.5, false},
+		{"0, 1", 0, 1, false},
+		{"0.3,0.25", 0.3, 0.25, false},
+		{"1.5,0.5", 0, 0, true},
+		{"-0.1,0.5", 0, 0, true},
+		{"0.5", 0, 0, true},
+		{"a,b", 0, 0, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			x, y, err := ParseFocus(tc.input)
+			if tc.hasErr {
+				if err == nil {
+					t.Errorf("ParseFocus(%q) expected error, got %v,%v", tc.input, x, y)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFocus(%q) failed: %v", tc.input, err)
+			}
+			if x != tc.x || y != tc.y {
+				t.Errorf("ParseFocus(%q) = %v,%v, expected %v,%v", tc.input, x, y, tc.x, tc.y)
+			}
+		})
+	}
+}
+
+func TestCropOffset(t *testing.T) {
+	tests := []struct {
+		size, crop int
+		f          float64
+		expected   int
+	}{
+		{1000, 500, 0.5, 250},
+		{1000, 500, 0, 0},
+		{1000, 500, 1, 500},
+		{1000, 500, 0.1, 0},   // clamped at the start
+		{1000, 500, 0.9, 500}, // clamped at the end
+		{1000, 500, 0.4, 150},
+		{500, 500, 0.7, 0},
+	}
+
+	for _, tc := range tests {
+		if got := cropOffset(tc.size, tc.crop, tc.f); got != tc.expected {
+			t.Errorf("cropOffset(%d, %d, %v) = %d, expected %d", tc.size, tc.crop, tc.f, got, tc.expected)
+		}
+	}
+}
+
+func TestGravityFocus(t *testing.T) {
+	tests := []struct {
+		gravity Gravity
+		x, y    float64
+	}{
+		{GravityCentre, 0.5, 0.5},
+		{GravityNorth, 0.5, 0},
+		{GravitySouth, 0.5, 1},
+		{GravityEast, 1, 0.5},
+		{GravityWest, 0, 0.5},
+		{GravityNorthWest, 0, 0},
+		{GravitySouthEast, 1, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.gravity.String(), func(t *testing.T) {
+			x, y := gravityFocus(tc.gravity)
+			if x != tc.x || y != tc.y {
+				t.Errorf("gravityFocus(%v) = %v,%v, expected %v,%v", tc.gravity, x, y, tc.x, tc.y)
+			}
+		})
+	}
+}
+
+func TestVipsResizeToCover(t *testing.T) {
+	for _, crop := range []CropOptions{
+		{Gravity: GravityCentre},
+		{Gravity: GravityNorthWest},
+		{Gravity: GravityAttention},
+		{Gravity: GravityFocus, FocusX: 0.2, FocusY: 0.8},
+	} {
+		t.Run(crop.Gravity.String(), func(t *testing.T) {
+			img, err := LoadVips(testImageVips)
+			if err != nil {
+				t.Fatalf("LoadVips failed: %v", err)
+			}
+			defer img.Close()
+
+			// Portrait target from a landscape source and vice versa
+			for _, size := range [][2]int{{108, 192}, {192, 108}} {
+				if err := img.ResizeToCover(size[0], size[1], MagicKernelSharp2021, LinearLight, crop); err != nil {
+					t.Fatalf("ResizeToCover failed: %v", err)
+				}
+				if img.Width() != size[0] || img.Height() != size[1] {
+					t.Errorf("ResizeToCover(%dx%d) = %dx%d", size[0], size[1], img.Width(), img.Height())
+				}
+			}
+		})
+	}
+}
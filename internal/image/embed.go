@@ -0,0 +1,773 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"sort"
+)
+
+// jpegXMPHeader identifies an XMP APP1 segment.
+var jpegXMPHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// injectMetadata writes XMP and IPTC blocks into an encoded image.
+// IPTC is only written to JPEG and TIFF; the other formats have no IPTC
+// container and carry the same fields in XMP instead.
+func injectMetadata(data []byte, format Format, blocks *metadataBlocks, hasAlpha bool) ([]byte, error) {
+	if blocks == nil || (len(blocks.xmp) == 0 && len(blocks.iim) == 0) {
+		return data, nil
+	}
+
+	switch format {
+	case JPEG:
+		return injectJPEGMetadata(data, blocks)
+	case PNG:
+		return injectPNGMetadata(data, blocks)
+	case WebP:
+		return injectWebPMetadata(data, blocks, hasAlpha)
+	case TIFF:
+		return injectTIFFMetadata(data, blocks)
+	case JXL:
+		return injectJXLMetadata(data, blocks)
+	case AVIF:
+		return injectAVIFMetadata(data, blocks)
+	default:
+		return nil, fmt.Errorf("can't write metadata to %s", format)
+	}
+}
+
+// injectJPEGMetadata inserts XMP (APP1) and IPTC (APP13) segments after the
+// leading APPn segments written by libvips.
+func injectJPEGMetadata(data []byte, blocks *metadataBlocks) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, fmt.Errorf("not a JPEG file")
+	}
+
+	// Find the end of the leading APP0-APP15 segments
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xff && data[pos+1] >= 0xe0 && data[pos+1] <= 0xef {
+		pos += 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+	}
+	if pos > len(data) {
+		return nil, fmt.Errorf("truncated JPEG segment")
+	}
+
+	var segments bytes.Buffer
+	writeSegment := func(marker byte, payload ...[]byte) {
+		size := 2
+		for _, p := range payload {
+			size += len(p)
+		}
+		if size > 0xffff {
+			debugLog("injectMetadata: skipping %d byte APP%d segment, too large for JPEG", size, marker-0xe0)
+			return
+		}
+		segments.Write([]byte{0xff, marker})
+		binary.Write(&segments, binary.BigEndian, uint16(size))
+		for _, p := range payload {
+			segments.Write(p)
+		}
+	}
+	if len(blocks.xmp) > 0 {
+		writeSegment(0xe1, jpegXMPHeader, blocks.xmp)
+	}
+	if len(blocks.iim) > 0 {
+		writeSegment(0xed, wrapPhotoshopIPTC(blocks.iim))
+	}
+
+	out := make([]byte, 0, len(data)+segments.Len())
+	out = append(out, data[:pos]...)
+	out = append(out, segments.Bytes()...)
+	return append(out, data[pos:]...), nil
+}
+
+// injectPNGMetadata inserts an XMP iTXt chunk before the first IDAT chunk.
+func injectPNGMetadata(data []byte, blocks *metadataBlocks) ([]byte, error) {
+	signature := []byte("\x89PNG\r\n\x1a\n")
+	if !bytes.HasPrefix(data, signature) {
+		return nil, fmt.Errorf("not a PNG file")
+	}
+	if len(blocks.xmp) == 0 {
+		return data, nil
+	}
+
+	pos := len(signature)
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		if string(data[pos+4:pos+8]) == "IDAT" {
+			break
+		}
+		pos += 12 + length
+	}
+	if pos+8 > len(data) {
+		return nil, fmt.Errorf("no IDAT chunk in PNG file")
+	}
+
+	// iTXt: keyword, NUL, compression flag, method, language NUL, translated keyword NUL, text
+	var payload bytes.Buffer
+	payload.WriteString("XML:com.adobe.xmp")
+	payload.Write([]byte{0, 0, 0, 0, 0})
+	payload.Write(blocks.xmp)
+
+	var chunk bytes.Buffer
+	binary.Write(&chunk, binary.BigEndian, uint32(payload.Len()))
+	typeAndData := append([]byte("iTXt"), payload.Bytes()...)
+	chunk.Write(typeAndData)
+	binary.Write(&chunk, binary.BigEndian, crc32.ChecksumIEEE(typeAndData))
+
+	out := make([]byte, 0, len(data)+chunk.Len())
+	out = append(out, data[:pos]...)
+	out = append(out, chunk.Bytes()...)
+	return append(out, data[pos:]...), nil
+}
+
+// VP8X feature flags.
+const (
+	webpFlagXMP   = 0x04
+	webpFlagAlpha = 0x10
+)
+
+// injectWebPMetadata appends an XMP chunk, converting a simple WebP file to
+// the extended (VP8X) format if needed.
+func injectWebPMetadata(data []byte, blocks *metadataBlocks, hasAlpha bool) ([]byte, error) {
+	if len(data) < 20 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("not a WebP file")
+	}
+	if len(blocks.xmp) == 0 {
+		return data, nil
+	}
+
+	body := append([]byte(nil), data[12:]...)
+	switch string(body[0:4]) {
+	case "VP8X":
+		body[8] |= webpFlagXMP
+	case "VP8 ", "VP8L":
+		width, height, err := webpDimensions(body)
+		if err != nil {
+			return nil, err
+		}
+		flags := byte(webpFlagXMP)
+		if hasAlpha {
+			flags |= webpFlagAlpha
+		}
+		vp8x := make([]byte, 18)
+		copy(vp8x, "VP8X")
+		binary.LittleEndian.PutUint32(vp8x[4:8], 10)
+		vp8x[8] = flags
+		putUint24(vp8x[12:15], width-1)
+		putUint24(vp8x[15:18], height-1)
+		body = append(vp8x, body...)
+	default:
+		return nil, fmt.Errorf("unexpected WebP chunk %q", body[0:4])
+	}
+
+	// Metadata chunks go after the image data
+	body = append(body, "XMP "...)
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(blocks.xmp)))
+	body = append(body, blocks.xmp...)
+	if len(blocks.xmp)%2 != 0 {
+		body = append(body, 0)
+	}
+
+	out := make([]byte, 0, 12+len(body))
+	out = append(out, "RIFF"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(4+len(body)))
+	out = append(out, "WEBP"...)
+	return append(out, body...), nil
+}
+
+// webpDimensions reads the canvas size from a simple VP8 or VP8L chunk.
+func webpDimensions(chunk []byte) (int, int, error) {
+	switch string(chunk[0:4]) {
+	case "VP8 ":
+		// Frame tag (3 bytes), start code (3 bytes), then 14-bit width and height
+		if len(chunk) < 18 {
+			return 0, 0, fmt.Errorf("truncated VP8 chunk")
+		}
+		width := int(binary.LittleEndian.Uint16(chunk[14:16]) & 0x3fff)
+		height := int(binary.LittleEndian.Uint16(chunk[16:18]) & 0x3fff)
+		return width, height, nil
+	case "VP8L":
+		// Signature byte, then 14-bit width-1 and height-1
+		if len(chunk) < 13 {
+			return 0, 0, fmt.Errorf("truncated VP8L chunk")
+		}
+		bits := binary.LittleEndian.Uint32(chunk[9:13])
+		width := int(bits&0x3fff) + 1
+		height := int((bits>>14)&0x3fff) + 1
+		return width, height, nil
+	default:
+		return 0, 0, fmt.Errorf("unexpected WebP chunk %q", chunk[0:4])
+	}
+}
+
+// putUint24 writes a little-endian 24-bit value.
+func putUint24(b []byte, v int) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
+
+// TIFF tags of the metadata blocks.
+const (
+	tiffTagXMP  = 700
+	tiffTagIPTC = 33723
+)
+
+// TIFF field types.
+const (
+	tiffTypeByte      = 1
+	tiffTypeUndefined = 7
+)
+
+// injectTIFFMetadata adds XMP and IPTC entries to the first IFD. The IFD is
+// rewritten at the end of the file with the block data, and the header is
+// pointed at it; the old IFD is left unreferenced.
+func injectTIFFMetadata(data []byte, blocks *metadataBlocks) ([]byte, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("not a TIFF file")
+	}
+	var order binary.ByteOrder
+	switch string(data[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a TIFF file")
+	}
+	if order.Uint16(data[2:4]) != 42 {
+		return nil, fmt.Errorf("unsupported TIFF variant %d", order.Uint16(data[2:4]))
+	}
+
+	ifd := int(order.Uint32(data[4:8]))
+	if ifd+2 > len(data) {
+		return nil, fmt.Errorf("truncated TIFF header")
+	}
+	count := int(order.Uint16(data[ifd : ifd+2]))
+	end := ifd + 2 + count*12
+	if end+4 > len(data) {
+		return nil, fmt.Errorf("truncated TIFF IFD")
+	}
+
+	var entries [][]byte
+	for i := 0; i < count; i++ {
+		entry := data[ifd+2+i*12 : ifd+14+i*12]
+		if tag := order.Uint16(entry[0:2]); tag != tiffTagXMP && tag != tiffTagIPTC {
+			entries = append(entries, entry)
+		}
+	}
+
+	out := append([]byte(nil), data...)
+	add := func(tag, kind uint16, payload []byte) {
+		entry := make([]byte, 12)
+		order.PutUint16(entry[0:2], tag)
+		order.PutUint16(entry[2:4], kind)
+		order.PutUint32(entry[4:8], uint32(len(payload)))
+		if len(payload) <= 4 {
+			copy(entry[8:12], payload)
+		} else {
+			if len(out)%2 != 0 {
+				out = append(out, 0)
+			}
+			order.PutUint32(entry[8:12], uint32(len(out)))
+			out = append(out, payload...)
+		}
+		entries = append(entries, entry)
+	}
+	if len(blocks.xmp) > 0 {
+		add(tiffTagXMP, tiffTypeByte, blocks.xmp)
+	}
+	if len(blocks.iim) > 0 {
+		add(tiffTagIPTC, tiffTypeUndefined, blocks.iim)
+	}
+
+	// Entries must be sorted by tag
+	sort.Slice(entries, func(i, j int) bool {
+		return order.Uint16(entries[i][0:2]) < order.Uint16(entries[j][0:2])
+	})
+	if len(out)%2 != 0 {
+		out = append(out, 0)
+	}
+	newIFD := len(out)
+	out = append(out, 0, 0)
+	order.PutUint16(out[newIFD:], uint16(len(entries)))
+	for _, entry := range entries {
+		out = append(out, entry...)
+	}
+	out = append(out, data[end:end+4]...) // next IFD
+	if len(out) > math.MaxUint32 {
+		return nil, fmt.Errorf("TIFF file too large for metadata")
+	}
+	order.PutUint32(out[4:8], uint32(newIFD))
+	return out, nil
+}
+
+// jxlSignature starts a JPEG XL file in the ISOBMFF container format.
+var jxlSignature = []byte{0, 0, 0, 0x0c, 'J', 'X', 'L', ' ', 0x0d, 0x0a, 0x87, 0x0a}
+
+// injectJXLMetadata appends an XMP box, wrapping a bare JPEG XL codestream
+// in the container format if needed.
+func injectJXLMetadata(data []byte, blocks *metadataBlocks) ([]byte, error) {
+	if len(blocks.xmp) == 0 {
+		return data, nil
+	}
+
+	var out []byte
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0x0a}):
+		out = append(out, jxlSignature...)
+		out = appendBox(out, "ftyp", []byte("jxl \x00\x00\x00\x00jxl "))
+		out = appendBox(out, "jxlc", data)
+	case bytes.HasPrefix(data, jxlSignature):
+		var err error
+		if out, err = closeLastBox(data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("not a JPEG XL file")
+	}
+	return appendBox(out, "xml ", blocks.xmp), nil
+}
+
+// isoBox is an ISOBMFF box at data[start:end], with its payload at
+// data[body:end].
+type isoBox struct {
+	typ              string
+	start, body, end int
+}
+
+// readBoxes returns the boxes in data[start:end].
+func readBoxes(data []byte, start, end int) ([]isoBox, error) {
+	var boxes []isoBox
+	for pos := start; pos < end; {
+		if pos+8 > end {
+			return nil, fmt.Errorf("truncated box at %d", pos)
+		}
+		box := isoBox{typ: string(data[pos+4 : pos+8]), start: pos, body: pos + 8}
+		size := uint64(binary.BigEndian.Uint32(data[pos : pos+4]))
+		switch size {
+		case 0: // to the end
+			size = uint64(end - pos)
+		case 1:
+			if pos+16 > end {
+				return nil, fmt.Errorf("truncated box at %d", pos)
+			}
+			size = binary.BigEndian.Uint64(data[pos+8 : pos+16])
+			box.body = pos + 16
+		}
+		if size < uint64(box.body-pos) || size > uint64(end-pos) {
+			return nil, fmt.Errorf("invalid %q box size %d", box.typ, size)
+		}
+		box.end = pos + int(size)
+		boxes = append(boxes, box)
+		pos = box.end
+	}
+	return boxes, nil
+}
+
+// appendBox appends a box of the given type and payload to out.
+func appendBox(out []byte, typ string, payload []byte) []byte {
+	if size := 8 + len(payload); size <= math.MaxUint32 {
+		out = binary.BigEndian.AppendUint32(out, uint32(size))
+		out = append(out, typ...)
+	} else {
+		out = binary.BigEndian.AppendUint32(out, 1)
+		out = append(out, typ...)
+		out = binary.BigEndian.AppendUint64(out, uint64(16+len(payload)))
+	}
+	return append(out, payload...)
+}
+
+// closeLastBox returns a copy of data in which a last box that extends to
+// the end of the file has an explicit size, so that boxes can be appended.
+func closeLastBox(data []byte) ([]byte, error) {
+	boxes, err := readBoxes(data, 0, len(data))
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), data...)
+	if len(boxes) == 0 {
+		return out, nil
+	}
+	last := boxes[len(boxes)-1]
+	if binary.BigEndian.Uint32(data[last.start:last.start+4]) == 0 {
+		if last.end-last.start > math.MaxUint32 {
+			return nil, fmt.Errorf("%q box too large to append metadata", last.typ)
+		}
+		binary.BigEndian.PutUint32(out[last.start:last.start+4], uint32(last.end-last.start))
+	}
+	return out, nil
+}
+
+// findBox returns the first box of type typ.
+func findBox(boxes []isoBox, typ string) (isoBox, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+	return isoBox{}, false
+}
+
+// ilocBox is a parsed HEIF item location box.
+type ilocBox struct {
+	version                                     byte
+	offsetSize, lengthSize, baseSize, indexSize int
+	items                                       []ilocItem
+}
+
+// ilocItem locates the data of one item.
+type ilocItem struct {
+	id      uint32
+	method  uint16 // construction method; 0 for file offsets
+	dataRef uint16
+	base    uint64
+	extents []ilocExtent
+}
+
+// ilocExtent is one piece of an item's data.
+type ilocExtent struct {
+	index, offset, length uint64
+}
+
+// parseIloc parses the payload of an iloc box.
+func parseIloc(p []byte) (*ilocBox, error) {
+	r := &byteReader{data: p}
+	iloc := &ilocBox{version: byte(r.sized(1))}
+	r.skip(3) // flags
+	sizes := byte(r.sized(1))
+	iloc.offsetSize, iloc.lengthSize = int(sizes>>4), int(sizes&0x0f)
+	sizes = byte(r.sized(1))
+	iloc.baseSize = int(sizes >> 4)
+	if iloc.version >= 1 {
+		iloc.indexSize = int(sizes & 0x0f)
+	}
+	count := r.sized(2)
+	if iloc.version >= 2 {
+		count = r.sized(4)
+	}
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		var item ilocItem
+		if iloc.version < 2 {
+			item.id = uint32(r.sized(2))
+		} else {
+			item.id = uint32(r.sized(4))
+		}
+		if iloc.version >= 1 {
+			item.method = uint16(r.sized(2)) & 0x0f
+		}
+		item.dataRef = uint16(r.sized(2))
+		item.base = r.sized(iloc.baseSize)
+		extents := r.sized(2)
+		for j := uint64(0); j < extents && r.err == nil; j++ {
+			var e ilocExtent
+			if iloc.version >= 1 {
+				e.index = r.sized(iloc.indexSize)
+			}
+			e.offset = r.sized(iloc.offsetSize)
+			e.length = r.sized(iloc.lengthSize)
+			item.extents = append(item.extents, e)
+		}
+		iloc.items = append(iloc.items, item)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid iloc box: %w", r.err)
+	}
+	return iloc, nil
+}
+
+// bytes returns the payload of the iloc box.
+func (iloc *ilocBox) bytes() ([]byte, error) {
+	w := &byteWriter{}
+	w.put(1, uint64(iloc.version))
+	w.put(3, 0)
+	w.put(1, uint64(iloc.offsetSize<<4|iloc.lengthSize))
+	w.put(1, uint64(iloc.baseSize<<4|iloc.indexSize))
+	idSize := 2
+	if iloc.version >= 2 {
+		idSize = 4
+	}
+	w.put(idSize, uint64(len(iloc.items)))
+	for _, item := range iloc.items {
+		w.put(idSize, uint64(item.id))
+		if iloc.version >= 1 {
+			w.put(2, uint64(item.method))
+		}
+		w.put(2, uint64(item.dataRef))
+		w.put(iloc.baseSize, item.base)
+		w.put(2, uint64(len(item.extents)))
+		for _, e := range item.extents {
+			if iloc.version >= 1 {
+				w.put(iloc.indexSize, e.index)
+			}
+			w.put(iloc.offsetSize, e.offset)
+			w.put(iloc.lengthSize, e.length)
+		}
+	}
+	if w.err != nil {
+		return nil, fmt.Errorf("iloc box: %w", w.err)
+	}
+	return w.data, nil
+}
+
+// injectAVIFMetadata adds the XMP packet as a metadata item of the primary
+// image, like libheif does: an item of type "mime" in iinf, linked to the
+// image by a "cdsc" reference in iref and located by iloc in a new mdat box
+// at the end of the file. Item data after the meta box is moved by its
+// growth, so iloc offsets are adjusted.
+func injectAVIFMetadata(data []byte, blocks *metadataBlocks) ([]byte, error) {
+	if len(blocks.xmp) == 0 {
+		return data, nil
+	}
+	data, err := closeLastBox(data)
+	if err != nil {
+		return nil, err
+	}
+	top, err := readBoxes(data, 0, len(data))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := findBox(top, "moov"); ok {
+		return nil, fmt.Errorf("can't write metadata to AVIF image sequences")
+	}
+	meta, ok := findBox(top, "meta")
+	if !ok || meta.body+4 > meta.end {
+		return nil, fmt.Errorf("no meta box in AVIF file")
+	}
+	children, err := readBoxes(data, meta.body+4, meta.end)
+	if err != nil {
+		return nil, err
+	}
+
+	// The XMP item gets the next free ID and describes the primary item
+	pitm, ok := findBox(children, "pitm")
+	if !ok {
+		return nil, fmt.Errorf("no primary item in AVIF file")
+	}
+	primary := &byteReader{data: data[pitm.body:pitm.end]}
+	var primaryID uint32
+	if byte(primary.sized(1)) == 0 {
+		primary.skip(3)
+		primaryID = uint32(primary.sized(2))
+	} else {
+		primary.skip(3)
+		primaryID = uint32(primary.sized(4))
+	}
+	ilocBoxPos, ok := findBox(children, "iloc")
+	if !ok {
+		return nil, fmt.Errorf("no iloc box in AVIF file")
+	}
+	iloc, err := parseIloc(data[ilocBoxPos.body:ilocBoxPos.end])
+	if err != nil {
+		return nil, err
+	}
+	var xmpID uint32
+	for _, item := range iloc.items {
+		xmpID = max(xmpID, item.id)
+	}
+	xmpID++
+	if primary.err != nil || (iloc.version < 2 && xmpID > math.MaxUint16) {
+		return nil, fmt.Errorf("can't add an item to the AVIF file")
+	}
+
+	iinf, err := appendInfe(data, children, xmpID)
+	if err != nil {
+		return nil, err
+	}
+	iref, err := appendCdsc(data, children, xmpID, primaryID)
+	if err != nil {
+		return nil, err
+	}
+
+	// build assembles the meta box with the XMP item at xmpOffset, moving
+	// data after the meta box by delta
+	build := func(delta, xmpOffset uint64) ([]byte, error) {
+		moved := *iloc
+		moved.items = nil
+		for _, item := range iloc.items {
+			item.extents = append([]ilocExtent(nil), item.extents...)
+			if item.method == 0 && item.dataRef == 0 {
+				for i, e := range item.extents {
+					if item.base+e.offset < uint64(meta.end) {
+						continue
+					}
+					if iloc.offsetSize > 0 {
+						item.extents[i].offset += delta
+					} else {
+						item.base += delta
+						break
+					}
+				}
+			}
+			moved.items = append(moved.items, item)
+		}
+		item := ilocItem{id: xmpID, extents: []ilocExtent{{offset: xmpOffset, length: uint64(len(blocks.xmp))}}}
+		if iloc.offsetSize == 0 {
+			item.base, item.extents[0].offset = xmpOffset, 0
+		}
+		moved.items = append(moved.items, item)
+		payload, err := moved.bytes()
+		if err != nil {
+			return nil, err
+		}
+
+		body := append([]byte(nil), data[meta.body:meta.body+4]...)
+		for _, child := range children {
+			switch child.typ {
+			case "iloc":
+				body = appendBox(body, "iloc", payload)
+			case "iinf":
+				body = append(body, iinf...)
+			case "iref":
+				body = append(body, iref...)
+			default:
+				body = append(body, data[child.start:child.end]...)
+			}
+		}
+		if _, ok := findBox(children, "iref"); !ok {
+			body = append(body, iref...)
+		}
+		return appendBox(nil, "meta", body), nil
+	}
+
+	probe, err := build(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	delta := uint64(len(probe) - (meta.end - meta.start))
+	xmpOffset := uint64(len(data)) + delta + 8
+	newMeta, err := build(delta, xmpOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(data)+int(delta)+8+len(blocks.xmp))
+	out = append(out, data[:meta.start]...)
+	out = append(out, newMeta...)
+	out = append(out, data[meta.end:]...)
+	return appendBox(out, "mdat", blocks.xmp), nil
+}
+
+// appendInfe returns the iinf box of a meta box with an item info entry
+// for an XMP item.
+func appendInfe(data []byte, children []isoBox, id uint32) ([]byte, error) {
+	box, ok := findBox(children, "iinf")
+	if !ok || box.body+4 > box.end {
+		return nil, fmt.Errorf("no iinf box in AVIF file")
+	}
+	r := &byteReader{data: data[box.body:box.end]}
+	version := byte(r.sized(1))
+	r.skip(3)
+	countSize := 2
+	if version > 0 {
+		countSize = 4
+	}
+	count := r.sized(countSize)
+	if r.err != nil || (countSize == 2 && count == math.MaxUint16) {
+		return nil, fmt.Errorf("can't add an item to the AVIF iinf box")
+	}
+
+	infe := &byteWriter{}
+	if id > math.MaxUint16 {
+		infe.put(1, 3)
+		infe.put(3, 0)
+		infe.put(4, uint64(id))
+	} else {
+		infe.put(1, 2)
+		infe.put(3, 0)
+		infe.put(2, uint64(id))
+	}
+	infe.put(2, 0) // protection index
+	infe.data = append(infe.data, "mime\x00application/rdf+xml\x00"...)
+
+	w := &byteWriter{}
+	w.put(1, uint64(version))
+	w.put(3, 0)
+	w.put(countSize, count+1)
+	w.data = append(w.data, data[box.body+4+countSize:box.end]...)
+	w.data = appendBox(w.data, "infe", infe.data)
+	return appendBox(nil, "iinf", w.data), nil
+}
+
+// appendCdsc returns the iref box of a meta box, created if needed, with a
+// reference from the item from describing the item to.
+func appendCdsc(data []byte, children []isoBox, from, to uint32) ([]byte, error) {
+	var version byte
+	var refs []byte
+	if box, ok := findBox(children, "iref"); ok {
+		if box.body+4 > box.end {
+			return nil, fmt.Errorf("invalid iref box")
+		}
+		version = data[box.body]
+		refs = data[box.body+4 : box.end]
+	} else if from > math.MaxUint16 || to > math.MaxUint16 {
+		version = 1
+	}
+	idSize := 2
+	if version > 0 {
+		idSize = 4
+	} else if from > math.MaxUint16 || to > math.MaxUint16 {
+		return nil, fmt.Errorf("can't reference item %d in the AVIF iref box", from)
+	}
+
+	cdsc := &byteWriter{}
+	cdsc.put(idSize, uint64(from))
+	cdsc.put(2, 1)
+	cdsc.put(idSize, uint64(to))
+
+	body := []byte{version, 0, 0, 0}
+	body = append(body, refs...)
+	body = appendBox(body, "cdsc", cdsc.data)
+	return appendBox(nil, "iref", body), nil
+}
+
+// byteReader reads big-endian integers, remembering the first error.
+type byteReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// sized reads an unsigned integer of n bytes (0, 1, 2, 4 or 8).
+func (r *byteReader) sized(n int) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos+n > len(r.data) {
+		r.err = fmt.Errorf("truncated at %d", r.pos)
+		return 0
+	}
+	var v uint64
+	for _, b := range r.data[r.pos : r.pos+n] {
+		v = v<<8 | uint64(b)
+	}
+	r.pos += n
+	return v
+}
+
+// skip skips n bytes.
+func (r *byteReader) skip(n int) {
+	r.sized(n)
+}
+
+// byteWriter writes big-endian integers, remembering the first error.
+type byteWriter struct {
+	data []byte
+	err  error
+}
+
+// put writes v as an unsigned integer of n bytes.
+func (w *byteWriter) put(n int, v uint64) {
+	if n < 8 && v>>(8*n) != 0 {
+		if w.err == nil {
+			w.err = fmt.Errorf("value %d doesn't fit in %d bytes", v, n)
+		}
+		return
+	}
+	for i := n - 1; i >= 0; i-- {
+		w.data = append(w.data, byte(v>>(8*i)))
+	}
+}
@@ -0,0 +1,360 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func testBlocks() *metadataBlocks {
+	return &metadataBlocks{
+		xmp: buildXMP([]xmpProperty{{ns: nsDC, name: "creator", kind: xmpSeq, values: []string{"Jane Doe"}}}),
+		iim: encodeIIM(testIPTCDatasets()),
+	}
+}
+
+func testImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 6))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i)
+	}
+	return img
+}
+
+// jpegSegments returns the payloads of the JPEG marker segments before SOS.
+func jpegSegments(t *testing.T, data []byte) map[byte][][]byte {
+	t.Helper()
+	segments := make(map[byte][][]byte)
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xff && data[pos+1] != 0xda {
+		size := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		segments[data[pos+1]] = append(segments[data[pos+1]], data[pos+4:pos+2+size])
+		pos += 2 + size
+	}
+	return segments
+}
+
+func TestInjectJPEGMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := injectMetadata(buf.Bytes(), JPEG, testBlocks(), false)
+	if err != nil {
+		t.Fatalf("injectMetadata failed: %v", err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("output is not a valid JPEG: %v", err)
+	}
+
+	segments := jpegSegments(t, out)
+	var xmp []byte
+	for _, app1 := range segments[0xe1] {
+		if bytes.HasPrefix(app1, jpegXMPHeader) {
+			xmp = app1[len(jpegXMPHeader):]
+		}
+	}
+	props, err := parseXMP(xmp)
+	if err != nil || props["dc:creator"] == nil {
+		t.Errorf("XMP not found in APP1: %v %v", props, err)
+	}
+
+	if len(segments[0xed]) != 1 {
+		t.Fatalf("expected one APP13 segment, got %d", len(segments[0xed]))
+	}
+	datasets, err := parseIIM(extractIIM(segments[0xed][0]))
+	if err != nil {
+		t.Fatalf("parseIIM failed: %v", err)
+	}
+	if got := iptcValue(datasets, iptcCity); got != "Hamburg" {
+		t.Errorf("IPTC city = %q, expected %q", got, "Hamburg")
+	}
+}
+
+func TestInjectPNGMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := injectMetadata(buf.Bytes(), PNG, testBlocks(), true)
+	if err != nil {
+		t.Fatalf("injectMetadata failed: %v", err)
+	}
+	// The PNG decoder verifies chunk CRCs
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("output is not a valid PNG: %v", err)
+	}
+
+	idx := bytes.Index(out, []byte("iTXtXML:com.adobe.xmp"))
+	if idx < 0 {
+		t.Fatal("iTXt XMP chunk not found")
+	}
+	if idx > bytes.Index(out, []byte("IDAT")) {
+		t.Error("iTXt chunk written after IDAT")
+	}
+}
+
+func TestInjectWebPMetadata(t *testing.T) {
+	// Minimal lossless WebP header: 5x3 canvas, no image data needed for the container
+	vp8l := []byte{0x2f, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(vp8l[1:], (5-1)|(3-1)<<14)
+	var simple []byte
+	simple = append(simple, "RIFF"...)
+	simple = binary.LittleEndian.AppendUint32(simple, uint32(4+8+len(vp8l)+1))
+	simple = append(simple, "WEBP"...)
+	simple = append(simple, "VP8L"...)
+	simple = binary.LittleEndian.AppendUint32(simple, uint32(len(vp8l)))
+	simple = append(simple, vp8l...)
+	simple = append(simple, 0) // padding
+
+	blocks := testBlocks()
+	out, err := injectMetadata(simple, WebP, blocks, true)
+	if err != nil {
+		t.Fatalf("injectMetadata failed: %v", err)
+	}
+
+	if got := binary.LittleEndian.Uint32(out[4:8]); int(got) != len(out)-8 {
+		t.Errorf("RIFF size = %d, expected %d", got, len(out)-8)
+	}
+	if string(out[12:16]) != "VP8X" {
+		t.Fatalf("first chunk = %q, expected VP8X", out[12:16])
+	}
+	if flags := out[20]; flags&webpFlagXMP == 0 || flags&webpFlagAlpha == 0 {
+		t.Errorf("VP8X flags = %#x, expected XMP and alpha", flags)
+	}
+	width := int(out[24]) | int(out[25])<<8 | int(out[26])<<16
+	height := int(out[27]) | int(out[28])<<8 | int(out[29])<<16
+	if width+1 != 5 || height+1 != 3 {
+		t.Errorf("VP8X canvas = %dx%d, expected 5x3", width+1, height+1)
+	}
+	idx := bytes.Index(out, []byte("XMP "))
+	if idx < 0 {
+		t.Fatal("XMP chunk not found")
+	}
+	size := int(binary.LittleEndian.Uint32(out[idx+4 : idx+8]))
+	if !bytes.Equal(out[idx+8:idx+8+size], blocks.xmp) {
+		t.Error("XMP chunk content mismatch")
+	}
+
+	// Already-extended files only get the flag set
+	again, err := injectWebPMetadata(out, &metadataBlocks{xmp: []byte("<x/>")}, false)
+	if err != nil {
+		t.Fatalf("injectWebPMetadata failed: %v", err)
+	}
+	if bytes.Count(again, []byte("VP8X")) != 1 {
+		t.Error("VP8X chunk duplicated")
+	}
+}
+
+func TestInjectMetadataNoBlocks(t *testing.T) {
+	data := []byte("unchanged")
+	for _, blocks := range []*metadataBlocks{nil, {}} {
+		out, err := injectMetadata(data, JPEG, blocks, false)
+		if err != nil || !bytes.Equal(out, data) {
+			t.Errorf("injectMetadata(%v) = %q, %v; expected input unchanged", blocks, out, err)
+		}
+	}
+}
+
+// tiffIFD0 returns the entries of the first IFD of a little-endian TIFF
+// file by tag, with their byte values: the value field if the count is
+// at most 4, otherwise the data at its offset.
+func tiffIFD0(t *testing.T, data []byte) map[uint16][]byte {
+	t.Helper()
+	le := binary.LittleEndian
+	ifd := int(le.Uint32(data[4:8]))
+	entries := make(map[uint16][]byte)
+	var last uint16
+	for i := 0; i < int(le.Uint16(data[ifd:])); i++ {
+		entry := data[ifd+2+i*12 : ifd+14+i*12]
+		tag, count := le.Uint16(entry[0:2]), int(le.Uint32(entry[4:8]))
+		if tag < last {
+			t.Errorf("IFD entry %d not sorted by tag", tag)
+		}
+		last = tag
+		if count <= 4 {
+			entries[tag] = entry[8:12]
+		} else {
+			offset := int(le.Uint32(entry[8:12]))
+			entries[tag] = data[offset : offset+count]
+		}
+	}
+	return entries
+}
+
+func TestInjectTIFFMetadata(t *testing.T) {
+	// Header, an IFD with ImageWidth and a stale IPTC entry, no next IFD
+	var tiff []byte
+	tiff = append(tiff, "II"...)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 42)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 2)
+	for _, entry := range [][3]uint32{{256, 3, 1}, {tiffTagIPTC, tiffTypeUndefined, 2}} {
+		tiff = binary.LittleEndian.AppendUint16(tiff, uint16(entry[0]))
+		tiff = binary.LittleEndian.AppendUint16(tiff, uint16(entry[1]))
+		tiff = binary.LittleEndian.AppendUint32(tiff, entry[2])
+		tiff = binary.LittleEndian.AppendUint32(tiff, 5)
+	}
+	tiff = binary.LittleEndian.AppendUint32(tiff, 0)
+
+	blocks := testBlocks()
+	out, err := injectMetadata(tiff, TIFF, blocks, false)
+	if err != nil {
+		t.Fatalf("injectMetadata failed: %v", err)
+	}
+	entries := tiffIFD0(t, out)
+	if len(entries) != 3 {
+		t.Errorf("IFD has %d entries, expected 3", len(entries))
+	}
+	if !bytes.Equal(entries[256], []byte{5, 0, 0, 0}) {
+		t.Errorf("ImageWidth = %v, expected it unchanged", entries[256])
+	}
+	if !bytes.Equal(entries[tiffTagXMP], blocks.xmp) {
+		t.Error("XMP tag content mismatch")
+	}
+	if !bytes.Equal(entries[tiffTagIPTC], blocks.iim) {
+		t.Error("IPTC tag content mismatch")
+	}
+
+	if _, err := injectMetadata([]byte("MM\x00\x2b"), TIFF, blocks, false); err == nil {
+		t.Error("BigTIFF: expected error, got nil")
+	}
+}
+
+func TestInjectJXLMetadata(t *testing.T) {
+	blocks := testBlocks()
+	codestream := []byte{0xff, 0x0a, 1, 2, 3}
+	out, err := injectMetadata(codestream, JXL, blocks, false)
+	if err != nil {
+		t.Fatalf("injectMetadata failed: %v", err)
+	}
+	if !bytes.HasPrefix(out, jxlSignature) {
+		t.Fatal("codestream not wrapped in a container")
+	}
+	boxes, err := readBoxes(out, 0, len(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, b := range boxes {
+		types = append(types, b.typ)
+	}
+	if strings.Join(types, ",") != "JXL ,ftyp,jxlc,xml " {
+		t.Fatalf("boxes = %v, expected signature, ftyp, jxlc and xml", types)
+	}
+	if jxlc := boxes[2]; !bytes.Equal(out[jxlc.body:jxlc.end], codestream) {
+		t.Error("jxlc box content mismatch")
+	}
+	if xml := boxes[3]; !bytes.Equal(out[xml.body:xml.end], blocks.xmp) {
+		t.Error("xml box content mismatch")
+	}
+
+	// A container whose last box runs to the end of the file gets its size
+	open := append(append([]byte(nil), out[:boxes[2].start]...), 0, 0, 0, 0, 'j', 'x', 'l', 'c', 0xff, 0x0a)
+	again, err := injectMetadata(open, JXL, blocks, false)
+	if err != nil {
+		t.Fatalf("injectMetadata failed: %v", err)
+	}
+	if boxes, err := readBoxes(again, 0, len(again)); err != nil || len(boxes) != 4 || boxes[2].end-boxes[2].start != 10 {
+		t.Errorf("boxes = %v, %v; expected a closed jxlc box and an xml box", boxes, err)
+	}
+}
+
+// testAVIF returns a minimal still AVIF file: one image item with ID 1 whose
+// data is pixels, in an mdat box after the meta box.
+func testAVIF(pixels []byte) []byte {
+	box := func(typ string, payload ...[]byte) []byte {
+		return appendBox(nil, typ, bytes.Join(payload, nil))
+	}
+	full := func(version byte, rest ...byte) []byte {
+		return append([]byte{version, 0, 0, 0}, rest...)
+	}
+
+	infe := box("infe", full(2, 0, 1, 0, 0), []byte("av01\x00"))
+	iinf := box("iinf", full(0, 0, 1), infe)
+	pitm := box("pitm", full(0, 0, 1))
+	hdlr := box("hdlr", full(0, 0, 0, 0, 0), []byte("pict"), make([]byte, 13))
+	iloc := func(offset uint32) []byte {
+		w := &byteWriter{}
+		w.put(4, 0)    // version, flags
+		w.put(1, 0x44) // offset and length size 4
+		w.put(1, 0)    // no base offset
+		w.put(2, 1)
+		w.put(2, 1) // item ID
+		w.put(2, 0) // data reference
+		w.put(2, 1) // extents
+		w.put(4, uint64(offset))
+		w.put(4, uint64(len(pixels)))
+		return box("iloc", w.data)
+	}
+	ftyp := box("ftyp", []byte("avifmif1avif"))
+
+	meta := box("meta", full(0), hdlr, pitm, iloc(0), iinf)
+	offset := len(ftyp) + len(meta) + 8
+	meta = box("meta", full(0), hdlr, pitm, iloc(uint32(offset)), iinf)
+	return bytes.Join([][]byte{ftyp, meta, box("mdat", pixels)}, nil)
+}
+
+func TestInjectAVIFMetadata(t *testing.T) {
+	pixels := []byte("pixel data")
+	blocks := testBlocks()
+	out, err := injectMetadata(testAVIF(pixels), AVIF, blocks, false)
+	if err != nil {
+		t.Fatalf("injectMetadata failed: %v", err)
+	}
+
+	top, err := readBoxes(out, 0, len(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, _ := findBox(top, "meta")
+	children, err := readBoxes(out, meta.body+4, meta.end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ilocBox, _ := findBox(children, "iloc")
+	iloc, err := parseIloc(out[ilocBox.body:ilocBox.end])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make(map[uint32][]byte)
+	for _, item := range iloc.items {
+		e := item.extents[0]
+		data[item.id] = out[item.base+e.offset : item.base+e.offset+e.length]
+	}
+	if !bytes.Equal(data[1], pixels) {
+		t.Errorf("image item data = %q, expected %q", data[1], pixels)
+	}
+	if !bytes.Equal(data[2], blocks.xmp) {
+		t.Errorf("XMP item data mismatch")
+	}
+
+	iinf, _ := findBox(children, "iinf")
+	if got := binary.BigEndian.Uint16(out[iinf.body+4:]); got != 2 {
+		t.Errorf("iinf has %d items, expected 2", got)
+	}
+	if !bytes.Contains(out[iinf.body:iinf.end], []byte("mime\x00application/rdf+xml\x00")) {
+		t.Error("XMP item info not found")
+	}
+	iref, ok := findBox(children, "iref")
+	if !ok {
+		t.Fatal("iref box not found")
+	}
+	cdsc := []byte{0, 0, 0, 14, 'c', 'd', 's', 'c', 0, 2, 0, 1, 0, 1}
+	if !bytes.Equal(out[iref.body+4:iref.end], cdsc) {
+		t.Errorf("iref = %x, expected a cdsc reference from item 2 to item 1", out[iref.body:iref.end])
+	}
+}
+
+func TestInjectAVIFMetadataSequence(t *testing.T) {
+	avif := append(testAVIF(nil), appendBox(nil, "moov", nil)...)
+	if _, err := injectMetadata(avif, AVIF, testBlocks(), false); err == nil {
+		t.Error("image sequence: expected error, got nil")
+	}
+}
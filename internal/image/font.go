@@ -0,0 +1,146 @@
+package image
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// FontName returns the name of the font in a TrueType or OpenType font
+// file as a Pango font description, e.g. "Brand Sans Bold", which selects
+// the font once the file is loaded. For collections the first font is used.
+func FontName(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read font: %w", err)
+	}
+	names, err := fontNames(data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	name := names[nameIDFamily]
+	if name == "" {
+		return "", fmt.Errorf("%s: font has no family name", path)
+	}
+	// Pango reads styles such as Bold or Light Italic after the family
+	if style := names[nameIDSubfamily]; style != "" && !strings.EqualFold(style, "Regular") {
+		name += " " + style
+	}
+	return name, nil
+}
+
+// Name IDs in the OpenType name table
+const (
+	nameIDFamily    = 1
+	nameIDSubfamily = 2
+)
+
+// fontNames returns the names from the name table of font data by name ID.
+func fontNames(data []byte) (map[uint16]string, error) {
+	be := binary.BigEndian
+	if len(data) < 12 {
+		return nil, fmt.Errorf("not a font file")
+	}
+
+	offset := 0
+	switch string(data[:4]) {
+	case "ttcf":
+		// A collection: use the first font
+		if len(data) < 16 || be.Uint32(data[8:]) == 0 {
+			return nil, fmt.Errorf("empty font collection")
+		}
+		offset = int(be.Uint32(data[12:]))
+	case "\x00\x01\x00\x00", "OTTO", "true":
+	case "wOFF", "wOF2":
+		return nil, fmt.Errorf("web fonts are not supported, use a TTF or OTF file")
+	default:
+		return nil, fmt.Errorf("not a font file")
+	}
+
+	// Find the name table in the table directory
+	if offset+12 > len(data) {
+		return nil, fmt.Errorf("truncated font file")
+	}
+	numTables := int(be.Uint16(data[offset+4:]))
+	var table []byte
+	for i := range numTables {
+		rec := offset + 12 + 16*i
+		if rec+16 > len(data) {
+			return nil, fmt.Errorf("truncated font file")
+		}
+		if string(data[rec:rec+4]) != "name" {
+			continue
+		}
+		start, length := int(be.Uint32(data[rec+8:])), int(be.Uint32(data[rec+12:]))
+		if start+length > len(data) {
+			return nil, fmt.Errorf("truncated font file")
+		}
+		table = data[start : start+length]
+		break
+	}
+	if len(table) < 6 {
+		return nil, fmt.Errorf("font has no name table")
+	}
+
+	// Pick the best record of each name: Windows US English, any Windows
+	// language, Unicode, then Macintosh
+	count, storage := int(be.Uint16(table[2:])), int(be.Uint16(table[4:]))
+	names := make(map[uint16]string)
+	ranks := make(map[uint16]int)
+	for i := range count {
+		rec := 6 + 12*i
+		if rec+12 > len(table) {
+			break
+		}
+		platform, language := be.Uint16(table[rec:]), be.Uint16(table[rec+4:])
+		nameID := be.Uint16(table[rec+6:])
+		length, start := int(be.Uint16(table[rec+8:])), storage+int(be.Uint16(table[rec+10:]))
+		if start+length > len(table) {
+			continue
+		}
+
+		var r int
+		switch {
+		case platform == 3 && language == 0x409:
+			r = 4
+		case platform == 3:
+			r = 3
+		case platform == 0:
+			r = 2
+		case platform == 1:
+			r = 1
+		}
+		if r <= ranks[nameID] {
+			continue
+		}
+		raw := table[start : start+length]
+		if platform == 1 {
+			names[nameID] = decodeLatin1(raw)
+		} else {
+			names[nameID] = decodeUTF16BE(raw)
+		}
+		ranks[nameID] = r
+	}
+	return names, nil
+}
+
+// decodeUTF16BE decodes the UTF-16BE strings of the Windows and Unicode
+// name records.
+func decodeUTF16BE(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	return strings.TrimSpace(string(utf16.Decode(u)))
+}
+
+// decodeLatin1 decodes Macintosh name records, which are ASCII in practice.
+func decodeLatin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return strings.TrimSpace(string(r))
+}
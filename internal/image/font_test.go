@@ -0,0 +1,129 @@
+package image
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// nameRecord is a record of the name table built by testFont.
+type nameRecord struct {
+	platform, language, nameID uint16
+	value                      string
+}
+
+// testFont builds a minimal font file with only a name table.
+func testFont(records ...nameRecord) []byte {
+	be := binary.BigEndian
+	var storage []byte
+	table := make([]byte, 6+12*len(records))
+	be.PutUint16(table[2:], uint16(len(records)))
+	be.PutUint16(table[4:], uint16(len(table)))
+	for i, rec := range records {
+		var raw []byte
+		if rec.platform == 1 {
+			raw = []byte(rec.value)
+		} else {
+			for _, u := range utf16.Encode([]rune(rec.value)) {
+				raw = be.AppendUint16(raw, u)
+			}
+		}
+		r := table[6+12*i:]
+		be.PutUint16(r[0:], rec.platform)
+		be.PutUint16(r[4:], rec.language)
+		be.PutUint16(r[6:], rec.nameID)
+		be.PutUint16(r[8:], uint16(len(raw)))
+		be.PutUint16(r[10:], uint16(len(storage)))
+		storage = append(storage, raw...)
+	}
+	table = append(table, storage...)
+
+	font := make([]byte, 12+16)
+	be.PutUint32(font[0:], 0x00010000)
+	be.PutUint16(font[4:], 1)
+	copy(font[12:], "name")
+	be.PutUint32(font[20:], uint32(len(font)))
+	be.PutUint32(font[24:], uint32(len(table)))
+	return append(font, table...)
+}
+
+func TestFontNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		records  []nameRecord
+		expected string // the family name
+	}{
+		{"windows", []nameRecord{{3, 0x409, 1, "Brand Sans"}}, "Brand Sans"},
+		{"prefers US English", []nameRecord{
+			{1, 0, 1, "Mac Name"},
+			{3, 0x407, 1, "Markenschrift"},
+			{3, 0x409, 1, "Brand Sans"},
+			{3, 0x409, 2, "Regular"},
+		}, "Brand Sans"},
+		{"macintosh", []nameRecord{{1, 0, 1, "Mac Name"}, {1, 0, 4, "Mac Name Bold"}}, "Mac Name"},
+		{"unicode", []nameRecord{{0, 0, 1, "Noto Sans Arabic"}}, "Noto Sans Arabic"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			names, err := fontNames(testFont(tc.records...))
+			if err != nil {
+				t.Fatalf("fontNames failed: %v", err)
+			}
+			if got := names[nameIDFamily]; got != tc.expected {
+				t.Errorf("family = %q, expected %q", got, tc.expected)
+			}
+		})
+	}
+
+	// Other files are rejected
+	for name, data := range map[string][]byte{
+		"woff2": append([]byte("wOF2"), make([]byte, 40)...),
+		"jpeg":  {0xff, 0xd8, 0xff, 0xe0, 0, 0, 0, 0, 0, 0, 0, 0},
+		"empty": nil,
+	} {
+		if _, err := fontNames(data); err == nil {
+			t.Errorf("fontNames(%s) expected error, got nil", name)
+		}
+	}
+}
+
+func TestFontName(t *testing.T) {
+	tests := []struct {
+		name     string
+		records  []nameRecord
+		expected string
+	}{
+		{"regular", []nameRecord{{3, 0x409, 1, "Brand Sans"}, {3, 0x409, 2, "Regular"}}, "Brand Sans"},
+		{"bold italic", []nameRecord{{3, 0x409, 1, "Brand Sans"}, {3, 0x409, 2, "Bold Italic"}}, "Brand Sans Bold Italic"},
+		{"no style", []nameRecord{{3, 0x409, 1, "Brand Sans Medium"}}, "Brand Sans Medium"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "brand.ttf")
+			if err := os.WriteFile(path, testFont(tc.records...), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := FontName(path)
+			if err != nil {
+				t.Fatalf("FontName failed: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("FontName = %q, expected %q", got, tc.expected)
+			}
+		})
+	}
+
+	// Fonts need a family name
+	path := filepath.Join(t.TempDir(), "nameless.ttf")
+	if err := os.WriteFile(path, testFont(nameRecord{3, 0x409, 2, "Regular"}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FontName(path); err == nil {
+		t.Error("FontName of a font without a family expected error, got nil")
+	}
+	if _, err := FontName(filepath.Join(t.TempDir(), "missing.ttf")); err == nil {
+		t.Error("FontName of a missing file expected error, got nil")
+	}
+}
@@ -0,0 +1,370 @@
+package image
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// Format represents an output image format.
+type Format int
+
+const (
+	// JPEG is baseline/progressive JPEG.
+	JPEG Format = iota
+	// PNG is lossless PNG, optionally palettised.
+	PNG
+	// WebP supports both lossy and lossless encoding.
+	WebP
+	// AVIF is AV1-compressed HEIF.
+	AVIF
+	// TIFF supports several compression schemes.
+	TIFF
+	// JXL is JPEG XL.
+	JXL
+)
+
+// ParseFormat converts a string to a Format type.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "jpeg", "jpg":
+		return JPEG, nil
+	case "png":
+		return PNG, nil
+	case "webp":
+		return WebP, nil
+	case "avif":
+		return AVIF, nil
+	case "tiff", "tif":
+		return TIFF, nil
+	case "jxl", "jpegxl", "jpeg-xl":
+		return JXL, nil
+	default:
+		return JPEG, fmt.Errorf("unknown format: %s", s)
+	}
+}
+
+// FormatFromPath returns the output format matching a file's extension.
+// The second return value is false if the extension is not a writable format.
+func FormatFromPath(path string) (Format, bool) {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if ext == "" {
+		return JPEG, false
+	}
+	f, err := ParseFormat(ext)
+	return f, err == nil
+}
+
+// String returns the format name.
+func (f Format) String() string {
+	switch f {
+	case JPEG:
+		return "jpeg"
+	case PNG:
+		return "png"
+	case WebP:
+		return "webp"
+	case AVIF:
+		return "avif"
+	case TIFF:
+		return "tiff"
+	case JXL:
+		return "jxl"
+	default:
+		return "unknown"
+	}
+}
+
+// Extension returns the file extension for the format, including the dot.
+func (f Format) Extension() string {
+	switch f {
+	case JPEG:
+		return ".jpg"
+	case PNG:
+		return ".png"
+	case WebP:
+		return ".webp"
+	case AVIF:
+		return ".avif"
+	case TIFF:
+		return ".tif"
+	case JXL:
+		return ".jxl"
+	default:
+		return ""
+	}
+}
+
+// TiffCompression represents a TIFF compression scheme.
+type TiffCompression int
+
+const (
+	// TiffDeflate is lossless zlib compression.
+	TiffDeflate TiffCompression = iota
+	// TiffNone writes uncompressed strips.
+	TiffNone
+	// TiffLZW is lossless LZW compression.
+	TiffLZW
+	// TiffJPEG is lossy JPEG compression, using the encoder quality.
+	TiffJPEG
+	// TiffZstd is lossless Zstandard compression.
+	TiffZstd
+	// TiffWebP is WebP compression, using the encoder quality.
+	TiffWebP
+	// TiffPackbits is lossless run-length compression.
+	TiffPackbits
+)
+
+// ParseTiffCompression converts a string to a TiffCompression type.
+func ParseTiffCompression(s string) (TiffCompression, error) {
+	switch strings.ToLower(s) {
+	case "deflate", "zip":
+		return TiffDeflate, nil
+	case "none":
+		return TiffNone, nil
+	case "lzw":
+		return TiffLZW, nil
+	case "jpeg", "jpg":
+		return TiffJPEG, nil
+	case "zstd":
+		return TiffZstd, nil
+	case "webp":
+		return TiffWebP, nil
+	case "packbits":
+		return TiffPackbits, nil
+	default:
+		return TiffDeflate, fmt.Errorf("unknown TIFF compression: %s", s)
+	}
+}
+
+// String returns the compression name.
+func (c TiffCompression) String() string {
+	switch c {
+	case TiffDeflate:
+		return "deflate"
+	case TiffNone:
+		return "none"
+	case TiffLZW:
+		return "lzw"
+	case TiffJPEG:
+		return "jpeg"
+	case TiffZstd:
+		return "zstd"
+	case TiffWebP:
+		return "webp"
+	case TiffPackbits:
+		return "packbits"
+	default:
+		return "unknown"
+	}
+}
+
+// EncodeOptions holds encoder settings for all output formats.
+// Each encoder only reads the fields that apply to it.
+type EncodeOptions struct {
+	// Quality is the lossy quality (1-100) for JPEG, WebP, AVIF and JXL,
+	// PNG palette quantisation, and JPEG/WebP-compressed TIFF.
+	Quality int
+
+	// JPEGSubsample is the JPEG chroma subsampling.
+	JPEGSubsample ChromaSubsampling
+	// JPEGProgressive writes progressive (interlaced) JPEG.
+	JPEGProgressive bool
+	// JPEGOptimizeCoding computes optimal Huffman tables.
+	JPEGOptimizeCoding bool
+	// JPEGTrellis enables trellis quantisation (mozjpeg only).
+	JPEGTrellis bool
+	// JPEGDeringing enables overshoot deringing of black-on-white edges
+	// (mozjpeg only).
+	JPEGDeringing bool
+	// JPEGQuantTable selects the quantisation table (0-8, mozjpeg only).
+	JPEGQuantTable int
+
+	// WebPLossless selects lossless WebP encoding.
+	WebPLossless bool
+	// WebPEffort is the WebP CPU effort (0-6, higher is smaller and slower).
+	WebPEffort int
+
+	// AVIFSpeed is the AVIF encoder speed (0-9, higher is faster and larger).
+	AVIFSpeed int
+	// AVIFBitDepth is the AVIF bit depth (8, 10 or 12).
+	AVIFBitDepth int
+
+	// PNGPalette quantises PNG output to an 8-bit palette.
+	PNGPalette bool
+
+	// TIFFCompression is the TIFF compression scheme.
+	TIFFCompression TiffCompression
+
+	// JXLDistance is the JPEG XL Butteraugli distance, 0.1-15, lower is
+	// better. If zero, the distance is derived from Quality; JPEG XL output
+	// is always lossy, as lossless encoding isn't exposed.
+	JXLDistance float64
+
+	// StripMetadata removes all metadata, including the ICC profile. Leave
+	// it unset to write the metadata selected by ApplyMetadataPolicy.
+	StripMetadata bool
+}
+
+// DefaultEncodeOptions returns encoder settings with the given quality and
+// sensible defaults for everything else. JPEG is left to libvips' defaults,
+// which subsample chroma below quality 90 only; see JPEGTuning for others.
+func DefaultEncodeOptions(quality int) EncodeOptions {
+	return EncodeOptions{
+		Quality:         quality,
+		WebPEffort:      4,
+		AVIFSpeed:       4,
+		AVIFBitDepth:    8,
+		TIFFCompression: TiffDeflate,
+		StripMetadata:   true,
+	}
+}
+
+// Validate checks that the encoder settings are within range.
+func (o EncodeOptions) Validate() error {
+	if o.Quality < 1 || o.Quality > 100 {
+		return fmt.Errorf("invalid quality: %d (must be 1-100)", o.Quality)
+	}
+	if o.WebPEffort < 0 || o.WebPEffort > 6 {
+		return fmt.Errorf("invalid WebP effort: %d (must be 0-6)", o.WebPEffort)
+	}
+	if o.AVIFSpeed < 0 || o.AVIFSpeed > 9 {
+		return fmt.Errorf("invalid AVIF speed: %d (must be 0-9)", o.AVIFSpeed)
+	}
+	switch o.AVIFBitDepth {
+	case 8, 10, 12:
+	default:
+		return fmt.Errorf("invalid AVIF bit depth: %d (must be 8, 10 or 12)", o.AVIFBitDepth)
+	}
+	if o.JPEGQuantTable < 0 || o.JPEGQuantTable > 8 {
+		return fmt.Errorf("invalid JPEG quant table: %d (must be 0-8)", o.JPEGQuantTable)
+	}
+	if o.JXLDistance < 0 || o.JXLDistance > 15 {
+		return fmt.Errorf("invalid JXL distance: %g (must be 0-15)", o.JXLDistance)
+	}
+	return nil
+}
+
+// Encode encodes the image in the given format and returns the bytes.
+func (v *VipsImage) Encode(format Format, opts EncodeOptions) ([]byte, error) {
+	var (
+		bytes []byte
+		err   error
+	)
+
+	switch format {
+	case JPEG:
+		params := vips.NewJpegExportParams()
+		params.Quality = opts.Quality
+		params.SubsampleMode = subsampleToVips(opts.JPEGSubsample)
+		params.Interlace = opts.JPEGProgressive
+		params.OptimizeCoding = opts.JPEGOptimizeCoding
+		params.TrellisQuant = opts.JPEGTrellis
+		params.OvershootDeringing = opts.JPEGDeringing
+		params.QuantTable = opts.JPEGQuantTable
+		params.StripMetadata = opts.StripMetadata
+		bytes, _, err = v.ref.ExportJpeg(params)
+
+	case PNG:
+		params := vips.NewPngExportParams()
+		params.Compression = 6
+		params.StripMetadata = opts.StripMetadata
+		if opts.PNGPalette {
+			params.Palette = true
+			params.Quality = opts.Quality
+		}
+		bytes, _, err = v.ref.ExportPng(params)
+
+	case WebP:
+		params := vips.NewWebpExportParams()
+		params.Quality = opts.Quality
+		params.Lossless = opts.WebPLossless
+		params.ReductionEffort = opts.WebPEffort
+		params.StripMetadata = opts.StripMetadata
+		bytes, _, err = v.ref.ExportWebp(params)
+
+	case AVIF:
+		params := vips.NewAvifExportParams()
+		params.Quality = opts.Quality
+		params.Bitdepth = opts.AVIFBitDepth
+		// libvips takes CPU effort, the inverse of speed
+		params.Effort = 9 - opts.AVIFSpeed
+		params.StripMetadata = opts.StripMetadata
+		bytes, _, err = v.ref.ExportAvif(params)
+
+	case TIFF:
+		params := vips.NewTiffExportParams()
+		params.Quality = opts.Quality
+		params.Compression = tiffCompressionToVips(opts.TIFFCompression)
+		params.StripMetadata = opts.StripMetadata
+		bytes, _, err = v.ref.ExportTiff(params)
+
+	case JXL:
+		// govips always sets a distance, and libvips ignores Q once one is
+		// set, so quality is mapped to a distance here
+		params := vips.NewJxlExportParams()
+		params.Distance = opts.JXLDistance
+		if params.Distance == 0 {
+			params.Distance = jxlQualityToDistance(opts.Quality)
+		}
+		params.Quality = 0
+		bytes, _, err = v.ref.ExportJxl(params)
+
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s", format)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("export %s failed: %w", strings.ToUpper(format.String()), err)
+	}
+
+	if !opts.StripMetadata {
+		bytes, err = injectMetadata(bytes, format, v.metadata, v.ref.HasAlpha())
+		if err != nil {
+			return nil, fmt.Errorf("write metadata failed: %w", err)
+		}
+	}
+	return bytes, nil
+}
+
+// SaveFormat encodes the image in the given format and writes it to path.
+func (v *VipsImage) SaveFormat(path string, format Format, opts EncodeOptions) error {
+	bytes, err := v.Encode(format, opts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, bytes, 0644)
+}
+
+// jxlQualityToDistance converts a quality of 1-100 to a JPEG XL distance,
+// with the mapping of libjxl's cjxl that libvips uses for Q.
+func jxlQualityToDistance(quality int) float64 {
+	if quality >= 30 {
+		return 0.1 + float64(100-quality)*0.09
+	}
+	return 6.4 + math.Pow(2.5, float64(30-quality)/5)/6.25
+}
+
+// tiffCompressionToVips converts our TiffCompression type to the vips type.
+func tiffCompressionToVips(c TiffCompression) vips.TiffCompression {
+	switch c {
+	case TiffNone:
+		return vips.TiffCompressionNone
+	case TiffLZW:
+		return vips.TiffCompressionLzw
+	case TiffJPEG:
+		return vips.TiffCompressionJpeg
+	case TiffZstd:
+		return vips.TiffCompressionZstd
+	case TiffWebP:
+		return vips.TiffCompressionWebp
+	case TiffPackbits:
+		return vips.TiffCompressionPackbits
+	default:
+		return vips.TiffCompressionDeflate
+	}
+}
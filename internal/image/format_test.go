@@ -0,0 +1,184 @@
+package image
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Format
+	}{
+		{"jpeg", JPEG},
+		{"jpg", JPEG},
+		{"JPG", JPEG},
+		{"png", PNG},
+		{"webp", WebP},
+		{"avif", AVIF},
+		{"tiff", TIFF},
+		{"tif", TIFF},
+		{"jxl", JXL},
+		{"jpeg-xl", JXL},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			f, err := ParseFormat(tc.input)
+			if err != nil {
+				t.Fatalf("ParseFormat(%q) failed: %v", tc.input, err)
+			}
+			if f != tc.expected {
+				t.Errorf("ParseFormat(%q) = %v, expected %v", tc.input, f, tc.expected)
+			}
+		})
+	}
+
+	if _, err := ParseFormat("gif"); err == nil {
+		t.Error("ParseFormat(\"gif\") expected error, got nil")
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected Format
+		ok       bool
+	}{
+		{"photo.jpg", JPEG, true},
+		{"/a/b/photo.JPEG", JPEG, true},
+		{"scan.tif", TIFF, true},
+		{"image.webp", WebP, true},
+		{"phone.heic", JPEG, false},
+		{"noext", JPEG, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			f, ok := FormatFromPath(tc.path)
+			if ok != tc.ok || (ok && f != tc.expected) {
+				t.Errorf("FormatFromPath(%q) = (%v, %v), expected (%v, %v)", tc.path, f, ok, tc.expected, tc.ok)
+			}
+		})
+	}
+}
+
+func TestEncodeOptionsValidate(t *testing.T) {
+	if err := DefaultEncodeOptions(92).Validate(); err != nil {
+		t.Errorf("default options invalid: %v", err)
+	}
+
+	bad := []EncodeOptions{
+		DefaultEncodeOptions(0),
+		DefaultEncodeOptions(101),
+		func() EncodeOptions { o := DefaultEncodeOptions(90); o.WebPEffort = 7; return o }(),
+		func() EncodeOptions { o := DefaultEncodeOptions(90); o.AVIFSpeed = 10; return o }(),
+		func() EncodeOptions { o := DefaultEncodeOptions(90); o.AVIFBitDepth = 16; return o }(),
+		func() EncodeOptions { o := DefaultEncodeOptions(90); o.JXLDistance = 20; return o }(),
+		func() EncodeOptions { o := DefaultEncodeOptions(90); o.JPEGQuantTable = 9; return o }(),
+	}
+	for i, o := range bad {
+		if err := o.Validate(); err == nil {
+			t.Errorf("case %d: expected validation error for %+v", i, o)
+		}
+	}
+}
+
+func TestVipsSaveFormats(t *testing.T) {
+	vipsTypes := map[Format]vips.ImageType{
+		JPEG: vips.ImageTypeJPEG,
+		PNG:  vips.ImageTypePNG,
+		WebP: vips.ImageTypeWEBP,
+		AVIF: vips.ImageTypeAVIF,
+		TIFF: vips.ImageTypeTIFF,
+		JXL:  vips.ImageTypeJXL,
+	}
+
+	outputDir := t.TempDir()
+
+	for format, vipsType := range vipsTypes {
+		t.Run(format.String(), func(t *testing.T) {
+			if !vips.IsTypeSupported(vipsType) {
+				t.Skipf("libvips built without %s support", format)
+			}
+
+			img, err := LoadVips(testImageVips)
+			if err != nil {
+				t.Fatalf("LoadVips failed: %v", err)
+			}
+			defer img.Close()
+
+			if err := img.ResizeToFit(100, 100, Bilinear); err != nil {
+				t.Fatalf("ResizeToFit failed: %v", err)
+			}
+
+			opts := DefaultEncodeOptions(80)
+			opts.PNGPalette = format == PNG
+			outputPath := filepath.Join(outputDir, "out"+format.Extension())
+			if err := img.SaveFormat(outputPath, format, opts); err != nil {
+				t.Fatalf("SaveFormat(%s) failed: %v", format, err)
+			}
+
+			data, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("Output file not created: %v", err)
+			}
+			if got := vips.DetermineImageType(data); got != vipsType {
+				t.Errorf("expected %s data, detected type %v", format, got)
+			}
+		})
+	}
+}
+
+func TestJXLQualityToDistance(t *testing.T) {
+	tests := []struct {
+		quality  int
+		expected float64
+	}{
+		{100, 0.1},
+		{90, 1.0},
+		{30, 6.4},
+		{1, 6.4 + math.Pow(2.5, 29.0/5)/6.25},
+	}
+	for _, tc := range tests {
+		if got := jxlQualityToDistance(tc.quality); math.Abs(got-tc.expected) > 1e-9 {
+			t.Errorf("jxlQualityToDistance(%d) = %g, expected %g", tc.quality, got, tc.expected)
+		}
+	}
+	for q := 2; q <= 100; q++ {
+		if jxlQualityToDistance(q) >= jxlQualityToDistance(q-1) {
+			t.Errorf("distance at quality %d is not below quality %d", q, q-1)
+		}
+	}
+}
+
+func TestVipsJXLQuality(t *testing.T) {
+	if !vips.IsTypeSupported(vips.ImageTypeJXL) {
+		t.Skip("libvips built without JPEG XL support")
+	}
+	img, err := LoadVips(testImageVips)
+	if err != nil {
+		t.Fatalf("LoadVips failed: %v", err)
+	}
+	defer img.Close()
+	if err := img.ResizeToFit(200, 200, Bilinear); err != nil {
+		t.Fatalf("ResizeToFit failed: %v", err)
+	}
+
+	// Without a distance, --quality picks it
+	low, err := img.Encode(JXL, DefaultEncodeOptions(40))
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	high, err := img.Encode(JXL, DefaultEncodeOptions(95))
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if len(low) >= len(high) {
+		t.Errorf("JXL at quality 40 is %d bytes, at 95 %d bytes; expected quality to change the output", len(low), len(high))
+	}
+}
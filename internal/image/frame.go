@@ -0,0 +1,407 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// FrameStyle describes a frame made of layers, e.g. a thin keyline around
+// the image inside a wide mat. Lengths are relative to the frame width, so
+// a style scales with the output size.
+type FrameStyle struct {
+	// Layers from the image outwards. Inner layers hug the image; the
+	// outermost layer fills the rest of the canvas.
+	Layers []FrameLayer
+	// Sides scales the frame width per side: top, right, bottom, left.
+	// {1, 1, 1.5, 1} gives a deeper bottom margin.
+	Sides [4]float64
+	// Radius rounds the corners of the image and inner layers.
+	Radius float64
+	// Shadow is cast by the image and inner layers onto the outermost layer.
+	Shadow *FrameShadow
+}
+
+// FrameLayer is one band of a frame.
+type FrameLayer struct {
+	// Width is the layer's share of the frame, relative to the sum of all
+	// layer widths.
+	Width float64
+	// Color of the layer; nil uses the frame colour.
+	Color color.Color
+}
+
+// FrameShadow is a drop shadow.
+type FrameShadow struct {
+	Blur    float64 // Gaussian sigma
+	OffsetX float64
+	OffsetY float64
+	Opacity float64 // 0-1
+	Color   color.Color
+}
+
+// FlatFrameStyle is a single layer of the frame colour on all sides.
+var FlatFrameStyle = FrameStyle{
+	Layers: []FrameLayer{{Width: 1}},
+	Sides:  [4]float64{1, 1, 1, 1},
+}
+
+// Insets are distances in pixels from the edges of an image.
+type Insets struct {
+	Top, Right, Bottom, Left int
+}
+
+// Validate checks that the style can be rendered.
+func (s FrameStyle) Validate() error {
+	if len(s.Layers) == 0 {
+		return fmt.Errorf("frame style has no layers")
+	}
+	for _, l := range s.Layers {
+		if l.Width <= 0 {
+			return fmt.Errorf("invalid frame layer width: %g (must be positive)", l.Width)
+		}
+	}
+	for _, side := range s.Sides {
+		if side < 0 {
+			return fmt.Errorf("invalid frame side proportion: %g (must not be negative)", side)
+		}
+	}
+	if s.Radius < 0 {
+		return fmt.Errorf("invalid frame corner radius: %g (must not be negative)", s.Radius)
+	}
+	if sh := s.Shadow; sh != nil {
+		if sh.Blur < 0 {
+			return fmt.Errorf("invalid shadow blur: %g (must not be negative)", sh.Blur)
+		}
+		if sh.Opacity < 0 || sh.Opacity > 1 {
+			return fmt.Errorf("invalid shadow opacity: %g (must be 0-1)", sh.Opacity)
+		}
+	}
+	return nil
+}
+
+// Insets returns the frame width in pixels on each side for a frame of
+// frameWidth pixels.
+func (s FrameStyle) Insets(frameWidth int) Insets {
+	side := func(i int) int {
+		return int(math.Round(float64(frameWidth) * s.Sides[i]))
+	}
+	return Insets{Top: side(0), Right: side(1), Bottom: side(2), Left: side(3)}
+}
+
+// layerInsets returns the widths in pixels of the inner layers, from the
+// image outwards. The outermost layer takes the remaining space.
+func (s FrameStyle) layerInsets(frameWidth int) []Insets {
+	var total float64
+	for _, l := range s.Layers {
+		total += l.Width
+	}
+
+	frame := s.Insets(frameWidth)
+	scale := func(side int, share float64) int {
+		return int(math.Round(float64(side) * share))
+	}
+	layers := make([]Insets, 0, len(s.Layers)-1)
+	for _, l := range s.Layers[:len(s.Layers)-1] {
+		share := l.Width / total
+		layers = append(layers, Insets{
+			Top:    scale(frame.Top, share),
+			Right:  scale(frame.Right, share),
+			Bottom: scale(frame.Bottom, share),
+			Left:   scale(frame.Left, share),
+		})
+	}
+	return layers
+}
+
+// layerColor returns the colour of layer i, or c if it has none.
+func (s FrameStyle) layerColor(i int, c color.Color) color.Color {
+	if s.Layers[i].Color != nil {
+		return s.Layers[i].Color
+	}
+	return c
+}
+
+// AddFrameStyle draws a frame in the given style around the image and
+// places it at (x, y) on a canvasWidth x canvasHeight canvas. frameWidth is
+// the nominal frame width in pixels and c the colour of layers without one.
+func (v *VipsImage) AddFrameStyle(style FrameStyle, frameWidth, canvasWidth, canvasHeight, x, y int, c color.Color) error {
+	return v.addFrameStyle(style, frameWidth, canvasWidth, canvasHeight, x, y, c, nil)
+}
+
+// AddFrameStyleOver is like AddFrameStyle, but the outermost layer is
+// replaced by the background image, which sets the canvas size.
+func (v *VipsImage) AddFrameStyleOver(style FrameStyle, frameWidth int, background *VipsImage, x, y int, c color.Color) error {
+	return v.addFrameStyle(style, frameWidth, background.Width(), background.Height(), x, y, c, background)
+}
+
+// addFrameStyle implements AddFrameStyle and AddFrameStyleOver; background may be nil.
+func (v *VipsImage) addFrameStyle(style FrameStyle, frameWidth, canvasWidth, canvasHeight, x, y int, c color.Color, background *VipsImage) error {
+	if err := style.Validate(); err != nil {
+		return err
+	}
+
+	// Inner layers hug the image
+	for i, in := range style.layerInsets(frameWidth) {
+		if err := v.AddFrame(in.Top, in.Right, in.Bottom, in.Left, style.layerColor(i, c)); err != nil {
+			return err
+		}
+		x -= in.Left
+		y -= in.Top
+	}
+
+	if x < 0 || y < 0 || x+v.Width() > canvasWidth || y+v.Height() > canvasHeight {
+		return fmt.Errorf("frame style does not fit the output size")
+	}
+
+	outer := style.layerColor(len(style.Layers)-1, c)
+	radius := int(math.Round(style.Radius * float64(frameWidth)))
+	debugLog("AddFrameStyle: layers=%d print=%dx%d at (%d,%d) canvas=%dx%d radius=%d shadow=%v",
+		len(style.Layers), v.Width(), v.Height(), x, y, canvasWidth, canvasHeight, radius, style.Shadow != nil)
+
+	if radius == 0 && style.Shadow == nil && background == nil {
+		return v.AddFrame(y, canvasWidth-v.Width()-x, canvasHeight-v.Height()-y, x, outer)
+	}
+	return v.composeOnMat(style.Shadow, radius, frameWidth, canvasWidth, canvasHeight, x, y, outer, background)
+}
+
+// composeOnMat composites the image with rounded corners and a drop shadow
+// onto a canvas of the mat colour, or onto the background if it isn't nil.
+func (v *VipsImage) composeOnMat(shadow *FrameShadow, radius, frameWidth, canvasWidth, canvasHeight, x, y int, mat color.Color, background *VipsImage) error {
+	format := v.ref.BandFormat()
+	hadAlpha := v.ref.HasAlpha()
+	width, height := v.Width(), v.Height()
+
+	mask, err := roundedMaskImage(width, height, radius)
+	if err != nil {
+		return err
+	}
+	defer mask.Close()
+
+	canvas, err := v.matCanvas(canvasWidth, canvasHeight, x, y, mat, background)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if v.ref != canvas {
+			canvas.Close()
+		}
+	}()
+
+	if shadow != nil {
+		layer, margin, err := v.shadowLayer(shadow, mask, frameWidth)
+		if err != nil {
+			return err
+		}
+		defer layer.Close()
+		dx := int(math.Round(shadow.OffsetX * float64(frameWidth)))
+		dy := int(math.Round(shadow.OffsetY * float64(frameWidth)))
+		if err := canvas.Composite(layer, vips.BlendModeOver, x+dx-margin, y+dy-margin); err != nil {
+			return fmt.Errorf("shadow composite failed: %w", err)
+		}
+	}
+
+	// Cut the corners out of the image
+	cutout, err := v.ref.Copy()
+	if err != nil {
+		return fmt.Errorf("copy failed: %w", err)
+	}
+	defer cutout.Close()
+	if radius > 0 {
+		if hadAlpha {
+			if err := cutout.ExtractBand(0, cutout.Bands()-1); err != nil {
+				return fmt.Errorf("extract band failed: %w", err)
+			}
+		}
+		alpha, err := scaledAlpha(mask, 1, format)
+		if err != nil {
+			return err
+		}
+		defer alpha.Close()
+		if err := cutout.BandJoin(alpha); err != nil {
+			return fmt.Errorf("band join failed: %w", err)
+		}
+	}
+	if err := canvas.Composite(cutout, vips.BlendModeOver, x, y); err != nil {
+		return fmt.Errorf("composite failed: %w", err)
+	}
+
+	// Compositing always adds an alpha band
+	if !hadAlpha {
+		if err := canvas.ExtractBand(0, canvas.Bands()-1); err != nil {
+			return fmt.Errorf("extract band failed: %w", err)
+		}
+	}
+	if err := canvas.Cast(format); err != nil {
+		return fmt.Errorf("cast failed: %w", err)
+	}
+
+	v.ref.Close()
+	v.ref = canvas
+	return nil
+}
+
+// matCanvas returns the canvas the image is composited onto: a copy of the
+// image, so it keeps the image's colour space and metadata, filled with the
+// mat colour or covered by the background if it isn't nil.
+func (v *VipsImage) matCanvas(canvasWidth, canvasHeight, x, y int, mat color.Color, background *VipsImage) (*vips.ImageRef, error) {
+	canvas, err := v.ref.Copy()
+	if err != nil {
+		return nil, fmt.Errorf("copy failed: %w", err)
+	}
+	matColor := vipsRGBA(mat)
+	if err := canvas.EmbedBackgroundRGBA(x, y, canvasWidth, canvasHeight, &matColor); err != nil {
+		canvas.Close()
+		return nil, fmt.Errorf("embed failed: %w", err)
+	}
+	if background != nil {
+		err = canvas.Composite(background.ref, vips.BlendModeOver, 0, 0)
+	} else {
+		err = canvas.DrawRect(matColor, x, y, v.Width(), v.Height(), true)
+	}
+	if err != nil {
+		canvas.Close()
+		return nil, fmt.Errorf("draw failed: %w", err)
+	}
+	return canvas, nil
+}
+
+// shadowLayer renders the shadow of an image with the given alpha mask. The
+// layer is larger than the image by the returned margin on each side.
+func (v *VipsImage) shadowLayer(shadow *FrameShadow, mask *vips.ImageRef, frameWidth int) (*vips.ImageRef, int, error) {
+	sigma := shadow.Blur * float64(frameWidth)
+	margin := int(math.Ceil(3 * sigma))
+	width, height := v.Width()+2*margin, v.Height()+2*margin
+
+	alpha, err := scaledAlpha(mask, shadow.Opacity, v.ref.BandFormat())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer alpha.Close()
+	if err := alpha.Embed(margin, margin, width, height, vips.ExtendBlack); err != nil {
+		return nil, 0, fmt.Errorf("shadow embed failed: %w", err)
+	}
+	if sigma > 0 {
+		if err := alpha.GaussianBlur(sigma); err != nil {
+			return nil, 0, fmt.Errorf("shadow blur failed: %w", err)
+		}
+	}
+
+	// A plane of the shadow colour, derived from the image to keep its colour space
+	layer, err := v.ref.Copy()
+	if err != nil {
+		return nil, 0, fmt.Errorf("copy failed: %w", err)
+	}
+	if layer.HasAlpha() {
+		if err := layer.ExtractBand(0, layer.Bands()-1); err != nil {
+			layer.Close()
+			return nil, 0, fmt.Errorf("extract band failed: %w", err)
+		}
+	}
+	r, g, b := colorChannels(shadow.Color, v.ref.BandFormat())
+	if err := layer.Linear([]float64{0, 0, 0}, []float64{r, g, b}); err != nil {
+		layer.Close()
+		return nil, 0, fmt.Errorf("shadow colour failed: %w", err)
+	}
+	if err := layer.Embed(margin, margin, width, height, vips.ExtendCopy); err != nil {
+		layer.Close()
+		return nil, 0, fmt.Errorf("shadow embed failed: %w", err)
+	}
+	if err := layer.Cast(v.ref.BandFormat()); err != nil {
+		layer.Close()
+		return nil, 0, fmt.Errorf("cast failed: %w", err)
+	}
+	if err := alpha.Cast(v.ref.BandFormat()); err != nil {
+		layer.Close()
+		return nil, 0, fmt.Errorf("cast failed: %w", err)
+	}
+	if err := layer.BandJoin(alpha); err != nil {
+		layer.Close()
+		return nil, 0, fmt.Errorf("band join failed: %w", err)
+	}
+	return layer, margin, nil
+}
+
+// scaledAlpha returns the 8-bit mask multiplied by opacity in the value
+// range of format.
+func scaledAlpha(mask *vips.ImageRef, opacity float64, format vips.BandFormat) (*vips.ImageRef, error) {
+	alpha, err := mask.Copy()
+	if err != nil {
+		return nil, fmt.Errorf("copy failed: %w", err)
+	}
+	scale := opacity
+	if format == vips.BandFormatUshort {
+		scale *= 65535.0 / 255.0
+	}
+	if err := alpha.Linear([]float64{scale}, []float64{0}); err != nil {
+		alpha.Close()
+		return nil, fmt.Errorf("alpha scale failed: %w", err)
+	}
+	if err := alpha.Cast(format); err != nil {
+		alpha.Close()
+		return nil, fmt.Errorf("cast failed: %w", err)
+	}
+	return alpha, nil
+}
+
+// colorChannels returns the RGB channels of c in the value range of format.
+func colorChannels(c color.Color, format vips.BandFormat) (float64, float64, float64) {
+	if c == nil {
+		c = color.Black
+	}
+	r, g, b, _ := c.RGBA()
+	scale := 255.0 / 65535
+	if format == vips.BandFormatUshort {
+		scale = 1
+	}
+	return float64(r) * scale, float64(g) * scale, float64(b) * scale
+}
+
+// vipsRGBA converts c to an opaque 8-bit vips colour.
+func vipsRGBA(c color.Color) vips.ColorRGBA {
+	r, g, b, _ := c.RGBA()
+	return vips.ColorRGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: 255}
+}
+
+// roundedMaskImage returns a width x height 8-bit mask that is opaque
+// except for anti-aliased rounded corners of the given radius.
+func roundedMaskImage(width, height, radius int) (*vips.ImageRef, error) {
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := enc.Encode(&buf, roundedMask(width, height, radius)); err != nil {
+		return nil, fmt.Errorf("mask encode failed: %w", err)
+	}
+	mask, err := vips.NewImageFromBuffer(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("mask load failed: %w", err)
+	}
+	return mask, nil
+}
+
+// roundedMask draws the mask for roundedMaskImage.
+func roundedMask(width, height, radius int) *image.Gray {
+	mask := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range mask.Pix {
+		mask.Pix[i] = 0xff
+	}
+
+	radius = min(radius, width/2, height/2)
+	r := float64(radius)
+	for py := 0; py < radius; py++ {
+		for px := 0; px < radius; px++ {
+			// Coverage of the pixel centre by the corner circle
+			d := math.Hypot(r-float64(px)-0.5, r-float64(py)-0.5)
+			a := uint8(math.Round(math.Max(0, math.Min(1, r-d+0.5)) * 255))
+			mask.SetGray(px, py, color.Gray{Y: a})
+			mask.SetGray(width-1-px, py, color.Gray{Y: a})
+			mask.SetGray(px, height-1-py, color.Gray{Y: a})
+			mask.SetGray(width-1-px, height-1-py, color.Gray{Y: a})
+		}
+	}
+	return mask
+}
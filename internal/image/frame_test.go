@@ -0,0 +1,192 @@
+package image
+
+import (
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func testGalleryStyle() FrameStyle {
+	return FrameStyle{
+		Layers: []FrameLayer{{Width: 1, Color: color.Black}, {Width: 3}},
+		Sides:  [4]float64{1, 1, 1.5, 0.5},
+	}
+}
+
+func TestFrameStyleInsets(t *testing.T) {
+	if got := FlatFrameStyle.Insets(40); got != (Insets{40, 40, 40, 40}) {
+		t.Errorf("flat Insets(40) = %+v", got)
+	}
+	if got := testGalleryStyle().Insets(40); got != (Insets{Top: 40, Right: 40, Bottom: 60, Left: 20}) {
+		t.Errorf("gallery Insets(40) = %+v", got)
+	}
+}
+
+func TestFrameStyleLayerInsets(t *testing.T) {
+	if got := FlatFrameStyle.layerInsets(40); len(got) != 0 {
+		t.Errorf("flat layerInsets = %+v, expected none", got)
+	}
+
+	// The keyline takes a quarter of each side
+	expected := []Insets{{Top: 10, Right: 10, Bottom: 15, Left: 5}}
+	if got := testGalleryStyle().layerInsets(40); !reflect.DeepEqual(got, expected) {
+		t.Errorf("gallery layerInsets = %+v, expected %+v", got, expected)
+	}
+}
+
+func TestFrameStyleValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		style  FrameStyle
+		hasErr bool
+	}{
+		{"flat", FlatFrameStyle, false},
+		{"gallery", testGalleryStyle(), false},
+		{"no layers", FrameStyle{Sides: [4]float64{1, 1, 1, 1}}, true},
+		{"zero width", FrameStyle{Layers: []FrameLayer{{Width: 0}}}, true},
+		{"negative side", FrameStyle{Layers: []FrameLayer{{Width: 1}}, Sides: [4]float64{1, -1, 1, 1}}, true},
+		{"negative radius", FrameStyle{Layers: []FrameLayer{{Width: 1}}, Radius: -1}, true},
+		{"opacity", FrameStyle{Layers: []FrameLayer{{Width: 1}}, Shadow: &FrameShadow{Opacity: 1.5}}, true},
+		{"blur", FrameStyle{Layers: []FrameLayer{{Width: 1}}, Shadow: &FrameShadow{Blur: -1, Opacity: 0.5}}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.style.Validate()
+			if tc.hasErr != (err != nil) {
+				t.Errorf("Validate() = %v, expected error: %v", err, tc.hasErr)
+			}
+		})
+	}
+}
+
+func TestRoundedMask(t *testing.T) {
+	mask := roundedMask(40, 30, 10)
+
+	for _, p := range [][2]int{{0, 0}, {39, 0}, {0, 29}, {39, 29}} {
+		if a := mask.GrayAt(p[0], p[1]).Y; a != 0 {
+			t.Errorf("corner pixel %v = %d, expected 0", p, a)
+		}
+	}
+	for _, p := range [][2]int{{20, 15}, {10, 0}, {0, 10}, {29, 29}, {5, 5}} {
+		if a := mask.GrayAt(p[0], p[1]).Y; a != 255 {
+			t.Errorf("inner pixel %v = %d, expected 255", p, a)
+		}
+	}
+	// Anti-aliased edge
+	if a := mask.GrayAt(3, 2).Y; a == 0 || a == 255 {
+		t.Errorf("edge pixel (3,2) = %d, expected partial coverage", a)
+	}
+
+	// Symmetric corners
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			a := mask.GrayAt(x, y).Y
+			if mask.GrayAt(39-x, y).Y != a || mask.GrayAt(x, 29-y).Y != a || mask.GrayAt(39-x, 29-y).Y != a {
+				t.Fatalf("corners differ at (%d,%d)", x, y)
+			}
+		}
+	}
+
+	// The radius is limited to half the shorter side
+	if a := roundedMask(8, 8, 100).GrayAt(4, 4).Y; a != 255 {
+		t.Errorf("centre of a fully rounded mask = %d, expected 255", a)
+	}
+}
+
+func TestVipsAddFrameStyle(t *testing.T) {
+	shadow := testGalleryStyle()
+	shadow.Radius = 0.5
+	shadow.Shadow = &FrameShadow{Blur: 0.2, OffsetX: 0.1, OffsetY: 0.2, Opacity: 0.5, Color: color.Black}
+
+	for name, style := range map[string]FrameStyle{"flat": FlatFrameStyle, "gallery": testGalleryStyle(), "shadow": shadow} {
+		t.Run(name, func(t *testing.T) {
+			img, err := LoadVips(testImageVips)
+			if err != nil {
+				t.Fatalf("LoadVips failed: %v", err)
+			}
+			defer img.Close()
+
+			if err := img.ResizeToFit(200, 150, Bilinear); err != nil {
+				t.Fatalf("ResizeToFit failed: %v", err)
+			}
+			bands := img.ref.Bands()
+			frame := style.Insets(20)
+			x, y := frame.Left+5, frame.Top+5
+			canvasWidth := x + img.Width() + frame.Right + 5
+			canvasHeight := y + img.Height() + frame.Bottom + 5
+
+			if err := img.AddFrameStyle(style, 20, canvasWidth, canvasHeight, x, y, color.White); err != nil {
+				t.Fatalf("AddFrameStyle failed: %v", err)
+			}
+			if img.Width() != canvasWidth || img.Height() != canvasHeight {
+				t.Errorf("AddFrameStyle size = %dx%d, expected %dx%d", img.Width(), img.Height(), canvasWidth, canvasHeight)
+			}
+			if img.ref.Bands() != bands {
+				t.Errorf("AddFrameStyle changed bands from %d to %d", bands, img.ref.Bands())
+			}
+
+			// The canvas corner is the mat colour
+			pixel, err := img.ref.GetPoint(0, 0)
+			if err != nil {
+				t.Fatalf("GetPoint failed: %v", err)
+			}
+			if pixel[0] != 255 {
+				t.Errorf("mat pixel = %v, expected white", pixel)
+			}
+		})
+	}
+
+	// A frame larger than the canvas is an error
+	img, err := LoadVips(testImageVips)
+	if err != nil {
+		t.Fatalf("LoadVips failed: %v", err)
+	}
+	defer img.Close()
+	if err := img.AddFrameStyle(testGalleryStyle(), 20, img.Width(), img.Height(), 0, 0, color.White); err == nil {
+		t.Error("AddFrameStyle expected error for a frame outside the canvas")
+	}
+}
+
+func TestVipsAddFrameStyleP3(t *testing.T) {
+	img, err := LoadVips(testImageVips)
+	if err != nil {
+		t.Fatalf("LoadVips failed: %v", err)
+	}
+	defer img.Close()
+	if err := img.ResizeToFit(200, 150, Bilinear); err != nil {
+		t.Fatalf("ResizeToFit failed: %v", err)
+	}
+	if err := img.ConvertToProfile(ProfileP3, IntentRelative); err != nil {
+		t.Fatalf("ConvertToProfile failed: %v", err)
+	}
+
+	// An sRGB red keyline, converted like the command converts it, is
+	// painted less saturated into P3 pixels
+	keyline, err := ConvertColor(color.RGBA{R: 255, A: 255}, ProfileP3, IntentRelative)
+	if err != nil {
+		t.Fatalf("ConvertColor failed: %v", err)
+	}
+	style := FrameStyle{Layers: []FrameLayer{{Width: 1, Color: keyline}, {Width: 1}}, Sides: [4]float64{1, 1, 1, 1}}
+	frame := style.Insets(20)
+	canvasWidth := frame.Left + img.Width() + frame.Right
+	canvasHeight := frame.Top + img.Height() + frame.Bottom
+	if err := img.AddFrameStyle(style, 20, canvasWidth, canvasHeight, frame.Left, frame.Top, color.White); err != nil {
+		t.Fatalf("AddFrameStyle failed: %v", err)
+	}
+
+	pixel, err := img.ref.GetPoint(frame.Left-5, frame.Top+5)
+	if err != nil {
+		t.Fatalf("GetPoint failed: %v", err)
+	}
+	r, g, b, _ := keyline.RGBA()
+	for i, expected := range []uint32{r >> 8, g >> 8, b >> 8} {
+		if d := pixel[i] - float64(expected); d < -1 || d > 1 {
+			t.Errorf("keyline pixel = %v, expected %v", pixel, keyline)
+			break
+		}
+	}
+	if pixel[1] == 0 {
+		t.Errorf("keyline pixel = %v, expected the sRGB red converted to P3", pixel)
+	}
+}
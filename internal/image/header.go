@@ -0,0 +1,40 @@
+package image
+
+// #cgo pkg-config: vips
+// #include <stdlib.h>
+// #include <vips/vips.h>
+//
+// static int ansel_image_size(const char *path, int *width, int *height) {
+// 	VipsImage *img = vips_image_new_from_file(path, NULL);
+// 	int orientation = 1;
+// 	if (img == NULL)
+// 		return -1;
+// 	if (vips_image_get_typeof(img, VIPS_META_ORIENTATION))
+// 		vips_image_get_int(img, VIPS_META_ORIENTATION, &orientation);
+// 	*width = img->Xsize;
+// 	*height = img->Ysize;
+// 	if (orientation >= 5 && orientation <= 8) {
+// 		*width = img->Ysize;
+// 		*height = img->Xsize;
+// 	}
+// 	g_object_unref(img);
+// 	return 0;
+// }
+import "C"
+
+import "unsafe"
+
+// ReadSize returns the dimensions of the image at path, upright as LoadVips
+// loads it. libvips opens images lazily, so only the header is read.
+func ReadSize(path string) (width, height int, err error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	vipsMu.Lock()
+	defer vipsMu.Unlock()
+	var w, h C.int
+	if C.ansel_image_size(cPath, &w, &h) != 0 {
+		return 0, 0, vipsError("read " + path)
+	}
+	return int(w), int(h), nil
+}
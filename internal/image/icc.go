@@ -0,0 +1,302 @@
+package image
+
+// #cgo pkg-config: vips
+// #include <stdlib.h>
+// #include <vips/vips.h>
+//
+// static int ansel_icc_transform(const void *buf, size_t len, const char *target, const char *fallback,
+// 		VipsIntent intent, int depth, void **out, size_t *outlen) {
+// 	VipsImage *in, *img;
+// 	int err;
+// 	if ((in = vips_image_new_from_buffer(buf, len, "", NULL)) == NULL)
+// 		return -1;
+// 	err = vips_icc_transform(in, &img, target, "input_profile", fallback, "intent", intent,
+// 		"depth", depth, "embedded", TRUE, NULL);
+// 	g_object_unref(in);
+// 	if (err)
+// 		return -1;
+// 	err = vips_tiffsave_buffer(img, out, outlen, NULL);
+// 	g_object_unref(img);
+// 	return err;
+// }
+import "C"
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// RenderingIntent selects how out-of-gamut colours are mapped during an ICC
+// profile conversion.
+type RenderingIntent int
+
+const (
+	// IntentRelative maps colours exactly, clipping those outside the target
+	// gamut and adapting the white point. It is the libvips default.
+	IntentRelative RenderingIntent = iota
+	// IntentPerceptual compresses the whole gamut to fit the target,
+	// preserving the relation between colours.
+	IntentPerceptual
+	// IntentSaturation favours vivid colours over accuracy.
+	IntentSaturation
+	// IntentAbsolute is like IntentRelative, but keeps the source white point.
+	IntentAbsolute
+)
+
+// ParseRenderingIntent converts a string to a RenderingIntent type.
+func ParseRenderingIntent(s string) (RenderingIntent, error) {
+	switch strings.ToLower(s) {
+	case "relative", "relative-colorimetric":
+		return IntentRelative, nil
+	case "perceptual":
+		return IntentPerceptual, nil
+	case "saturation":
+		return IntentSaturation, nil
+	case "absolute", "absolute-colorimetric":
+		return IntentAbsolute, nil
+	default:
+		return IntentRelative, fmt.Errorf("unknown rendering intent: %s", s)
+	}
+}
+
+// String returns the intent name.
+func (i RenderingIntent) String() string {
+	switch i {
+	case IntentRelative:
+		return "relative"
+	case IntentPerceptual:
+		return "perceptual"
+	case IntentSaturation:
+		return "saturation"
+	case IntentAbsolute:
+		return "absolute"
+	default:
+		return "unknown"
+	}
+}
+
+// OutputProfile is the ICC profile output images are converted to and
+// tagged with: one of the built-in sRGB and Display P3 profiles, or an
+// ICC file.
+type OutputProfile struct {
+	name string
+	path string
+}
+
+// Built-in output profiles.
+var (
+	ProfileSRGB = OutputProfile{name: "srgb"}
+	ProfileP3   = OutputProfile{name: "p3"}
+)
+
+// ParseOutputProfile converts "srgb", "p3" or the path of an ICC file to an
+// OutputProfile. Files are checked for a valid ICC header.
+func ParseOutputProfile(s string) (OutputProfile, error) {
+	switch strings.ToLower(s) {
+	case "srgb":
+		return ProfileSRGB, nil
+	case "p3", "display-p3":
+		return ProfileP3, nil
+	}
+
+	if !strings.EqualFold(filepath.Ext(s), ".icc") && !strings.EqualFold(filepath.Ext(s), ".icm") {
+		return ProfileSRGB, fmt.Errorf("unknown output profile: %s (use srgb, p3 or an .icc file)", s)
+	}
+	data, err := os.ReadFile(s)
+	if err != nil {
+		return ProfileSRGB, fmt.Errorf("failed to read output profile: %w", err)
+	}
+	// Every ICC profile has the "acsp" signature at offset 36
+	if len(data) < 128 || !bytes.Equal(data[36:40], []byte("acsp")) {
+		return ProfileSRGB, fmt.Errorf("not an ICC profile: %s", s)
+	}
+	return OutputProfile{name: filepath.Base(s), path: s}, nil
+}
+
+// String returns the profile name.
+func (p OutputProfile) String() string {
+	return p.name
+}
+
+// Path returns the ICC file of the profile, or "" for a built-in profile.
+func (p OutputProfile) Path() string {
+	return p.path
+}
+
+// vipsProfile returns the profile argument for libvips' icc_transform.
+func (p OutputProfile) vipsProfile() (string, error) {
+	switch {
+	case p.path != "":
+		return p.path, nil
+	case p.name == "p3":
+		// Built into libvips
+		return "p3", nil
+	default:
+		return vips.GetSRGBIEC6196621ICCProfilePath()
+	}
+}
+
+// ConvertToProfile converts the image from its embedded ICC profile to the
+// output profile with intent, and embeds the output profile. Images without
+// a profile are treated as sRGB (or generic CMYK for CMYK images).
+func (v *VipsImage) ConvertToProfile(profile OutputProfile, intent RenderingIntent) error {
+	target, err := profile.vipsProfile()
+	if err != nil {
+		return fmt.Errorf("failed to load output profile: %w", err)
+	}
+
+	fallback, err := vips.GetSRGBIEC6196621ICCProfilePath()
+	if err != nil {
+		return fmt.Errorf("failed to load sRGB profile: %w", err)
+	}
+	if !v.ref.HasICCProfile() {
+		switch v.ref.Interpretation() {
+		case vips.InterpretationCMYK:
+			fallback = "cmyk"
+		case vips.InterpretationBW, vips.InterpretationGrey16:
+			// An RGB profile can't import greyscale pixels
+			if err := v.ref.ToColorSpace(vips.InterpretationSRGB); err != nil {
+				return fmt.Errorf("greyscale conversion failed: %w", err)
+			}
+		}
+	}
+
+	debugLog("ConvertToProfile: embedded=%v target=%s intent=%s", v.ref.HasICCProfile(), profile, intent)
+	ref, err := iccTransform(v.ref, target, fallback, intent)
+	if err != nil {
+		return fmt.Errorf("ICC transform failed: %w", err)
+	}
+	if ref != v.ref {
+		v.ref.Close()
+		v.ref = ref
+	}
+	return nil
+}
+
+// iccTransform converts ref from its embedded ICC profile, or fallback if it
+// has none, to target with intent. It returns ref, converted in place, or a
+// new image with the metadata of ref.
+//
+// govips converts with the perceptual intent only. For the other intents,
+// the image is handed to vips_icc_transform as an uncompressed TIFF, like
+// rendered text, and the EXIF data, which TIFF doesn't carry, is copied over.
+func iccTransform(ref *vips.ImageRef, target, fallback string, intent RenderingIntent) (*vips.ImageRef, error) {
+	if intent == IntentPerceptual {
+		return ref, ref.TransformICCProfileWithFallback(target, fallback)
+	}
+
+	data, _, err := ref.ExportTiff(&vips.TiffExportParams{
+		Compression: vips.TiffCompressionNone,
+		Predictor:   vips.TiffPredictorNone,
+	})
+	if err != nil {
+		return nil, err
+	}
+	depth := 16
+	if ref.BandFormat() == vips.BandFormatUchar || ref.BandFormat() == vips.BandFormatChar {
+		depth = 8
+	}
+
+	cTarget, cFallback := C.CString(target), C.CString(fallback)
+	defer C.free(unsafe.Pointer(cTarget))
+	defer C.free(unsafe.Pointer(cFallback))
+	var buf unsafe.Pointer
+	var length C.size_t
+	if err := func() error {
+		vipsMu.Lock()
+		defer vipsMu.Unlock()
+		if C.ansel_icc_transform(unsafe.Pointer(&data[0]), C.size_t(len(data)), cTarget, cFallback,
+			intentToVips(intent), C.int(depth), &buf, &length) != 0 {
+			return vipsError("icc_transform")
+		}
+		return nil
+	}(); err != nil {
+		return nil, err
+	}
+	out := C.GoBytes(buf, C.int(length))
+	C.g_free(C.gpointer(buf))
+
+	converted, err := vips.NewImageFromBuffer(out)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range ref.GetFields() {
+		switch {
+		case field == "exif-data":
+			converted.SetBlob(field, ref.GetBlob(field))
+		case strings.HasPrefix(field, "exif-"):
+			converted.SetString(field, ref.GetAsString(field))
+		}
+	}
+	return converted, nil
+}
+
+// intentToVips converts a RenderingIntent to libvips' VipsIntent.
+func intentToVips(i RenderingIntent) C.VipsIntent {
+	switch i {
+	case IntentPerceptual:
+		return C.VIPS_INTENT_PERCEPTUAL
+	case IntentSaturation:
+		return C.VIPS_INTENT_SATURATION
+	case IntentAbsolute:
+		return C.VIPS_INTENT_ABSOLUTE
+	default:
+		return C.VIPS_INTENT_RELATIVE
+	}
+}
+
+// ConvertColor converts an sRGB colour, like a frame colour given on the
+// command line, to the output profile with intent, so that it looks the same
+// when painted into converted pixels. The alpha is kept, and like ParseColor
+// the result isn't premultiplied.
+func ConvertColor(c Color, profile OutputProfile, intent RenderingIntent) (Color, error) {
+	if profile == ProfileSRGB {
+		return c, nil
+	}
+	target, err := profile.vipsProfile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load output profile: %w", err)
+	}
+	fallback, err := vips.GetSRGBIEC6196621ICCProfilePath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sRGB profile: %w", err)
+	}
+
+	r, g, b, a := c.RGBA()
+	pixel := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	pixel.SetNRGBA(0, 0, color.NRGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, pixel); err != nil {
+		return nil, err
+	}
+	ref, err := vips.NewImageFromBuffer(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create colour image: %w", err)
+	}
+	defer ref.Close()
+	converted, err := iccTransform(ref, target, fallback, intent)
+	if err != nil {
+		return nil, fmt.Errorf("ICC transform failed: %w", err)
+	}
+	if converted != ref {
+		defer converted.Close()
+	}
+
+	values, err := converted.GetPoint(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read colour: %w", err)
+	}
+	if len(values) < 3 || len(values) > 4 || converted.Interpretation() == vips.InterpretationCMYK {
+		return nil, fmt.Errorf("can't convert colours to the %s profile", profile)
+	}
+	return color.RGBA{R: uint8(values[0] + 0.5), G: uint8(values[1] + 0.5), B: uint8(values[2] + 0.5), A: uint8(a >> 8)}, nil
+}
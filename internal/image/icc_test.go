@@ -0,0 +1,178 @@
+package image
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRenderingIntent(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected RenderingIntent
+	}{
+		{"relative", IntentRelative},
+		{"relative-colorimetric", IntentRelative},
+		{"perceptual", IntentPerceptual},
+		{"Saturation", IntentSaturation},
+		{"absolute", IntentAbsolute},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			i, err := ParseRenderingIntent(tc.input)
+			if err != nil {
+				t.Fatalf("ParseRenderingIntent(%q) failed: %v", tc.input, err)
+			}
+			if i != tc.expected {
+				t.Errorf("ParseRenderingIntent(%q) = %v, expected %v", tc.input, i, tc.expected)
+			}
+		})
+	}
+
+	if _, err := ParseRenderingIntent("vivid"); err == nil {
+		t.Error("ParseRenderingIntent(\"vivid\") expected error, got nil")
+	}
+}
+
+func TestParseOutputProfile(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := make([]byte, 128)
+	copy(valid[36:], "acsp")
+	validPath := filepath.Join(dir, "printer.icc")
+	if err := os.WriteFile(validPath, valid, 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalidPath := filepath.Join(dir, "broken.icc")
+	if err := os.WriteFile(invalidPath, make([]byte, 128), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"srgb", "srgb", false},
+		{"sRGB", "srgb", false},
+		{"p3", "p3", false},
+		{"display-p3", "p3", false},
+		{validPath, "printer.icc", false},
+		{invalidPath, "", true},
+		{filepath.Join(dir, "missing.icc"), "", true},
+		{"adobe", "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(filepath.Base(tc.input), func(t *testing.T) {
+			p, err := ParseOutputProfile(tc.input)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("ParseOutputProfile(%q) expected error, got %v", tc.input, p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseOutputProfile(%q) failed: %v", tc.input, err)
+			}
+			if p.String() != tc.expected {
+				t.Errorf("ParseOutputProfile(%q) = %v, expected %v", tc.input, p, tc.expected)
+			}
+		})
+	}
+}
+
+func TestVipsConvertToProfile(t *testing.T) {
+	for _, profile := range []OutputProfile{ProfileSRGB, ProfileP3} {
+		t.Run(profile.String(), func(t *testing.T) {
+			img, err := LoadVips(testImageVips)
+			if err != nil {
+				t.Fatalf("LoadVips failed: %v", err)
+			}
+			defer img.Close()
+
+			width, height := img.Width(), img.Height()
+			if err := img.ConvertToProfile(profile, IntentPerceptual); err != nil {
+				t.Fatalf("ConvertToProfile failed: %v", err)
+			}
+			if !img.ref.HasICCProfile() {
+				t.Error("output profile not embedded")
+			}
+			if img.Width() != width || img.Height() != height {
+				t.Errorf("size changed to %dx%d", img.Width(), img.Height())
+			}
+
+			// The profile must survive the default metadata policy
+			if err := img.ApplyMetadataPolicy(MetadataOptions{}, JPEG); err != nil {
+				t.Fatalf("ApplyMetadataPolicy failed: %v", err)
+			}
+			if !img.ref.HasICCProfile() {
+				t.Error("profile removed by metadata policy")
+			}
+		})
+	}
+}
+
+func TestVipsConvertToProfileIntent(t *testing.T) {
+	for _, intent := range []RenderingIntent{IntentRelative, IntentPerceptual, IntentSaturation, IntentAbsolute} {
+		t.Run(intent.String(), func(t *testing.T) {
+			img, err := LoadVips(testImageVips)
+			if err != nil {
+				t.Fatalf("LoadVips failed: %v", err)
+			}
+			defer img.Close()
+
+			width, height, exif := img.Width(), img.Height(), img.ref.HasExif()
+			if err := img.ConvertToProfile(ProfileP3, intent); err != nil {
+				t.Fatalf("ConvertToProfile failed: %v", err)
+			}
+			if !img.ref.HasICCProfile() {
+				t.Error("output profile not embedded")
+			}
+			if img.Width() != width || img.Height() != height {
+				t.Errorf("size changed to %dx%d", img.Width(), img.Height())
+			}
+			if img.ref.HasExif() != exif {
+				t.Errorf("EXIF present = %v after the conversion, expected %v", img.ref.HasExif(), exif)
+			}
+		})
+	}
+
+	// Relative and perceptual give the same colour for matrix profiles
+	red := color.RGBA{R: 255, A: 255}
+	relative, err := ConvertColor(red, ProfileP3, IntentRelative)
+	if err != nil {
+		t.Fatalf("ConvertColor failed: %v", err)
+	}
+	perceptual, err := ConvertColor(red, ProfileP3, IntentPerceptual)
+	if err != nil {
+		t.Fatalf("ConvertColor failed: %v", err)
+	}
+	r1, g1, b1, _ := relative.RGBA()
+	r2, g2, b2, _ := perceptual.RGBA()
+	for _, d := range []int{int(r1>>8) - int(r2>>8), int(g1>>8) - int(g2>>8), int(b1>>8) - int(b2>>8)} {
+		if d < -1 || d > 1 {
+			t.Errorf("relative %v, perceptual %v, expected the same colour", relative, perceptual)
+			break
+		}
+	}
+}
+
+func TestVipsConvertColor(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	if c, err := ConvertColor(red, ProfileSRGB, IntentRelative); err != nil || c != red {
+		t.Errorf("ConvertColor(sRGB) = %v, %v; expected %v", c, err, red)
+	}
+
+	// Pure sRGB red lies inside the Display P3 gamut, so it is less saturated
+	c, err := ConvertColor(red, ProfileP3, IntentRelative)
+	if err != nil {
+		t.Fatalf("ConvertColor failed: %v", err)
+	}
+	r, g, b, a := c.RGBA()
+	if r>>8 >= 255 || g>>8 == 0 || b>>8 == 0 || a>>8 != 255 {
+		t.Errorf("ConvertColor(p3) = %v, expected a less saturated opaque red", c)
+	}
+}
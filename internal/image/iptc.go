@@ -0,0 +1,237 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf8"
+)
+
+// IPTC IIM dataset numbers in the application record (record 2).
+const (
+	iptcRecordVersion   = 0
+	iptcObjectName      = 5
+	iptcKeywords        = 25
+	iptcDateCreated     = 55
+	iptcByline          = 80
+	iptcBylineTitle     = 85
+	iptcCity            = 90
+	iptcSublocation     = 92
+	iptcProvinceState   = 95
+	iptcCountryCode     = 100
+	iptcCountryName     = 101
+	iptcHeadline        = 105
+	iptcCredit          = 110
+	iptcSource          = 115
+	iptcCopyrightNotice = 116
+	iptcContact         = 118
+	iptcCaption         = 120
+	iptcWriterEditor    = 122
+)
+
+// iptcCodedCharacterSet is dataset 1:90, which declares the text encoding.
+const iptcCodedCharacterSet = 90
+
+// iptcUTF8 is the 1:90 value declaring UTF-8 text (ESC % G).
+var iptcUTF8 = []byte{0x1b, 0x25, 0x47}
+
+// photoshopHeader prefixes the Photoshop image resource block in JPEG APP13.
+var photoshopHeader = []byte("Photoshop 3.0\x00")
+
+// photoshopIPTCResource is the image resource ID holding IPTC IIM data.
+const photoshopIPTCResource = 0x0404
+
+// iptcDataset is a single IPTC IIM dataset (record:dataset = data).
+type iptcDataset struct {
+	record  byte
+	dataset byte
+	data    []byte
+}
+
+// parseIIM parses raw IPTC IIM data into datasets.
+func parseIIM(data []byte) ([]iptcDataset, error) {
+	var datasets []iptcDataset
+	for len(data) > 0 {
+		// Trailing padding is common, stop at the first non-tag byte
+		if data[0] != 0x1c {
+			break
+		}
+		if len(data) < 5 {
+			return datasets, fmt.Errorf("truncated IPTC dataset header")
+		}
+		record, dataset := data[1], data[2]
+		length := int(binary.BigEndian.Uint16(data[3:5]))
+		data = data[5:]
+
+		// Extended datasets store the size of the length field in the low 15 bits
+		if length&0x8000 != 0 {
+			n := length & 0x7fff
+			if n > 4 || len(data) < n {
+				return datasets, fmt.Errorf("invalid IPTC extended length")
+			}
+			length = 0
+			for _, b := range data[:n] {
+				length = length<<8 | int(b)
+			}
+			data = data[n:]
+		}
+
+		if length > len(data) {
+			return datasets, fmt.Errorf("truncated IPTC dataset %d:%d", record, dataset)
+		}
+		datasets = append(datasets, iptcDataset{record: record, dataset: dataset, data: data[:length]})
+		data = data[length:]
+	}
+	return datasets, nil
+}
+
+// encodeIIM serializes datasets to raw IPTC IIM data.
+func encodeIIM(datasets []iptcDataset) []byte {
+	var buf bytes.Buffer
+	for _, ds := range datasets {
+		buf.Write([]byte{0x1c, ds.record, ds.dataset})
+		if len(ds.data) < 0x8000 {
+			binary.Write(&buf, binary.BigEndian, uint16(len(ds.data)))
+		} else {
+			binary.Write(&buf, binary.BigEndian, uint16(0x8004))
+			binary.Write(&buf, binary.BigEndian, uint32(len(ds.data)))
+		}
+		buf.Write(ds.data)
+	}
+	return buf.Bytes()
+}
+
+// extractIIM returns the raw IIM data from an iptc-data blob. libvips stores
+// the whole APP13 payload for JPEG (a Photoshop resource block) and raw IIM
+// for TIFF, so both are accepted.
+func extractIIM(blob []byte) []byte {
+	if len(blob) > 0 && blob[0] == 0x1c {
+		return blob
+	}
+
+	data := bytes.TrimPrefix(blob, photoshopHeader)
+	for len(data) >= 12 && bytes.Equal(data[:4], []byte("8BIM")) {
+		id := binary.BigEndian.Uint16(data[4:6])
+
+		// Pascal string name, padded to an even length including the length byte
+		nameLen := int(data[6]) + 1
+		if nameLen%2 != 0 {
+			nameLen++
+		}
+		offset := 6 + nameLen
+		if len(data) < offset+4 {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		offset += 4
+		if len(data) < offset+size {
+			return nil
+		}
+		if id == photoshopIPTCResource {
+			return data[offset : offset+size]
+		}
+
+		// Resource data is padded to an even length
+		if size%2 != 0 {
+			size++
+		}
+		if len(data) < offset+size {
+			return nil
+		}
+		data = data[offset+size:]
+	}
+	return nil
+}
+
+// wrapPhotoshopIPTC wraps raw IIM data in a Photoshop resource block for JPEG APP13.
+func wrapPhotoshopIPTC(iim []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(photoshopHeader)
+	buf.WriteString("8BIM")
+	binary.Write(&buf, binary.BigEndian, uint16(photoshopIPTCResource))
+	buf.Write([]byte{0, 0}) // empty name, padded
+	binary.Write(&buf, binary.BigEndian, uint32(len(iim)))
+	buf.Write(iim)
+	if len(iim)%2 != 0 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+// iptcBlobForFormat returns IIM data in the container libvips expects for format.
+func iptcBlobForFormat(iim []byte, format Format) []byte {
+	if format == JPEG {
+		return wrapPhotoshopIPTC(iim)
+	}
+	return iim
+}
+
+// iptcIsUTF8 reports whether the datasets declare UTF-8 text via 1:90.
+func iptcIsUTF8(datasets []iptcDataset) bool {
+	for _, ds := range datasets {
+		if ds.record == 1 && ds.dataset == iptcCodedCharacterSet {
+			return bytes.Equal(ds.data, iptcUTF8)
+		}
+	}
+	return false
+}
+
+// iptcString decodes dataset text. Without a UTF-8 declaration, text that
+// isn't valid UTF-8 is treated as Latin-1, which most legacy writers use.
+func iptcString(data []byte, declaredUTF8 bool) string {
+	if declaredUTF8 || utf8.Valid(data) {
+		return string(bytes.TrimRight(data, "\x00"))
+	}
+	runes := make([]rune, 0, len(data))
+	for _, b := range data {
+		if b == 0 {
+			break
+		}
+		runes = append(runes, rune(b))
+	}
+	return string(runes)
+}
+
+// iptcValues collects the decoded values of an application record dataset.
+func iptcValues(datasets []iptcDataset, dataset byte) []string {
+	isUTF8 := iptcIsUTF8(datasets)
+	var values []string
+	for _, ds := range datasets {
+		if ds.record == 2 && ds.dataset == dataset {
+			if s := iptcString(ds.data, isUTF8); s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+// iptcValue returns the first decoded value of an application record dataset.
+func iptcValue(datasets []iptcDataset, dataset byte) string {
+	if values := iptcValues(datasets, dataset); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// filterIPTC keeps the envelope character set declaration, the record
+// version, and the application record datasets accepted by keep.
+func filterIPTC(datasets []iptcDataset, keep func(dataset byte) bool) []iptcDataset {
+	var out []iptcDataset
+	var hasContent bool
+	for _, ds := range datasets {
+		switch {
+		case ds.record == 1 && ds.dataset == iptcCodedCharacterSet:
+			out = append(out, ds)
+		case ds.record == 2 && ds.dataset == iptcRecordVersion:
+			out = append(out, ds)
+		case ds.record == 2 && keep(ds.dataset):
+			out = append(out, ds)
+			hasContent = true
+		}
+	}
+	if !hasContent {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,122 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// ChromaSubsampling selects the resolution of the colour channels in JPEG
+// output.
+type ChromaSubsampling int
+
+const (
+	// SubsampleAuto lets libvips decide: 4:2:0 below quality 90, 4:4:4 above.
+	SubsampleAuto ChromaSubsampling = iota
+	// Subsample420 halves the colour resolution in both directions.
+	Subsample420
+	// Subsample444 keeps the colour channels at full resolution, which keeps
+	// thin coloured lines such as keylines crisp.
+	Subsample444
+)
+
+// ParseChromaSubsampling converts a string to a ChromaSubsampling type.
+func ParseChromaSubsampling(s string) (ChromaSubsampling, error) {
+	switch strings.ToLower(s) {
+	case "auto":
+		return SubsampleAuto, nil
+	case "4:2:0", "420", "on":
+		return Subsample420, nil
+	case "4:4:4", "444", "off":
+		return Subsample444, nil
+	default:
+		return SubsampleAuto, fmt.Errorf("unknown chroma subsampling: %s (use auto, 4:2:0 or 4:4:4)", s)
+	}
+}
+
+// String returns the subsampling as a J:a:b ratio.
+func (c ChromaSubsampling) String() string {
+	switch c {
+	case SubsampleAuto:
+		return "auto"
+	case Subsample420:
+		return "4:2:0"
+	case Subsample444:
+		return "4:4:4"
+	default:
+		return "unknown"
+	}
+}
+
+// subsamples reports whether JPEG output at quality is chroma subsampled.
+func (c ChromaSubsampling) subsamples(quality int) bool {
+	if c == SubsampleAuto {
+		return quality < 90
+	}
+	return c == Subsample420
+}
+
+// subsampleToVips converts our ChromaSubsampling type to the vips type.
+func subsampleToVips(c ChromaSubsampling) vips.SubsampleMode {
+	switch c {
+	case Subsample420:
+		return vips.VipsForeignSubsampleOn
+	case Subsample444:
+		return vips.VipsForeignSubsampleOff
+	default:
+		return vips.VipsForeignSubsampleAuto
+	}
+}
+
+// JPEGTuning is a named set of JPEG encoder settings.
+type JPEGTuning int
+
+const (
+	// JPEGWeb favours small files: 4:2:0 subsampling, progressive scans,
+	// and mozjpeg's trellis quantisation, deringing and ImageMagick tables.
+	JPEGWeb JPEGTuning = iota
+	// JPEGPrint favours fidelity and compatibility with RIPs and print labs:
+	// full-resolution colour, baseline scans and the standard tables.
+	JPEGPrint
+)
+
+// ParseJPEGTuning converts a string to a JPEGTuning type.
+func ParseJPEGTuning(s string) (JPEGTuning, error) {
+	switch strings.ToLower(s) {
+	case "web":
+		return JPEGWeb, nil
+	case "print":
+		return JPEGPrint, nil
+	default:
+		return JPEGWeb, fmt.Errorf("unknown JPEG defaults: %s (use web or print)", s)
+	}
+}
+
+// String returns the tuning name.
+func (t JPEGTuning) String() string {
+	switch t {
+	case JPEGWeb:
+		return "web"
+	case JPEGPrint:
+		return "print"
+	default:
+		return "unknown"
+	}
+}
+
+// Apply sets the JPEG settings of opts to those of the tuning. Huffman
+// optimisation is lossless, so both tunings use it.
+func (t JPEGTuning) Apply(opts *EncodeOptions) {
+	web := t == JPEGWeb
+	opts.JPEGSubsample = Subsample444
+	opts.JPEGQuantTable = 0
+	if web {
+		opts.JPEGSubsample = Subsample420
+		opts.JPEGQuantTable = 3
+	}
+	opts.JPEGProgressive = web
+	opts.JPEGOptimizeCoding = true
+	opts.JPEGTrellis = web
+	opts.JPEGDeringing = web
+}
@@ -0,0 +1,122 @@
+package image
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseChromaSubsampling(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ChromaSubsampling
+	}{
+		{"auto", SubsampleAuto},
+		{"4:2:0", Subsample420},
+		{"420", Subsample420},
+		{"4:4:4", Subsample444},
+		{"OFF", Subsample444},
+	}
+	for _, tc := range tests {
+		got, err := ParseChromaSubsampling(tc.input)
+		if err != nil {
+			t.Fatalf("ParseChromaSubsampling(%q) failed: %v", tc.input, err)
+		}
+		if got != tc.expected {
+			t.Errorf("ParseChromaSubsampling(%q) = %s, expected %s", tc.input, got, tc.expected)
+		}
+	}
+	if _, err := ParseChromaSubsampling("4:1:1"); err == nil {
+		t.Error("ParseChromaSubsampling(4:1:1) expected error, got nil")
+	}
+}
+
+func TestJPEGTuning(t *testing.T) {
+	for _, name := range []string{"web", "print"} {
+		tuning, err := ParseJPEGTuning(name)
+		if err != nil {
+			t.Fatalf("ParseJPEGTuning(%q) failed: %v", name, err)
+		}
+		if tuning.String() != name {
+			t.Errorf("String() = %q, expected %q", tuning, name)
+		}
+	}
+	if _, err := ParseJPEGTuning("archive"); err == nil {
+		t.Error("ParseJPEGTuning(archive) expected error, got nil")
+	}
+
+	// The tunings are opt-in: the defaults leave the subsampling to libvips
+	// and the encoder settings off
+	opts := DefaultEncodeOptions(90)
+	if opts.JPEGSubsample != SubsampleAuto || opts.JPEGProgressive || opts.JPEGOptimizeCoding ||
+		opts.JPEGTrellis || opts.JPEGDeringing || opts.JPEGQuantTable != 0 {
+		t.Errorf("default options = %+v, expected the encoder defaults", opts)
+	}
+	JPEGWeb.Apply(&opts)
+	if !opts.JPEGProgressive || opts.JPEGSubsample != Subsample420 || opts.JPEGQuantTable != 3 {
+		t.Errorf("web options = %+v", opts)
+	}
+
+	// Print overrides every setting of web
+	JPEGPrint.Apply(&opts)
+	if opts.JPEGProgressive || opts.JPEGTrellis || opts.JPEGDeringing || opts.JPEGSubsample != Subsample444 ||
+		opts.JPEGQuantTable != 0 || !opts.JPEGOptimizeCoding {
+		t.Errorf("print options = %+v", opts)
+	}
+}
+
+func TestVipsEncodeJPEGOptions(t *testing.T) {
+	img, err := LoadVips(testImageVips)
+	if err != nil {
+		t.Fatalf("LoadVips failed: %v", err)
+	}
+	defer img.Close()
+	if err := img.ResizeToFit(200, 200, Bilinear); err != nil {
+		t.Fatalf("ResizeToFit failed: %v", err)
+	}
+
+	tests := []struct {
+		tuning      JPEGTuning
+		progressive bool
+		sampling    byte // horizontal and vertical factor of the luma component
+	}{
+		{JPEGWeb, true, 0x22},
+		{JPEGPrint, false, 0x11},
+	}
+	for _, tc := range tests {
+		t.Run(tc.tuning.String(), func(t *testing.T) {
+			opts := DefaultEncodeOptions(92)
+			tc.tuning.Apply(&opts)
+			data, err := img.Encode(JPEG, opts)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+
+			// SOF2 marks progressive JPEG, SOF0 baseline; the luma
+			// sampling factors follow the component ID
+			marker, sof := jpegFrameHeader(data)
+			if sof == nil {
+				t.Fatal("no frame header")
+			}
+			if progressive := marker == 0xc2; progressive != tc.progressive {
+				t.Errorf("frame marker = %#x, expected progressive: %v", marker, tc.progressive)
+			}
+			if got := sof[7]; got != tc.sampling {
+				t.Errorf("luma sampling = %#x, expected %#x", got, tc.sampling)
+			}
+		})
+	}
+}
+
+// jpegFrameHeader returns the start-of-frame marker of a JPEG file and the
+// segment after its length.
+func jpegFrameHeader(data []byte) (byte, []byte) {
+	for i := 2; i+4 <= len(data) && data[i] == 0xff; {
+		marker := data[i+1]
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xc0 || marker == 0xc2 {
+			return marker, data[i+4 : min(i+2+n, len(data))]
+		}
+		i += 2 + n
+	}
+	return 0, nil
+}
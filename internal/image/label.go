@@ -0,0 +1,457 @@
+package image
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/rivo/uniseg"
+)
+
+// ellipsis marks truncated label text.
+const ellipsis = "…"
+
+// LabelAlign is the horizontal alignment of a label relative to the image.
+type LabelAlign int
+
+const (
+	// LabelLeft aligns the label with the left edge of the image.
+	LabelLeft LabelAlign = iota
+	// LabelCentre centres the label on the image.
+	LabelCentre
+	// LabelRight aligns the label with the right edge of the image.
+	LabelRight
+)
+
+// ParseLabelAlign converts a string to a LabelAlign.
+func ParseLabelAlign(s string) (LabelAlign, error) {
+	switch strings.ToLower(s) {
+	case "left":
+		return LabelLeft, nil
+	case "centre", "center":
+		return LabelCentre, nil
+	case "right":
+		return LabelRight, nil
+	default:
+		return LabelLeft, fmt.Errorf("unknown label alignment: %s (use left, centre or right)", s)
+	}
+}
+
+// String returns the alignment name.
+func (a LabelAlign) String() string {
+	switch a {
+	case LabelLeft:
+		return "left"
+	case LabelCentre:
+		return "centre"
+	case LabelRight:
+		return "right"
+	default:
+		return "unknown"
+	}
+}
+
+// LabelPlacement is where a label is drawn relative to the image.
+type LabelPlacement int
+
+const (
+	// LabelBelow draws the label in the frame, just below the image.
+	LabelBelow LabelPlacement = iota
+	// LabelAbove draws the label in the frame, just above the image.
+	LabelAbove
+	// LabelInside centres the label vertically in the frame below the
+	// image, e.g. in the deep bottom margin of a polaroid frame.
+	LabelInside
+	// LabelOverlay draws the label on the image, near its bottom edge.
+	LabelOverlay
+)
+
+// ParseLabelPlacement converts a string to a LabelPlacement.
+func ParseLabelPlacement(s string) (LabelPlacement, error) {
+	switch strings.ToLower(s) {
+	case "below":
+		return LabelBelow, nil
+	case "above":
+		return LabelAbove, nil
+	case "inside":
+		return LabelInside, nil
+	case "overlay":
+		return LabelOverlay, nil
+	default:
+		return LabelBelow, fmt.Errorf("unknown label placement: %s (use below, above, inside or overlay)", s)
+	}
+}
+
+// String returns the placement name.
+func (p LabelPlacement) String() string {
+	switch p {
+	case LabelBelow:
+		return "below"
+	case LabelAbove:
+		return "above"
+	case LabelInside:
+		return "inside"
+	case LabelOverlay:
+		return "overlay"
+	default:
+		return "unknown"
+	}
+}
+
+// LabelStyle describes how a label is laid out and drawn.
+type LabelStyle struct {
+	Font       string // Pango font description including the size, e.g. "sans 24"
+	FontFile   string // font file to load in addition to the installed fonts
+	Size       int    // font size in pixels, which scales the box padding
+	Align      LabelAlign
+	Placement  LabelPlacement
+	Color      color.Color // text colour; nil is black
+	Background color.Color // box behind the text; nil or transparent draws none
+	MaxLines   int         // wrap to at most this many lines, 0 for no limit
+	Padding    int         // gap between the image edge and the label box
+	SafeMargin int         // keep the label box this far inside the output edges
+}
+
+// measureFunc returns the rendered size of a line of text.
+type measureFunc func(text string) (width, height int)
+
+// labelLayout is the position of a label on the output.
+type labelLayout struct {
+	lines   []string
+	origins []image.Point   // top left of each line
+	box     image.Rectangle // background box
+	text    image.Rectangle // text block inside the box
+}
+
+// AddLabel draws text on the image as laid out by style. area is the
+// position of the image in the output, as returned by the fit functions.
+// Text that is wider than the image is wrapped at word boundaries, and text
+// beyond style.MaxLines is cut off with an ellipsis.
+func (v *VipsImage) AddLabel(text string, style LabelStyle, area image.Rectangle) error {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	measure := newTextMeasurer(style)
+	layout := layoutLabel(text, style, area, image.Rect(0, 0, v.Width(), v.Height()), measure.size)
+	if measure.err != nil {
+		return measure.err
+	}
+	debugLog("AddLabel: %d lines, box %v, text %v, %s %s", len(layout.lines), layout.box, layout.text, style.Placement, style.Align)
+	if layout.box.Empty() {
+		return nil
+	}
+
+	if err := v.fillLabelBox(layout.box, style.Background); err != nil {
+		return err
+	}
+	for i, line := range layout.lines {
+		if err := v.drawLabelLine(line, style, layout.origins[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drawLabelLine renders a line of text in the label colour and composites
+// it onto the image at pt. Lines are drawn one at a time so that each is
+// placed by the label alignment whatever its writing direction.
+func (v *VipsImage) drawLabelLine(line string, style LabelStyle, pt image.Point) error {
+	c := orBlack(style.Color)
+	text, err := renderText(labelSpan(line, c), style.Font, style.FontFile)
+	if err != nil {
+		return err
+	}
+	defer text.Close()
+
+	// The colour's alpha scales the coverage of the glyphs
+	if _, _, _, a := c.RGBA(); a < 0xffff {
+		if err := text.Linear([]float64{1, 1, 1, float64(a) / 0xffff}, []float64{0, 0, 0, 0}); err != nil {
+			return fmt.Errorf("text opacity failed: %w", err)
+		}
+		if err := text.Cast(vips.BandFormatUchar); err != nil {
+			return fmt.Errorf("cast failed: %w", err)
+		}
+	}
+
+	return v.compositeLayer(text, vips.BlendModeOver, pt.X, pt.Y)
+}
+
+// fillLabelBox fills the box with c, blending it with the image if c is
+// translucent. A nil or fully transparent colour leaves the image unchanged.
+func (v *VipsImage) fillLabelBox(box image.Rectangle, c color.Color) error {
+	if c == nil {
+		return nil
+	}
+	_, _, _, a := c.RGBA()
+	switch a {
+	case 0:
+		return nil
+	case 0xffff:
+		if err := v.ref.DrawRect(vipsRGBA(c), box.Min.X, box.Min.Y, box.Dx(), box.Dy(), true); err != nil {
+			return fmt.Errorf("draw failed: %w", err)
+		}
+		return nil
+	}
+
+	// Blend the premultiplied colour over the area under the box
+	format := v.ref.BandFormat()
+	region, err := v.ref.Copy()
+	if err != nil {
+		return fmt.Errorf("copy failed: %w", err)
+	}
+	defer region.Close()
+	if err := region.ExtractArea(box.Min.X, box.Min.Y, box.Dx(), box.Dy()); err != nil {
+		return fmt.Errorf("crop failed: %w", err)
+	}
+	r, g, b := colorChannels(c, format)
+	alpha := float64(a) / 0xffff
+	mul := []float64{1 - alpha, 1 - alpha, 1 - alpha}
+	// ParseColor keeps hex alpha colours unpremultiplied
+	add := []float64{r * alpha, g * alpha, b * alpha}
+	if region.HasAlpha() {
+		mul, add = append(mul, 1), append(add, 0)
+	}
+	if region.Bands() < 3 {
+		mul, add = mul[:region.Bands()], add[:region.Bands()]
+	}
+	if err := region.Linear(mul, add); err != nil {
+		return fmt.Errorf("blend failed: %w", err)
+	}
+	if err := region.Cast(format); err != nil {
+		return fmt.Errorf("cast failed: %w", err)
+	}
+	if err := v.ref.Insert(region, box.Min.X, box.Min.Y, false, nil); err != nil {
+		return fmt.Errorf("insert failed: %w", err)
+	}
+	return nil
+}
+
+// layoutLabel wraps the text to the image width and positions it. area is
+// the image and canvas the whole output; the box is moved out of the safe
+// margin and clamped to the canvas.
+func layoutLabel(text string, style LabelStyle, area, canvas image.Rectangle, measure measureFunc) labelLayout {
+	pad := style.Size / 3
+	maxWidth := area.Dx() - pad
+	if style.Placement == LabelOverlay {
+		maxWidth -= 2 * style.Padding
+	}
+	lines := wrapLabel(text, max(maxWidth, 1), style.MaxLines, func(s string) int {
+		w, _ := measure(s)
+		return w
+	})
+
+	textWidth, textHeight := 0, 0
+	sizes := make([]image.Point, len(lines))
+	for i, line := range lines {
+		w, h := measure(line)
+		sizes[i] = image.Pt(w, h)
+		textWidth = max(textWidth, w)
+		textHeight += h
+	}
+
+	// The box extends half the padding around the text
+	inset := pad / 2
+	boxWidth, boxHeight := textWidth+2*inset, textHeight+2*inset
+
+	left, right := area.Min.X-inset, area.Max.X+inset
+	if style.Placement == LabelOverlay {
+		left, right = area.Min.X+style.Padding, area.Max.X-style.Padding
+	}
+	var boxLeft int
+	switch style.Align {
+	case LabelCentre:
+		boxLeft = (left + right - boxWidth) / 2
+	case LabelRight:
+		boxLeft = right - boxWidth
+	default:
+		boxLeft = left
+	}
+
+	var boxTop int
+	switch style.Placement {
+	case LabelAbove:
+		boxTop = area.Min.Y - style.Padding - boxHeight
+	case LabelInside:
+		boxTop = (area.Max.Y + canvas.Max.Y - boxHeight) / 2
+	case LabelOverlay:
+		boxTop = area.Max.Y - style.Padding - boxHeight
+	default:
+		boxTop = area.Max.Y + style.Padding
+	}
+	if style.SafeMargin > 0 {
+		safe := canvas.Inset(style.SafeMargin)
+		boxLeft = clampSpan(boxLeft, boxWidth, safe.Min.X, safe.Max.X)
+		boxTop = clampSpan(boxTop, boxHeight, safe.Min.Y, safe.Max.Y)
+	}
+
+	// Lines are aligned within the text block like the block on the image
+	block := image.Rect(boxLeft+inset, boxTop+inset, boxLeft+inset+textWidth, boxTop+inset+textHeight)
+	origins := make([]image.Point, len(lines))
+	y := block.Min.Y
+	for i, size := range sizes {
+		switch style.Align {
+		case LabelCentre:
+			origins[i] = image.Pt(block.Min.X+(textWidth-size.X)/2, y)
+		case LabelRight:
+			origins[i] = image.Pt(block.Max.X-size.X, y)
+		default:
+			origins[i] = image.Pt(block.Min.X, y)
+		}
+		y += size.Y
+	}
+
+	return labelLayout{
+		lines:   lines,
+		origins: origins,
+		box:     image.Rect(boxLeft, boxTop, boxLeft+boxWidth, boxTop+boxHeight).Intersect(canvas),
+		text:    block,
+	}
+}
+
+// clampSpan moves a span of length n starting at start inside [lo, hi),
+// keeping it at lo if it is too long.
+func clampSpan(start, n, lo, hi int) int {
+	return max(min(start, hi-n), lo)
+}
+
+// wrapLabel breaks text into lines no wider than maxWidth at spaces, keeping
+// explicit line breaks. A word that doesn't fit on a line of its own, and
+// the last line if there are more than maxLines (0 for no limit), are cut
+// off with an ellipsis.
+func wrapLabel(text string, maxWidth, maxLines int, width func(string) int) []string {
+	var lines []string
+	full := func() bool { return maxLines > 0 && len(lines) >= maxLines }
+
+	var rest []string // words that didn't fit within maxLines
+	for _, paragraph := range strings.Split(text, "\n") {
+		words := strings.Fields(paragraph)
+		if full() {
+			rest = append(rest, words...)
+			continue
+		}
+		line := ""
+		for i, word := range words {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if width(candidate) <= maxWidth {
+				line = candidate
+				continue
+			}
+			if line == "" {
+				// A single word wider than the label
+				line = truncateLabel(word, maxWidth, width)
+				continue
+			}
+			lines = append(lines, line)
+			line = word
+			if full() {
+				line = ""
+				rest = append(rest, words[i:]...)
+				break
+			}
+			if width(line) > maxWidth {
+				line = truncateLabel(line, maxWidth, width)
+			}
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if len(rest) > 0 && len(lines) > 0 {
+		last := len(lines) - 1
+		lines[last] = truncateLabel(lines[last]+" "+strings.Join(rest, " "), maxWidth, width)
+	}
+	return lines
+}
+
+// truncateLabel shortens s until it fits maxWidth with an ellipsis,
+// preferring to cut at a space. s is returned unchanged if it fits.
+func truncateLabel(s string, maxWidth int, width func(string) int) string {
+	if width(s) <= maxWidth {
+		return s
+	}
+	for i := strings.LastIndex(s, " "); i > 0; i = strings.LastIndex(s[:i], " ") {
+		if cut := strings.TrimRight(s[:i], " "); cut != "" && width(cut+ellipsis) <= maxWidth {
+			return cut + ellipsis
+		}
+	}
+	// No word boundary fits, so cut within the first word
+	for s != "" {
+		s = strings.TrimRight(s[:lastClusterStart(s)], " ")
+		if width(s+ellipsis) <= maxWidth {
+			return s + ellipsis
+		}
+	}
+	return ellipsis
+}
+
+// lastClusterStart returns the index of the last user-perceived character
+// in s, so that truncation doesn't split an accented letter, a Hangul or
+// Indic syllable, or an emoji sequence such as a flag or a ZWJ family.
+func lastClusterStart(s string) int {
+	start, state := 0, -1
+	for rest := s; rest != ""; {
+		var cluster string
+		cluster, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		start = len(s) - len(rest) - len(cluster)
+	}
+	return start
+}
+
+// textMeasurer measures label text in the label font. Each measurement
+// renders the text, so results are cached. The first error is kept in err
+// and later measurements return zero.
+type textMeasurer struct {
+	font, fontFile string
+	cache          map[string]image.Point
+	err            error
+}
+
+// newTextMeasurer returns a textMeasurer for the font of style.
+func newTextMeasurer(style LabelStyle) *textMeasurer {
+	return &textMeasurer{font: style.Font, fontFile: style.FontFile, cache: make(map[string]image.Point)}
+}
+
+// size returns the rendered size of text. It is a measureFunc.
+func (m *textMeasurer) size(text string) (int, int) {
+	if m.err != nil {
+		return 0, 0
+	}
+	if s, ok := m.cache[text]; ok {
+		return s.X, s.Y
+	}
+	w, h, err := textSize(labelMarkup(text), m.font, m.fontFile)
+	if err != nil {
+		m.err = fmt.Errorf("failed to measure label: %w", err)
+		return 0, 0
+	}
+	m.cache[text] = image.Pt(w, h)
+	return w, h
+}
+
+// labelMarkup escapes text for Pango markup, which libvips renders.
+func labelMarkup(text string) string {
+	return html.EscapeString(text)
+}
+
+// labelSpan returns the Pango markup of text in colour c. Its alpha is
+// applied separately since older versions of Pango ignore it.
+func labelSpan(text string, c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf(`<span foreground="#%02x%02x%02x">%s</span>`, r>>8, g>>8, b>>8, labelMarkup(text))
+}
+
+// orBlack returns c, or black if it is nil.
+func orBlack(c color.Color) color.Color {
+	if c == nil {
+		return color.Black
+	}
+	return c
+}
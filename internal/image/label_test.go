@@ -0,0 +1,232 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// fixedMeasure measures text as 10px per character and 20px per line.
+func fixedMeasure(text string) (int, int) {
+	lines := strings.Split(text, "\n")
+	w := 0
+	for _, line := range lines {
+		w = max(w, 10*utf8.RuneCountInString(line))
+	}
+	return w, 20 * len(lines)
+}
+
+func fixedWidth(text string) int {
+	w, _ := fixedMeasure(text)
+	return w
+}
+
+func TestParseLabelAlign(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected LabelAlign
+	}{
+		{"left", LabelLeft},
+		{"centre", LabelCentre},
+		{"center", LabelCentre},
+		{"RIGHT", LabelRight},
+	}
+	for _, tc := range tests {
+		got, err := ParseLabelAlign(tc.input)
+		if err != nil {
+			t.Fatalf("ParseLabelAlign(%q) failed: %v", tc.input, err)
+		}
+		if got != tc.expected {
+			t.Errorf("ParseLabelAlign(%q) = %v, expected %v", tc.input, got, tc.expected)
+		}
+	}
+	if _, err := ParseLabelAlign("justify"); err == nil {
+		t.Error("ParseLabelAlign(\"justify\") expected error, got nil")
+	}
+}
+
+func TestParseLabelPlacement(t *testing.T) {
+	for _, p := range []LabelPlacement{LabelBelow, LabelAbove, LabelInside, LabelOverlay} {
+		got, err := ParseLabelPlacement(p.String())
+		if err != nil {
+			t.Fatalf("ParseLabelPlacement(%q) failed: %v", p, err)
+		}
+		if got != p {
+			t.Errorf("ParseLabelPlacement(%q) = %v", p, got)
+		}
+	}
+	if _, err := ParseLabelPlacement("beside"); err == nil {
+		t.Error("ParseLabelPlacement(\"beside\") expected error, got nil")
+	}
+}
+
+func TestWrapLabel(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxWidth int
+		maxLines int
+		expected []string
+	}{
+		{"fits", "Tram 28", 100, 1, []string{"Tram 28"}},
+		{"wrap", "Tram 28 climbing through Alfama", 100, 0, []string{"Tram 28", "climbing", "through", "Alfama"}},
+		{"wrap two words", "Tram 28 climbing through Alfama", 150, 0, []string{"Tram 28", "climbing", "through Alfama"}},
+		{"ellipsis", "Tram 28 climbing through Alfama", 150, 2, []string{"Tram 28", "climbing…"}},
+		{"single line", "Tram 28 climbing through Alfama", 160, 1, []string{"Tram 28…"}},
+		{"long word", "Photographers", 60, 1, []string{"Photo…"}},
+		{"line breaks", "Lisbon\nJune 2024", 100, 0, []string{"Lisbon", "June 2024"}},
+		{"line breaks truncated", "Lisbon\nJune 2024", 100, 1, []string{"Lisbon…"}},
+		{"extra spaces", "  Tram   28  ", 100, 1, []string{"Tram 28"}},
+		{"empty", "", 100, 1, nil},
+		{"right to left", "שלום עולם ומלואו", 100, 1, []string{"שלום עולם…"}},
+		{"emoji flag", "🇵🇹🇵🇹🇵🇹🇵🇹", 60, 1, []string{"🇵🇹🇵🇹…"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := wrapLabel(tc.text, tc.maxWidth, tc.maxLines, fixedWidth)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("wrapLabel(%q, %d, %d) = %q, expected %q", tc.text, tc.maxWidth, tc.maxLines, got, tc.expected)
+			}
+			for _, line := range got {
+				if fixedWidth(line) > tc.maxWidth {
+					t.Errorf("line %q is wider than %d", line, tc.maxWidth)
+				}
+			}
+		})
+	}
+}
+
+func TestLastClusterStart(t *testing.T) {
+	tests := []struct {
+		input, expected string // expected is the last cluster
+	}{
+		{"abc", "c"},
+		{"cafe\u0301", "e\u0301"},
+		{"ok 👍🏽", "👍🏽"},
+		{"flags 🇵🇹🇩🇪", "🇩🇪"},
+		{"🇵🇹🇩🇪🇫", "🇫"},
+		{"family 👨\u200d👩\u200d👧", "👨\u200d👩\u200d👧"},
+		{"heart ❤️", "❤️"},
+		{"سلام", "م"},
+		{"한국어", "어"},
+		{"\u1112\u1161\u11ab", "\u1112\u1161\u11ab"}, // a syllable of Hangul jamo
+		{"नमस्ते", "ते"},
+		{"น้ำ", "น้ำ"},
+		{"x", "x"},
+		{"", ""},
+	}
+	for _, tc := range tests {
+		if got := tc.input[lastClusterStart(tc.input):]; got != tc.expected {
+			t.Errorf("last cluster of %q = %q, expected %q", tc.input, got, tc.expected)
+		}
+	}
+}
+
+func TestLayoutLabel(t *testing.T) {
+	// A 400x300 image at 50,50 on a 500x500 canvas
+	area := image.Rect(50, 50, 450, 350)
+	canvas := image.Rect(0, 0, 500, 500)
+
+	tests := []struct {
+		name      string
+		align     LabelAlign
+		placement LabelPlacement
+		box       image.Rectangle
+	}{
+		// "Tram 28" is 70x20, the box adds 3px around it
+		{"below left", LabelLeft, LabelBelow, image.Rect(47, 360, 123, 386)},
+		{"below centre", LabelCentre, LabelBelow, image.Rect(212, 360, 288, 386)},
+		{"below right", LabelRight, LabelBelow, image.Rect(377, 360, 453, 386)},
+		{"above", LabelLeft, LabelAbove, image.Rect(47, 14, 123, 40)},
+		{"inside", LabelCentre, LabelInside, image.Rect(212, 412, 288, 438)},
+		{"overlay", LabelRight, LabelOverlay, image.Rect(364, 314, 440, 340)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			style := LabelStyle{Size: 18, Align: tc.align, Placement: tc.placement, Padding: 10}
+			got := layoutLabel("Tram 28", style, area, canvas, fixedMeasure)
+			if got.box != tc.box {
+				t.Errorf("box = %v, expected %v", got.box, tc.box)
+			}
+			if !got.text.In(got.box) || got.text.Dx() != 70 || got.text.Dy() != 20 {
+				t.Errorf("text = %v, expected 70x20 in %v", got.text, got.box)
+			}
+		})
+	}
+
+	// Lines are aligned within the text block
+	style := LabelStyle{Size: 18, Align: LabelRight, Placement: LabelBelow, Padding: 10, MaxLines: 2}
+	got := layoutLabel("Tram 28 climbing through Alfama", style, image.Rect(0, 0, 160, 100), image.Rect(0, 0, 200, 200), fixedMeasure)
+	expected := []image.Point{{90, 113}, {70, 133}}
+	if !reflect.DeepEqual(got.origins, expected) {
+		t.Errorf("origins of %q = %v, expected %v", got.lines, got.origins, expected)
+	}
+
+	// Boxes are kept out of the safe margin
+	style = LabelStyle{Size: 18, Placement: LabelBelow, Padding: 10, SafeMargin: 30}
+	got = layoutLabel("Tram 28", style, image.Rect(50, 50, 450, 450), canvas, fixedMeasure)
+	if expected := image.Rect(47, 444, 123, 470); got.box != expected {
+		t.Errorf("box with safe margin = %v, expected %v", got.box, expected)
+	}
+	if !got.text.In(got.box) {
+		t.Errorf("text %v is outside the box %v", got.text, got.box)
+	}
+
+	// Boxes are clamped to the canvas
+	style = LabelStyle{Size: 18, Placement: LabelBelow, Padding: 10, MaxLines: 0}
+	got = layoutLabel(strings.Repeat("word ", 100), style, area, canvas, fixedMeasure)
+	if !got.box.In(canvas) {
+		t.Errorf("box %v is outside the canvas", got.box)
+	}
+	for _, line := range got.lines {
+		if fixedWidth(line) > area.Dx() {
+			t.Errorf("line %q is wider than the image", line)
+		}
+	}
+}
+
+func TestVipsAddLabel(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		style LabelStyle
+	}{
+		{"below", "Tram 28 climbing through Alfama at dawn", LabelStyle{Font: "sans 24", Size: 24, Color: color.Black, Background: color.White, MaxLines: 1, Padding: 10}},
+		{"overlay translucent", "Tram 28 climbing through Alfama at dawn", LabelStyle{Font: "sans 24", Size: 24, Placement: LabelOverlay, Align: LabelCentre,
+			Color: color.White, Background: color.RGBA{0, 0, 0, 128}, MaxLines: 2, Padding: 10}},
+		{"above transparent", "Tram 28 climbing through Alfama at dawn", LabelStyle{Font: "sans 24", Size: 24, Placement: LabelAbove, Align: LabelRight,
+			Color: color.Black, Background: color.RGBA{}, Padding: 10}},
+		{"right to left", "ترام ٢٨ في ألفاما (Lisbon)", LabelStyle{Font: "sans 24", Size: 24, Align: LabelRight,
+			Color: color.Black, Background: color.White, MaxLines: 2, Padding: 10}},
+		{"emoji", "Lisboa 🇵🇹 ☀️ 👨‍👩‍👧 <b>&</b>", LabelStyle{Font: "sans 24", Size: 24, Align: LabelCentre,
+			Color: color.Black, Background: color.White, MaxLines: 1, Padding: 10}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := LoadVips(testImageVips)
+			if err != nil {
+				t.Fatalf("LoadVips failed: %v", err)
+			}
+			defer img.Close()
+			if err := img.ResizeToFit(400, 400, Lanczos); err != nil {
+				t.Fatalf("ResizeToFit failed: %v", err)
+			}
+			w, h := img.Width(), img.Height()
+			if err := img.AddFrame(80, 40, 80, 40, color.White); err != nil {
+				t.Fatalf("AddFrame failed: %v", err)
+			}
+
+			area := image.Rect(40, 80, 40+w, 80+h)
+			if err := img.AddLabel(tc.text, tc.style, area); err != nil {
+				t.Fatalf("AddLabel failed: %v", err)
+			}
+			if img.Width() != w+80 || img.Height() != h+160 {
+				t.Errorf("AddLabel changed the size to %dx%d", img.Width(), img.Height())
+			}
+		})
+	}
+}
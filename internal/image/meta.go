@@ -0,0 +1,404 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bep/imagemeta"
+)
+
+// Metadata is the descriptive and camera metadata of a photo, combined from
+// embedded EXIF, IPTC and XMP, XMP sidecars and DXO PhotoLab sidecars. It is
+// the data label templates are rendered with, so fields are exported and
+// empty when no source has a value.
+//
+// Descriptive fields prefer the DXO sidecar, then XMP, then IPTC, then EXIF,
+// since editors update the former first. Camera fields prefer EXIF.
+type Metadata struct {
+	Filename string // base name without extension
+
+	Title     string // falls back to the headline
+	Headline  string
+	Caption   string
+	Creator   string
+	Copyright string
+	Keywords  []string
+
+	Location string // sublocation, e.g. a landmark
+	City     string
+	State    string
+	Country  string
+
+	Make         string
+	Model        string
+	Camera       string // make and model without repeating the make
+	Lens         string
+	FocalLength  float64 // mm
+	FNumber      float64
+	ExposureTime string // e.g. "1/250" or "2"
+	ISO          int
+	DateTaken    time.Time
+}
+
+// Date formats the capture date with a Go time layout, e.g. "2006" or
+// "2 January 2006". It returns "" if the date is unknown.
+func (m *Metadata) Date(layout string) string {
+	if m.DateTaken.IsZero() {
+		return ""
+	}
+	return m.DateTaken.Format(layout)
+}
+
+// metadataSources holds the raw metadata of a photo before it is combined.
+type metadataSources struct {
+	exif map[string]any      // EXIF tags by imagemeta name
+	iptc map[string]any      // IPTC tags by imagemeta name
+	xmp  map[string][]string // XMP properties as returned by parseXMP
+	dxo  map[string]string   // string fields of a DXO PhotoLab sidecar
+}
+
+// ReadMetadata reads the metadata of an image file and its sidecars. Missing
+// or unreadable sources are skipped, so it always returns a value.
+func ReadMetadata(path string) *Metadata {
+	debugLog("reading metadata for %s", path)
+	src := metadataSources{
+		exif: make(map[string]any),
+		iptc: make(map[string]any),
+		xmp:  make(map[string][]string),
+	}
+	readEmbeddedMetadata(path, &src)
+
+	// Sidecar XMP overrides embedded XMP
+	if props := readXMPSidecar(path); props != nil {
+		for k, v := range props {
+			src.xmp[k] = v
+		}
+	}
+	src.dxo = readDXOFields(path)
+
+	m := newMetadata(src)
+	m.Filename = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return m
+}
+
+// readEmbeddedMetadata collects the EXIF, IPTC and XMP metadata embedded in
+// an image file.
+func readEmbeddedMetadata(path string, src *metadataSources) {
+	format := detectImageFormat(path)
+	if format == 0 {
+		debugLog("unsupported image format")
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		debugLog("failed to open file: %v", err)
+		return
+	}
+	defer f.Close()
+
+	err = imagemeta.Decode(imagemeta.Options{
+		R:           f,
+		ImageFormat: format,
+		Sources:     imagemeta.EXIF | imagemeta.IPTC | imagemeta.XMP,
+		HandleTag: func(tag imagemeta.TagInfo) error {
+			switch tag.Source {
+			case imagemeta.EXIF:
+				src.exif[tag.Tag] = tag.Value
+			case imagemeta.IPTC:
+				src.iptc[tag.Tag] = tag.Value
+			}
+			return nil
+		},
+		HandleXMP: func(r io.Reader) error {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			props, err := parseXMP(data)
+			if err != nil {
+				debugLog("XMP parse error: %v", err)
+			}
+			for k, v := range props {
+				src.xmp[k] = v
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		debugLog("metadata decode error: %v", err)
+	}
+	debugLog("parsed %d EXIF, %d IPTC and %d XMP tags", len(src.exif), len(src.iptc), len(src.xmp))
+}
+
+// SidecarPaths returns the paths metadata sidecars of the image at path are
+// read from, whether they exist or not.
+func SidecarPaths(path string) []string {
+	return append(xmpSidecarPaths(path), dxoSidecarPath(path))
+}
+
+// xmpSidecarPaths returns the XMP sidecars of an image in the order they are
+// looked for.
+func xmpSidecarPaths(path string) []string {
+	return []string{path + ".xmp", strings.TrimSuffix(path, filepath.Ext(path)) + ".xmp"}
+}
+
+// dxoSidecarPath returns the DXO PhotoLab sidecar of an image.
+func dxoSidecarPath(path string) string {
+	return path + ".dop"
+}
+
+// readXMPSidecar reads photo.jpg.xmp or photo.xmp next to an image, as
+// written by darktable and Lightroom. Returns nil if there is none.
+func readXMPSidecar(path string) map[string][]string {
+	for _, sidecar := range xmpSidecarPaths(path) {
+		data, err := os.ReadFile(sidecar)
+		if err != nil {
+			continue
+		}
+		debugLog("found XMP sidecar: %s", sidecar)
+		props, err := parseXMP(data)
+		if err != nil {
+			debugLog("XMP sidecar parse error: %v", err)
+		}
+		return props
+	}
+	return nil
+}
+
+// dxoFieldPattern matches a string field of a DXO PhotoLab sidecar.
+var dxoFieldPattern = regexp.MustCompile(`(\w+)\s*=\s*"([^"]*)"`)
+
+// readDXOFields reads the string fields of a DXO PhotoLab sidecar (.dop).
+// The first value of each field wins. Returns nil if there is no sidecar.
+func readDXOFields(imagePath string) map[string]string {
+	data, err := os.ReadFile(dxoSidecarPath(imagePath))
+	if err != nil {
+		return nil
+	}
+	fields := make(map[string]string)
+	for _, m := range dxoFieldPattern.FindAllSubmatch(data, -1) {
+		if _, seen := fields[string(m[1])]; !seen {
+			fields[string(m[1])] = string(m[2])
+		}
+	}
+	debugLog("parsed %d fields from DXO sidecar", len(fields))
+	return fields
+}
+
+// newMetadata combines the metadata sources, applying fallbacks.
+func newMetadata(src metadataSources) *Metadata {
+	xmp := func(key string) string {
+		if v := src.xmp[key]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	exif := func(key string) string { return metaString(src.exif[key]) }
+	iptc := func(key string) string { return metaString(src.iptc[key]) }
+
+	m := &Metadata{
+		Title:     firstNonEmpty(src.dxo["statusTitle"], xmp("dc:title"), iptc("ObjectName")),
+		Headline:  firstNonEmpty(src.dxo["contentHeadline"], xmp("photoshop:Headline"), iptc("Headline")),
+		Caption:   firstNonEmpty(src.dxo["contentDescription"], xmp("dc:description"), iptc("Caption-Abstract"), exif("ImageDescription")),
+		Creator:   firstNonEmpty(src.dxo["contactCreator"], xmp("dc:creator"), iptc("By-line"), exif("Artist")),
+		Copyright: firstNonEmpty(src.dxo["statusCopyrightNotice"], xmp("dc:rights"), iptc("CopyrightNotice"), exif("Copyright")),
+		Location:  firstNonEmpty(src.dxo["imageLocation"], xmp("Iptc4xmpCore:Location"), iptc("Sub-location")),
+		City:      firstNonEmpty(src.dxo["imageCity"], xmp("photoshop:City"), iptc("City")),
+		State:     firstNonEmpty(src.dxo["imageState"], xmp("photoshop:State"), iptc("Province-State")),
+		Country:   firstNonEmpty(src.dxo["imageCountry"], xmp("photoshop:Country"), iptc("Country-PrimaryLocationName")),
+		Make:      firstNonEmpty(exif("Make"), xmp("tiff:Make")),
+		Model:     firstNonEmpty(exif("Model"), xmp("tiff:Model")),
+		Lens:      firstNonEmpty(exif("LensModel"), xmp("exifEX:LensModel"), xmp("aux:Lens")),
+	}
+	if m.Title == "" {
+		m.Title = m.Headline
+	}
+	m.Camera = cameraName(m.Make, m.Model)
+
+	if v := src.xmp["dc:subject"]; len(v) > 0 {
+		m.Keywords = v
+	} else {
+		m.Keywords = metaStrings(src.iptc["Keywords"])
+	}
+
+	m.FocalLength = firstFloat(src.exif["FocalLength"], xmp("exif:FocalLength"))
+	m.FNumber = firstFloat(src.exif["FNumber"], xmp("exif:FNumber"))
+	m.ISO = int(firstFloat(src.exif["ISO"], xmp("exif:ISOSpeedRatings")))
+	if t := firstFloat(src.exif["ExposureTime"], xmp("exif:ExposureTime")); t > 0 {
+		m.ExposureTime = formatExposureTime(t)
+	}
+
+	for _, s := range []string{exif("DateTimeOriginal"), xmp("exif:DateTimeOriginal"), xmp("photoshop:DateCreated"), xmp("xmp:CreateDate"), iptc("DateCreated")} {
+		if t, ok := parseMetadataDate(s); ok {
+			m.DateTaken = t
+			break
+		}
+	}
+	return m
+}
+
+// firstNonEmpty returns the first value that isn't blank, trimmed.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// firstFloat returns the first value that converts to a positive number.
+func firstFloat(values ...any) float64 {
+	for _, v := range values {
+		if f, ok := metaFloat(v); ok && f > 0 {
+			return f
+		}
+	}
+	return 0
+}
+
+// metaString converts a tag value to a string. Lists are joined with commas.
+func metaString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimRight(v, "\x00")
+	case []byte:
+		return string(bytes.TrimRight(v, "\x00"))
+	case []string:
+		return strings.Join(v, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// metaStrings converts a tag value that may be repeated to a list.
+func metaStrings(v any) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, s := range v {
+			values = append(values, metaString(s))
+		}
+		return values
+	default:
+		if s := metaString(v); s != "" {
+			return []string{s}
+		}
+		return nil
+	}
+}
+
+// metaFloat converts a numeric tag value, including rationals and strings
+// like "28/10", to a float. Lists use their first value.
+func metaFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case interface{ Float64() float64 }:
+		return v.Float64(), true
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case []uint16:
+		if len(v) > 0 {
+			return float64(v[0]), true
+		}
+	case []any:
+		if len(v) > 0 {
+			return metaFloat(v[0])
+		}
+	case string:
+		if num, den, ok := strings.Cut(v, "/"); ok {
+			n, err1 := strconv.ParseFloat(strings.TrimSpace(num), 64)
+			d, err2 := strconv.ParseFloat(strings.TrimSpace(den), 64)
+			if err1 == nil && err2 == nil && d != 0 {
+				return n / d, true
+			}
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// formatExposureTime formats an exposure time in seconds the way cameras
+// show it: fractions of a second as 1/n, longer exposures as a number.
+func formatExposureTime(t float64) string {
+	if t < 1 {
+		n := 1 / t
+		if math.Abs(n-math.Round(n)) < 0.05*n {
+			return fmt.Sprintf("1/%d", int(math.Round(n)))
+		}
+	}
+	return strconv.FormatFloat(math.Round(t*10)/10, 'f', -1, 64)
+}
+
+// makeSuffixes are company suffixes that are dropped from camera makes.
+var makeSuffixes = []string{" corporation", " imaging corp", " optical co", " co.,", " co., ", " company"}
+
+// cameraName combines make and model, without repeating the make if the
+// model already starts with it ("Canon" + "Canon EOS R5").
+func cameraName(maker, model string) string {
+	lower := strings.ToLower(maker)
+	for _, suffix := range makeSuffixes {
+		if i := strings.Index(lower, suffix); i > 0 {
+			maker, lower = maker[:i], lower[:i]
+		}
+	}
+	switch {
+	case model == "":
+		return maker
+	case maker == "" || strings.HasPrefix(strings.ToLower(model), lower):
+		return model
+	default:
+		return maker + " " + model
+	}
+}
+
+// metadataDateLayouts are the date formats used by EXIF, XMP and IPTC.
+var metadataDateLayouts = []string{
+	"2006:01:02 15:04:05",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"20060102",
+	"2006-01",
+	"2006",
+}
+
+// parseMetadataDate parses a date in any of the metadata formats.
+func parseMetadataDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.HasPrefix(s, "0000") {
+		return time.Time{}, false
+	}
+	for _, layout := range metadataDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,208 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bep/imagemeta"
+)
+
+// copyFixture copies a file from testdata/metadata into dir under name.
+func copyFixture(t *testing.T, dir, fixture, name string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("../../testdata/metadata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadMetadataSidecars(t *testing.T) {
+	dir := t.TempDir()
+	imgPath := filepath.Join(dir, "fuji.jpg")
+	if err := os.WriteFile(imgPath, []byte("dummy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, dir, "fuji.xmp", "fuji.xmp")
+	copyFixture(t, dir, "fuji.jpg.dop", "fuji.jpg.dop")
+
+	m := ReadMetadata(imgPath)
+	expected := &Metadata{
+		Filename:     "fuji",
+		Title:        "Morning Tram",
+		Headline:     "Tram 28",                         // DXO
+		Caption:      "Tram 28 climbing through Alfama", // DXO
+		Creator:      "Ada Example",
+		Keywords:     []string{"tram", "street"},
+		Location:     "Alfama", // DXO
+		City:         "Lisbon", // empty in DXO, from XMP
+		Country:      "Portugal",
+		Make:         "FUJIFILM",
+		Model:        "X-T5",
+		Camera:       "FUJIFILM X-T5",
+		Lens:         "XF23mmF1.4 R LM WR",
+		FocalLength:  23,
+		FNumber:      2.8,
+		ExposureTime: "1/250",
+		ISO:          400,
+		DateTaken:    time.Date(2024, 6, 21, 5, 42, 10, 0, time.FixedZone("", 2*60*60)),
+	}
+	if !m.DateTaken.Equal(expected.DateTaken) {
+		t.Errorf("DateTaken = %v, expected %v", m.DateTaken, expected.DateTaken)
+	}
+	m.DateTaken = expected.DateTaken
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("ReadMetadata =\n%+v\nexpected\n%+v", m, expected)
+	}
+}
+
+func TestReadMetadataEmbedded(t *testing.T) {
+	m := ReadMetadata(testImagePath)
+	if m.Filename != "input" {
+		t.Errorf("Filename = %q, expected input", m.Filename)
+	}
+	// The embedded headline matches the headline-only reader
+	if headline := ReadIPTCHeadline(testImagePath); m.Headline != headline {
+		t.Errorf("Headline = %q, ReadIPTCHeadline = %q", m.Headline, headline)
+	}
+
+	// Missing files have empty metadata
+	if m := ReadMetadata("/nonexistent/photo.jpg"); m.Title != "" || m.Camera != "" || !m.DateTaken.IsZero() {
+		t.Errorf("ReadMetadata of a missing file = %+v", m)
+	}
+}
+
+func TestNewMetadataPrecedence(t *testing.T) {
+	fNumber, _ := imagemeta.NewRat[uint32](56, 10)
+	focal, _ := imagemeta.NewRat[uint32](50, 1)
+	exposure, _ := imagemeta.NewRat[uint32](1, 60)
+
+	src := metadataSources{
+		exif: map[string]any{
+			"Make":             "NIKON CORPORATION",
+			"Model":            "NIKON Z 6_2",
+			"FNumber":          fNumber,
+			"FocalLength":      focal,
+			"ExposureTime":     exposure,
+			"ISO":              uint16(800),
+			"DateTimeOriginal": "2023:12:24 18:30:00",
+			"Artist":           "EXIF Artist",
+			"Copyright":        "EXIF Copyright",
+		},
+		iptc: map[string]any{
+			"ObjectName":      "IPTC Title",
+			"Headline":        "IPTC Headline",
+			"By-line":         []string{"IPTC Creator"},
+			"Keywords":        []string{"snow", "night"},
+			"CopyrightNotice": "IPTC Copyright",
+			"City":            []byte("Zürich"),
+		},
+		xmp: map[string][]string{
+			"dc:title":     {"XMP Title"},
+			"exif:FNumber": {"4/1"},
+		},
+	}
+
+	m := newMetadata(src)
+	checks := []struct {
+		field, got, expected string
+	}{
+		{"Title", m.Title, "XMP Title"},
+		{"Headline", m.Headline, "IPTC Headline"},
+		{"Creator", m.Creator, "IPTC Creator"},
+		{"Copyright", m.Copyright, "IPTC Copyright"},
+		{"City", m.City, "Zürich"},
+		{"Camera", m.Camera, "NIKON Z 6_2"},
+		{"ExposureTime", m.ExposureTime, "1/60"},
+		{"Date", m.Date("2006-01-02 15:04"), "2023-12-24 18:30"},
+	}
+	for _, c := range checks {
+		if c.got != c.expected {
+			t.Errorf("%s = %q, expected %q", c.field, c.got, c.expected)
+		}
+	}
+	if m.FNumber != 5.6 || m.FocalLength != 50 || m.ISO != 800 {
+		t.Errorf("exposure = f/%v %vmm ISO %d, expected EXIF values", m.FNumber, m.FocalLength, m.ISO)
+	}
+	if !reflect.DeepEqual(m.Keywords, []string{"snow", "night"}) {
+		t.Errorf("Keywords = %v", m.Keywords)
+	}
+
+	// The title falls back to the headline
+	delete(src.xmp, "dc:title")
+	delete(src.iptc, "ObjectName")
+	if m := newMetadata(src); m.Title != "IPTC Headline" {
+		t.Errorf("Title fallback = %q, expected the headline", m.Title)
+	}
+
+	// Empty sources give empty metadata
+	if m := newMetadata(metadataSources{}); !reflect.DeepEqual(m, &Metadata{}) {
+		t.Errorf("newMetadata(empty) = %+v", m)
+	}
+}
+
+func TestCameraName(t *testing.T) {
+	tests := []struct {
+		make, model, expected string
+	}{
+		{"Canon", "Canon EOS R5", "Canon EOS R5"},
+		{"NIKON CORPORATION", "NIKON Z 6_2", "NIKON Z 6_2"},
+		{"OLYMPUS IMAGING CORP.", "E-M5", "OLYMPUS E-M5"},
+		{"SONY", "ILCE-7M3", "SONY ILCE-7M3"},
+		{"", "X100V", "X100V"},
+		{"Leica Camera AG", "", "Leica Camera AG"},
+		{"", "", ""},
+	}
+	for _, tc := range tests {
+		if got := cameraName(tc.make, tc.model); got != tc.expected {
+			t.Errorf("cameraName(%q, %q) = %q, expected %q", tc.make, tc.model, got, tc.expected)
+		}
+	}
+}
+
+func TestFormatExposureTime(t *testing.T) {
+	tests := []struct {
+		seconds  float64
+		expected string
+	}{
+		{1.0 / 250, "1/250"},
+		{1.0 / 3, "1/3"},
+		{0.4, "0.4"},
+		{1, "1"},
+		{2.5, "2.5"},
+		{30, "30"},
+	}
+	for _, tc := range tests {
+		if got := formatExposureTime(tc.seconds); got != tc.expected {
+			t.Errorf("formatExposureTime(%v) = %q, expected %q", tc.seconds, got, tc.expected)
+		}
+	}
+}
+
+func TestParseMetadataDate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{"2023:12:24 18:30:00", "2023-12-24", true},
+		{"2024-06-21T05:42:10+02:00", "2024-06-21", true},
+		{"2024-06-21T05:42:10.25Z", "2024-06-21", true},
+		{"2024-06-21", "2024-06-21", true},
+		{"20240621", "2024-06-21", true},
+		{"0000:00:00 00:00:00", "", false},
+		{"yesterday", "", false},
+		{"", "", false},
+	}
+	for _, tc := range tests {
+		got, ok := parseMetadataDate(tc.input)
+		if ok != tc.ok || (ok && got.Format("2006-01-02") != tc.expected) {
+			t.Errorf("parseMetadataDate(%q) = %v, %v, expected %s, %v", tc.input, got, ok, tc.expected, tc.ok)
+		}
+	}
+}
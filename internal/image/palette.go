@@ -0,0 +1,378 @@
+package image
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// paletteSampleSize is the longer side the image is reduced to before its
+// colours are extracted. Small images keep the extraction fast, and the
+// reduction already averages away noise.
+const paletteSampleSize = 128
+
+// paletteIterations is the number of k-means refinements of the median cut.
+const paletteIterations = 8
+
+// Swatch is one colour of an image's palette.
+type Swatch struct {
+	Color  color.RGBA
+	Weight float64 // fraction of the image's pixels closest to this colour
+}
+
+// Hex returns the swatch colour as #rrggbb.
+func (s Swatch) Hex() string {
+	return HexColor(s.Color)
+}
+
+// Palette holds the dominant colours of an image.
+type Palette struct {
+	Swatches []Swatch   // sorted by decreasing weight
+	Average  color.RGBA // mean colour in linear light
+}
+
+// Dominant returns the most common colour, or the average if there are no swatches.
+func (p Palette) Dominant() color.RGBA {
+	if len(p.Swatches) == 0 {
+		return p.Average
+	}
+	return p.Swatches[0].Color
+}
+
+// AutoColor selects how a frame colour is derived from an image's palette.
+type AutoColor int
+
+const (
+	// AutoNone uses the configured colour.
+	AutoNone AutoColor = iota
+	// AutoDominant uses the image's dominant colour.
+	AutoDominant
+	// AutoDark uses a deep shade of the dominant hue.
+	AutoDark
+	// AutoLight uses a pale tint of the dominant hue.
+	AutoLight
+	// AutoComplement uses a muted colour opposite the dominant hue.
+	AutoComplement
+)
+
+// ParseAutoColor reports whether s names an automatic colour ("auto",
+// "auto-dark", "auto-light" or "auto-complement").
+func ParseAutoColor(s string) (AutoColor, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "auto":
+		return AutoDominant, true
+	case "auto-dark":
+		return AutoDark, true
+	case "auto-light":
+		return AutoLight, true
+	case "auto-complement":
+		return AutoComplement, true
+	default:
+		return AutoNone, false
+	}
+}
+
+// String returns the automatic colour name.
+func (a AutoColor) String() string {
+	switch a {
+	case AutoNone:
+		return "none"
+	case AutoDominant:
+		return "auto"
+	case AutoDark:
+		return "auto-dark"
+	case AutoLight:
+		return "auto-light"
+	case AutoComplement:
+		return "auto-complement"
+	default:
+		return "unknown"
+	}
+}
+
+// Color derives a colour from the palette. The shades keep the dominant hue
+// but limit the saturation, so frames don't compete with the image.
+func (p Palette) Color(mode AutoColor) color.RGBA {
+	dominant := p.Dominant()
+	h, s, l := rgbToHSL(dominant)
+	switch mode {
+	case AutoDark:
+		return hslToRGB(h, math.Min(s, 0.4), 0.12)
+	case AutoLight:
+		return hslToRGB(h, math.Min(s, 0.3), 0.93)
+	case AutoComplement:
+		return hslToRGB(math.Mod(h+0.5, 1), math.Min(s, 0.6), math.Max(0.3, math.Min(l, 0.7)))
+	default:
+		return dominant
+	}
+}
+
+// HexColor formats a colour as #rrggbb.
+func HexColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+// Palette extracts up to n dominant colours from the image. The colours are
+// taken from an 8-bit reduction of the image in its current colour space,
+// so convert to the output profile first.
+func (v *VipsImage) Palette(n int) (Palette, error) {
+	if n < 1 {
+		return Palette{}, fmt.Errorf("invalid palette size: %d (must be at least 1)", n)
+	}
+
+	sample, err := v.ref.Copy()
+	if err != nil {
+		return Palette{}, fmt.Errorf("copy failed: %w", err)
+	}
+	defer sample.Close()
+
+	if sample.HasAlpha() {
+		if err := sample.Flatten(&vips.Color{R: 255, G: 255, B: 255}); err != nil {
+			return Palette{}, fmt.Errorf("flatten failed: %w", err)
+		}
+	}
+	if scale := float64(paletteSampleSize) / float64(max(sample.Width(), sample.Height())); scale < 1 {
+		if err := sample.Resize(scale, vips.KernelLinear); err != nil {
+			return Palette{}, fmt.Errorf("resize failed: %w", err)
+		}
+	}
+	if err := sample.ToColorSpace(vips.InterpretationSRGB); err != nil {
+		return Palette{}, fmt.Errorf("colour conversion failed: %w", err)
+	}
+	if err := sample.Cast(vips.BandFormatUchar); err != nil {
+		return Palette{}, fmt.Errorf("cast failed: %w", err)
+	}
+
+	pixels, err := sample.ToBytes()
+	if err != nil {
+		return Palette{}, err
+	}
+	debugLog("Palette: %d colours from %dx%d sample", n, sample.Width(), sample.Height())
+	return extractPalette(pixels, n), nil
+}
+
+// extractPalette finds up to n dominant colours of packed RGB pixels. The
+// colours are seeded by median cut and refined with k-means, so the weights
+// reflect how many pixels each colour stands for.
+func extractPalette(pixels []byte, n int) Palette {
+	count := len(pixels) / 3
+	if count == 0 {
+		return Palette{}
+	}
+	px := make([][3]float64, count)
+	var sum [3]float64
+	for i := range px {
+		for c := 0; c < 3; c++ {
+			px[i][c] = float64(pixels[i*3+c])
+			sum[c] += srgbToLinear(px[i][c] / 255)
+		}
+	}
+	average := linearToRGBA([3]float64{sum[0] / float64(count), sum[1] / float64(count), sum[2] / float64(count)})
+
+	centres := medianCut(px, n)
+	for iter := 0; iter < paletteIterations; iter++ {
+		sums := make([][3]float64, len(centres))
+		counts := make([]int, len(centres))
+		for _, p := range px {
+			k := nearestCentre(p, centres)
+			for c := 0; c < 3; c++ {
+				sums[k][c] += p[c]
+			}
+			counts[k]++
+		}
+		for k := range centres {
+			if counts[k] > 0 {
+				for c := 0; c < 3; c++ {
+					centres[k][c] = sums[k][c] / float64(counts[k])
+				}
+			}
+		}
+	}
+
+	// Swatch colours are the mean of their pixels in linear light
+	linSums := make([][3]float64, len(centres))
+	counts := make([]int, len(centres))
+	for _, p := range px {
+		k := nearestCentre(p, centres)
+		for c := 0; c < 3; c++ {
+			linSums[k][c] += srgbToLinear(p[c] / 255)
+		}
+		counts[k]++
+	}
+
+	palette := Palette{Average: average}
+	for k := range centres {
+		if counts[k] == 0 {
+			continue
+		}
+		mean := [3]float64{}
+		for c := 0; c < 3; c++ {
+			mean[c] = linSums[k][c] / float64(counts[k])
+		}
+		palette.Swatches = append(palette.Swatches, Swatch{
+			Color:  linearToRGBA(mean),
+			Weight: float64(counts[k]) / float64(count),
+		})
+	}
+	sort.SliceStable(palette.Swatches, func(i, j int) bool {
+		return palette.Swatches[i].Weight > palette.Swatches[j].Weight
+	})
+	return palette
+}
+
+// medianCut splits the pixels into up to n boxes, always splitting the box
+// with the largest spread times population along its widest channel, and
+// returns the mean colour of each box. It reorders px.
+func medianCut(px [][3]float64, n int) [][3]float64 {
+	boxes := [][][3]float64{px}
+	for len(boxes) < n {
+		best, bestChannel, bestScore := -1, 0, 0.0
+		for i, box := range boxes {
+			channel, spread := widestChannel(box)
+			if score := spread * float64(len(box)); len(box) > 1 && score > bestScore {
+				best, bestChannel, bestScore = i, channel, score
+			}
+		}
+		if best < 0 {
+			break // all boxes are single colours
+		}
+		box := boxes[best]
+		sort.Slice(box, func(i, j int) bool { return box[i][bestChannel] < box[j][bestChannel] })
+		mid := len(box) / 2
+		boxes[best] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+
+	centres := make([][3]float64, len(boxes))
+	for i, box := range boxes {
+		for _, p := range box {
+			for c := 0; c < 3; c++ {
+				centres[i][c] += p[c]
+			}
+		}
+		for c := 0; c < 3; c++ {
+			centres[i][c] /= float64(len(box))
+		}
+	}
+	return centres
+}
+
+// widestChannel returns the channel with the largest range in the box, and the range.
+func widestChannel(box [][3]float64) (int, float64) {
+	lo := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	hi := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range box {
+		for c := 0; c < 3; c++ {
+			lo[c] = math.Min(lo[c], p[c])
+			hi[c] = math.Max(hi[c], p[c])
+		}
+	}
+	channel := 0
+	for c := 1; c < 3; c++ {
+		if hi[c]-lo[c] > hi[channel]-lo[channel] {
+			channel = c
+		}
+	}
+	return channel, hi[channel] - lo[channel]
+}
+
+// nearestCentre returns the index of the centre closest to p.
+func nearestCentre(p [3]float64, centres [][3]float64) int {
+	best, bestDist := 0, math.Inf(1)
+	for k, c := range centres {
+		dr, dg, db := p[0]-c[0], p[1]-c[1], p[2]-c[2]
+		if dist := dr*dr + dg*dg + db*db; dist < bestDist {
+			best, bestDist = k, dist
+		}
+	}
+	return best
+}
+
+// srgbToLinear converts a gamma-encoded sRGB value (0-1) to linear light.
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB converts a linear-light value (0-1) to gamma-encoded sRGB.
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// linearToRGBA converts linear-light RGB (0-1) to an 8-bit sRGB colour.
+func linearToRGBA(lin [3]float64) color.RGBA {
+	var out [3]uint8
+	for c := 0; c < 3; c++ {
+		out[c] = uint8(math.Round(math.Max(0, math.Min(1, linearToSRGB(lin[c]))) * 255))
+	}
+	return color.RGBA{R: out[0], G: out[1], B: out[2], A: 255}
+}
+
+// rgbToHSL converts a colour to hue, saturation and lightness, all 0-1.
+func rgbToHSL(c color.RGBA) (h, s, l float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	hi, lo := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+	l = (hi + lo) / 2
+	if hi == lo {
+		return 0, 0, l
+	}
+	d := hi - lo
+	if l > 0.5 {
+		s = d / (2 - hi - lo)
+	} else {
+		s = d / (hi + lo)
+	}
+	switch hi {
+	case r:
+		h = (g - b) / d
+		if g < b {
+			h += 6
+		}
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return h / 6, s, l
+}
+
+// hslToRGB converts hue, saturation and lightness (0-1) to a colour.
+func hslToRGB(h, s, l float64) color.RGBA {
+	if s == 0 {
+		v := uint8(math.Round(l * 255))
+		return color.RGBA{R: v, G: v, B: v, A: 255}
+	}
+	var q float64
+	if l < 0.5 {
+		q = l * (1 + s)
+	} else {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+	channel := func(t float64) uint8 {
+		t = t - math.Floor(t)
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 0.5:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+		return uint8(math.Round(v * 255))
+	}
+	return color.RGBA{R: channel(h + 1.0/3), G: channel(h), B: channel(h - 1.0/3), A: 255}
+}
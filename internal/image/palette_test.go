@@ -0,0 +1,169 @@
+package image
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+// testPixels returns packed RGB pixels with count pixels of each colour.
+func testPixels(colors []color.RGBA, counts []int) []byte {
+	var pixels []byte
+	for i, c := range colors {
+		for j := 0; j < counts[i]; j++ {
+			pixels = append(pixels, c.R, c.G, c.B)
+		}
+	}
+	return pixels
+}
+
+func TestExtractPalette(t *testing.T) {
+	red := color.RGBA{200, 30, 30, 255}
+	blue := color.RGBA{20, 40, 180, 255}
+	pixels := testPixels([]color.RGBA{red, blue}, []int{300, 100})
+
+	p := extractPalette(pixels, 4)
+	if len(p.Swatches) != 2 {
+		t.Fatalf("extractPalette found %d swatches, expected 2: %+v", len(p.Swatches), p.Swatches)
+	}
+	if p.Swatches[0].Color != red || p.Swatches[1].Color != blue {
+		t.Errorf("swatches = %+v, expected red then blue", p.Swatches)
+	}
+	if math.Abs(p.Swatches[0].Weight-0.75) > 1e-9 || math.Abs(p.Swatches[1].Weight-0.25) > 1e-9 {
+		t.Errorf("weights = %v, %v, expected 0.75, 0.25", p.Swatches[0].Weight, p.Swatches[1].Weight)
+	}
+	if p.Dominant() != red {
+		t.Errorf("Dominant() = %v, expected %v", p.Dominant(), red)
+	}
+
+	// The average is taken in linear light, so it is brighter than the sRGB mean
+	black := color.RGBA{0, 0, 0, 255}
+	white := color.RGBA{255, 255, 255, 255}
+	p = extractPalette(testPixels([]color.RGBA{black, white}, []int{1, 1}), 1)
+	if p.Average.R != 188 || p.Average.G != 188 || p.Average.B != 188 {
+		t.Errorf("Average = %v, expected #bcbcbc", p.Average)
+	}
+	if len(p.Swatches) != 1 || p.Swatches[0].Weight != 1 {
+		t.Errorf("single swatch = %+v", p.Swatches)
+	}
+
+	if p := extractPalette(nil, 3); len(p.Swatches) != 0 {
+		t.Errorf("extractPalette(nil) = %+v, expected no swatches", p)
+	}
+}
+
+func TestParseAutoColor(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected AutoColor
+		ok       bool
+	}{
+		{"auto", AutoDominant, true},
+		{"Auto-Dark", AutoDark, true},
+		{"auto-light", AutoLight, true},
+		{"auto-complement", AutoComplement, true},
+		{"white", AutoNone, false},
+		{"#fff", AutoNone, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			got, ok := ParseAutoColor(tc.input)
+			if got != tc.expected || ok != tc.ok {
+				t.Errorf("ParseAutoColor(%q) = %v, %v, expected %v, %v", tc.input, got, ok, tc.expected, tc.ok)
+			}
+		})
+	}
+}
+
+func TestPaletteColor(t *testing.T) {
+	orange := color.RGBA{220, 120, 20, 255}
+	p := Palette{Swatches: []Swatch{{Color: orange, Weight: 1}}}
+	hue, _, _ := rgbToHSL(orange)
+
+	if got := p.Color(AutoDominant); got != orange {
+		t.Errorf("auto = %v, expected %v", got, orange)
+	}
+
+	tests := []struct {
+		mode     AutoColor
+		hue      float64
+		minLight float64
+		maxLight float64
+	}{
+		{AutoDark, hue, 0, 0.2},
+		{AutoLight, hue, 0.85, 1},
+		{AutoComplement, math.Mod(hue+0.5, 1), 0.3, 0.7},
+	}
+	for _, tc := range tests {
+		t.Run(tc.mode.String(), func(t *testing.T) {
+			h, s, l := rgbToHSL(p.Color(tc.mode))
+			if math.Abs(h-tc.hue) > 0.02 {
+				t.Errorf("hue = %.3f, expected %.3f", h, tc.hue)
+			}
+			if s > 0.61 {
+				t.Errorf("saturation = %.3f, expected a muted colour", s)
+			}
+			if l < tc.minLight || l > tc.maxLight {
+				t.Errorf("lightness = %.3f, expected %.2f-%.2f", l, tc.minLight, tc.maxLight)
+			}
+		})
+	}
+
+	// Without swatches the average is used
+	grey := color.RGBA{90, 90, 90, 255}
+	if got := (Palette{Average: grey}).Color(AutoDominant); got != grey {
+		t.Errorf("empty palette auto = %v, expected %v", got, grey)
+	}
+}
+
+func TestHSLRoundTrip(t *testing.T) {
+	for _, c := range []color.RGBA{
+		{0, 0, 0, 255}, {255, 255, 255, 255}, {255, 0, 0, 255}, {0, 128, 0, 255},
+		{12, 34, 200, 255}, {220, 120, 20, 255}, {128, 128, 128, 255},
+	} {
+		h, s, l := rgbToHSL(c)
+		if got := hslToRGB(h, s, l); got != c {
+			t.Errorf("hslToRGB(rgbToHSL(%v)) = %v", c, got)
+		}
+	}
+}
+
+func TestHexColor(t *testing.T) {
+	if got := HexColor(color.RGBA{0x1a, 0x2b, 0xff, 255}); got != "#1a2bff" {
+		t.Errorf("HexColor = %q, expected #1a2bff", got)
+	}
+	if got := (Swatch{Color: color.RGBA{255, 255, 255, 255}}).Hex(); got != "#ffffff" {
+		t.Errorf("Swatch.Hex = %q, expected #ffffff", got)
+	}
+}
+
+func TestVipsPalette(t *testing.T) {
+	img, err := LoadVips(testImageVips)
+	if err != nil {
+		t.Fatalf("LoadVips failed: %v", err)
+	}
+	defer img.Close()
+
+	p, err := img.Palette(5)
+	if err != nil {
+		t.Fatalf("Palette failed: %v", err)
+	}
+	if len(p.Swatches) == 0 || len(p.Swatches) > 5 {
+		t.Fatalf("Palette(5) returned %d swatches", len(p.Swatches))
+	}
+	total := 0.0
+	for i, s := range p.Swatches {
+		total += s.Weight
+		if i > 0 && s.Weight > p.Swatches[i-1].Weight {
+			t.Errorf("swatches not sorted by weight: %+v", p.Swatches)
+		}
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("weights sum to %v, expected 1", total)
+	}
+
+	if _, err := img.Palette(0); err == nil {
+		t.Error("Palette(0) expected error")
+	}
+}
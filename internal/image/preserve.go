@@ -0,0 +1,337 @@
+package image
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MetadataPolicy selects which source metadata is copied to the output.
+type MetadataPolicy int
+
+const (
+	// MetadataNone strips all metadata except the ICC profile.
+	MetadataNone MetadataPolicy = iota
+	// MetadataCopyright keeps creator, copyright, credit and usage terms only.
+	MetadataCopyright
+	// MetadataIPTC keeps all descriptive IPTC and XMP metadata (titles,
+	// captions, keywords, location, copyright), but no camera EXIF data.
+	MetadataIPTC
+	// MetadataAll keeps all EXIF, IPTC and XMP metadata.
+	MetadataAll
+)
+
+// ParseMetadataPolicy converts a string to a MetadataPolicy type.
+func ParseMetadataPolicy(s string) (MetadataPolicy, error) {
+	switch strings.ToLower(s) {
+	case "none", "":
+		return MetadataNone, nil
+	case "copyright":
+		return MetadataCopyright, nil
+	case "iptc":
+		return MetadataIPTC, nil
+	case "all":
+		return MetadataAll, nil
+	default:
+		return MetadataNone, fmt.Errorf("unknown metadata policy: %s", s)
+	}
+}
+
+// String returns the policy name.
+func (p MetadataPolicy) String() string {
+	switch p {
+	case MetadataNone:
+		return "none"
+	case MetadataCopyright:
+		return "copyright"
+	case MetadataIPTC:
+		return "iptc"
+	case MetadataAll:
+		return "all"
+	default:
+		return "unknown"
+	}
+}
+
+// MetadataOptions controls which metadata is preserved in the output.
+type MetadataOptions struct {
+	Policy MetadataPolicy
+	// StripGPS removes location coordinates even when the policy keeps EXIF/XMP.
+	StripGPS bool
+}
+
+// metadataBlocks holds XMP and IPTC data that ansel writes into the encoded
+// file itself (see injectMetadata), as govips can't hand modified blobs to
+// libvips. EXIF is left to libvips, which rewrites it from the image fields.
+type metadataBlocks struct {
+	xmp []byte
+	iim []byte
+}
+
+// EXIF tags by libexif name, grouped by policy.
+var (
+	exifCopyrightTags = map[string]bool{
+		"Artist":    true,
+		"Copyright": true,
+	}
+	exifDescriptiveTags = map[string]bool{
+		"ImageDescription": true,
+		"XPTitle":          true,
+		"XPComment":        true,
+		"XPAuthor":         true,
+		"XPKeywords":       true,
+		"XPSubject":        true,
+	}
+	// Layout tags are rewritten by libvips to match the output image
+	exifLayoutTags = map[string]bool{
+		"Orientation":     true,
+		"ImageWidth":      true,
+		"ImageLength":     true,
+		"PixelXDimension": true,
+		"PixelYDimension": true,
+	}
+)
+
+// IPTC datasets kept by MetadataCopyright.
+var iptcCopyrightDatasets = map[byte]bool{
+	iptcByline:          true,
+	iptcBylineTitle:     true,
+	iptcCredit:          true,
+	iptcSource:          true,
+	iptcCopyrightNotice: true,
+	iptcContact:         true,
+}
+
+// XMP namespaces holding camera data, removed by MetadataIPTC.
+var xmpCameraNamespaces = []string{
+	nsEXIF,
+	nsTIFF,
+	"http://ns.adobe.com/exif/1.0/aux/",
+	"http://cipa.jp/exif/1.0/",
+	"http://ns.adobe.com/camera-raw-settings/1.0/",
+}
+
+// ApplyMetadataPolicy prunes the metadata carried over from the source image
+// so that encoding in format writes only what opts selects. Call it after all
+// other processing: orientation and dimension tags are set to match the
+// current image.
+//
+// EXIF is kept for every format. The filtered XMP and IPTC blocks are written
+// by Encode; formats without an IPTC container get its fields in XMP only.
+func (v *VipsImage) ApplyMetadataPolicy(opts MetadataOptions, format Format) error {
+	v.metadata = nil
+	if opts.Policy == MetadataNone {
+		return v.ref.RemoveMetadata()
+	}
+
+	var (
+		keep     []string
+		exif     = make(map[string]string)
+		datasets []iptcDataset
+		xmp      []byte
+	)
+	for _, field := range v.ref.GetFields() {
+		switch field {
+		case "iptc-data":
+			var err error
+			datasets, err = parseIIM(extractIIM(v.ref.GetBlob(field)))
+			if err != nil {
+				debugLog("ApplyMetadataPolicy: %v", err)
+			}
+		case "xmp-data":
+			xmp = v.ref.GetBlob(field)
+		}
+		if strings.HasPrefix(field, "exif-ifd0-") {
+			exif[strings.TrimPrefix(field, "exif-ifd0-")] = exifFieldValue(v.ref.GetAsString(field))
+		}
+		if keepMetadataField(field, opts) {
+			keep = append(keep, field)
+		}
+	}
+
+	blocks := selectMetadataBlocks(opts, datasets, xmp, exif, v.Width(), v.Height())
+	v.metadata = blocks
+
+	debugLog("ApplyMetadataPolicy: policy=%s stripGPS=%v keeping %d fields", opts.Policy, opts.StripGPS, len(keep))
+	if err := v.ref.RemoveMetadata(keep...); err != nil {
+		return fmt.Errorf("remove metadata failed: %w", err)
+	}
+
+	// Pixels are upright after LoadVips, so the output must not be rotated again
+	return v.ref.SetOrientation(1)
+}
+
+// keepMetadataField reports whether a libvips metadata field survives opts.
+// The XMP and IPTC blobs are handled separately.
+func keepMetadataField(field string, opts MetadataOptions) bool {
+	switch field {
+	case "exif-data", "resolution-unit":
+		return true
+	case "xmp-data", "iptc-data", "jpeg-thumbnail-data":
+		return false
+	}
+
+	var ifd int
+	var tag string
+	if n, _ := fmt.Sscanf(field, "exif-ifd%d-%s", &ifd, &tag); n == 2 {
+		switch {
+		case ifd == 1: // thumbnail of the unprocessed image
+			return false
+		case ifd == 3: // GPS
+			return opts.Policy == MetadataAll && !opts.StripGPS
+		case exifLayoutTags[tag]:
+			return false
+		case exifCopyrightTags[tag]:
+			return true
+		case exifDescriptiveTags[tag]:
+			return opts.Policy >= MetadataIPTC
+		default:
+			return opts.Policy == MetadataAll
+		}
+	}
+
+	// Comments and other format-specific fields
+	return opts.Policy == MetadataAll
+}
+
+// selectMetadataBlocks builds the XMP and IPTC blocks to write for opts.
+func selectMetadataBlocks(opts MetadataOptions, datasets []iptcDataset, xmp []byte, exif map[string]string, width, height int) *metadataBlocks {
+	blocks := &metadataBlocks{}
+
+	if opts.Policy == MetadataCopyright {
+		if kept := filterIPTC(datasets, func(ds byte) bool { return iptcCopyrightDatasets[ds] }); kept != nil {
+			blocks.iim = encodeIIM(kept)
+		}
+		var props map[string][]string
+		if len(xmp) > 0 {
+			props, _ = parseXMP(xmp)
+		}
+		if copyright := copyrightXMP(props, datasets, exif); len(copyright) > 0 {
+			blocks.xmp = buildXMP(copyright)
+		}
+		return blocks
+	}
+
+	if kept := filterIPTC(datasets, func(byte) bool { return true }); kept != nil {
+		blocks.iim = encodeIIM(kept)
+	}
+
+	switch {
+	case len(xmp) > 0:
+		if opts.Policy == MetadataIPTC {
+			for _, ns := range xmpCameraNamespaces {
+				xmp = removeXMPProperties(xmp, ns, "")
+			}
+		}
+		if opts.StripGPS {
+			xmp = removeXMPProperties(xmp, nsEXIF, "GPS")
+		}
+		xmp = setXMPProperty(xmp, nsTIFF, "Orientation", "1")
+		xmp = setXMPProperty(xmp, nsTIFF, "ImageWidth", strconv.Itoa(width))
+		xmp = setXMPProperty(xmp, nsTIFF, "ImageLength", strconv.Itoa(height))
+		xmp = setXMPProperty(xmp, nsEXIF, "PixelXDimension", strconv.Itoa(width))
+		xmp = setXMPProperty(xmp, nsEXIF, "PixelYDimension", strconv.Itoa(height))
+		blocks.xmp = xmp
+	case len(datasets) > 0:
+		// Formats without IPTC support still get the descriptive fields via XMP
+		if props := iptcToXMP(datasets); len(props) > 0 {
+			blocks.xmp = buildXMP(props)
+		}
+	}
+
+	return blocks
+}
+
+// copyrightXMP collects creator and rights properties, preferring XMP over
+// IPTC over EXIF values.
+func copyrightXMP(xmp map[string][]string, datasets []iptcDataset, exif map[string]string) []xmpProperty {
+	var props []xmpProperty
+	add := func(ns, name string, kind xmpKind, values ...[]string) {
+		for _, v := range values {
+			if len(v) > 0 {
+				props = append(props, xmpProperty{ns: ns, name: name, kind: kind, values: v})
+				return
+			}
+		}
+	}
+	single := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return []string{s}
+	}
+
+	add(nsDC, "creator", xmpSeq, xmp["dc:creator"], iptcValues(datasets, iptcByline), single(exif["Artist"]))
+	add(nsDC, "rights", xmpAlt, xmp["dc:rights"], iptcValues(datasets, iptcCopyrightNotice), single(exif["Copyright"]))
+	add(nsPhotoshop, "AuthorsPosition", xmpSimple, xmp["photoshop:AuthorsPosition"], iptcValues(datasets, iptcBylineTitle))
+	add(nsPhotoshop, "Credit", xmpSimple, xmp["photoshop:Credit"], iptcValues(datasets, iptcCredit))
+	add(nsPhotoshop, "Source", xmpSimple, xmp["photoshop:Source"], iptcValues(datasets, iptcSource))
+	add(nsXMPRights, "Marked", xmpSimple, xmp["xmpRights:Marked"])
+	add(nsXMPRights, "UsageTerms", xmpAlt, xmp["xmpRights:UsageTerms"])
+	add(nsXMPRights, "WebStatement", xmpSimple, xmp["xmpRights:WebStatement"])
+	return props
+}
+
+// iptcToXMP maps descriptive IPTC datasets to their XMP equivalents.
+func iptcToXMP(datasets []iptcDataset) []xmpProperty {
+	mappings := []struct {
+		dataset byte
+		ns      string
+		name    string
+		kind    xmpKind
+	}{
+		{iptcObjectName, nsDC, "title", xmpAlt},
+		{iptcCaption, nsDC, "description", xmpAlt},
+		{iptcKeywords, nsDC, "subject", xmpBag},
+		{iptcByline, nsDC, "creator", xmpSeq},
+		{iptcCopyrightNotice, nsDC, "rights", xmpAlt},
+		{iptcHeadline, nsPhotoshop, "Headline", xmpSimple},
+		{iptcBylineTitle, nsPhotoshop, "AuthorsPosition", xmpSimple},
+		{iptcCredit, nsPhotoshop, "Credit", xmpSimple},
+		{iptcSource, nsPhotoshop, "Source", xmpSimple},
+		{iptcWriterEditor, nsPhotoshop, "CaptionWriter", xmpSimple},
+		{iptcCity, nsPhotoshop, "City", xmpSimple},
+		{iptcProvinceState, nsPhotoshop, "State", xmpSimple},
+		{iptcCountryName, nsPhotoshop, "Country", xmpSimple},
+		{iptcSublocation, nsIptcCore, "Location", xmpSimple},
+		{iptcCountryCode, nsIptcCore, "CountryCode", xmpSimple},
+	}
+
+	var props []xmpProperty
+	for _, m := range mappings {
+		values := iptcValues(datasets, m.dataset)
+		if len(values) == 0 {
+			continue
+		}
+		if m.kind == xmpSimple || m.kind == xmpAlt {
+			values = values[:1]
+		}
+		props = append(props, xmpProperty{ns: m.ns, name: m.name, kind: m.kind, values: values})
+	}
+
+	// IPTC dates are CCYYMMDD, XMP uses ISO 8601
+	if d := iptcValue(datasets, iptcDateCreated); len(d) == 8 {
+		props = append(props, xmpProperty{ns: nsPhotoshop, name: "DateCreated", kind: xmpSimple,
+			values: []string{d[0:4] + "-" + d[4:6] + "-" + d[6:8]}})
+	}
+	return props
+}
+
+// xmpHasGPS reports whether an XMP packet contains GPS coordinates.
+func xmpHasGPS(xmp []byte) bool {
+	prefix, ok := xmpNamespacePrefix(xmp, nsEXIF)
+	return ok && strings.Contains(string(xmp), prefix+":GPS")
+}
+
+// exifValueRegex matches libvips' string form of EXIF fields:
+// "value (description, format, N components, N bytes)".
+var exifValueRegex = regexp.MustCompile(`^(.*) \([^()]*, [^()]*, \d+ components?, \d+ bytes?\)$`)
+
+// exifFieldValue returns the value part of a libvips EXIF field string.
+func exifFieldValue(s string) string {
+	if m := exifValueRegex.FindStringSubmatch(s); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+	return strings.TrimSpace(s)
+}
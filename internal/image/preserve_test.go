@@ -0,0 +1,394 @@
+package image
+
+import (
+	"bytes"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+    xmlns:tiff="http://ns.adobe.com/tiff/1.0/"
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    photoshop:Headline="Harbour at dusk"
+    tiff:Orientation="6"
+    exif:GPSLatitude="53,33.1N"
+    exif:GPSLongitude="9,59.4E">
+   <dc:creator>
+    <rdf:Seq>
+     <rdf:li>Jane Doe</rdf:li>
+    </rdf:Seq>
+   </dc:creator>
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>harbour</rdf:li>
+     <rdf:li>dusk</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+   <exif:FNumber>28/10</exif:FNumber>
+   <tiff:ImageWidth>6000</tiff:ImageWidth>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+func testIPTCDatasets() []iptcDataset {
+	return []iptcDataset{
+		{record: 1, dataset: iptcCodedCharacterSet, data: iptcUTF8},
+		{record: 2, dataset: iptcRecordVersion, data: []byte{0, 4}},
+		{record: 2, dataset: iptcHeadline, data: []byte("Harbour at dusk")},
+		{record: 2, dataset: iptcKeywords, data: []byte("harbour")},
+		{record: 2, dataset: iptcKeywords, data: []byte("dusk")},
+		{record: 2, dataset: iptcByline, data: []byte("Jane Doe")},
+		{record: 2, dataset: iptcCopyrightNotice, data: []byte("© 2024 Jane Doe")},
+		{record: 2, dataset: iptcCity, data: []byte("Hamburg")},
+	}
+}
+
+func TestParseMetadataPolicy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected MetadataPolicy
+	}{
+		{"none", MetadataNone},
+		{"copyright", MetadataCopyright},
+		{"IPTC", MetadataIPTC},
+		{"all", MetadataAll},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			p, err := ParseMetadataPolicy(tc.input)
+			if err != nil {
+				t.Fatalf("ParseMetadataPolicy(%q) failed: %v", tc.input, err)
+			}
+			if p != tc.expected {
+				t.Errorf("ParseMetadataPolicy(%q) = %v, expected %v", tc.input, p, tc.expected)
+			}
+		})
+	}
+
+	if _, err := ParseMetadataPolicy("exif"); err == nil {
+		t.Error("ParseMetadataPolicy(\"exif\") expected error, got nil")
+	}
+}
+
+func TestIIMRoundTrip(t *testing.T) {
+	datasets := testIPTCDatasets()
+	datasets = append(datasets, iptcDataset{record: 2, dataset: iptcCaption, data: bytes.Repeat([]byte("x"), 40000)})
+
+	parsed, err := parseIIM(encodeIIM(datasets))
+	if err != nil {
+		t.Fatalf("parseIIM failed: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, datasets) {
+		t.Errorf("round trip mismatch: got %d datasets, expected %d", len(parsed), len(datasets))
+	}
+
+	// The Photoshop resource wrapping used in JPEG APP13 must unwrap to the same data
+	iim := encodeIIM(datasets)
+	if got := extractIIM(wrapPhotoshopIPTC(iim)); !bytes.Equal(got, iim) {
+		t.Error("extractIIM(wrapPhotoshopIPTC(iim)) did not return the original data")
+	}
+}
+
+func TestIPTCString(t *testing.T) {
+	// Legacy files without a 1:90 declaration are usually Latin-1
+	datasets := []iptcDataset{{record: 2, dataset: iptcCity, data: []byte("K\xf6ln")}}
+	if got := iptcValue(datasets, iptcCity); got != "Köln" {
+		t.Errorf("iptcValue = %q, expected %q", got, "Köln")
+	}
+}
+
+func TestFilterIPTC(t *testing.T) {
+	kept := filterIPTC(testIPTCDatasets(), func(ds byte) bool { return iptcCopyrightDatasets[ds] })
+	if got := iptcValue(kept, iptcByline); got != "Jane Doe" {
+		t.Errorf("byline = %q, expected %q", got, "Jane Doe")
+	}
+	if got := iptcValue(kept, iptcHeadline); got != "" {
+		t.Errorf("headline = %q, expected it to be removed", got)
+	}
+	if !iptcIsUTF8(kept) {
+		t.Error("character set declaration was removed")
+	}
+
+	// Only envelope datasets left means nothing to write
+	if kept := filterIPTC(testIPTCDatasets(), func(byte) bool { return false }); kept != nil {
+		t.Errorf("expected nil, got %d datasets", len(kept))
+	}
+}
+
+func TestParseXMP(t *testing.T) {
+	props, err := parseXMP([]byte(testXMP))
+	if err != nil {
+		t.Fatalf("parseXMP failed: %v", err)
+	}
+
+	tests := map[string][]string{
+		"photoshop:Headline": {"Harbour at dusk"},
+		"dc:creator":         {"Jane Doe"},
+		"dc:subject":         {"harbour", "dusk"},
+		"exif:FNumber":       {"28/10"},
+		"tiff:Orientation":   {"6"},
+	}
+	for key, expected := range tests {
+		if got := props[key]; !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s = %v, expected %v", key, got, expected)
+		}
+	}
+}
+
+func TestBuildXMPRoundTrip(t *testing.T) {
+	packet := buildXMP([]xmpProperty{
+		{ns: nsDC, name: "creator", kind: xmpSeq, values: []string{"Jane Doe"}},
+		{ns: nsDC, name: "rights", kind: xmpAlt, values: []string{"© Jane <Doe> & Co"}},
+		{ns: nsPhotoshop, name: "Credit", kind: xmpSimple, values: []string{"Ansel"}},
+	})
+
+	props, err := parseXMP(packet)
+	if err != nil {
+		t.Fatalf("parseXMP failed: %v", err)
+	}
+	if got := props["dc:rights"]; len(got) != 1 || got[0] != "© Jane <Doe> & Co" {
+		t.Errorf("dc:rights = %v", got)
+	}
+	if got := props["photoshop:Credit"]; len(got) != 1 || got[0] != "Ansel" {
+		t.Errorf("photoshop:Credit = %v", got)
+	}
+}
+
+func TestXMPEdits(t *testing.T) {
+	xmp := setXMPProperty([]byte(testXMP), nsTIFF, "Orientation", "1")
+	xmp = setXMPProperty(xmp, nsTIFF, "ImageWidth", "1080")
+	xmp = removeXMPProperties(xmp, nsEXIF, "GPS")
+
+	props, err := parseXMP(xmp)
+	if err != nil {
+		t.Fatalf("parseXMP failed: %v", err)
+	}
+	if got := props["tiff:Orientation"]; !reflect.DeepEqual(got, []string{"1"}) {
+		t.Errorf("tiff:Orientation = %v, expected [1]", got)
+	}
+	if got := props["tiff:ImageWidth"]; !reflect.DeepEqual(got, []string{"1080"}) {
+		t.Errorf("tiff:ImageWidth = %v, expected [1080]", got)
+	}
+	if xmpHasGPS(xmp) {
+		t.Error("GPS properties were not removed")
+	}
+	if got := props["exif:FNumber"]; got == nil {
+		t.Error("exif:FNumber was removed along with GPS")
+	}
+
+	// Removing a whole namespace also removes element-form array properties
+	xmp = removeXMPProperties([]byte(testXMP), nsDC, "")
+	props, err = parseXMP(xmp)
+	if err != nil {
+		t.Fatalf("parseXMP failed: %v", err)
+	}
+	if props["dc:creator"] != nil || props["dc:subject"] != nil {
+		t.Errorf("dc properties not removed: %v", props)
+	}
+}
+
+func TestKeepMetadataField(t *testing.T) {
+	tests := []struct {
+		field    string
+		policy   MetadataPolicy
+		stripGPS bool
+		expected bool
+	}{
+		{"exif-data", MetadataCopyright, false, true},
+		{"exif-ifd0-Copyright", MetadataCopyright, false, true},
+		{"exif-ifd0-Make", MetadataCopyright, false, false},
+		{"exif-ifd0-ImageDescription", MetadataCopyright, false, false},
+		{"exif-ifd0-ImageDescription", MetadataIPTC, false, true},
+		{"exif-ifd2-FNumber", MetadataIPTC, false, false},
+		{"exif-ifd2-FNumber", MetadataAll, false, true},
+		{"exif-ifd0-Orientation", MetadataAll, false, false},
+		{"exif-ifd1-Compression", MetadataAll, false, false},
+		{"exif-ifd3-GPSLatitude", MetadataAll, false, true},
+		{"exif-ifd3-GPSLatitude", MetadataAll, true, false},
+		{"exif-ifd3-GPSLatitude", MetadataIPTC, false, false},
+		{"xmp-data", MetadataAll, false, false},
+		{"jpeg-thumbnail-data", MetadataAll, false, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.field+"/"+tc.policy.String(), func(t *testing.T) {
+			got := keepMetadataField(tc.field, MetadataOptions{Policy: tc.policy, StripGPS: tc.stripGPS})
+			if got != tc.expected {
+				t.Errorf("keepMetadataField(%q) = %v, expected %v", tc.field, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSelectMetadataBlocks(t *testing.T) {
+	exif := map[string]string{"Artist": "EXIF Artist", "Copyright": "EXIF Copyright"}
+
+	t.Run("copyright", func(t *testing.T) {
+		blocks := selectMetadataBlocks(MetadataOptions{Policy: MetadataCopyright}, testIPTCDatasets(), []byte(testXMP), exif, 1080, 720)
+
+		datasets, err := parseIIM(blocks.iim)
+		if err != nil {
+			t.Fatalf("parseIIM failed: %v", err)
+		}
+		if iptcValue(datasets, iptcHeadline) != "" || iptcValue(datasets, iptcCity) != "" {
+			t.Error("descriptive IPTC datasets were kept")
+		}
+
+		props, err := parseXMP(blocks.xmp)
+		if err != nil {
+			t.Fatalf("parseXMP failed: %v", err)
+		}
+		// XMP wins over EXIF; IPTC fills in what XMP doesn't have
+		if got := props["dc:creator"]; !reflect.DeepEqual(got, []string{"Jane Doe"}) {
+			t.Errorf("dc:creator = %v", got)
+		}
+		if got := props["dc:rights"]; !reflect.DeepEqual(got, []string{"© 2024 Jane Doe"}) {
+			t.Errorf("dc:rights = %v", got)
+		}
+		if props["photoshop:Headline"] != nil || props["exif:FNumber"] != nil {
+			t.Error("non-copyright XMP properties were kept")
+		}
+	})
+
+	t.Run("iptc", func(t *testing.T) {
+		blocks := selectMetadataBlocks(MetadataOptions{Policy: MetadataIPTC}, testIPTCDatasets(), []byte(testXMP), exif, 1080, 720)
+		props, err := parseXMP(blocks.xmp)
+		if err != nil {
+			t.Fatalf("parseXMP failed: %v", err)
+		}
+		if props["photoshop:Headline"] == nil || props["dc:subject"] == nil {
+			t.Error("descriptive XMP properties were removed")
+		}
+		if props["exif:FNumber"] != nil || props["tiff:Orientation"] != nil || xmpHasGPS(blocks.xmp) {
+			t.Error("camera XMP properties were kept")
+		}
+	})
+
+	t.Run("all with strip-gps", func(t *testing.T) {
+		blocks := selectMetadataBlocks(MetadataOptions{Policy: MetadataAll, StripGPS: true}, nil, []byte(testXMP), exif, 1080, 720)
+		props, err := parseXMP(blocks.xmp)
+		if err != nil {
+			t.Fatalf("parseXMP failed: %v", err)
+		}
+		if xmpHasGPS(blocks.xmp) {
+			t.Error("GPS was kept")
+		}
+		if got := props["tiff:Orientation"]; !reflect.DeepEqual(got, []string{"1"}) {
+			t.Errorf("tiff:Orientation = %v, expected [1]", got)
+		}
+		if got := props["tiff:ImageWidth"]; !reflect.DeepEqual(got, []string{"1080"}) {
+			t.Errorf("tiff:ImageWidth = %v, expected [1080]", got)
+		}
+		if blocks.iim != nil {
+			t.Error("expected no IPTC block without source IPTC")
+		}
+	})
+
+	t.Run("iptc without xmp", func(t *testing.T) {
+		blocks := selectMetadataBlocks(MetadataOptions{Policy: MetadataIPTC}, testIPTCDatasets(), nil, nil, 1080, 720)
+		props, err := parseXMP(blocks.xmp)
+		if err != nil {
+			t.Fatalf("parseXMP failed: %v", err)
+		}
+		if got := props["photoshop:City"]; !reflect.DeepEqual(got, []string{"Hamburg"}) {
+			t.Errorf("photoshop:City = %v", got)
+		}
+		if got := props["dc:subject"]; !reflect.DeepEqual(got, []string{"harbour", "dusk"}) {
+			t.Errorf("dc:subject = %v", got)
+		}
+	})
+}
+
+func TestExifFieldValue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Jane Doe (Jane Doe, ASCII, 9 components, 9 bytes)", "Jane Doe"},
+		{"(c) 2024 (Doe) (© 2024, ASCII, 10 components, 10 bytes)", "(c) 2024 (Doe)"},
+		{"plain", "plain"},
+	}
+
+	for _, tc := range tests {
+		if got := exifFieldValue(tc.input); got != tc.expected {
+			t.Errorf("exifFieldValue(%q) = %q, expected %q", tc.input, got, tc.expected)
+		}
+	}
+}
+
+func TestXMPPacketHeader(t *testing.T) {
+	packet := buildXMP([]xmpProperty{{ns: nsPhotoshop, name: "Credit", kind: xmpSimple, values: []string{"x"}}})
+	if !strings.HasPrefix(string(packet), "<?xpacket begin=\"\ufeff\"") {
+		t.Errorf("unexpected packet header: %q", packet[:40])
+	}
+}
+
+func TestVipsApplyMetadataPolicy(t *testing.T) {
+	// Build a JPEG fixture carrying the test IPTC and XMP (with GPS)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	src, err := injectMetadata(buf.Bytes(), JPEG, &metadataBlocks{xmp: []byte(testXMP), iim: encodeIIM(testIPTCDatasets())}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcPath := filepath.Join(t.TempDir(), "meta.jpg")
+	if err := os.WriteFile(srcPath, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy        MetadataPolicy
+		expectCity    bool
+		expectFNumber bool
+	}{
+		{MetadataNone, false, false},
+		{MetadataCopyright, false, false},
+		{MetadataIPTC, true, false},
+		{MetadataAll, true, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			img, err := LoadVips(srcPath)
+			if err != nil {
+				t.Fatalf("LoadVips failed: %v", err)
+			}
+			defer img.Close()
+
+			opts := MetadataOptions{Policy: tc.policy, StripGPS: true}
+			if err := img.ApplyMetadataPolicy(opts, JPEG); err != nil {
+				t.Fatalf("ApplyMetadataPolicy failed: %v", err)
+			}
+			encode := DefaultEncodeOptions(90)
+			encode.StripMetadata = tc.policy == MetadataNone
+			data, err := img.Encode(JPEG, encode)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+
+			if got := bytes.Contains(data, []byte("Hamburg")); got != tc.expectCity {
+				t.Errorf("IPTC city present = %v, expected %v", got, tc.expectCity)
+			}
+			if got := bytes.Contains(data, []byte("exif:FNumber")); got != tc.expectFNumber {
+				t.Errorf("XMP FNumber present = %v, expected %v", got, tc.expectFNumber)
+			}
+			if got := bytes.Contains(data, []byte("Jane Doe")); got != (tc.policy != MetadataNone) {
+				t.Errorf("creator present = %v", got)
+			}
+			if bytes.Contains(data, []byte("GPSLatitude")) {
+				t.Error("GPS data written despite StripGPS")
+			}
+		})
+	}
+}
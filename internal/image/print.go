@@ -0,0 +1,47 @@
+package image
+
+import (
+	"fmt"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// mmPerInch converts between the pixels per millimetre libvips stores and
+// pixels per inch.
+const mmPerInch = 25.4
+
+// SetResolution sets the print resolution in pixels per inch. JPEG output
+// records it in the JFIF header and EXIF, TIFF and PNG output in their
+// resolution tags.
+func (v *VipsImage) SetResolution(dpi float64) error {
+	ref, err := v.ref.CopyChangingResolution(dpi/mmPerInch, dpi/mmPerInch)
+	if err != nil {
+		return fmt.Errorf("set resolution failed: %w", err)
+	}
+	v.ref.Close()
+	v.ref = ref
+	// TIFF resolution tags are written in centimetres unless told otherwise
+	v.ref.SetString("resolution-unit", "in")
+	return nil
+}
+
+// Resolution returns the horizontal resolution in pixels per inch.
+func (v *VipsImage) Resolution() float64 {
+	return v.ref.ResX() * mmPerInch
+}
+
+// AddBleed extends the image by bleed pixels on every side for printing past
+// the trim line. The bleed mirrors the edges of the image, so a frame or a
+// photo that runs to the edge continues beyond it.
+func (v *VipsImage) AddBleed(bleed int) error {
+	if bleed <= 0 {
+		return nil
+	}
+	debugLog("AddBleed: %dpx", bleed)
+
+	w, h := v.Width(), v.Height()
+	if err := v.ref.Embed(bleed, bleed, w+2*bleed, h+2*bleed, vips.ExtendMirror); err != nil {
+		return fmt.Errorf("bleed failed: %w", err)
+	}
+	return nil
+}
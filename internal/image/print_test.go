@@ -0,0 +1,75 @@
+package image
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+func TestVipsSetResolution(t *testing.T) {
+	img, err := LoadVips(testImageVips)
+	if err != nil {
+		t.Fatalf("LoadVips failed: %v", err)
+	}
+	defer img.Close()
+	if err := img.ResizeToFit(200, 200, Bilinear); err != nil {
+		t.Fatalf("ResizeToFit failed: %v", err)
+	}
+	if err := img.SetResolution(360); err != nil {
+		t.Fatalf("SetResolution failed: %v", err)
+	}
+	if got := img.Resolution(); math.Abs(got-360) > 0.01 {
+		t.Errorf("Resolution() = %v, expected 360", got)
+	}
+
+	for _, format := range []Format{JPEG, TIFF, PNG} {
+		t.Run(format.String(), func(t *testing.T) {
+			data, err := img.Encode(format, DefaultEncodeOptions(90))
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			out, err := vips.NewImageFromBuffer(data)
+			if err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			defer out.Close()
+			if got := out.ResX() * mmPerInch; math.Abs(got-360) > 0.5 {
+				t.Errorf("resolution = %v, expected 360", got)
+			}
+
+			// The JFIF header holds the density in dots per inch
+			if format == JPEG {
+				if string(data[6:11]) != "JFIF\x00" {
+					t.Fatal("no JFIF header")
+				}
+				if unit, x := data[13], binary.BigEndian.Uint16(data[14:]); unit != 1 || x != 360 {
+					t.Errorf("JFIF density = %d (unit %d), expected 360 dpi", x, unit)
+				}
+			}
+		})
+	}
+}
+
+func TestVipsAddBleed(t *testing.T) {
+	img, err := LoadVips(testImageVips)
+	if err != nil {
+		t.Fatalf("LoadVips failed: %v", err)
+	}
+	defer img.Close()
+	if err := img.ResizeToFit(200, 200, Bilinear); err != nil {
+		t.Fatalf("ResizeToFit failed: %v", err)
+	}
+	w, h := img.Width(), img.Height()
+
+	if err := img.AddBleed(0); err != nil {
+		t.Fatalf("AddBleed(0) failed: %v", err)
+	}
+	if err := img.AddBleed(12); err != nil {
+		t.Fatalf("AddBleed failed: %v", err)
+	}
+	if img.Width() != w+24 || img.Height() != h+24 {
+		t.Errorf("size with bleed = %dx%d, expected %dx%d", img.Width(), img.Height(), w+24, h+24)
+	}
+}
@@ -0,0 +1,78 @@
+package image
+
+import "testing"
+
+func TestParseSharpen(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Sharpen
+		name     string // String of the result
+	}{
+		{"none", Sharpen{}, "none"},
+		{"", Sharpen{}, "none"},
+		{"screen-low", Sharpen{Radius: 0.5, Amount: 0.5, Threshold: 2}, "screen-low"},
+		{"Glossy", Sharpen{Radius: 0.8, Amount: 1, Threshold: 3}, "glossy"},
+		{"custom(0.6,1.4,4)", Sharpen{Radius: 0.6, Amount: 1.4, Threshold: 4}, "custom(0.6,1.4,4)"},
+		{"custom( 1, 1.5, 3 )", Sharpen{Radius: 1, Amount: 1.5, Threshold: 3}, "matte"},
+		{"custom(1,0,0)", Sharpen{Radius: 1}, "none"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseSharpen(tc.input)
+			if err != nil {
+				t.Fatalf("ParseSharpen(%q) failed: %v", tc.input, err)
+			}
+			if got != tc.expected {
+				t.Errorf("ParseSharpen(%q) = %+v, expected %+v", tc.input, got, tc.expected)
+			}
+			if got.String() != tc.name {
+				t.Errorf("String() = %q, expected %q", got.String(), tc.name)
+			}
+		})
+	}
+
+	for _, input := range []string{
+		"crisp",
+		"custom(1,2)",
+		"custom(1,2,3,4)",
+		"custom(1,2,3",
+		"custom(a,2,3)",
+		"custom(0,1,2)",
+		"custom(1,-1,2)",
+		"custom(1,1,300)",
+	} {
+		if _, err := ParseSharpen(input); err == nil {
+			t.Errorf("ParseSharpen(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestVipsSharpen(t *testing.T) {
+	for _, name := range []string{"none", "screen-high", "matte", "custom(2,3,0)"} {
+		t.Run(name, func(t *testing.T) {
+			s, err := ParseSharpen(name)
+			if err != nil {
+				t.Fatalf("ParseSharpen failed: %v", err)
+			}
+			img, err := LoadVips(testImageVips)
+			if err != nil {
+				t.Fatalf("LoadVips failed: %v", err)
+			}
+			defer img.Close()
+			if err := img.ResizeToFit(300, 300, Lanczos); err != nil {
+				t.Fatalf("ResizeToFit failed: %v", err)
+			}
+			w, h := img.Width(), img.Height()
+
+			if err := img.Sharpen(s); err != nil {
+				t.Fatalf("Sharpen failed: %v", err)
+			}
+			if img.Width() != w || img.Height() != h {
+				t.Errorf("Sharpen changed the size to %dx%d, expected %dx%d", img.Width(), img.Height(), w, h)
+			}
+			if img.ref.Bands() != 3 {
+				t.Errorf("Sharpen returned %d bands, expected 3", img.ref.Bands())
+			}
+		})
+	}
+}
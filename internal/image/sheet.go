@@ -0,0 +1,179 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// SheetLayout is a grid of equal cells on a print sheet, e.g. four 4x6
+// prints on a letter sheet. All lengths are in pixels.
+type SheetLayout struct {
+	Width, Height         int // the sheet
+	Margin                int // space around the grid, where crop marks go
+	Gutter                int // space between cells
+	Columns, Rows         int // derived from the cell size if zero
+	CellWidth, CellHeight int // derived from the grid if zero
+}
+
+// Resolve fills in the grid from the cell size, or the cell size from the
+// grid, and checks that the cells fit on the sheet.
+func (l SheetLayout) Resolve() (SheetLayout, error) {
+	if l.Margin < 0 || l.Gutter < 0 {
+		return l, fmt.Errorf("sheet margin and gutter must not be negative")
+	}
+	innerWidth, innerHeight := l.Width-2*l.Margin, l.Height-2*l.Margin
+	if innerWidth <= 0 || innerHeight <= 0 {
+		return l, fmt.Errorf("sheet margin is too large for a %dx%d sheet", l.Width, l.Height)
+	}
+
+	switch {
+	case l.CellWidth > 0 && l.CellHeight > 0 && l.Columns == 0 && l.Rows == 0:
+		// As many cells as fit, with a gutter between each pair
+		l.Columns = (innerWidth + l.Gutter) / (l.CellWidth + l.Gutter)
+		l.Rows = (innerHeight + l.Gutter) / (l.CellHeight + l.Gutter)
+		if l.Columns == 0 || l.Rows == 0 {
+			return l, fmt.Errorf("a %dx%d cell does not fit on the sheet", l.CellWidth, l.CellHeight)
+		}
+	case l.Columns > 0 && l.Rows > 0 && l.CellWidth == 0 && l.CellHeight == 0:
+		l.CellWidth = (innerWidth - (l.Columns-1)*l.Gutter) / l.Columns
+		l.CellHeight = (innerHeight - (l.Rows-1)*l.Gutter) / l.Rows
+		if l.CellWidth <= 0 || l.CellHeight <= 0 {
+			return l, fmt.Errorf("a %dx%d grid does not fit on the sheet", l.Columns, l.Rows)
+		}
+	case l.Columns > 0 && l.Rows > 0 && l.CellWidth > 0 && l.CellHeight > 0:
+		if grid := l.grid(); grid.Dx() > innerWidth || grid.Dy() > innerHeight {
+			return l, fmt.Errorf("%dx%d cells of %dx%d do not fit on the sheet", l.Columns, l.Rows, l.CellWidth, l.CellHeight)
+		}
+	default:
+		return l, fmt.Errorf("sheet layout needs a grid or a cell size")
+	}
+	return l, nil
+}
+
+// Count returns the number of cells on a sheet.
+func (l SheetLayout) Count() int {
+	return l.Columns * l.Rows
+}
+
+// grid returns the area covered by the cells, centred on the sheet.
+func (l SheetLayout) grid() image.Rectangle {
+	w := l.Columns*l.CellWidth + (l.Columns-1)*l.Gutter
+	h := l.Rows*l.CellHeight + (l.Rows-1)*l.Gutter
+	x, y := (l.Width-w)/2, (l.Height-h)/2
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// Cells returns the position of each cell, row by row from the top left.
+func (l SheetLayout) Cells() []image.Rectangle {
+	grid := l.grid()
+	cells := make([]image.Rectangle, 0, l.Count())
+	for row := range l.Rows {
+		for col := range l.Columns {
+			x := grid.Min.X + col*(l.CellWidth+l.Gutter)
+			y := grid.Min.Y + row*(l.CellHeight+l.Gutter)
+			cells = append(cells, image.Rect(x, y, x+l.CellWidth, y+l.CellHeight))
+		}
+	}
+	return cells
+}
+
+// CropMarks returns crop marks of the given length and weight for every
+// cut line: the edges of the cells extended into the space around the
+// grid, starting gap pixels from it. Marks are shortened to the sheet, so
+// they never touch a cell.
+func (l SheetLayout) CropMarks(length, gap, weight int) []image.Rectangle {
+	grid := l.grid()
+	var marks []image.Rectangle
+	add := func(r image.Rectangle) {
+		if r = r.Intersect(image.Rect(0, 0, l.Width, l.Height)); !r.Empty() {
+			marks = append(marks, r)
+		}
+	}
+
+	// Without a gutter, neighbouring cells share a cut line
+	var xs, ys []int
+	for col := range l.Columns {
+		x := grid.Min.X + col*(l.CellWidth+l.Gutter)
+		if col == 0 || l.Gutter > 0 {
+			xs = append(xs, x)
+		}
+		xs = append(xs, x+l.CellWidth)
+	}
+	for row := range l.Rows {
+		y := grid.Min.Y + row*(l.CellHeight+l.Gutter)
+		if row == 0 || l.Gutter > 0 {
+			ys = append(ys, y)
+		}
+		ys = append(ys, y+l.CellHeight)
+	}
+
+	half := weight / 2
+	for _, x := range xs {
+		add(image.Rect(x-half, grid.Min.Y-gap-length, x-half+weight, grid.Min.Y-gap))
+		add(image.Rect(x-half, grid.Max.Y+gap, x-half+weight, grid.Max.Y+gap+length))
+	}
+	for _, y := range ys {
+		add(image.Rect(grid.Min.X-gap-length, y-half, grid.Min.X-gap, y-half+weight))
+		add(image.Rect(grid.Max.X+gap, y-half, grid.Max.X+gap+length, y-half+weight))
+	}
+	return marks
+}
+
+// ComposeSheet places the cells on a sheet of the paper colour at the
+// layout's cell positions, centred in their cells. There may be fewer
+// images than cells; the sheet takes the colour space of the first.
+func ComposeSheet(layout SheetLayout, cells []*VipsImage, paper color.Color) (*VipsImage, error) {
+	if len(cells) == 0 || len(cells) > layout.Count() {
+		return nil, fmt.Errorf("sheet needs 1 to %d images, got %d", layout.Count(), len(cells))
+	}
+	positions := layout.Cells()
+	at := func(i int) image.Point {
+		r := positions[i]
+		return image.Pt(r.Min.X+(r.Dx()-cells[i].Width())/2, r.Min.Y+(r.Dy()-cells[i].Height())/2)
+	}
+
+	// The first cell, framed by the paper, becomes the sheet
+	sheet, err := cells[0].Copy()
+	if err != nil {
+		return nil, err
+	}
+	p := at(0)
+	if err := sheet.AddFrame(p.Y, layout.Width-cells[0].Width()-p.X, layout.Height-cells[0].Height()-p.Y, p.X, paper); err != nil {
+		sheet.Close()
+		return nil, err
+	}
+
+	for i, cell := range cells[1:] {
+		p := at(i + 1)
+		if err := sheet.ref.Insert(cell.ref, p.X, p.Y, false, nil); err != nil {
+			sheet.Close()
+			return nil, fmt.Errorf("insert failed: %w", err)
+		}
+	}
+	debugLog("ComposeSheet: %d images on %dx%d, %dx%d cells of %dx%d", len(cells), layout.Width, layout.Height,
+		layout.Columns, layout.Rows, layout.CellWidth, layout.CellHeight)
+	return sheet, nil
+}
+
+// DrawMarks fills the rectangles, e.g. the crop marks of a sheet, with c.
+func (v *VipsImage) DrawMarks(marks []image.Rectangle, c color.Color) error {
+	ink := vipsRGBA(c)
+	for _, m := range marks {
+		if err := v.ref.DrawRect(ink, m.Min.X, m.Min.Y, m.Dx(), m.Dy(), true); err != nil {
+			return fmt.Errorf("draw failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Rotate90 turns the image a quarter turn clockwise, e.g. to match the
+// orientation of a sheet's cells.
+func (v *VipsImage) Rotate90() error {
+	if err := v.ref.Rotate(vips.Angle90); err != nil {
+		return fmt.Errorf("rotate failed: %w", err)
+	}
+	return nil
+}
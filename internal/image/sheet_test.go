@@ -0,0 +1,162 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSheetLayoutResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		layout   SheetLayout
+		expected SheetLayout
+	}{
+		{
+			"from cell size",
+			SheetLayout{Width: 1000, Height: 800, Margin: 50, Gutter: 20, CellWidth: 200, CellHeight: 300},
+			SheetLayout{Width: 1000, Height: 800, Margin: 50, Gutter: 20, Columns: 4, Rows: 2, CellWidth: 200, CellHeight: 300},
+		},
+		{
+			"from grid",
+			SheetLayout{Width: 1000, Height: 800, Margin: 50, Gutter: 20, Columns: 3, Rows: 2},
+			SheetLayout{Width: 1000, Height: 800, Margin: 50, Gutter: 20, Columns: 3, Rows: 2, CellWidth: 286, CellHeight: 340},
+		},
+		{
+			"both",
+			SheetLayout{Width: 1000, Height: 800, Columns: 2, Rows: 2, CellWidth: 500, CellHeight: 400},
+			SheetLayout{Width: 1000, Height: 800, Columns: 2, Rows: 2, CellWidth: 500, CellHeight: 400},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.layout.Resolve()
+			if err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("Resolve() = %+v, expected %+v", got, tc.expected)
+			}
+		})
+	}
+
+	for _, l := range []SheetLayout{
+		{Width: 1000, Height: 800, Margin: 400, Columns: 1, Rows: 1},
+		{Width: 1000, Height: 800, CellWidth: 1200, CellHeight: 300},
+		{Width: 1000, Height: 800, Gutter: 500, Columns: 3, Rows: 1},
+		{Width: 1000, Height: 800, Columns: 2, Rows: 2, CellWidth: 600, CellHeight: 400},
+		{Width: 1000, Height: 800, Margin: -1, Columns: 1, Rows: 1},
+		{Width: 1000, Height: 800},
+	} {
+		if _, err := l.Resolve(); err == nil {
+			t.Errorf("Resolve(%+v) expected error, got nil", l)
+		}
+	}
+}
+
+func TestSheetLayoutCells(t *testing.T) {
+	l, err := SheetLayout{Width: 1000, Height: 800, Margin: 50, Gutter: 20, CellWidth: 200, CellHeight: 300}.Resolve()
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	cells := l.Cells()
+	if len(cells) != 8 {
+		t.Fatalf("got %d cells, expected 8", len(cells))
+	}
+
+	// The 860x620 grid is centred on the sheet
+	if cells[0] != image.Rect(70, 90, 270, 390) {
+		t.Errorf("first cell = %v, expected (70,90)-(270,390)", cells[0])
+	}
+	if cells[5] != image.Rect(290, 410, 490, 710) {
+		t.Errorf("sixth cell = %v, expected (290,410)-(490,710)", cells[5])
+	}
+}
+
+func TestSheetLayoutCropMarks(t *testing.T) {
+	l := SheetLayout{Width: 1000, Height: 800, Margin: 50, Gutter: 20, Columns: 4, Rows: 2, CellWidth: 200, CellHeight: 300}
+
+	tests := []struct {
+		name   string
+		gutter int
+		length int
+		count  int
+		first  image.Rectangle
+	}{
+		// Both edges of each cell are cut: 8 lines across, 4 down
+		{"gutter", 20, 30, 24, image.Rect(69, 50, 71, 80)},
+		// Neighbouring cells share a cut line: 5 across, 3 down
+		{"no gutter", 0, 30, 16, image.Rect(99, 60, 101, 90)},
+		// Long marks are shortened to the sheet
+		{"clipped", 20, 100, 24, image.Rect(69, 0, 71, 80)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := l
+			l.Gutter = tc.gutter
+			marks := l.CropMarks(tc.length, 10, 2)
+			if len(marks) != tc.count {
+				t.Fatalf("got %d marks, expected %d", len(marks), tc.count)
+			}
+			if marks[0] != tc.first {
+				t.Errorf("first mark = %v, expected %v", marks[0], tc.first)
+			}
+
+			sheet := image.Rect(0, 0, l.Width, l.Height)
+			for _, m := range marks {
+				if !m.In(sheet) {
+					t.Errorf("mark %v outside the sheet", m)
+				}
+				for _, c := range l.Cells() {
+					if m.Overlaps(c) {
+						t.Errorf("mark %v overlaps cell %v", m, c)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestVipsComposeSheet(t *testing.T) {
+	layout, err := SheetLayout{Width: 600, Height: 400, Margin: 20, Gutter: 10, Columns: 2, Rows: 1}.Resolve()
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+
+	var cells []*VipsImage
+	for range 2 {
+		img, err := LoadVips(testImageVips)
+		if err != nil {
+			t.Fatalf("LoadVips failed: %v", err)
+		}
+		defer img.Close()
+		if err := img.ResizeToFit(layout.CellWidth, layout.CellHeight, Bilinear); err != nil {
+			t.Fatalf("ResizeToFit failed: %v", err)
+		}
+		cells = append(cells, img)
+	}
+
+	sheet, err := ComposeSheet(layout, cells, color.White)
+	if err != nil {
+		t.Fatalf("ComposeSheet failed: %v", err)
+	}
+	defer sheet.Close()
+	if sheet.Width() != 600 || sheet.Height() != 400 {
+		t.Errorf("sheet size = %dx%d, expected 600x400", sheet.Width(), sheet.Height())
+	}
+	if err := sheet.DrawMarks(layout.CropMarks(8, 4, 1), color.Black); err != nil {
+		t.Fatalf("DrawMarks failed: %v", err)
+	}
+
+	w, h := cells[0].Width(), cells[0].Height()
+	if err := cells[0].Rotate90(); err != nil {
+		t.Fatalf("Rotate90 failed: %v", err)
+	}
+	if cells[0].Width() != h || cells[0].Height() != w {
+		t.Errorf("rotated size = %dx%d, expected %dx%d", cells[0].Width(), cells[0].Height(), h, w)
+	}
+
+	if _, err := ComposeSheet(layout, append(cells, cells[0]), color.White); err == nil {
+		t.Error("more images than cells expected error, got nil")
+	}
+}
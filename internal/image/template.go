@@ -0,0 +1,68 @@
+package image
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// LabelTemplate renders label text from a photo's Metadata using Go
+// template syntax, e.g. `{{.Title}} — {{.Camera}}, f/{{.FNumber}} {{.Date "2006"}}`.
+type LabelTemplate struct {
+	tmpl *template.Template
+}
+
+// labelTemplateFuncs are the functions available in label templates.
+var labelTemplateFuncs = template.FuncMap{
+	// default returns def if the value is empty: {{.Title | default "Untitled"}}
+	"default": func(def string, v any) any {
+		if isEmptyValue(v) {
+			return def
+		}
+		return v
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"join": func(sep string, values []string) string {
+		return strings.Join(values, sep)
+	},
+}
+
+// ParseLabelTemplate parses a label template. Unknown fields and functions
+// are reported here rather than when the first image is rendered.
+func ParseLabelTemplate(text string) (*LabelTemplate, error) {
+	tmpl, err := template.New("label").Funcs(labelTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label template: %w", err)
+	}
+	t := &LabelTemplate{tmpl: tmpl}
+	if _, err := t.Execute(&Metadata{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Execute renders the template for m. Leading and trailing whitespace,
+// which missing fields tend to leave behind, is trimmed.
+func (t *LabelTemplate) Execute(m *Metadata) (string, error) {
+	var buf strings.Builder
+	if err := t.tmpl.Execute(&buf, m); err != nil {
+		return "", fmt.Errorf("invalid label template: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// isEmptyValue reports whether v is the zero value of its type or an empty list.
+func isEmptyValue(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return rv.Len() == 0
+	default:
+		return rv.IsZero()
+	}
+}
@@ -0,0 +1,113 @@
+package image
+
+import (
+	"testing"
+	"time"
+)
+
+// testMetadata is a fully populated fixture for template tests.
+func testMetadata() *Metadata {
+	return &Metadata{
+		Filename:     "DSCF1234",
+		Title:        "Morning Tram",
+		Headline:     "Tram 28",
+		Creator:      "Ada Example",
+		Keywords:     []string{"tram", "street"},
+		City:         "Lisbon",
+		Country:      "Portugal",
+		Camera:       "FUJIFILM X-T5",
+		Lens:         "XF23mmF1.4 R LM WR",
+		FocalLength:  23,
+		FNumber:      2.8,
+		ExposureTime: "1/250",
+		ISO:          400,
+		DateTaken:    time.Date(2024, 6, 21, 5, 42, 10, 0, time.UTC),
+	}
+}
+
+func TestLabelTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		meta     *Metadata
+		expected string
+	}{
+		{
+			name:     "full",
+			template: `{{.Title}} — {{.Camera}}, {{.FocalLength}}mm f/{{.FNumber}} {{.Date "2006"}}`,
+			meta:     testMetadata(),
+			expected: "Morning Tram — FUJIFILM X-T5, 23mm f/2.8 2024",
+		},
+		{
+			name:     "exposure",
+			template: `{{.ExposureTime}}s · ISO {{.ISO}} · {{.Lens}}`,
+			meta:     testMetadata(),
+			expected: "1/250s · ISO 400 · XF23mmF1.4 R LM WR",
+		},
+		{
+			name:     "default",
+			template: `{{.Title | default .Filename}}, {{.Country | default "somewhere"}}`,
+			meta:     &Metadata{Filename: "DSCF1234"},
+			expected: "DSCF1234, somewhere",
+		},
+		{
+			name:     "default numbers",
+			template: `f/{{.FNumber | default "?"}}`,
+			meta:     &Metadata{},
+			expected: "f/?",
+		},
+		{
+			name:     "optional sections",
+			template: `{{with .City}}{{.}}, {{end}}{{.Country}}`,
+			meta:     &Metadata{Country: "Portugal"},
+			expected: "Portugal",
+		},
+		{
+			name:     "functions",
+			template: `{{upper .City}} {{join ", " .Keywords}} {{lower .Camera}}`,
+			meta:     testMetadata(),
+			expected: "LISBON tram, street fujifilm x-t5",
+		},
+		{
+			name:     "missing date",
+			template: `{{.Title}} {{.Date "2006"}}`,
+			meta:     &Metadata{Title: "Untitled"},
+			expected: "Untitled",
+		},
+		{
+			name:     "empty",
+			template: `{{.Headline}}`,
+			meta:     &Metadata{},
+			expected: "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := ParseLabelTemplate(tc.template)
+			if err != nil {
+				t.Fatalf("ParseLabelTemplate failed: %v", err)
+			}
+			got, err := tmpl.Execute(tc.meta)
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("Execute = %q, expected %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseLabelTemplateErrors(t *testing.T) {
+	for _, text := range []string{
+		`{{.Title`,
+		`{{.Aperture}}`,
+		`{{.Title | shout}}`,
+		`{{.Date}}`,
+	} {
+		if _, err := ParseLabelTemplate(text); err == nil {
+			t.Errorf("ParseLabelTemplate(%q) expected error", text)
+		}
+	}
+}
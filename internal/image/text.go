@@ -0,0 +1,131 @@
+package image
+
+// #cgo pkg-config: vips
+// #include <stdlib.h>
+// #include <vips/vips.h>
+//
+// static int ansel_text(VipsImage **out, const char *text, const char *font, const char *fontfile) {
+// 	if (fontfile != NULL)
+// 		return vips_text(out, text, "font", font, "fontfile", fontfile, "rgba", TRUE, NULL);
+// 	return vips_text(out, text, "font", font, "rgba", TRUE, NULL);
+// }
+//
+// static int ansel_text_size(const char *text, const char *font, const char *fontfile, int *width, int *height) {
+// 	VipsImage *img;
+// 	if (ansel_text(&img, text, font, fontfile))
+// 		return -1;
+// 	*width = img->Xsize;
+// 	*height = img->Ysize;
+// 	g_object_unref(img);
+// 	return 0;
+// }
+//
+// static int ansel_text_tiff(const char *text, const char *font, const char *fontfile, void **buf, size_t *len) {
+// 	VipsImage *img;
+// 	int err;
+// 	if (ansel_text(&img, text, font, fontfile))
+// 		return -1;
+// 	err = vips_tiffsave_buffer(img, buf, len, NULL);
+// 	g_object_unref(img);
+// 	return err;
+// }
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// Text is rendered by libvips with Pango, in-process, so it is measured
+// exactly as it is drawn. Pango lays out bidirectional text and falls back
+// to other fonts for missing glyphs; RGBA rendering keeps colour emoji.
+
+// vipsMu serialises the libvips calls of this package, so that an error read
+// from the libvips error buffer belongs to the call that failed.
+var vipsMu sync.Mutex
+
+// textSize returns the size of Pango markup rendered in font. fontfile, if
+// not empty, is a font file to load in addition to the installed fonts.
+func textSize(markup, font, fontfile string) (width, height int, err error) {
+	if markup == "" {
+		return 0, 0, nil
+	}
+	cText, cFont, cFontfile := textArgs(markup, font, fontfile)
+	defer freeTextArgs(cText, cFont, cFontfile)
+
+	vipsMu.Lock()
+	defer vipsMu.Unlock()
+	var w, h C.int
+	if C.ansel_text_size(cText, cFont, cFontfile, &w, &h) != 0 {
+		return 0, 0, vipsError("measure text")
+	}
+	return int(w), int(h), nil
+}
+
+// renderText renders Pango markup in font to an sRGB image with alpha.
+//
+// govips only creates images from encoded files, so the pixels are handed
+// over as an uncompressed TIFF, which libvips writes and reads as a plain
+// copy of the pixel memory, without the filtering and checksums of PNG.
+func renderText(markup, font, fontfile string) (*vips.ImageRef, error) {
+	cText, cFont, cFontfile := textArgs(markup, font, fontfile)
+	defer freeTextArgs(cText, cFont, cFontfile)
+
+	var buf unsafe.Pointer
+	var length C.size_t
+	if err := func() error {
+		vipsMu.Lock()
+		defer vipsMu.Unlock()
+		if C.ansel_text_tiff(cText, cFont, cFontfile, &buf, &length) != 0 {
+			return vipsError("render text")
+		}
+		return nil
+	}(); err != nil {
+		return nil, err
+	}
+	data := C.GoBytes(buf, C.int(length))
+	C.g_free(C.gpointer(buf))
+
+	img, err := vips.NewImageFromBuffer(data)
+	if err != nil {
+		return nil, fmt.Errorf("text load failed: %w", err)
+	}
+	return img, nil
+}
+
+// textArgs converts the arguments of ansel_text to C strings. An empty
+// fontfile is passed as NULL.
+func textArgs(markup, font, fontfile string) (*C.char, *C.char, *C.char) {
+	var cFontfile *C.char
+	if fontfile != "" {
+		cFontfile = C.CString(fontfile)
+	}
+	return C.CString(markup), C.CString(font), cFontfile
+}
+
+// freeTextArgs frees the strings returned by textArgs.
+func freeTextArgs(args ...*C.char) {
+	for _, arg := range args {
+		if arg != nil {
+			C.free(unsafe.Pointer(arg))
+		}
+	}
+}
+
+// vipsError returns the libvips error buffer as an error and clears it.
+// Call it with vipsMu held. The buffer is copied and cleared under libvips'
+// own lock, as other workers may report errors at the same time.
+func vipsError(op string) error {
+	buf := C.vips_error_buffer_copy()
+	msg := strings.TrimSpace(C.GoString(buf))
+	C.g_free(C.gpointer(buf))
+	if msg == "" {
+		return errors.New(op + " failed")
+	}
+	return fmt.Errorf("%s failed: %s", op, msg)
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"image/color"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -19,6 +18,9 @@ const KernelMKS2021 vips.Kernel = 7
 // VipsImage wraps a govips image reference.
 type VipsImage struct {
 	ref *vips.ImageRef
+
+	// metadata is written into the encoded file, see ApplyMetadataPolicy
+	metadata *metadataBlocks
 }
 
 // InitVips initializes the vips library. Call once at startup.
@@ -57,11 +59,16 @@ func ShutdownVips() {
 }
 
 // LoadVips loads an image using libvips.
+// The image is rotated upright according to its EXIF orientation.
 func LoadVips(path string) (*VipsImage, error) {
 	img, err := vips.NewImageFromFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load image: %w", err)
 	}
+	if err := img.AutoRotate(); err != nil {
+		img.Close()
+		return nil, fmt.Errorf("failed to apply orientation: %w", err)
+	}
 	return &VipsImage{ref: img}, nil
 }
 
@@ -83,8 +90,30 @@ func (v *VipsImage) Close() {
 	}
 }
 
+// Copy returns a copy of the image that can be processed independently.
+// libvips shares the decoded source pixels between copies, so branching an
+// image into several outputs only decodes it once.
+func (v *VipsImage) Copy() (*VipsImage, error) {
+	ref, err := v.ref.Copy()
+	if err != nil {
+		return nil, fmt.Errorf("copy failed: %w", err)
+	}
+	return &VipsImage{ref: ref, metadata: v.metadata}, nil
+}
+
 // ResizeToFit resizes to fit within the given dimensions, maintaining aspect ratio.
+// Resampling is done in linear light.
 func (v *VipsImage) ResizeToFit(maxWidth, maxHeight int, filter Filter) error {
+	return v.ResizeToFitColorspace(maxWidth, maxHeight, filter, LinearLight)
+}
+
+// ResizeToFitColorspace resizes to fit within the given dimensions, maintaining
+// aspect ratio, resampling in the given colour space.
+//
+// For LinearLight the image is converted to float scRGB before resampling and
+// back to sRGB afterwards (16-bit sources stay 16-bit), so no precision is lost
+// in the intermediate steps.
+func (v *VipsImage) ResizeToFitColorspace(maxWidth, maxHeight int, filter Filter, space Colorspace) error {
 	srcWidth := float64(v.ref.Width())
 	srcHeight := float64(v.ref.Height())
 
@@ -95,12 +124,38 @@ func (v *VipsImage) ResizeToFit(maxWidth, maxHeight int, filter Filter) error {
 		scale = scaleY
 	}
 
+	return v.resizeColorspace(scale, filter, space)
+}
+
+// resizeColorspace scales the image by scale, resampling in the given colour space.
+func (v *VipsImage) resizeColorspace(scale float64, filter Filter, space Colorspace) error {
+	// Remember the encoding to return to after resampling in linear light;
+	// greyscale stays greyscale
+	outSpace := vips.InterpretationSRGB
+	if space == LinearLight {
+		switch v.ref.Interpretation() {
+		case vips.InterpretationRGB16, vips.InterpretationGrey16, vips.InterpretationBW:
+			outSpace = v.ref.Interpretation()
+		}
+
+		debugLog("ResizeToFit: converting %v to scRGB", v.ref.Interpretation())
+		if err := v.ref.ToColorSpace(vips.InterpretationScRGB); err != nil {
+			return fmt.Errorf("convert to linear light failed: %w", err)
+		}
+	}
+
 	kernel := filterToVipsKernel(filter)
 	err := v.ref.Resize(scale, kernel)
 	if err != nil {
 		return fmt.Errorf("resize failed: %w", err)
 	}
 
+	if space == LinearLight {
+		if err := v.ref.ToColorSpace(outSpace); err != nil {
+			return fmt.Errorf("convert from linear light failed: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -129,154 +184,38 @@ func (v *VipsImage) AddUniformFrame(width int, c color.Color) error {
 
 // SaveJPEG saves the image as JPEG.
 func (v *VipsImage) SaveJPEG(path string, quality int) error {
-	params := vips.NewJpegExportParams()
-	params.Quality = quality
-	params.StripMetadata = true
-
-	bytes, _, err := v.ref.ExportJpeg(params)
-	if err != nil {
-		return fmt.Errorf("export JPEG failed: %w", err)
-	}
-
-	return os.WriteFile(path, bytes, 0644)
+	return v.SaveFormat(path, JPEG, DefaultEncodeOptions(quality))
 }
 
-// Save saves the image, detecting format from extension.
+// Save saves the image, detecting format from extension. Metadata is
+// stripped from JPEG output and kept in other formats.
 func (v *VipsImage) Save(path string, quality int) error {
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".jpg", ".jpeg":
-		return v.SaveJPEG(path, quality)
-	case ".png":
-		params := vips.NewPngExportParams()
-		params.Compression = 6
-		bytes, _, err := v.ref.ExportPng(params)
-		if err != nil {
-			return fmt.Errorf("export PNG failed: %w", err)
-		}
-		return os.WriteFile(path, bytes, 0644)
-	case ".tif", ".tiff":
-		params := vips.NewTiffExportParams()
-		params.Compression = vips.TiffCompressionDeflate
-		bytes, _, err := v.ref.ExportTiff(params)
-		if err != nil {
-			return fmt.Errorf("export TIFF failed: %w", err)
-		}
-		return os.WriteFile(path, bytes, 0644)
-	default:
-		return fmt.Errorf("unsupported output format: %s", ext)
-	}
-}
-
-// getTextDimensions uses vips CLI to measure actual text dimensions.
-func getTextDimensions(text, font string) (width, height int, err error) {
-	tmpFile := "/tmp/ansel_text_measure.png"
-	defer os.Remove(tmpFile)
-
-	// Use vips text command to create a text image
-	cmd := exec.Command("vips", "text", tmpFile, text, "--font", font)
-	if err := cmd.Run(); err != nil {
-		return 0, 0, err
-	}
-
-	// Read dimensions using vipsheader
-	out, err := exec.Command("vipsheader", "-f", "width", tmpFile).Output()
-	if err != nil {
-		return 0, 0, err
-	}
-	fmt.Sscanf(strings.TrimSpace(string(out)), "%d", &width)
-
-	out, err = exec.Command("vipsheader", "-f", "height", tmpFile).Output()
-	if err != nil {
-		return 0, 0, err
+	format, ok := FormatFromPath(path)
+	if !ok {
+		return fmt.Errorf("unsupported output format: %s", strings.ToLower(filepath.Ext(path)))
 	}
-	fmt.Sscanf(strings.TrimSpace(string(out)), "%d", &height)
-
-	return width, height, nil
+	opts := DefaultEncodeOptions(quality)
+	opts.StripMetadata = format == JPEG
+	return v.SaveFormat(path, format, opts)
 }
 
-// AddLabel renders a text label on the image with a white background.
-// Font should be in Pango format, e.g. "sans 24" or "Arial Bold 18".
-// fontSize is the point size used in the font string (needed for positioning).
-// offsetX is the X position where the image starts (left edge alignment).
-// imageBottomY is the Y position where the image ends (bottom edge).
-// paddingY is the vertical padding between image bottom and label top.
-func (v *VipsImage) AddLabel(text, font string, fontSize int, offsetX, imageBottomY, paddingY int) error {
-	if text == "" {
-		return nil
+// compositeLayer blends an sRGB layer with alpha onto the image at x, y,
+// keeping the image's bands and format.
+func (v *VipsImage) compositeLayer(layer *vips.ImageRef, mode vips.BlendMode, x, y int) error {
+	format := v.ref.BandFormat()
+	hadAlpha := v.ref.HasAlpha()
+	if err := v.ref.Composite(layer, mode, x, y); err != nil {
+		return fmt.Errorf("composite failed: %w", err)
 	}
 
-	// Get actual text dimensions by rendering to a temporary image
-	textWidth, textHeight, err := getTextDimensions(text, font)
-	if err != nil {
-		// Fallback to estimation
-		debugLog("AddLabel: getTextDimensions failed: %v, using estimation", err)
-		textWidth = int(float64(len(text)) * float64(fontSize) * 0.6)
-		textHeight = int(float64(fontSize) * 1.35)
-	}
-
-	padding := fontSize / 3
-	bgWidth := textWidth + 2*padding
-	bgHeight := textHeight + padding
-
-	// Position label so its top aligns with imageBottomY + paddingY
-	bgTop := imageBottomY + paddingY
-	bgLeft := offsetX - padding/2
-	if bgLeft < 0 {
-		bgLeft = 0
-	}
-	if bgTop < 0 {
-		bgTop = 0
-	}
-	// Clamp to image bounds
-	if bgLeft+bgWidth > v.Width() {
-		bgWidth = v.Width() - bgLeft
-	}
-	if bgTop+bgHeight > v.Height() {
-		bgHeight = v.Height() - bgTop
-	}
-
-	debugLog("AddLabel: text=%q font=%s fontSize=%d", text, font, fontSize)
-	debugLog("AddLabel: offsetX=%d imageBottomY=%d paddingY=%d textSize=%dx%d imageSize=%dx%d",
-		offsetX, imageBottomY, paddingY, textWidth, textHeight, v.Width(), v.Height())
-	debugLog("AddLabel: background rect at (%d,%d) size %dx%d", bgLeft, bgTop, bgWidth, bgHeight)
-
-	// Draw white background rectangle
-	bgColor := vips.ColorRGBA{
-		R: 255,
-		G: 255,
-		B: 255,
-		A: 255,
-	}
-
-	if err := v.ref.DrawRect(bgColor, bgLeft, bgTop, bgWidth, bgHeight, true); err != nil {
-		debugLog("AddLabel: DrawRect error: %v", err)
-		return err
-	}
-
-	// Now overlay black text (solid, no transparency)
-	// Position text inside the background box
-	textX := bgLeft + padding/2
-	textY := bgTop + padding/2
-
-	labelColor := vips.Color{R: 0, G: 0, B: 0}
-	params := &vips.LabelParams{
-		Text:      text,
-		Font:      font,
-		Width:     vips.Scalar{Value: float64(v.Width() - textX), Relative: false}, // Max width for text
-		Height:    vips.Scalar{Value: float64(textHeight), Relative: false},
-		OffsetX:   vips.Scalar{Value: float64(textX), Relative: false},
-		OffsetY:   vips.Scalar{Value: float64(textY), Relative: false},
-		Opacity:   1.0, // Solid black text
-		Color:     labelColor,
-		Alignment: vips.AlignLow, // Left align
+	// Compositing always adds an alpha band
+	if !hadAlpha {
+		if err := v.ref.ExtractBand(0, v.ref.Bands()-1); err != nil {
+			return fmt.Errorf("extract band failed: %w", err)
+		}
 	}
-
-	debugLog("AddLabel: text position (%d,%d) maxWidth=%d height=%d", textX, textY, v.Width()-textX, textHeight)
-
-	if err := v.ref.Label(params); err != nil {
-		debugLog("AddLabel: Label error: %v", err)
-		return err
+	if err := v.ref.Cast(format); err != nil {
+		return fmt.Errorf("cast failed: %w", err)
 	}
 	return nil
 }
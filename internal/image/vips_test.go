@@ -1,10 +1,14 @@
 package image
 
 import (
+	"image"
 	"image/color"
+	"image/png"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/davidbyttow/govips/v2/vips"
 )
 
 const testImageVips = "../../testdata/input.jpg"
@@ -30,6 +34,31 @@ func TestLoadVips(t *testing.T) {
 	t.Logf("Loaded image: %dx%d", img.Width(), img.Height())
 }
 
+func TestVipsReadSize(t *testing.T) {
+	img, err := LoadVips(testImageVips)
+	if err != nil {
+		t.Fatalf("LoadVips failed: %v", err)
+	}
+	defer img.Close()
+
+	// The header gives the dimensions of the loaded, upright image
+	width, height, err := ReadSize(testImageVips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width != img.Width() || height != img.Height() {
+		t.Errorf("ReadSize = %dx%d, expected %dx%d", width, height, img.Width(), img.Height())
+	}
+
+	pattern := writePattern(t, 30, 20, func(x, y int) uint8 { return 128 })
+	if width, height, err := ReadSize(pattern); err != nil || width != 30 || height != 20 {
+		t.Errorf("ReadSize = %dx%d, %v, expected 30x20", width, height, err)
+	}
+	if _, _, err := ReadSize(filepath.Join(t.TempDir(), "missing.jpg")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
 func TestVipsResizeToFit(t *testing.T) {
 	img, err := LoadVips(testImageVips)
 	if err != nil {
@@ -314,6 +343,8 @@ func TestParseColor(t *testing.T) {
 		{"white", 255, 255, 255, 255},
 		{"black", 0, 0, 0, 255},
 		{"red", 255, 0, 0, 255},
+		{"transparent", 0, 0, 0, 0},
+		{"#ffffff80", 255, 255, 255, 128},
 	}
 
 	for _, tc := range tests {
@@ -362,3 +393,140 @@ func TestParseFilter(t *testing.T) {
 		})
 	}
 }
+
+// writePattern writes a grayscale PNG test pattern to a temporary file.
+func writePattern(t *testing.T, width, height int, value func(x, y int) uint8) string {
+	t.Helper()
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: value(x, y)})
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "pattern.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// resizedAverage loads path, resizes it to fit size x size and returns the mean pixel value.
+func resizedAverage(t *testing.T, path string, size int, space Colorspace) float64 {
+	t.Helper()
+
+	img, err := LoadVips(path)
+	if err != nil {
+		t.Fatalf("LoadVips failed: %v", err)
+	}
+	defer img.Close()
+
+	if err := img.ResizeToFitColorspace(size, size, Lanczos, space); err != nil {
+		t.Fatalf("ResizeToFitColorspace(%s) failed: %v", space, err)
+	}
+	if img.Width() != size || img.Height() != size {
+		t.Fatalf("expected %dx%d, got %dx%d", size, size, img.Width(), img.Height())
+	}
+	if img.ref.BandFormat() != vips.BandFormatUchar {
+		t.Errorf("expected 8-bit output after %s resize, got %v", space, img.ref.BandFormat())
+	}
+
+	avg, err := img.ref.Average()
+	if err != nil {
+		t.Fatalf("Average failed: %v", err)
+	}
+	return avg
+}
+
+func TestResizeColorspaceCheckerboard(t *testing.T) {
+	// 1px black/white checkerboard: half the pixels emit full light, so the
+	// linear-light average is 50% intensity, which is sRGB ~188, not 128.
+	path := writePattern(t, 256, 256, func(x, y int) uint8 {
+		if (x+y)%2 == 0 {
+			return 255
+		}
+		return 0
+	})
+
+	linear := resizedAverage(t, path, 32, LinearLight)
+	srgb := resizedAverage(t, path, 32, SRGB)
+	t.Logf("checkerboard average: linear=%.1f srgb=%.1f", linear, srgb)
+
+	if linear < 178 || linear > 198 {
+		t.Errorf("linear-light average = %.1f, expected ~188", linear)
+	}
+	if srgb < 118 || srgb > 138 {
+		t.Errorf("sRGB average = %.1f, expected ~128", srgb)
+	}
+}
+
+func TestResizeColorspaceShadowStripes(t *testing.T) {
+	// Thin bright lines on a dark background: resizing in sRGB darkens the
+	// lines into the shadows, linear light keeps their energy.
+	path := writePattern(t, 256, 256, func(x, y int) uint8 {
+		if x%4 == 0 {
+			return 200
+		}
+		return 10
+	})
+
+	linear := resizedAverage(t, path, 64, LinearLight)
+	srgb := resizedAverage(t, path, 64, SRGB)
+	t.Logf("stripes average: linear=%.1f srgb=%.1f", linear, srgb)
+
+	if linear <= srgb+20 {
+		t.Errorf("expected linear-light result (%.1f) to be clearly brighter than sRGB (%.1f)", linear, srgb)
+	}
+}
+
+func TestResizeColorspaceKeepsGrey(t *testing.T) {
+	path := writePattern(t, 64, 64, func(x, y int) uint8 { return uint8(x * 4) })
+	for _, space := range []Colorspace{LinearLight, SRGB} {
+		img, err := LoadVips(path)
+		if err != nil {
+			t.Fatalf("LoadVips failed: %v", err)
+		}
+		if err := img.ResizeToFitColorspace(16, 16, Lanczos, space); err != nil {
+			t.Fatalf("ResizeToFitColorspace(%s) failed: %v", space, err)
+		}
+		if img.ref.Bands() != 1 || img.ref.Interpretation() != vips.InterpretationBW {
+			t.Errorf("%s resize of greyscale gave %d bands, %v; expected 1 band, B_W", space, img.ref.Bands(), img.ref.Interpretation())
+		}
+		img.Close()
+	}
+}
+
+func TestParseColorspace(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Colorspace
+	}{
+		{"linear", LinearLight},
+		{"linear-light", LinearLight},
+		{"scrgb", LinearLight},
+		{"srgb", SRGB},
+		{"gamma", SRGB},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			c, err := ParseColorspace(tc.input)
+			if err != nil {
+				t.Fatalf("ParseColorspace(%q) failed: %v", tc.input, err)
+			}
+			if c != tc.expected {
+				t.Errorf("ParseColorspace(%q) = %v, expected %v", tc.input, c, tc.expected)
+			}
+		})
+	}
+
+	if _, err := ParseColorspace("cmyk"); err == nil {
+		t.Error("ParseColorspace(\"cmyk\") expected error, got nil")
+	}
+}
@@ -0,0 +1,460 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// Watermark is a logo or a line of text stamped on the output.
+type Watermark struct {
+	Path string // logo file, e.g. a PNG or SVG with alpha
+	Text string // label template of a text watermark
+}
+
+// ParseWatermark converts "text:<template>" or the path of a logo file to
+// a Watermark.
+func ParseWatermark(s string) (Watermark, error) {
+	if text, ok := strings.CutPrefix(s, "text:"); ok {
+		if strings.TrimSpace(text) == "" {
+			return Watermark{}, fmt.Errorf("missing text in watermark: %s", s)
+		}
+		return Watermark{Text: text}, nil
+	}
+	if s == "" {
+		return Watermark{}, fmt.Errorf("missing watermark (use a logo file or text:<text>)")
+	}
+	return Watermark{Path: s}, nil
+}
+
+// String returns the watermark as given to ParseWatermark.
+func (w Watermark) String() string {
+	if w.Path != "" {
+		return w.Path
+	}
+	return "text:" + w.Text
+}
+
+// WatermarkMode selects how often a watermark is stamped.
+type WatermarkMode int
+
+const (
+	// WatermarkSingle stamps the watermark once at the anchor.
+	WatermarkSingle WatermarkMode = iota
+	// WatermarkTile repeats the watermark in a grid.
+	WatermarkTile
+	// WatermarkDiagonal repeats the watermark in a grid turned to run
+	// along the diagonal, like a proof stamp.
+	WatermarkDiagonal
+)
+
+// ParseWatermarkMode converts a string to a WatermarkMode.
+func ParseWatermarkMode(s string) (WatermarkMode, error) {
+	switch strings.ToLower(s) {
+	case "single":
+		return WatermarkSingle, nil
+	case "tile", "tiled":
+		return WatermarkTile, nil
+	case "diagonal":
+		return WatermarkDiagonal, nil
+	default:
+		return WatermarkSingle, fmt.Errorf("unknown watermark mode: %s (use single, tile or diagonal)", s)
+	}
+}
+
+// String returns the mode name.
+func (m WatermarkMode) String() string {
+	switch m {
+	case WatermarkSingle:
+		return "single"
+	case WatermarkTile:
+		return "tile"
+	case WatermarkDiagonal:
+		return "diagonal"
+	default:
+		return "unknown"
+	}
+}
+
+// BlendMode is how a watermark is combined with the pixels below it.
+type BlendMode int
+
+const (
+	// BlendOver paints the watermark over the image.
+	BlendOver BlendMode = iota
+	// BlendMultiply darkens the image, good for dark logos on light frames.
+	BlendMultiply
+	// BlendScreen lightens the image, good for light logos on dark images.
+	BlendScreen
+	// BlendOverlay increases contrast where the watermark is.
+	BlendOverlay
+	// BlendSoftLight is a gentler overlay.
+	BlendSoftLight
+	// BlendDifference inverts the image where the watermark is light.
+	BlendDifference
+)
+
+// ParseBlendMode converts a string to a BlendMode.
+func ParseBlendMode(s string) (BlendMode, error) {
+	switch strings.ToLower(s) {
+	case "over", "normal":
+		return BlendOver, nil
+	case "multiply":
+		return BlendMultiply, nil
+	case "screen":
+		return BlendScreen, nil
+	case "overlay":
+		return BlendOverlay, nil
+	case "soft-light", "softlight":
+		return BlendSoftLight, nil
+	case "difference":
+		return BlendDifference, nil
+	default:
+		return BlendOver, fmt.Errorf("unknown blend mode: %s (use over, multiply, screen, overlay, soft-light or difference)", s)
+	}
+}
+
+// String returns the blend mode name.
+func (b BlendMode) String() string {
+	switch b {
+	case BlendOver:
+		return "over"
+	case BlendMultiply:
+		return "multiply"
+	case BlendScreen:
+		return "screen"
+	case BlendOverlay:
+		return "overlay"
+	case BlendSoftLight:
+		return "soft-light"
+	case BlendDifference:
+		return "difference"
+	default:
+		return "unknown"
+	}
+}
+
+// blendToVips converts a BlendMode to the vips blend mode.
+func blendToVips(b BlendMode) vips.BlendMode {
+	switch b {
+	case BlendMultiply:
+		return vips.BlendModeMultiply
+	case BlendScreen:
+		return vips.BlendModeScreen
+	case BlendOverlay:
+		return vips.BlendModeOverlay
+	case BlendSoftLight:
+		return vips.BlendModeSoftLight
+	case BlendDifference:
+		return vips.BlendModeDifference
+	default:
+		return vips.BlendModeOver
+	}
+}
+
+// WatermarkStyle describes where and how a watermark is stamped.
+type WatermarkStyle struct {
+	Anchor  Gravity // position of a single watermark; attention and entropy aren't allowed
+	Mode    WatermarkMode
+	Margin  int // distance from the edges, and the gap between tiles
+	Opacity float64
+	Blend   BlendMode
+	// OnFrame places a single watermark in the frame along the anchor's
+	// edge instead of on the image; tiles cover the whole output.
+	OnFrame bool
+}
+
+// Validate checks that the style can be applied.
+func (s WatermarkStyle) Validate() error {
+	switch s.Anchor {
+	case GravityAttention, GravityEntropy, GravityFocus:
+		return fmt.Errorf("invalid watermark position: %s (use centre or a compass direction)", s.Anchor)
+	}
+	if s.OnFrame && s.Mode == WatermarkSingle && s.Anchor == GravityCentre {
+		return fmt.Errorf("watermarks on the frame need an edge position, e.g. south or southeast")
+	}
+	if s.Opacity < 0 || s.Opacity > 1 {
+		return fmt.Errorf("invalid watermark opacity: %g (must be 0-1)", s.Opacity)
+	}
+	if s.Margin < 0 {
+		return fmt.Errorf("invalid watermark margin: %d (must not be negative)", s.Margin)
+	}
+	return nil
+}
+
+// Logo is a watermark logo, loaded once per run and scaled for each
+// output. It is safe for concurrent use.
+type Logo struct {
+	data   []byte     // the file, for vector logos
+	raster *VipsImage // decoded raster logo
+}
+
+// LoadLogo loads a watermark logo.
+func LoadLogo(path string) (*Logo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load watermark: %w", err)
+	}
+	switch vips.DetermineImageType(data) {
+	case vips.ImageTypeSVG, vips.ImageTypePDF:
+		// Rendered at each output's size rather than scaled
+		return &Logo{data: data}, nil
+	}
+
+	ref, err := vips.NewImageFromBuffer(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load watermark: %w", err)
+	}
+	raster := &VipsImage{ref: ref}
+	if err := raster.toSRGBA(); err != nil {
+		raster.Close()
+		return nil, err
+	}
+	return &Logo{raster: raster}, nil
+}
+
+// Scaled returns the logo scaled to the given width. Vector logos such as
+// SVG are rendered at that width rather than scaled.
+func (l *Logo) Scaled(width int) (*VipsImage, error) {
+	if l.raster == nil {
+		// The height is left unbounded, like libvips' own thumbnail command
+		ref, err := vips.NewThumbnailWithSizeFromBuffer(l.data, width, 10000000, vips.InterestingNone, vips.SizeBoth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render watermark: %w", err)
+		}
+		mark := &VipsImage{ref: ref}
+		if err := mark.toSRGBA(); err != nil {
+			mark.Close()
+			return nil, err
+		}
+		return mark, nil
+	}
+
+	mark, err := l.raster.Copy()
+	if err != nil {
+		return nil, err
+	}
+	if width != mark.Width() {
+		if err := mark.ref.Resize(float64(width)/float64(mark.Width()), vips.KernelLanczos3); err != nil {
+			mark.Close()
+			return nil, fmt.Errorf("watermark resize failed: %w", err)
+		}
+	}
+	return mark, nil
+}
+
+// Close releases the logo.
+func (l *Logo) Close() {
+	if l.raster != nil {
+		l.raster.Close()
+	}
+}
+
+// TextWatermark renders text in font and colour c about width pixels wide.
+// fontfile, if not empty, is a font file to load first.
+func TextWatermark(text, font, fontfile string, c color.Color, width int) (*VipsImage, error) {
+	// Pango text width is close to proportional to the font size
+	const probeSize = 100
+	w, _, err := textSize(labelMarkup(text), fmt.Sprintf("%s %d", font, probeSize), fontfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure watermark: %w", err)
+	}
+	if w == 0 {
+		return nil, fmt.Errorf("empty watermark text")
+	}
+	size := max(1, probeSize*width/w)
+
+	ref, err := renderText(labelSpan(text, orBlack(c)), fmt.Sprintf("%s %d", font, size), fontfile)
+	if err != nil {
+		return nil, err
+	}
+	return &VipsImage{ref: ref}, nil
+}
+
+// toSRGBA converts a watermark to 8-bit sRGB with an alpha band.
+func (v *VipsImage) toSRGBA() error {
+	if v.ref.Interpretation() != vips.InterpretationSRGB {
+		if err := v.ref.ToColorSpace(vips.InterpretationSRGB); err != nil {
+			return fmt.Errorf("watermark colour conversion failed: %w", err)
+		}
+	}
+	if !v.ref.HasAlpha() {
+		if err := v.ref.AddAlpha(); err != nil {
+			return fmt.Errorf("watermark alpha failed: %w", err)
+		}
+	}
+	if err := v.ref.Cast(vips.BandFormatUchar); err != nil {
+		return fmt.Errorf("cast failed: %w", err)
+	}
+	return nil
+}
+
+// AddWatermark stamps mark on the image. area is the position of the image
+// in the output, as returned by the fit functions; mark is not changed. It
+// fails if a watermark on the frame doesn't fit, rather than leaving the
+// output unmarked.
+func (v *VipsImage) AddWatermark(mark *VipsImage, style WatermarkStyle, area image.Rectangle) error {
+	layer, err := mark.ref.Copy()
+	if err != nil {
+		return fmt.Errorf("copy failed: %w", err)
+	}
+	defer layer.Close()
+
+	// The opacity scales the alpha band
+	if style.Opacity < 1 {
+		if err := layer.Linear([]float64{1, 1, 1, style.Opacity}, []float64{0, 0, 0, 0}); err != nil {
+			return fmt.Errorf("watermark opacity failed: %w", err)
+		}
+		if err := layer.Cast(vips.BandFormatUchar); err != nil {
+			return fmt.Errorf("cast failed: %w", err)
+		}
+	}
+
+	canvas := image.Rect(0, 0, v.Width(), v.Height())
+	var pos image.Rectangle
+	if style.Mode == WatermarkSingle {
+		pos = watermarkRect(style, image.Pt(layer.Width(), layer.Height()), area, canvas)
+		if pos.Empty() {
+			return fmt.Errorf("no room for the watermark in the frame (widen the frame or place it on the image)")
+		}
+		if pos.Dx() != layer.Width() {
+			// Shrunk to fit the frame
+			if err := layer.Resize(float64(pos.Dx())/float64(layer.Width()), vips.KernelLanczos3); err != nil {
+				return fmt.Errorf("watermark resize failed: %w", err)
+			}
+		}
+	} else {
+		pos = area
+		if style.OnFrame {
+			pos = canvas
+		}
+		if err := tileWatermark(layer, style, pos.Dx(), pos.Dy()); err != nil {
+			return err
+		}
+	}
+
+	debugLog("AddWatermark: %s %s at %v, opacity %.2f, %s", style.Mode, style.Anchor, pos, style.Opacity, style.Blend)
+	return v.compositeLayer(layer, blendToVips(style.Blend), pos.Min.X, pos.Min.Y)
+}
+
+// tileWatermark repeats layer in a grid to cover width x height, turned
+// along the diagonal of the area in WatermarkDiagonal mode.
+func tileWatermark(layer *vips.ImageRef, style WatermarkStyle, width, height int) error {
+	// Each tile has half the gap on every side
+	gap := max(style.Margin, 1)
+	tileWidth, tileHeight := layer.Width()+gap, layer.Height()+gap
+	if err := layer.Embed(gap/2, gap/2, tileWidth, tileHeight, vips.ExtendBlack); err != nil {
+		return fmt.Errorf("watermark embed failed: %w", err)
+	}
+
+	// A diagonal grid must cover the area whichever way it is turned
+	coverWidth, coverHeight := width, height
+	angle := 0.0
+	if style.Mode == WatermarkDiagonal {
+		side := int(math.Ceil(math.Hypot(float64(width), float64(height))))
+		coverWidth, coverHeight = side, side
+		angle = -math.Atan2(float64(height), float64(width)) * 180 / math.Pi
+	}
+	across := (coverWidth + tileWidth - 1) / tileWidth
+	down := (coverHeight + tileHeight - 1) / tileHeight
+	if err := layer.Replicate(across, down); err != nil {
+		return fmt.Errorf("watermark tile failed: %w", err)
+	}
+	if angle != 0 {
+		if err := layer.Similarity(1, angle, &vips.ColorRGBA{}, 0, 0, 0, 0); err != nil {
+			return fmt.Errorf("watermark rotate failed: %w", err)
+		}
+	}
+
+	// Keep the centre of the pattern
+	left := (layer.Width() - width) / 2
+	top := (layer.Height() - height) / 2
+	if err := layer.ExtractArea(max(left, 0), max(top, 0), min(width, layer.Width()), min(height, layer.Height())); err != nil {
+		return fmt.Errorf("watermark crop failed: %w", err)
+	}
+	return nil
+}
+
+// watermarkRect returns where a single watermark of the given size goes.
+// On the image it sits at the anchor, inset by the margin. On the frame it
+// is centred across the band between the image and the anchor's edge of
+// the canvas, shrunk to fit if needed, and lines up with the image along
+// the band. An empty rectangle means there is no room.
+func watermarkRect(style WatermarkStyle, size image.Point, area, canvas image.Rectangle) image.Rectangle {
+	if !style.OnFrame {
+		return anchorRect(style.Anchor, size, area.Inset(style.Margin))
+	}
+
+	// The band along the anchor's edge; corners use the top or bottom band
+	var band image.Rectangle
+	horizontal := true
+	switch style.Anchor {
+	case GravityNorth, GravityNorthEast, GravityNorthWest:
+		band = image.Rect(area.Min.X, canvas.Min.Y, area.Max.X, area.Min.Y)
+	case GravitySouth, GravitySouthEast, GravitySouthWest:
+		band = image.Rect(area.Min.X, area.Max.Y, area.Max.X, canvas.Max.Y)
+	case GravityEast:
+		band = image.Rect(area.Max.X, area.Min.Y, canvas.Max.X, area.Max.Y)
+		horizontal = false
+	case GravityWest:
+		band = image.Rect(canvas.Min.X, area.Min.Y, area.Min.X, area.Max.Y)
+		horizontal = false
+	default:
+		return image.Rectangle{}
+	}
+
+	// Leave a little of the band free on both sides of the watermark
+	scale := 1.0
+	if horizontal {
+		band.Min.X += style.Margin
+		band.Max.X -= style.Margin
+		scale = min(scale, float64(band.Dy())*watermarkBandFill/float64(size.Y))
+	} else {
+		band.Min.Y += style.Margin
+		band.Max.Y -= style.Margin
+		scale = min(scale, float64(band.Dx())*watermarkBandFill/float64(size.X))
+	}
+	size = image.Pt(int(float64(size.X)*scale), int(float64(size.Y)*scale))
+	if size.X < 1 || size.Y < 1 || band.Dx() < size.X || band.Dy() < size.Y {
+		return image.Rectangle{}
+	}
+
+	// Only the corners move the watermark along the band
+	along := GravityCentre
+	switch style.Anchor {
+	case GravityNorthEast, GravitySouthEast:
+		along = GravityEast
+	case GravityNorthWest, GravitySouthWest:
+		along = GravityWest
+	}
+	return anchorRect(along, size, band)
+}
+
+// watermarkBandFill is the largest part of the frame's thickness a
+// watermark on the frame fills.
+const watermarkBandFill = 0.6
+
+// anchorRect returns a rectangle of the given size placed in bounds at the
+// anchor, centred on the axes the anchor doesn't name.
+func anchorRect(anchor Gravity, size image.Point, bounds image.Rectangle) image.Rectangle {
+	x := bounds.Min.X + (bounds.Dx()-size.X)/2
+	y := bounds.Min.Y + (bounds.Dy()-size.Y)/2
+	switch anchor {
+	case GravityWest, GravityNorthWest, GravitySouthWest:
+		x = bounds.Min.X
+	case GravityEast, GravityNorthEast, GravitySouthEast:
+		x = bounds.Max.X - size.X
+	}
+	switch anchor {
+	case GravityNorth, GravityNorthEast, GravityNorthWest:
+		y = bounds.Min.Y
+	case GravitySouth, GravitySouthEast, GravitySouthWest:
+		y = bounds.Max.Y - size.Y
+	}
+	return image.Rect(x, y, x+size.X, y+size.Y)
+}
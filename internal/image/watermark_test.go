@@ -0,0 +1,209 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseWatermark(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Watermark
+	}{
+		{"logo.png", Watermark{Path: "logo.png"}},
+		{"brand/logo.svg", Watermark{Path: "brand/logo.svg"}},
+		{"text:© Ada Example", Watermark{Text: "© Ada Example"}},
+		{"text:© {{.Creator}} {{.Date \"2006\"}}", Watermark{Text: "© {{.Creator}} {{.Date \"2006\"}}"}},
+	}
+	for _, tc := range tests {
+		got, err := ParseWatermark(tc.input)
+		if err != nil {
+			t.Fatalf("ParseWatermark(%q) failed: %v", tc.input, err)
+		}
+		if got != tc.expected {
+			t.Errorf("ParseWatermark(%q) = %+v, expected %+v", tc.input, got, tc.expected)
+		}
+		if got.String() != tc.input {
+			t.Errorf("String() = %q, expected %q", got.String(), tc.input)
+		}
+	}
+	for _, input := range []string{"", "text:", "text:  "} {
+		if _, err := ParseWatermark(input); err == nil {
+			t.Errorf("ParseWatermark(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestParseWatermarkModeAndBlend(t *testing.T) {
+	for _, m := range []WatermarkMode{WatermarkSingle, WatermarkTile, WatermarkDiagonal} {
+		if got, err := ParseWatermarkMode(m.String()); err != nil || got != m {
+			t.Errorf("ParseWatermarkMode(%q) = %v, %v", m, got, err)
+		}
+	}
+	if _, err := ParseWatermarkMode("scattered"); err == nil {
+		t.Error("ParseWatermarkMode(\"scattered\") expected error, got nil")
+	}
+
+	for _, b := range []BlendMode{BlendOver, BlendMultiply, BlendScreen, BlendOverlay, BlendSoftLight, BlendDifference} {
+		if got, err := ParseBlendMode(b.String()); err != nil || got != b {
+			t.Errorf("ParseBlendMode(%q) = %v, %v", b, got, err)
+		}
+	}
+	if _, err := ParseBlendMode("dissolve"); err == nil {
+		t.Error("ParseBlendMode(\"dissolve\") expected error, got nil")
+	}
+}
+
+func TestWatermarkStyleValidate(t *testing.T) {
+	valid := []WatermarkStyle{
+		{Anchor: GravitySouthEast, Opacity: 0.5},
+		{Anchor: GravityCentre, Mode: WatermarkDiagonal, Opacity: 0.2, OnFrame: true},
+		{Anchor: GravitySouth, Opacity: 1, OnFrame: true},
+	}
+	for _, s := range valid {
+		if err := s.Validate(); err != nil {
+			t.Errorf("Validate(%+v) failed: %v", s, err)
+		}
+	}
+	invalid := []WatermarkStyle{
+		{Anchor: GravityAttention, Opacity: 0.5},
+		{Anchor: GravityCentre, Opacity: 0.5, OnFrame: true},
+		{Anchor: GravitySouth, Opacity: 1.5},
+		{Anchor: GravitySouth, Opacity: 0.5, Margin: -1},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Validate(%+v) expected error, got nil", s)
+		}
+	}
+}
+
+func TestWatermarkRect(t *testing.T) {
+	// A 400x300 image at 50,50 on a 500x500 canvas
+	area := image.Rect(50, 50, 450, 350)
+	canvas := image.Rect(0, 0, 500, 500)
+	size := image.Pt(100, 40)
+
+	tests := []struct {
+		name    string
+		anchor  Gravity
+		onFrame bool
+		canvas  image.Rectangle
+		rect    image.Rectangle
+	}{
+		{"image southeast", GravitySouthEast, false, canvas, image.Rect(340, 300, 440, 340)},
+		{"image centre", GravityCentre, false, canvas, image.Rect(200, 180, 300, 220)},
+		{"image northwest", GravityNorthWest, false, canvas, image.Rect(60, 60, 160, 100)},
+		{"frame south", GravitySouth, true, canvas, image.Rect(200, 405, 300, 445)},
+		{"frame southeast shrunk", GravitySouthEast, true, image.Rect(0, 0, 500, 380), image.Rect(395, 356, 440, 374)},
+		{"frame east", GravityEast, true, canvas, image.Rect(460, 194, 490, 206)},
+		{"no frame", GravitySouth, true, area, image.Rectangle{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			style := WatermarkStyle{Anchor: tc.anchor, Margin: 10, OnFrame: tc.onFrame}
+			if got := watermarkRect(style, size, area, tc.canvas); got != tc.rect {
+				t.Errorf("watermarkRect = %v, expected %v", got, tc.rect)
+			}
+		})
+	}
+}
+
+func TestVipsAddWatermark(t *testing.T) {
+	tests := []struct {
+		name  string
+		style WatermarkStyle
+	}{
+		{"single", WatermarkStyle{Anchor: GravitySouthEast, Margin: 10, Opacity: 0.6}},
+		{"frame", WatermarkStyle{Anchor: GravitySouth, Margin: 10, Opacity: 1, Blend: BlendMultiply, OnFrame: true}},
+		{"tile", WatermarkStyle{Mode: WatermarkTile, Margin: 20, Opacity: 0.3, Blend: BlendScreen}},
+		{"diagonal", WatermarkStyle{Mode: WatermarkDiagonal, Margin: 20, Opacity: 0.3, OnFrame: true}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := LoadVips(testImageVips)
+			if err != nil {
+				t.Fatalf("LoadVips failed: %v", err)
+			}
+			defer img.Close()
+			if err := img.ResizeToFit(400, 400, Lanczos); err != nil {
+				t.Fatalf("ResizeToFit failed: %v", err)
+			}
+			w, h := img.Width(), img.Height()
+			if err := img.AddFrame(60, 40, 60, 40, color.White); err != nil {
+				t.Fatalf("AddFrame failed: %v", err)
+			}
+			bands := img.ref.Bands()
+
+			mark, err := TextWatermark("© Ada Example", "sans bold", "", color.White, 120)
+			if err != nil {
+				t.Fatalf("TextWatermark failed: %v", err)
+			}
+			defer mark.Close()
+			if mark.Width() < 100 || mark.Width() > 140 {
+				t.Errorf("TextWatermark width = %d, expected about 120", mark.Width())
+			}
+
+			area := image.Rect(40, 60, 40+w, 60+h)
+			if err := img.AddWatermark(mark, tc.style, area); err != nil {
+				t.Fatalf("AddWatermark failed: %v", err)
+			}
+			if img.Width() != w+80 || img.Height() != h+120 || img.ref.Bands() != bands {
+				t.Errorf("AddWatermark changed the image to %dx%d with %d bands", img.Width(), img.Height(), img.ref.Bands())
+			}
+		})
+	}
+}
+
+func TestVipsAddWatermarkNoRoom(t *testing.T) {
+	img, err := LoadVips(testImageVips)
+	if err != nil {
+		t.Fatalf("LoadVips failed: %v", err)
+	}
+	defer img.Close()
+	mark, err := TextWatermark("© Ada Example", "sans bold", "", color.White, 120)
+	if err != nil {
+		t.Fatalf("TextWatermark failed: %v", err)
+	}
+	defer mark.Close()
+
+	// Without a frame there is no room on it
+	style := WatermarkStyle{Anchor: GravitySouth, Opacity: 1, OnFrame: true}
+	area := image.Rect(0, 0, img.Width(), img.Height())
+	if err := img.AddWatermark(mark, style, area); err == nil {
+		t.Error("AddWatermark without a frame expected error, got nil")
+	}
+}
+
+func TestVipsLogo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logo.png")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, image.NewNRGBA(image.Rect(0, 0, 200, 100))); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	logo, err := LoadLogo(path)
+	if err != nil {
+		t.Fatalf("LoadLogo failed: %v", err)
+	}
+	defer logo.Close()
+	for _, width := range []int{50, 120} {
+		mark, err := logo.Scaled(width)
+		if err != nil {
+			t.Fatalf("Scaled(%d) failed: %v", width, err)
+		}
+		if mark.Width() != width || mark.Height() != width/2 || !mark.ref.HasAlpha() {
+			t.Errorf("Scaled(%d) = %dx%d, alpha %v", width, mark.Width(), mark.Height(), mark.ref.HasAlpha())
+		}
+		mark.Close()
+	}
+}
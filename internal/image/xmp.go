@@ -0,0 +1,274 @@
+package image
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// XMP namespace URIs and the prefixes used when writing them.
+const (
+	nsRDF       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsDC        = "http://purl.org/dc/elements/1.1/"
+	nsPhotoshop = "http://ns.adobe.com/photoshop/1.0/"
+	nsXMPRights = "http://ns.adobe.com/xap/1.0/rights/"
+	nsIptcCore  = "http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/"
+	nsTIFF      = "http://ns.adobe.com/tiff/1.0/"
+	nsEXIF      = "http://ns.adobe.com/exif/1.0/"
+	nsXMP       = "http://ns.adobe.com/xap/1.0/"
+	nsAux       = "http://ns.adobe.com/exif/1.0/aux/"
+	nsExifEX    = "http://cipa.jp/exif/1.0/"
+)
+
+var xmpPrefixes = map[string]string{
+	nsDC:        "dc",
+	nsPhotoshop: "photoshop",
+	nsXMPRights: "xmpRights",
+	nsIptcCore:  "Iptc4xmpCore",
+	nsTIFF:      "tiff",
+	nsEXIF:      "exif",
+	nsXMP:       "xmp",
+	nsAux:       "aux",
+	nsExifEX:    "exifEX",
+}
+
+// xmpPrefixOrder is the order namespaces are declared in generated packets.
+var xmpPrefixOrder = []string{nsDC, nsPhotoshop, nsXMPRights, nsIptcCore}
+
+// xmpKind is the RDF container type of an XMP property.
+type xmpKind int
+
+const (
+	xmpSimple xmpKind = iota
+	xmpSeq
+	xmpBag
+	xmpAlt
+)
+
+// xmpProperty is a single property in a generated XMP packet.
+type xmpProperty struct {
+	ns     string
+	name   string
+	kind   xmpKind
+	values []string
+}
+
+// parseXMP extracts the simple and array properties of an XMP packet.
+// Keys are "prefix:name" using the canonical prefixes in xmpPrefixes,
+// values of arrays are returned in document order. Properties in unknown
+// namespaces and nested structures are ignored.
+func parseXMP(data []byte) (map[string][]string, error) {
+	props := make(map[string][]string)
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	// Parser state: depth of the open rdf:Description and the current property
+	var (
+		inDescription int
+		property      *xml.Name
+		depth         int
+		text          strings.Builder
+		inItem        bool
+		nested        bool
+	)
+
+	key := func(n xml.Name) (string, bool) {
+		prefix, ok := xmpPrefixes[n.Space]
+		if !ok {
+			return "", false
+		}
+		return prefix + ":" + n.Local, true
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return props, fmt.Errorf("parse XMP: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if t.Name.Space == nsRDF && t.Name.Local == "Description" {
+				inDescription = depth
+				// Simple properties may be written as attributes
+				for _, attr := range t.Attr {
+					if k, ok := key(attr.Name); ok {
+						props[k] = append(props[k], attr.Value)
+					}
+				}
+				continue
+			}
+			if inDescription == 0 {
+				continue
+			}
+			switch {
+			case property == nil && depth == inDescription+1:
+				name := t.Name
+				property = &name
+				nested = false
+				text.Reset()
+				// rdf:resource values have no text content
+				for _, attr := range t.Attr {
+					if attr.Name.Space == nsRDF && attr.Name.Local == "resource" {
+						if k, ok := key(name); ok {
+							props[k] = append(props[k], attr.Value)
+						}
+					}
+				}
+			case property != nil && t.Name.Space == nsRDF && t.Name.Local == "li":
+				inItem = true
+				text.Reset()
+			case property != nil && t.Name.Space != nsRDF:
+				// Structured value, which isn't supported
+				nested = true
+			}
+
+		case xml.CharData:
+			if property != nil {
+				text.Write(t)
+			}
+
+		case xml.EndElement:
+			switch {
+			case inItem && t.Name.Space == nsRDF && t.Name.Local == "li":
+				if k, ok := key(*property); ok && !nested {
+					if v := strings.TrimSpace(text.String()); v != "" {
+						props[k] = append(props[k], v)
+					}
+				}
+				inItem = false
+				text.Reset()
+			case property != nil && depth == inDescription+1:
+				if k, ok := key(*property); ok && !nested {
+					if _, seen := props[k]; !seen {
+						if v := strings.TrimSpace(text.String()); v != "" {
+							props[k] = append(props[k], v)
+						}
+					}
+				}
+				property = nil
+			case depth == inDescription:
+				inDescription = 0
+			}
+			depth--
+		}
+	}
+
+	return props, nil
+}
+
+// buildXMP renders properties as a standalone XMP packet.
+func buildXMP(props []xmpProperty) []byte {
+	used := make(map[string]bool)
+	for _, p := range props {
+		used[p.ns] = true
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	buf.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	buf.WriteString(" <rdf:RDF xmlns:rdf=\"" + nsRDF + "\">\n")
+	buf.WriteString("  <rdf:Description rdf:about=\"\"")
+	for _, ns := range xmpPrefixOrder {
+		if used[ns] {
+			fmt.Fprintf(&buf, "\n    xmlns:%s=\"%s\"", xmpPrefixes[ns], ns)
+		}
+	}
+	buf.WriteString(">\n")
+
+	for _, p := range props {
+		tag := xmpPrefixes[p.ns] + ":" + p.name
+		switch p.kind {
+		case xmpSimple:
+			fmt.Fprintf(&buf, "   <%s>%s</%s>\n", tag, xmlEscape(p.values[0]), tag)
+		default:
+			container := map[xmpKind]string{xmpSeq: "rdf:Seq", xmpBag: "rdf:Bag", xmpAlt: "rdf:Alt"}[p.kind]
+			fmt.Fprintf(&buf, "   <%s>\n    <%s>\n", tag, container)
+			for _, v := range p.values {
+				if p.kind == xmpAlt {
+					fmt.Fprintf(&buf, "     <rdf:li xml:lang=\"x-default\">%s</rdf:li>\n", xmlEscape(v))
+				} else {
+					fmt.Fprintf(&buf, "     <rdf:li>%s</rdf:li>\n", xmlEscape(v))
+				}
+			}
+			fmt.Fprintf(&buf, "    </%s>\n   </%s>\n", container, tag)
+		}
+	}
+
+	buf.WriteString("  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n")
+	buf.WriteString("<?xpacket end=\"w\"?>")
+	return buf.Bytes()
+}
+
+// xmlEscape escapes text for use in XML character data.
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// xmpNamespacePrefix returns the prefix a packet binds to a namespace URI.
+func xmpNamespacePrefix(data []byte, ns string) (string, bool) {
+	re := regexp.MustCompile(`xmlns:([A-Za-z_][\w.-]*)\s*=\s*["']` + regexp.QuoteMeta(ns) + `["']`)
+	m := re.FindSubmatch(data)
+	if m == nil {
+		return "", false
+	}
+	return string(m[1]), true
+}
+
+// setXMPProperty replaces the value of an existing simple property, whether
+// written as an attribute or an element. Missing properties are not added.
+func setXMPProperty(data []byte, ns, name, value string) []byte {
+	prefix, ok := xmpNamespacePrefix(data, ns)
+	if !ok {
+		return data
+	}
+	tag := regexp.QuoteMeta(prefix + ":" + name)
+	escaped := bytes.ReplaceAll([]byte(xmlEscape(value)), []byte("$"), []byte("$$"))
+
+	attr := regexp.MustCompile(`(\s` + tag + `\s*=\s*)(["'])[^"']*(["'])`)
+	data = attr.ReplaceAll(data, append([]byte("${1}${2}"), append(escaped, []byte("${3}")...)...))
+
+	elem := regexp.MustCompile(`(<` + tag + `(?:\s[^>]*)?>)[^<]*(</` + tag + `>)`)
+	return elem.ReplaceAll(data, append([]byte("${1}"), append(escaped, []byte("${2}")...)...))
+}
+
+// removeXMPProperties removes every property in namespace ns whose name
+// starts with namePrefix, in both attribute and element form.
+func removeXMPProperties(data []byte, ns, namePrefix string) []byte {
+	prefix, ok := xmpNamespacePrefix(data, ns)
+	if !ok {
+		return data
+	}
+	tag := regexp.QuoteMeta(prefix+":"+namePrefix) + `[\w.-]*`
+
+	attr := regexp.MustCompile(`\s` + tag + `\s*=\s*(?:"[^"]*"|'[^']*')`)
+	data = attr.ReplaceAll(data, nil)
+
+	empty := regexp.MustCompile(`\s*<` + tag + `(?:\s[^>]*)?/>`)
+	data = empty.ReplaceAll(data, nil)
+
+	// Go regexps have no backreferences, so match open/close tags by name
+	open := regexp.MustCompile(`\s*<(` + tag + `)(?:\s[^>]*)?>`)
+	for {
+		loc := open.FindSubmatchIndex(data)
+		if loc == nil {
+			break
+		}
+		closeTag := []byte("</" + string(data[loc[2]:loc[3]]) + ">")
+		end := bytes.Index(data[loc[1]:], closeTag)
+		if end < 0 {
+			break
+		}
+		end += loc[1] + len(closeTag)
+		data = append(data[:loc[0]:loc[0]], data[end:]...)
+	}
+	return data
+}